@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/skwair/huectl/pkg/adaptive"
+	"github.com/skwair/huectl/pkg/sun"
+	"github.com/spf13/cobra"
+)
+
+type adaptiveFlags struct {
+	Groups    []string
+	Latitude  float64
+	Longitude float64
+	Curve     adaptive.Curve
+	Interval  time.Duration
+	Hold      time.Duration
+	Preview   bool
+}
+
+const adaptiveExample = `
+	# Adapt the lights of the living room and the desk lamp, in Paris
+	huectl adaptive --latitude 48.86 --longitude 2.35 --group "Living room" "Desk lamp"
+
+	# Show how lights will change over the day
+	huectl adaptive --latitude 48.86 --longitude 2.35 --preview`
+
+func newAdaptiveCmd() *cobra.Command {
+	var flags adaptiveFlags
+
+	cmd := &cobra.Command{
+		Use:   "adaptive [ID|NAME...]",
+		Short: "Makes lights follow a natural daylight curve",
+		Long: `Continuously updates the brightness and color temperature of the given lights
+and of the lights of the given groups to follow daylight: warm and dim at night,
+cool and bright at midday. Targets are computed from the position of the sun
+at the given location, and changes are applied with long transitions so they
+go unnoticed.
+
+Lights that are off are left alone, as are lights changed by other means
+(e.g. the Hue app or a switch) until the hold duration expires.`,
+		Example: adaptiveExample,
+		Run:     func(_ *cobra.Command, args []string) { must(runAdaptiveCmd(args, &flags)) },
+	}
+
+	cmd.Flags().StringArrayVarP(&flags.Groups, "group", "g", nil, "Group whose lights to update, by ID or name, can be repeated")
+	cmd.Flags().Float64Var(&flags.Latitude, "latitude", 0, "Latitude of the lights, in degrees")
+	cmd.Flags().Float64Var(&flags.Longitude, "longitude", 0, "Longitude of the lights, in degrees")
+	cmd.Flags().IntVar(&flags.Curve.MinBrightness, "min-brightness", adaptive.DefaultCurve.MinBrightness, "Brightness at night, in percent")
+	cmd.Flags().IntVar(&flags.Curve.MaxBrightness, "max-brightness", adaptive.DefaultCurve.MaxBrightness, "Brightness at midday, in percent")
+	cmd.Flags().IntVar(&flags.Curve.WarmestCT, "warmest", adaptive.DefaultCurve.WarmestCT, "Color temperature at night, in mireds")
+	cmd.Flags().IntVar(&flags.Curve.CoolestCT, "coolest", adaptive.DefaultCurve.CoolestCT, "Color temperature at midday, in mireds")
+	cmd.Flags().DurationVar(&flags.Interval, "interval", adaptive.DefaultInterval, "How often to update lights")
+	cmd.Flags().DurationVar(&flags.Hold, "hold", adaptive.DefaultHold, "How long to leave lights changed manually alone")
+	cmd.Flags().BoolVar(&flags.Preview, "preview", false, "Show the targets over the day instead of updating lights")
+	_ = cmd.MarkFlagRequired("latitude")
+	_ = cmd.MarkFlagRequired("longitude")
+	_ = cmd.RegisterFlagCompletionFunc("group", completeGroups())
+
+	return cmd
+}
+
+func runAdaptiveCmd(args []string, flags *adaptiveFlags) error {
+	loc := sun.Location{Latitude: flags.Latitude, Longitude: flags.Longitude}
+	if loc.Latitude < -90 || loc.Latitude > 90 || loc.Longitude < -180 || loc.Longitude > 180 {
+		return fmt.Errorf("invalid location %g,%g", loc.Latitude, loc.Longitude)
+	}
+
+	if err := flags.Curve.Validate(); err != nil {
+		return err
+	}
+
+	if flags.Preview {
+		return printAdaptivePreview(flags.Curve, loc)
+	}
+
+	client, err := setupDirectClient()
+	if err != nil {
+		return fmt.Errorf("unable to setup Hue client: %w", err)
+	}
+
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	engine := adaptive.New(client, loc,
+		adaptive.WithLights(args...),
+		adaptive.WithGroups(flags.Groups...),
+		adaptive.WithCurve(flags.Curve),
+		adaptive.WithInterval(flags.Interval),
+		adaptive.WithHold(flags.Hold),
+		adaptive.WithLogger(logger),
+	)
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	err = engine.Run(ctx)
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+
+	return err
+}
+
+func printAdaptivePreview(curve adaptive.Curve, loc sun.Location) error {
+	now := time.Now()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 4, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tBRIGHTNESS (%)\tCT (MIREDS)\tCT (K)")
+	for h := 0; h < 24; h++ {
+		t := midnight.Add(time.Duration(h) * time.Hour)
+		target := curve.Target(loc, t)
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\n", t.Format("15:04"), int(math.Round(float64(target.Bri)/254*100)), target.CT, 1000000/target.CT)
+	}
+
+	return tw.Flush()
+}
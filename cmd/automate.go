@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/skwair/huectl/pkg/automate"
+	"github.com/spf13/cobra"
+)
+
+type automateFlags struct {
+	File   string
+	DryRun bool
+	Count  int
+}
+
+const automateExample = `
+	# automations.yaml
+	location:
+	  latitude: 48.86
+	  longitude: 2.35
+	automations:
+	  - name: Wake up
+	    when: "30 6 * * 1-5"
+	    actions:
+	      - lights: [Bedroom]
+	        on: true
+	        brightness: 80
+	        ct: 250
+	        transition: 10m
+	  - name: Evening
+	    when: sunset-30m
+	    actions:
+	      - scene: Relax
+	        group: Living room
+	  - name: Night
+	    when: "0 1 * * *"
+	    actions:
+	      - group: Living room
+	        on: false
+
+	# Show when the automations above will run, then run them
+	huectl automate -f automations.yaml --dry-run
+	huectl automate -f automations.yaml`
+
+func newAutomateCmd() *cobra.Command {
+	var flags automateFlags
+
+	cmd := &cobra.Command{
+		Use:   "automate",
+		Short: "Runs automations defined in a file",
+		Long: `Runs a scheduler on this host, applying the actions of each automation
+when its trigger fires. Unlike schedules stored on the bridge, automations are
+not limited in number and can be relative to sunrise and sunset.
+
+Triggers are set with "when", either as a cron expression (e.g. "30 7 * * 1-5",
+"@hourly") or as "sunrise" or "sunset" with an optional offset (e.g.
+"sunset-30m", "sunrise+1h"). Sunrise and sunset are computed from the
+location set in the file.
+
+Actions recall a scene (scene, with an optional group), or set the state of
+lights (lights) or of a group (group) with on, brightness (in percent),
+color (a name or a hex code), ct (in mireds) and transition (e.g. "2s").`,
+		Example: automateExample,
+		Args:    cobra.NoArgs,
+		Run:     func(*cobra.Command, []string) { must(runAutomateCmd(&flags)) },
+	}
+
+	cmd.Flags().StringVarP(&flags.File, "file", "f", "", "Automations file")
+	cmd.Flags().BoolVar(&flags.DryRun, "dry-run", false, "Show upcoming firings instead of running automations")
+	cmd.Flags().IntVar(&flags.Count, "count", 10, "Number of upcoming firings to show with --dry-run")
+	_ = cmd.MarkFlagRequired("file")
+
+	return cmd
+}
+
+func runAutomateCmd(flags *automateFlags) error {
+	cfg, err := automate.Load(flags.File)
+	if err != nil {
+		return err
+	}
+
+	if flags.DryRun {
+		return printUpcomingFirings(automate.New(nil, cfg), flags.Count)
+	}
+
+	client, err := setupDirectClient()
+	if err != nil {
+		return fmt.Errorf("unable to setup Hue client: %w", err)
+	}
+
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	scheduler := automate.New(client, cfg, automate.WithLogger(logger))
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	logger.Printf("Running %d automations from %s", len(cfg.Automations), flags.File)
+
+	err = scheduler.Run(ctx)
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+
+	return err
+}
+
+func printUpcomingFirings(scheduler *automate.Scheduler, count int) error {
+	firings := scheduler.Upcoming(time.Now(), count)
+	if len(firings) == 0 {
+		fmt.Println("No automation will ever fire")
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 4, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tAUTOMATION\tACTIONS")
+	for _, f := range firings {
+		for i := range f.Automation.Actions {
+			when, name := f.Time.Format("Mon Jan 2 15:04"), f.Automation.Name
+			if i > 0 {
+				when, name = "", ""
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", when, name, f.Automation.Actions[i].String())
+		}
+	}
+
+	return tw.Flush()
+}
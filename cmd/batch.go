@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/skwair/huectl/pkg/hue"
+)
+
+// reportBatch prints the attributes applied to each light, in the order they
+// were given on the command line. If any light failed, it prints a summary
+// table to stderr and returns an error so the CLI exits with a non-zero status.
+func reportBatch(ids []string, results map[string]hue.BatchResult) error {
+	var failed []string
+	printed := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if printed[id] {
+			continue
+		}
+		printed[id] = true
+
+		res := results[id]
+		if res.Update != nil {
+			printUpdateResult(id, res.Update)
+		}
+
+		if res.Failed() {
+			failed = append(failed, id)
+		}
+	}
+
+	if len(failed) == 0 {
+		return nil
+	}
+
+	fmt.Fprintln(os.Stderr)
+
+	tw := tabwriter.NewWriter(os.Stderr, 0, 4, 4, ' ', 0)
+	fmt.Fprintln(tw, "LIGHT\tSTATUS\tERROR")
+	for _, id := range failed {
+		res := results[id]
+		if res.Err != nil {
+			fmt.Fprintf(tw, "%s\tfailed\t%v\n", id, res.Err)
+		} else {
+			fmt.Fprintf(tw, "%s\tpartial\t%v\n", id, res.Update.Err())
+		}
+	}
+	tw.Flush()
+
+	return fmt.Errorf("%d of %d lights were not fully updated", len(failed), len(printed))
+}
+
+// printUpdateResult prints which attributes of a light were applied to stdout
+// and which were rejected to stderr.
+func printUpdateResult(id string, res *hue.UpdateResult) {
+	for _, attr := range res.Applied {
+		fmt.Printf("light %s: %s set to %v\n", id, attr.Name(), attr.Value)
+	}
+
+	for _, err := range res.Rejected {
+		fmt.Fprintf(os.Stderr, "light %s: %s not set: %v\n", id, err.Attribute(), err)
+	}
+}
@@ -0,0 +1,466 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/skwair/huectl/pkg/config"
+	"github.com/skwair/huectl/pkg/hue"
+	"github.com/spf13/cobra"
+)
+
+func newBridgeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bridge",
+		Short: "Manage the connection to the Hue bridge",
+		Args:  cobra.NoArgs,
+	}
+
+	cmd.AddCommand(newTrustBridgeCmd())
+	cmd.AddCommand(newUpdateBridgeCmd())
+
+	return cmd
+}
+
+type trustBridgeFlags struct {
+	Reset bool
+	Yes   bool
+}
+
+func newTrustBridgeCmd() *cobra.Command {
+	var flags trustBridgeFlags
+
+	cmd := &cobra.Command{
+		Use:   "trust",
+		Short: "Show or renew the pinned certificate of the bridge",
+		Long: `Shows the certificate presented by the bridge and whether it matches the one
+pinned when running "huectl init". Requests are refused when it does not match,
+as another host may be impersonating the bridge.
+
+Bridges renew their certificate from time to time, e.g. after some firmware
+updates: use --reset to pin the new certificate once you are sure you are
+connected to your bridge. Certificates of recent bridges are issued by the Hue
+root CA, renewed certificates of such bridges must be issued by it too.`,
+		Example: `  huectl bridge trust --reset`,
+		Args:    cobra.NoArgs,
+		Run:     func(*cobra.Command, []string) { must(runTrustBridgeCmd(&flags)) },
+	}
+
+	cmd.Flags().BoolVar(&flags.Reset, "reset", false, "Pin the certificate currently presented by the bridge")
+	cmd.Flags().BoolVarP(&flags.Yes, "yes", "y", false, "Do not ask for confirmation before pinning a new certificate")
+
+	return cmd
+}
+
+func runTrustBridgeCmd(flags *trustBridgeFlags) error {
+	cfgPath, err := config.AbsolutePath()
+	if err != nil {
+		return err
+	}
+
+	cfg, err := readConfig()
+	if err != nil {
+		return err
+	}
+
+	u, err := url.Parse(cfg.BridgeURL)
+	if err != nil {
+		return fmt.Errorf("invalid bridge URL %q: %w", cfg.BridgeURL, err)
+	}
+	if u.Scheme != "https" {
+		return fmt.Errorf("bridge URL %q does not use HTTPS, there is no certificate to trust", cfg.BridgeURL)
+	}
+
+	certs, err := hue.FetchCertificates(u.Host, 5*time.Second)
+	if err != nil {
+		return err
+	}
+
+	fingerprint := hue.Fingerprint(certs[0].Raw)
+	caErr := hue.VerifyBridgeCertificate(certs[0], certs[1:], cfg.BridgeID)
+
+	// Check the certificate the same way requests do.
+	verifier := &hue.CertVerifier{Fingerprint: cfg.CertFingerprint}
+	if cfg.VerifyBridgeCA {
+		verifier.BridgeID = cfg.BridgeID
+	}
+	raw := make([][]byte, len(certs))
+	for i, c := range certs {
+		raw[i] = c.Raw
+	}
+	verifyErr := verifier.VerifyPeerCertificate(raw, nil)
+
+	pinned := cfg.CertFingerprint
+	if pinned == "" {
+		pinned = "none"
+	} else if hue.IsLegacyFingerprint(pinned) {
+		pinned += " (SHA-1)"
+	}
+
+	fmt.Printf("Pinned fingerprint:   %s\n", pinned)
+	fmt.Printf("Bridge fingerprint:   %s\n", fingerprint)
+	fmt.Printf("Valid until:          %s\n", certs[0].NotAfter.Format("2006-01-02"))
+	if caErr == nil {
+		fmt.Println("Issued by Hue CA:     yes")
+	} else {
+		fmt.Printf("Issued by Hue CA:     no (%v)\n", caErr)
+	}
+	if verifyErr == nil {
+		fmt.Println("Status:               trusted")
+	} else {
+		fmt.Printf("Status:               NOT TRUSTED (%v)\n", verifyErr)
+	}
+
+	if !flags.Reset {
+		return nil
+	}
+
+	if verifyErr == nil && cfg.CertFingerprint == fingerprint && cfg.VerifyBridgeCA == (caErr == nil) {
+		fmt.Println("The certificate of the bridge is already pinned")
+		return nil
+	}
+
+	// A bridge whose certificate was issued by the Hue CA has no reason to
+	// present a self-signed one.
+	if cfg.VerifyBridgeCA && caErr != nil {
+		return errors.New("refusing to pin a certificate not issued by the Hue root CA, the bridge is expected to present one")
+	}
+
+	if !flags.Yes && !confirm(fmt.Sprintf("Pin the certificate of the bridge at %s?", u.Host)) {
+		return errors.New("aborted")
+	}
+
+	if err = checkNoOverrides(); err != nil {
+		return err
+	}
+	fileCfg, err := readConfigFile()
+	if err != nil {
+		return err
+	}
+
+	fileCfg.CertFingerprint = fingerprint
+	fileCfg.VerifyBridgeCA = caErr == nil
+	if err = writeConfigFile(cfgPath, fileCfg); err != nil {
+		return fmt.Errorf("unable to save configuration: %w", err)
+	}
+
+	fmt.Println("Certificate pinned")
+
+	return nil
+}
+
+// updatePollInterval is how often the state of software updates is polled
+// while waiting for them.
+const updatePollInterval = 5 * time.Second
+
+func newUpdateBridgeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "update",
+		Short: "Manage software updates of the bridge and its lights",
+		Long: `Shows the software updates pending on the bridge and its lights, checks for new
+ones and installs them. Updates are downloaded by the bridge in the background
+once found, and are ready to install afterwards.`,
+		Args: cobra.NoArgs,
+		// If called with no sub-command, show the status instead of printing
+		// help.
+		Run: func(*cobra.Command, []string) { must(runUpdateStatusCmd()) },
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "status",
+		Short: "Show pending software updates of the bridge and its lights",
+		Args:  cobra.NoArgs,
+		Run:   func(*cobra.Command, []string) { must(runUpdateStatusCmd()) },
+	})
+	cmd.AddCommand(newUpdateCheckCmd())
+	cmd.AddCommand(newUpdateInstallCmd())
+
+	return cmd
+}
+
+func newUpdateCheckCmd() *cobra.Command {
+	var timeout time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "check",
+		Short: "Make the bridge check for software updates",
+		Long: `Makes the bridge check for software updates of itself and its lights, waits
+for the check to complete and shows the pending updates.`,
+		Args: cobra.NoArgs,
+		Run:  func(*cobra.Command, []string) { must(runUpdateCheckCmd(timeout)) },
+	}
+
+	cmd.Flags().DurationVar(&timeout, "timeout", 5*time.Minute, "How long to wait for the check to complete")
+
+	return cmd
+}
+
+type updateInstallFlags struct {
+	Yes     bool
+	Timeout time.Duration
+}
+
+func newUpdateInstallCmd() *cobra.Command {
+	var flags updateInstallFlags
+
+	cmd := &cobra.Command{
+		Use:   "install",
+		Short: "Install the software updates ready to be installed",
+		Long: `Installs the software updates ready to be installed on the bridge and its
+lights, and reports progress until they are installed. Lights may turn off or
+become unavailable while they are updated, and the bridge restarts after
+installing its own update.`,
+		Args: cobra.NoArgs,
+		Run:  func(*cobra.Command, []string) { must(runUpdateInstallCmd(&flags)) },
+	}
+
+	cmd.Flags().BoolVarP(&flags.Yes, "yes", "y", false, "Do not ask for confirmation before installing updates")
+	cmd.Flags().DurationVar(&flags.Timeout, "timeout", time.Hour, "How long to wait for updates to be installed")
+
+	return cmd
+}
+
+func runUpdateStatusCmd() error {
+	// Send requests to the bridge directly, the daemon may cache their
+	// responses.
+	client, err := setupDirectClient()
+	if err != nil {
+		return fmt.Errorf("unable to setup Hue client: %w", err)
+	}
+
+	return printUpdateStatus(client)
+}
+
+func runUpdateCheckCmd(timeout time.Duration) error {
+	client, err := setupDirectClient()
+	if err != nil {
+		return fmt.Errorf("unable to setup Hue client: %w", err)
+	}
+
+	res, err := client.CheckForUpdates()
+	if err != nil {
+		return fmt.Errorf("unable to check for updates: %w", err)
+	}
+	if err = res.Err(); err != nil {
+		return fmt.Errorf("unable to check for updates: %w", err)
+	}
+
+	fmt.Println("Checking for updates...")
+
+	err = waitForUpdates(client, timeout, func(su *hue.SoftwareUpdate, _ []hue.Light) bool {
+		return !su.CheckForUpdate
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Println()
+
+	return printUpdateStatus(client)
+}
+
+func runUpdateInstallCmd(flags *updateInstallFlags) error {
+	client, err := setupDirectClient()
+	if err != nil {
+		return fmt.Errorf("unable to setup Hue client: %w", err)
+	}
+
+	su, err := client.SoftwareUpdate()
+	if err != nil {
+		return fmt.Errorf("unable to get software update state: %w", err)
+	}
+
+	switch su.State {
+	case hue.SoftwareUpdateStateAnyReadyToInstall, hue.SoftwareUpdateStateAllReadyToInstall:
+	case hue.SoftwareUpdateStateInstalling:
+		fmt.Println("Updates are already being installed")
+	case hue.SoftwareUpdateStateTransferring:
+		return errors.New("updates are still being downloaded by the bridge, try again later")
+	default:
+		return errors.New("no update ready to install, run `huectl bridge update check` to check for new ones")
+	}
+
+	if su.State != hue.SoftwareUpdateStateInstalling {
+		if err = printUpdateStatus(client); err != nil {
+			return err
+		}
+		fmt.Println()
+		if !flags.Yes && !confirm("Install updates now? Lights may be unavailable for a while") {
+			return errors.New("aborted")
+		}
+
+		res, err := client.InstallUpdates()
+		if err != nil {
+			return fmt.Errorf("unable to install updates: %w", err)
+		}
+		if err = res.Err(); err != nil {
+			return fmt.Errorf("unable to install updates: %w", err)
+		}
+	}
+
+	fmt.Println("Installing updates...")
+
+	// Report progress each time a device completes its update. The bridge
+	// may take a while to start installing: until it does, updates are done
+	// once no device is left to update.
+	last, started := -1, false
+	err = waitForUpdates(client, flags.Timeout, func(su *hue.SoftwareUpdate, lights []hue.Light) bool {
+		states := []string{su.Bridge.State}
+		for _, l := range lights {
+			states = append(states, l.SoftWareUpdate.State)
+		}
+
+		installing, ready := 0, 0
+		for _, state := range states {
+			switch state {
+			case hue.DeviceUpdateStateInstalling:
+				installing++
+			case hue.DeviceUpdateStateReadyToInstall:
+				ready++
+			}
+		}
+		if installing != last && installing > 0 {
+			fmt.Printf("%d devices being updated\n", installing)
+		}
+		last = installing
+
+		if su.State == hue.SoftwareUpdateStateInstalling || installing > 0 {
+			started = true
+			return false
+		}
+
+		return started || ready == 0 || su.State == hue.SoftwareUpdateStateNoUpdates
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Updates installed\n\n")
+
+	return printUpdateStatus(client)
+}
+
+// waitForUpdates polls the state of software updates until done returns true,
+// the timeout expires or the command is interrupted. Errors are reported but
+// do not stop polling, as the bridge restarts when updating itself.
+func waitForUpdates(client *hue.Client, timeout time.Duration, done func(*hue.SoftwareUpdate, []hue.Light) bool) error {
+	sigCtx, stop := signalContext()
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(sigCtx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(updatePollInterval)
+	defer ticker.Stop()
+
+	var lastErr string
+	for {
+		select {
+		case <-ctx.Done():
+			if sigCtx.Err() != nil {
+				fmt.Println("Stopped waiting, the bridge carries on in the background")
+				return nil
+			}
+			return fmt.Errorf("updates did not complete within %s, see `huectl bridge update status`", timeout)
+		case <-ticker.C:
+		}
+
+		su, err := client.SoftwareUpdate()
+		var lights []hue.Light
+		if err == nil {
+			lights, err = client.Lights()
+		}
+		if err != nil {
+			if err.Error() != lastErr {
+				fmt.Fprintf(os.Stderr, "unable to get software update state, retrying: %v\n", err)
+				lastErr = err.Error()
+			}
+			continue
+		}
+		lastErr = ""
+
+		if done(su, lights) {
+			return nil
+		}
+	}
+}
+
+// printUpdateStatus prints the state of the software updates of the bridge and
+// of each light.
+func printUpdateStatus(client *hue.Client) error {
+	cfg, err := client.Config()
+	if err != nil {
+		return fmt.Errorf("unable to get software update state: %w", err)
+	}
+
+	lights, err := client.Lights()
+	if err != nil {
+		return fmt.Errorf("unable to list lights: %w", err)
+	}
+	sort.Slice(lights, func(i, j int) bool { return hue.LessID(lights[i].ID, lights[j].ID) })
+
+	su := cfg.SoftwareUpdate
+	fmt.Printf("Update state:    %s\n", updateStateDescription(su.State))
+	if su.AutoInstall.On {
+		fmt.Printf("Auto install:    on, at %s\n", su.AutoInstall.UpdateTime)
+	} else {
+		fmt.Println("Auto install:    off")
+	}
+	if su.LastChange != "" {
+		fmt.Printf("Last change:     %s\n", su.LastChange)
+	}
+	fmt.Println()
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 4, ' ', 0)
+	fmt.Fprintln(tw, "DEVICE\tVERSION\tUPDATE\tLAST INSTALL")
+	fmt.Fprintf(tw, "bridge (%s)\t%s\t%s\t%s\n", cfg.Name, cfg.SWVersion, orNone(su.Bridge.State), orNone(su.Bridge.LastInstall))
+	for _, l := range lights {
+		fmt.Fprintf(tw, "light %s (%s)\t%s\t%s\t%s\n", l.ID, l.Name, l.SoftWareVersion, orNone(l.SoftWareUpdate.State), orNone(l.SoftWareUpdate.LastInstall))
+	}
+
+	return tw.Flush()
+}
+
+// updateStateDescription describes the state of the software updates of the
+// bridge and its devices.
+func updateStateDescription(state string) string {
+	switch state {
+	case hue.SoftwareUpdateStateNoUpdates:
+		return "up to date"
+	case hue.SoftwareUpdateStateTransferring:
+		return "downloading updates"
+	case hue.SoftwareUpdateStateAnyReadyToInstall:
+		return "some updates ready to install"
+	case hue.SoftwareUpdateStateAllReadyToInstall:
+		return "all updates ready to install"
+	case hue.SoftwareUpdateStateInstalling:
+		return "installing updates"
+	default:
+		return orNone(state)
+	}
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
+
+// confirm asks a yes/no question on the terminal, defaulting to no.
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+func newCacheCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the local cache of lights, groups and scenes",
+		Long: `huectl keeps a local copy of the lights, groups and scenes of the bridge,
+used to resolve names, complete commands and list lights with --offline.
+It is refreshed automatically when stale, these commands manage it manually.`,
+		Args: cobra.NoArgs,
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "refresh",
+		Short: "Fetch lights, groups and scenes from the bridge and update the cache",
+		Args:  cobra.NoArgs,
+		Run:   func(*cobra.Command, []string) { must(runCacheRefreshCmd()) },
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "clear",
+		Short: "Remove the cache",
+		Args:  cobra.NoArgs,
+		Run:   func(*cobra.Command, []string) { must(runCacheClearCmd()) },
+	})
+
+	return cmd
+}
+
+func runCacheRefreshCmd() error {
+	client, err := setupClient()
+	if err != nil {
+		return fmt.Errorf("unable to setup Hue client: %w", err)
+	}
+
+	c, err := setupCache(inventoryCacheTTL)
+	if err != nil {
+		return err
+	}
+
+	inv, changed, err := c.Refresh(client)
+	if err != nil {
+		return fmt.Errorf("unable to refresh cache: %w", err)
+	}
+
+	status := "unchanged"
+	if changed {
+		status = "updated"
+	}
+	fmt.Printf("Cached %d lights, %d groups and %d scenes (%s)\n", len(inv.Lights), len(inv.Groups), len(inv.Scenes), status)
+
+	return nil
+}
+
+func runCacheClearCmd() error {
+	c, err := setupCache(inventoryCacheTTL)
+	if err != nil {
+		return err
+	}
+
+	if err = c.Clear(); err != nil {
+		return fmt.Errorf("unable to clear cache: %w", err)
+	}
+
+	return nil
+}
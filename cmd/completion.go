@@ -0,0 +1,211 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/skwair/huectl/pkg/cache"
+	"github.com/skwair/huectl/pkg/colors"
+	"github.com/skwair/huectl/pkg/effect"
+	"github.com/skwair/huectl/pkg/music"
+	"github.com/spf13/cobra"
+)
+
+// completionCacheTTL is how long resources fetched from the bridge are reused
+// for completions. Short enough to pick up renamed lights, long enough to not
+// query the bridge for each tab press.
+const completionCacheTTL = time.Minute
+
+const completionExample = `
+	# Bash, load completions for the current session
+	source <(huectl completion bash)
+
+	# Zsh, load completions for each session (compinit must be enabled)
+	huectl completion zsh > "${fpath[1]}/_huectl"
+
+	# Fish
+	huectl completion fish > ~/.config/fish/completions/huectl.fish
+
+	# PowerShell
+	huectl completion powershell | Out-String | Invoke-Expression`
+
+func newCompletionCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:                   "completion bash|zsh|fish|powershell",
+		Short:                 "Generates shell completion scripts",
+		Example:               completionExample,
+		DisableFlagsInUseLine: true,
+		ValidArgs:             []string{"bash", "zsh", "fish", "powershell"},
+		Args:                  cobra.ExactValidArgs(1),
+		Run:                   func(cmd *cobra.Command, args []string) { must(runCompletionCmd(cmd.Root(), args[0])) },
+	}
+}
+
+func runCompletionCmd(root *cobra.Command, shell string) error {
+	switch shell {
+	case "bash":
+		return root.GenBashCompletion(os.Stdout)
+	case "zsh":
+		return root.GenZshCompletion(os.Stdout)
+	case "fish":
+		return root.GenFishCompletion(os.Stdout, true)
+	case "powershell":
+		return root.GenPowerShellCompletionWithDesc(os.Stdout)
+	default:
+		return fmt.Errorf("unsupported shell %q", shell)
+	}
+}
+
+// completeLightIDs completes light IDs, described by the name of the light,
+// and light names. Lights already given as arguments are not suggested again.
+func completeLightIDs(_ *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	inv, err := completionInventory()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	used := make(map[string]bool, len(args))
+	for _, arg := range args {
+		used[strings.ToLower(arg)] = true
+	}
+
+	// The inventory is already sorted by ID.
+	var completions []string
+	for _, light := range inv.Lights {
+		if used[light.ID] || used[strings.ToLower(light.Name)] {
+			continue
+		}
+		completions = append(completions, completeResource(light.ID, light.Name, toComplete)...)
+	}
+
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeGroups returns a function completing the IDs and names of the groups
+// of the given types, or of all groups if none is given.
+func completeGroups(types ...string) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(_ *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		inv, err := completionInventory()
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+
+		var completions []string
+		for _, group := range inv.Groups {
+			if len(types) > 0 && !contains(types, group.Type) {
+				continue
+			}
+			completions = append(completions, completeResource(group.ID, group.Name, toComplete)...)
+		}
+
+		return completions, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// completionInventory returns the inventory used to complete resources,
+// fetching it from the bridge if the cached one is too old.
+func completionInventory() (*cache.Inventory, error) {
+	client, err := setupClient()
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := setupCache(completionCacheTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Inventory(client)
+}
+
+// completeResource returns the completions of a resource matching toComplete:
+// its ID, described by its name, and its name, quoted for the shell if needed.
+func completeResource(id, name, toComplete string) []string {
+	var completions []string
+	if strings.HasPrefix(id, toComplete) {
+		completions = append(completions, id+"\t"+name)
+	}
+
+	// The word being completed may already start with a quote.
+	prefix := strings.ToLower(strings.TrimLeft(toComplete, `'"`))
+	if name != "" && strings.HasPrefix(strings.ToLower(name), prefix) {
+		completions = append(completions, shellQuote(name)+"\t"+id)
+	}
+
+	return completions
+}
+
+// shellQuote quotes s so a shell reads it as a single word, leaving it as is
+// if it does not need to be.
+func shellQuote(s string) string {
+	safe := true
+	for _, r := range s {
+		if !(unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("-_.,:/+@%", r)) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return s
+	}
+
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+// completeValues returns a completion function suggesting the given values.
+func completeValues(values ...string) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(_ *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return filterPrefix(values, toComplete), cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// completeColorNames completes the names of known colors.
+func completeColorNames(_ *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return filterPrefix(colors.Names(), toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeEffectNames completes the names of registered effects.
+func completeEffectNames(_ *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	return filterPrefix(effect.Names(), toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+func completeMusicPresets(_ *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return filterPrefix(music.PresetNames(), toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+func completeImageFiles(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return []string{"jpg", "jpeg", "png", "gif"}, cobra.ShellCompDirectiveFilterFileExt
+}
+
+func filterPrefix(values []string, prefix string) []string {
+	var filtered []string
+	for _, v := range values {
+		if strings.HasPrefix(v, prefix) {
+			filtered = append(filtered, v)
+		}
+	}
+
+	return filtered
+}
+
+// registerEnumCompletion completes the values of the given enum flag.
+func registerEnumCompletion(cmd *cobra.Command, name string, e *enumValue) {
+	_ = cmd.RegisterFlagCompletionFunc(name, completeValues(e.allowed...))
+}
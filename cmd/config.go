@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/skwair/huectl/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+func newConfigCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Manage the configuration of huectl",
+		Args:  cobra.NoArgs,
+	}
+
+	cmd.AddCommand(newViewConfigCmd())
+	cmd.AddCommand(newSecureConfigCmd())
+
+	return cmd
+}
+
+func newViewConfigCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "view",
+		Short: "Show the effective configuration",
+		Long: `Shows the configuration used by huectl, along with where each setting comes
+from: a global flag, an environment variable or the configuration file. See
+"huectl --help" for the precedence order. Credentials are redacted, and those
+kept in a secret store are not read.`,
+		Args: cobra.NoArgs,
+		Run:  func(*cobra.Command, []string) { must(runViewConfigCmd()) },
+	}
+}
+
+// redacted replaces the value of credentials shown by `huectl config view`.
+const redacted = "<redacted>"
+
+func runViewConfigCmd() error {
+	cfgPath, err := config.AbsolutePath()
+	if err != nil {
+		return err
+	}
+
+	cfg, err := readConfig()
+	if err != nil {
+		return err
+	}
+
+	file, err := config.Read()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if file == nil {
+		cfgPath += " (not found)"
+		file = &config.Config{}
+	}
+
+	flags, env := globalFlags.Overrides, config.EnvOverrides()
+
+	// source returns where a setting overridable by the given flag and
+	// environment variable comes from.
+	source := func(flag, flagValue, envName, envValue string) string {
+		switch {
+		case flagValue != "":
+			return "flag --" + flag
+		case envValue != "":
+			return "env " + envName
+		default:
+			return "file"
+		}
+	}
+
+	clientIDSource := source("client-id", flags.ClientID, config.EnvClientID, env.ClientID)
+	clientID, clientKey := redactSecret(cfg.ClientID), redactSecret(cfg.ClientKey)
+	clientKeySource := "file"
+	switch {
+	case clientIDSource != "file":
+		clientKeySource = "env " + config.EnvClientKey
+	case file.ClientID == "" && cfg.SecretStore != "" && cfg.SecretStore != config.SecretStorePlaintext:
+		// Reading the secret store may require a passphrase.
+		clientID, clientKey = redacted, redacted
+		clientIDSource = cfg.SecretStore + " secret store"
+		clientKeySource = clientIDSource
+	}
+
+	fmt.Printf("Configuration file: %s\n\n", cfgPath)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 4, ' ', 0)
+	fmt.Fprintln(tw, "SETTING\tVALUE\tSOURCE")
+	row := func(name, value, source string) {
+		// Unset settings come from nowhere.
+		if value == "" || value == "false" {
+			source = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", name, value, source)
+	}
+
+	row("bridge_url", cfg.BridgeURL, source("bridge-url", flags.BridgeURL, config.EnvBridgeURL, env.BridgeURL))
+	row("bridge_id", cfg.BridgeID, source("bridge-id", flags.BridgeID, config.EnvBridgeID, env.BridgeID))
+	row("cert_fingerprint", cfg.CertFingerprint, source("cert-fingerprint", flags.CertFingerprint, config.EnvCertFingerprint, env.CertFingerprint))
+	row("verify_bridge_ca", strconv.FormatBool(cfg.VerifyBridgeCA), "file")
+	row("client_id", clientID, clientIDSource)
+	row("client_key", clientKey, clientKeySource)
+	row("secret_store", cfg.SecretStore, "file")
+
+	return tw.Flush()
+}
+
+// redactSecret returns the value shown for a secret by `huectl config view`.
+func redactSecret(v string) string {
+	if v == "" {
+		return ""
+	}
+
+	return redacted
+}
+
+func newSecureConfigCmd() *cobra.Command {
+	store := newEnumValue(config.SecretStores...)
+	store.value = config.SecretStoreKeyring
+
+	cmd := &cobra.Command{
+		Use:   "secure",
+		Short: "Move the credentials of the bridge user to a secret store",
+		Long: `Moves the credentials of the bridge user to the given secret store, removing
+them from the previous one. Configurations created by older versions of huectl
+keep them in plaintext in the configuration file: run this command to move them
+to the keyring of the system, or to a file encrypted with a passphrase.`,
+		Example: `  huectl config secure --store file`,
+		Args:    cobra.NoArgs,
+		Run:     func(*cobra.Command, []string) { must(runSecureConfigCmd(store.value)) },
+	}
+
+	cmd.Flags().Var(store, "store", "Secret store to move the credentials to")
+	registerEnumCompletion(cmd, "store", store)
+
+	return cmd
+}
+
+func runSecureConfigCmd(store string) error {
+	// Overridden credentials would be stored instead of the configured ones.
+	if err := checkNoOverrides(); err != nil {
+		return err
+	}
+
+	cfgPath, err := config.AbsolutePath()
+	if err != nil {
+		return err
+	}
+
+	cfg, err := readConfigFile()
+	if err != nil {
+		return err
+	}
+
+	previous := *cfg
+	if previous.SecretStore == "" {
+		previous.SecretStore = config.SecretStorePlaintext
+	}
+	if previous.SecretStore == store {
+		return fmt.Errorf("credentials are already stored in %s", store)
+	}
+
+	oldPassphrase := passphrasePrompt(false)
+	if err = cfg.LoadSecrets(oldPassphrase); err != nil {
+		return fmt.Errorf("unable to load credentials: %w", err)
+	}
+	if cfg.ClientID == "" {
+		return errors.New("no credentials to move, please run `huectl init` first")
+	}
+
+	cfg.SecretStore = store
+	if err = saveConfig(cfgPath, cfg); err != nil {
+		return fmt.Errorf("unable to save configuration: %w", err)
+	}
+
+	if err = previous.DeleteSecrets(oldPassphrase); err != nil {
+		return fmt.Errorf("credentials were moved but could not be deleted from %s: %w", previous.SecretStore, err)
+	}
+
+	fmt.Printf("Credentials moved to %s\n", store)
+
+	return nil
+}
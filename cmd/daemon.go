@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/skwair/huectl/pkg/daemon"
+	"github.com/spf13/cobra"
+)
+
+type daemonFlags struct {
+	CacheTTL time.Duration
+	Verbose  bool
+}
+
+func newDaemonCmd() *cobra.Command {
+	var flags daemonFlags
+
+	cmd := &cobra.Command{
+		Use:   "daemon",
+		Short: "Keeps a connection to the bridge open to speed up other commands",
+		Long: `Runs in the foreground, holding a persistent connection to the bridge and
+listening on a Unix socket. While it runs, other huectl commands send their
+requests through it instead of connecting to the bridge themselves, which makes
+them noticeably faster, e.g. when bound to keyboard shortcuts. Responses of
+requests reading the state of the bridge are also cached for a short time.
+
+The socket is created in $XDG_RUNTIME_DIR if set, or in the user cache
+directory otherwise. Set HUECTL_NO_DAEMON=1 to bypass a running daemon.`,
+		Args: cobra.NoArgs,
+		Run:  func(*cobra.Command, []string) { must(runDaemonCmd(&flags)) },
+	}
+
+	cmd.Flags().DurationVar(&flags.CacheTTL, "cache-ttl", daemon.DefaultCacheTTL, "How long to cache the state of the bridge, 0 to disable")
+	cmd.Flags().BoolVarP(&flags.Verbose, "verbose", "v", false, "Log every request")
+
+	return cmd
+}
+
+func runDaemonCmd(flags *daemonFlags) error {
+	client, err := setupDirectClient()
+	if err != nil {
+		return fmt.Errorf("unable to setup Hue client: %w", err)
+	}
+
+	path, err := daemon.SocketPath()
+	if err != nil {
+		return err
+	}
+
+	l, err := daemon.Listen(path)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+
+	opts := []daemon.Option{daemon.WithCacheTTL(flags.CacheTTL)}
+	if flags.Verbose {
+		opts = append(opts, daemon.WithLogger(logger))
+	}
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	logger.Printf("Listening on %s", path)
+
+	err = daemon.New(client, opts...).Serve(ctx, l)
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+
+	return err
+}
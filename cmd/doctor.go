@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/skwair/huectl/pkg/doctor"
+	"github.com/spf13/cobra"
+)
+
+type doctorFlags struct {
+	JSON             bool
+	Timeout          time.Duration
+	BatteryThreshold int
+}
+
+func newDoctorCmd() *cobra.Command {
+	var flags doctorFlags
+
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Diagnose the connection to the bridge and the health of its devices",
+		Long: `Checks, in order, that the configuration is valid, the bridge can be reached,
+its certificate matches the pinned one and the configured user is registered on
+it. Once connected, it also reports pending software updates, the Zigbee channel
+of the bridge, unreachable lights and sensors, and sensors with a low battery.
+Checks depending on a failed one are skipped.
+
+The exit code is 0 when all checks passed, 2 when some raised warnings and 3
+when some failed. It is 1 when the checks could not be run or reported at all.
+Use --json for a machine-readable report.`,
+		Example: `  huectl doctor
+  huectl doctor --json | jq '.checks[] | select(.status != "ok")'`,
+		Args: cobra.NoArgs,
+		Run: func(*cobra.Command, []string) {
+			report, err := runDoctorCmd(&flags)
+			must(err)
+			if code := report.ExitCode(); code != doctor.ExitCodeOK {
+				os.Exit(code)
+			}
+		},
+	}
+
+	cmd.Flags().BoolVar(&flags.JSON, "json", false, "Print the report as JSON")
+	cmd.Flags().DurationVar(&flags.Timeout, "timeout", doctor.DefaultTimeout, "How long to wait for the bridge to answer each check")
+	cmd.Flags().IntVar(&flags.BatteryThreshold, "battery-threshold", doctor.DefaultBatteryThreshold, "Battery level, in percent, under which sensors are reported")
+
+	return cmd
+}
+
+func runDoctorCmd(flags *doctorFlags) (*doctor.Report, error) {
+	if flags.Timeout <= 0 {
+		return nil, fmt.Errorf("timeout must be positive, got %s", flags.Timeout)
+	}
+
+	doc := doctor.New(
+		doctor.WithTimeout(flags.Timeout),
+		doctor.WithBatteryThreshold(flags.BatteryThreshold),
+	)
+
+	// Check the bridge directly, not the daemon.
+	report := doc.Run(readConfigWithSecrets)
+
+	if flags.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return nil, err
+		}
+	} else if err := printDoctorReport(report); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+func printDoctorReport(report *doctor.Report) error {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 4, ' ', 0)
+	fmt.Fprintln(tw, "CHECK\tSTATUS\tMESSAGE")
+	for _, res := range report.Checks {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", res.Check, strings.ToUpper(string(res.Status)), res.Message)
+		for _, detail := range res.Details {
+			fmt.Fprintf(tw, "\t\t  %s\n", detail)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	switch report.Status {
+	case doctor.StatusWarning:
+		fmt.Println("\nSome checks raised warnings")
+	case doctor.StatusFailure:
+		fmt.Println("\nSome checks failed")
+	default:
+		fmt.Println("\nAll checks passed")
+	}
+
+	return nil
+}
@@ -0,0 +1,218 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/skwair/huectl/pkg/effect"
+	"github.com/skwair/huectl/pkg/hue"
+	"github.com/spf13/cobra"
+)
+
+type effectFlags struct {
+	Lights     []string
+	Groups     []string
+	Duration   time.Duration
+	From       string
+	To         string
+	Color      string
+	Brightness int
+	Frequency  float64
+	Period     time.Duration
+	RateLimit  int
+}
+
+const effectExample = `
+	# Wake up with a 30 minutes sunrise in the bedroom
+	huectl effect run sunrise --light Bedroom --duration 30m
+
+	# Slowly dim the living room to a warm glow
+	huectl effect run fade --group "Living room" --to 10%,2200K --duration 20m
+
+	# Flicker two lamps like candles until interrupted
+	huectl effect run candle --light 3 --light 4`
+
+func newEffectCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "effect",
+		Short:   "Runs light effects such as fades, sunrises or candle flickers",
+		Example: effectExample,
+	}
+
+	cmd.AddCommand(newRunEffectCmd())
+	cmd.AddCommand(newListEffectsCmd())
+
+	return cmd
+}
+
+func newRunEffectCmd() *cobra.Command {
+	var flags effectFlags
+
+	cmd := &cobra.Command{
+		Use:   "run EFFECT",
+		Short: "Runs an effect on lights",
+		Long: `Runs an effect on the given lights and on the lights of the given groups, by
+sending them a sequence of states. Lights are turned on when the effect starts.
+
+Effects that transition to a final state (fade, sunrise) leave lights in it once
+they complete. Others restore lights to the state they were in before starting,
+as do all effects when interrupted.
+
+States given to --from and --to are comma-separated lists of a brightness in
+percent, a color temperature in Kelvin or a color name or hex code, e.g.
+"10%,2200K" or "80%,orange". Colors given to --color use the same format.
+
+Updates are rate limited to avoid overloading the bridge, see "huectl effect
+list" for the available effects.`,
+		Example:           effectExample,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeEffectNames,
+		Run:               func(_ *cobra.Command, args []string) { must(runEffectCmd(args[0], &flags)) },
+	}
+
+	cmd.Flags().StringArrayVarP(&flags.Lights, "light", "l", nil, "Light to run the effect on, by ID or name, can be repeated")
+	cmd.Flags().StringArrayVarP(&flags.Groups, "group", "g", nil, "Group whose lights to run the effect on, by ID or name, can be repeated")
+	cmd.Flags().DurationVarP(&flags.Duration, "duration", "d", 0, "Duration of the effect, 0 to use its default")
+	cmd.Flags().StringVar(&flags.From, "from", "", "State to start from, e.g. 100%,4000K")
+	cmd.Flags().StringVar(&flags.To, "to", "", "State to end with, e.g. 10%,2200K")
+	cmd.Flags().StringVar(&flags.Color, "color", "", "Color of the effect, e.g. 2200K or red")
+	cmd.Flags().IntVar(&flags.Brightness, "brightness", 0, "Brightness of the effect in percent, 0 to use its default")
+	cmd.Flags().Float64Var(&flags.Frequency, "frequency", 0, "Frequency of the effect in Hz, 0 to use its default")
+	cmd.Flags().DurationVar(&flags.Period, "period", 0, "Period of the effect, 0 to use its default")
+	cmd.Flags().IntVar(&flags.RateLimit, "rate-limit", effect.DefaultRateLimit, "Maximum number of light updates sent per second")
+
+	_ = cmd.RegisterFlagCompletionFunc("light", completeLightIDs)
+	_ = cmd.RegisterFlagCompletionFunc("group", completeGroups())
+
+	return cmd
+}
+
+func newListEffectsCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "Lists available effects",
+		Args:  cobra.NoArgs,
+		Run:   func(*cobra.Command, []string) { must(runListEffectsCmd()) },
+	}
+}
+
+func runEffectCmd(name string, flags *effectFlags) error {
+	if len(flags.Lights) == 0 && len(flags.Groups) == 0 {
+		return errors.New("at least one light or group is required")
+	}
+
+	params := effect.Params{
+		Duration:   flags.Duration,
+		Brightness: flags.Brightness,
+		Frequency:  flags.Frequency,
+		Period:     flags.Period,
+	}
+
+	for _, s := range []struct {
+		flag, value string
+		dst         **effect.State
+	}{
+		{"--from", flags.From, &params.From},
+		{"--to", flags.To, &params.To},
+		{"--color", flags.Color, &params.Color},
+	} {
+		if s.value == "" {
+			continue
+		}
+
+		state, err := effect.ParseState(s.value)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", s.flag, err)
+		}
+		*s.dst = state
+	}
+
+	e, err := effect.New(name, params)
+	if err != nil {
+		return err
+	}
+
+	client, err := setupDirectClient()
+	if err != nil {
+		return fmt.Errorf("unable to setup Hue client: %w", err)
+	}
+
+	lights, err := effectLights(client, flags.Lights, flags.Groups)
+	if err != nil {
+		return err
+	}
+
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	runner := effect.NewRunner(client, effect.WithRateLimit(flags.RateLimit), effect.WithLogger(logger))
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	err = runner.Run(ctx, e, lights)
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+
+	return err
+}
+
+// effectLights returns the given lights along with the lights of the given
+// groups, without duplicates.
+func effectLights(client *hue.Client, lightRefs, groupRefs []string) ([]hue.Light, error) {
+	ids, err := resolveLightIDs(client, lightRefs)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(groupRefs) > 0 {
+		groups, err := client.Groups()
+		if err != nil {
+			return nil, fmt.Errorf("unable to list groups: %w", err)
+		}
+
+		for _, ref := range groupRefs {
+			g := hue.FindGroup(groups, ref)
+			if g == nil {
+				return nil, fmt.Errorf("unknown group %q", ref)
+			}
+			ids = append(ids, g.Lights...)
+		}
+	}
+
+	lights, err := client.Lights()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list lights: %w", err)
+	}
+
+	seen := make(map[string]bool, len(ids))
+	var res []hue.Light
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		light := hue.FindLight(lights, id)
+		if light == nil {
+			return nil, fmt.Errorf("unknown light %q", id)
+		}
+		res = append(res, *light)
+	}
+
+	return res, nil
+}
+
+func runListEffectsCmd() error {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 4, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tDESCRIPTION")
+	for _, name := range effect.Names() {
+		fmt.Fprintf(tw, "%s\t%s\n", name, effect.Help(name))
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/skwair/huectl/pkg/hue"
+	"github.com/spf13/cobra"
+)
+
+func newEntertainmentCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "entertainment",
+		Aliases: []string{"ent"},
+		Short:   "Manage entertainment groups",
+		Long: `Manages entertainment groups, which are groups of lights that colors can be
+streamed to with the Entertainment API, e.g. to sync them with a screen. Only
+lights supporting streaming can be part of them.`,
+		Args: cobra.NoArgs,
+		Run:  func(*cobra.Command, []string) { must(runListEntertainmentCmd()) },
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List entertainment groups",
+		Args:    cobra.NoArgs,
+		Run:     func(*cobra.Command, []string) { must(runListEntertainmentCmd()) },
+	})
+	cmd.AddCommand(newCreateEntertainmentCmd())
+	cmd.AddCommand(&cobra.Command{
+		Use:   "delete ID|NAME",
+		Short: "Delete an entertainment group",
+		Args:  cobra.ExactArgs(1),
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) > 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			return completeGroups(hue.GroupTypeEntertainment)(cmd, args, toComplete)
+		},
+		Run: func(_ *cobra.Command, args []string) { must(runDeleteEntertainmentCmd(args[0])) },
+	})
+
+	return cmd
+}
+
+func newCreateEntertainmentCmd() *cobra.Command {
+	class := newEnumValue(hue.EntertainmentClassTV, hue.EntertainmentClassOther)
+	class.value = hue.EntertainmentClassTV
+
+	cmd := &cobra.Command{
+		Use:     "create NAME ID|NAME...",
+		Short:   "Create an entertainment group with the given lights",
+		Example: `  huectl entertainment create "Media room" "TV left" "TV right" 7`,
+		Args:    cobra.MinimumNArgs(2),
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) == 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			return completeLightIDs(cmd, args[1:], toComplete)
+		},
+		Run: func(_ *cobra.Command, args []string) { must(runCreateEntertainmentCmd(args[0], args[1:], class.value)) },
+	}
+
+	cmd.Flags().Var(class, "class", "Class of the group")
+	registerEnumCompletion(cmd, "class", class)
+
+	return cmd
+}
+
+func runListEntertainmentCmd() error {
+	client, err := setupClient()
+	if err != nil {
+		return fmt.Errorf("unable to setup Hue client: %w", err)
+	}
+
+	groups, err := client.EntertainmentGroups()
+	if err != nil {
+		return fmt.Errorf("unable to list groups: %w", err)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 4, ' ', 0)
+	defer tw.Flush()
+
+	fmt.Fprintln(tw, "ID\tNAME\tCLASS\tLIGHTS\tSTREAMING")
+
+	for _, g := range groups {
+		streaming := "no"
+		if g.Stream != nil && g.Stream.Active {
+			streaming = "yes"
+			if g.Stream.Owner != "" {
+				streaming += " (" + g.Stream.Owner + ")"
+			}
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", g.ID, g.Name, g.Class, strings.Join(g.Lights, ", "), streaming)
+	}
+
+	return nil
+}
+
+func runCreateEntertainmentCmd(name string, refs []string, class string) error {
+	client, err := setupClient()
+	if err != nil {
+		return fmt.Errorf("unable to setup Hue client: %w", err)
+	}
+
+	ids, err := resolveLightIDs(client, refs)
+	if err != nil {
+		return err
+	}
+
+	lights, err := client.Lights()
+	if err != nil {
+		return fmt.Errorf("unable to list lights: %w", err)
+	}
+
+	// The bridge rejects lights that can not stream with an unhelpful
+	// "invalid value" error, report them by name instead.
+	for _, id := range ids {
+		if l := hue.FindLight(lights, id); l != nil && !l.Capabilities.Streaming.Renderer {
+			return fmt.Errorf("light %s (%s) does not support streaming", l.ID, l.Name)
+		}
+	}
+
+	id, err := client.CreateEntertainmentGroup(name, class, ids)
+	if err != nil {
+		return fmt.Errorf("unable to create entertainment group: %w", err)
+	}
+
+	fmt.Printf("Created entertainment group %s\n", id)
+
+	return nil
+}
+
+func runDeleteEntertainmentCmd(ref string) error {
+	client, err := setupClient()
+	if err != nil {
+		return fmt.Errorf("unable to setup Hue client: %w", err)
+	}
+
+	groups, err := client.EntertainmentGroups()
+	if err != nil {
+		return fmt.Errorf("unable to list groups: %w", err)
+	}
+
+	// Only look for entertainment groups so rooms are not deleted by mistake.
+	g := hue.FindGroup(groups, ref)
+	if g == nil {
+		return fmt.Errorf("unknown entertainment group %q", ref)
+	}
+
+	if err = client.DeleteGroup(g.ID); err != nil {
+		return fmt.Errorf("unable to delete entertainment group: %w", err)
+	}
+
+	fmt.Printf("Deleted entertainment group %s\n", g.ID)
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/skwair/huectl/pkg/exporter"
+	"github.com/skwair/huectl/pkg/hue"
+	"github.com/spf13/cobra"
+)
+
+type exporterFlags struct {
+	Listen   string
+	Interval time.Duration
+}
+
+func newExporterCmd() *cobra.Command {
+	var flags exporterFlags
+
+	cmd := &cobra.Command{
+		Use:   "exporter",
+		Short: "Exposes the state of lights and sensors as Prometheus metrics",
+		Long: `Periodically scrapes the bridge and serves the state of lights and sensors as
+Prometheus metrics on /metrics:
+
+  hue_light_on, hue_light_brightness, hue_light_reachable
+  hue_sensor_temperature_celsius, hue_sensor_lightlevel_lux,
+  hue_sensor_battery_percent, hue_sensor_reachable
+  hue_bridge_request_duration_seconds, hue_bridge_request_errors_total,
+  hue_bridge_api_errors_total
+  hue_up, hue_last_scrape_timestamp_seconds
+
+Light and sensor metrics are labeled by ID, name, room and model.`,
+		Example: `  huectl exporter --listen :9366 --interval 30s`,
+		Args:    cobra.NoArgs,
+		Run:     func(*cobra.Command, []string) { must(runExporterCmd(&flags)) },
+	}
+
+	cmd.Flags().StringVar(&flags.Listen, "listen", ":9366", "Address to serve metrics on")
+	cmd.Flags().DurationVar(&flags.Interval, "interval", exporter.DefaultInterval, "How often to scrape the bridge")
+
+	return cmd
+}
+
+func runExporterCmd(flags *exporterFlags) error {
+	if flags.Interval <= 0 {
+		return fmt.Errorf("interval must be positive, got %s", flags.Interval)
+	}
+
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	exp := exporter.New(exporter.WithInterval(flags.Interval), exporter.WithLogger(logger))
+
+	client, err := setupDirectClient(hue.WithRequestObserver(exp.ObserveRequest))
+	if err != nil {
+		return fmt.Errorf("unable to setup Hue client: %w", err)
+	}
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- exp.Run(ctx, client)
+		// Stop serving metrics that are no longer updated.
+		cancel()
+	}()
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", exp.Handler())
+
+	srv := &http.Server{
+		Addr:              flags.Listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	logger.Printf("Serving metrics on %s/metrics", flags.Listen)
+
+	err = listenAndServe(ctx, srv)
+
+	cancel()
+	if rerr := <-runErr; err == nil && !errors.Is(rerr, context.Canceled) {
+		err = fmt.Errorf("unable to scrape the bridge: %w", rerr)
+	}
+
+	return err
+}
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// adjustableInt is a flag value that is either absolute (e.g. 50) or relative
+// to the current value when prefixed with a sign (e.g. +10 or -20).
+type adjustableInt struct {
+	value    int
+	relative bool
+}
+
+// String implements the pflag.Value interface.
+func (a *adjustableInt) String() string {
+	if a.relative && a.value >= 0 {
+		return "+" + strconv.Itoa(a.value)
+	}
+
+	return strconv.Itoa(a.value)
+}
+
+// Set implements the pflag.Value interface.
+func (a *adjustableInt) Set(s string) error {
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("%q is not a valid integer", s)
+	}
+
+	a.value = v
+	a.relative = strings.HasPrefix(s, "+") || strings.HasPrefix(s, "-")
+
+	return nil
+}
+
+// Type implements the pflag.Value interface.
+func (a *adjustableInt) Type() string { return "[+|-]int" }
+
+// xyValue is a flag value holding CIE xy color coordinates, written as "x,y".
+type xyValue [2]float32
+
+// String implements the pflag.Value interface.
+func (xy *xyValue) String() string {
+	if *xy == (xyValue{}) {
+		return ""
+	}
+
+	return fmt.Sprintf("%g,%g", xy[0], xy[1])
+}
+
+// Set implements the pflag.Value interface.
+func (xy *xyValue) Set(s string) error {
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 {
+		return fmt.Errorf("%q is not a valid pair of xy coordinates, e.g.: 0.3,0.4", s)
+	}
+
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 32)
+		if err != nil || v < 0 || v > 1 {
+			return fmt.Errorf("%q is not a valid coordinate, must be between 0 and 1", part)
+		}
+		xy[i] = float32(v)
+	}
+
+	return nil
+}
+
+// Type implements the pflag.Value interface.
+func (xy *xyValue) Type() string { return "x,y" }
+
+// enumValue is a string flag value restricted to a set of allowed values.
+type enumValue struct {
+	value   string
+	allowed []string
+}
+
+func newEnumValue(allowed ...string) *enumValue {
+	return &enumValue{allowed: allowed}
+}
+
+// String implements the pflag.Value interface.
+func (e *enumValue) String() string { return e.value }
+
+// Set implements the pflag.Value interface.
+func (e *enumValue) Set(s string) error {
+	for _, a := range e.allowed {
+		if s == a {
+			e.value = s
+			return nil
+		}
+	}
+
+	return fmt.Errorf("must be one of %s", strings.Join(e.allowed, ", "))
+}
+
+// Type implements the pflag.Value interface.
+func (e *enumValue) Type() string { return strings.Join(e.allowed, "|") }
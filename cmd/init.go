@@ -1,10 +1,12 @@
 package cmd
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"time"
@@ -15,78 +17,394 @@ import (
 	"gopkg.in/yaml.v2"
 )
 
+type initFlags struct {
+	RegenerateKey bool
+	SecretStore   string
+	Bridge        string
+	Wait          time.Duration
+	Username      string
+	ClientKey     string
+	Force         bool
+}
+
 func newInitCmd() *cobra.Command {
-	return &cobra.Command{
+	var flags initFlags
+	secretStore := newEnumValue(config.SecretStores...)
+	secretStore.value = config.SecretStoreKeyring
+
+	cmd := &cobra.Command{
 		Use:   "init",
 		Short: "Initializes huectl, connecting to a local Hue bridge and creating a new user",
-		Args:  cobra.NoArgs,
-		Run:   func(*cobra.Command, []string) { must(runInitCmd()) },
+		Long: `Initializes huectl, connecting to a local Hue bridge and creating a new user.
+
+The bridge is searched for on the local network unless its address is given
+with --bridge. A new user is registered once the link button of the bridge is
+pressed: by default huectl waits for Enter to be pressed after it, with --wait
+it keeps trying until the button is pressed, which suits provisioning scripts.
+An existing user can be used instead with --username.
+
+The bridge also returns a client key for the new user, required to stream to
+entertainment groups. Configurations created before huectl requested one have
+no client key: use --regenerate-key to register a new user on the configured
+bridge and store its credentials instead.
+
+Credentials are kept in the keyring of the system by default. Where there is
+none, e.g. on headless machines, use --secret-store=file to keep them in a file
+encrypted with a passphrase, given by HUECTL_PASSPHRASE when huectl can not ask
+for it.`,
+		Example: `  huectl init
+  huectl init --bridge 192.168.1.50 --wait 30s
+  huectl init --bridge 192.168.1.50 --username "$HUE_USER" --force`,
+		Args: cobra.NoArgs,
+		Run: func(*cobra.Command, []string) {
+			flags.SecretStore = secretStore.value
+			must(runInitCmd(&flags))
+		},
 	}
+
+	cmd.Flags().BoolVar(&flags.RegenerateKey, "regenerate-key", false, "Register a new user on the configured bridge to obtain a client key")
+	cmd.Flags().Var(secretStore, "secret-store", "Where to store the credentials of the bridge user")
+	registerEnumCompletion(cmd, "secret-store", secretStore)
+	cmd.Flags().StringVar(&flags.Bridge, "bridge", "", "Address of the bridge, skipping discovery")
+	cmd.Flags().DurationVar(&flags.Wait, "wait", 0, "Wait up to this long for the link button to be pressed instead of asking to press Enter")
+	cmd.Flags().StringVar(&flags.Username, "username", "", "Use this existing user of the bridge instead of registering a new one")
+	cmd.Flags().StringVar(&flags.ClientKey, "client-key", "", "Client key of the user given by --username, if any")
+	cmd.Flags().BoolVar(&flags.Force, "force", false, "Overwrite the existing configuration")
+
+	return cmd
 }
 
-func runInitCmd() error {
+// linkButtonPollInterval is how often huectl tries to register a user while
+// waiting for the link button of the bridge to be pressed.
+const linkButtonPollInterval = time.Second
+
+func runInitCmd(flags *initFlags) error {
+	if flags.Wait < 0 {
+		return fmt.Errorf("wait must be positive, got %s", flags.Wait)
+	}
+	if flags.ClientKey != "" && flags.Username == "" {
+		return errors.New("--client-key requires --username")
+	}
+
 	cfgPath, err := config.AbsolutePath()
 	if err != nil {
 		return err
 	}
 
-	if _, err = os.Stat(cfgPath); err == nil {
-		return fmt.Errorf("huectl already initialized; configuration found at %q", cfgPath)
+	if flags.RegenerateKey {
+		if flags.Bridge != "" || flags.Username != "" {
+			return errors.New("--regenerate-key can not be used with --bridge or --username")
+		}
+		return regenerateClientKey(cfgPath, flags.Wait)
 	}
 
-	fmt.Println("Searching for a Hue bridge on your local network...")
+	if _, err = os.Stat(cfgPath); err == nil && !flags.Force {
+		return fmt.Errorf("huectl already initialized; configuration found at %q, use --force to overwrite it", cfgPath)
+	}
 
-	httpClient := &http.Client{
+	// Bridges can not be verified before their certificate is known, it is
+	// trusted on first use and pinned afterwards.
+	discoveryClient := &http.Client{
 		Timeout: 5 * time.Second,
 		Transport: &http.Transport{
 			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
 		},
 	}
 
+	selectedBridge, err := selectBridge(discoveryClient, flags.Bridge)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Found Hue bridge %q at: %s\n", selectedBridge.Name, selectedBridge.IPAddr)
+
+	// Make sure credentials can be stored before registering a user that
+	// would otherwise be lost.
+	if err = checkSecretStore(flags.SecretStore, selectedBridge.ID); err != nil {
+		return err
+	}
+
+	certs := selectedBridge.Certificates
+	verifyCA := hue.VerifyBridgeCertificate(certs[0], certs[1:], selectedBridge.ID) == nil
+	if verifyCA {
+		fmt.Println("Bridge certificate issued by the Hue root CA")
+	}
+	fmt.Printf("Pinning bridge certificate with fingerprint %s\n", selectedBridge.CertFingerprint)
+
+	bridgeURL := fmt.Sprintf("https://%s", selectedBridge.IPAddr)
+	httpClient := bridgeHTTPClient(selectedBridge.CertFingerprint, selectedBridge.ID, verifyCA)
+
+	var creds *hue.Credentials
+	if flags.Username != "" {
+		creds, err = importUser(httpClient, bridgeURL, flags.Username, flags.ClientKey)
+	} else {
+		creds, err = registerUser(httpClient, selectedBridge.IPAddr, flags.Wait)
+	}
+	if err != nil {
+		return err
+	}
+
+	cfg := &config.Config{
+		BridgeID:        selectedBridge.ID,
+		BridgeURL:       bridgeURL,
+		ClientID:        creds.Username,
+		ClientKey:       creds.ClientKey,
+		CertFingerprint: selectedBridge.CertFingerprint,
+		VerifyBridgeCA:  verifyCA,
+		SecretStore:     flags.SecretStore,
+	}
+
+	fmt.Printf("Saving configuration to %q\n", cfgPath)
+
+	if flags.Force {
+		return replaceConfig(cfgPath, cfg)
+	}
+
+	if err = saveConfig(cfgPath, cfg); err != nil {
+		return fmt.Errorf("unable to save configuration: %w", err)
+	}
+
+	return nil
+}
+
+// replaceConfig saves the configuration in place of the one being
+// overwritten. Credentials of the previous configuration are only deleted
+// once the new ones are saved, so a failure loses neither of them, and old
+// users are not left in the keyring.
+func replaceConfig(path string, cfg *config.Config) error {
+	// There is nothing to delete without a readable configuration, which may
+	// be replaced precisely because it is broken.
+	old, err := config.Read()
+	if err != nil {
+		old = nil
+	}
+
+	// The new credentials must not be added to the previous secrets file,
+	// whose passphrase may be forgotten: set it aside until they are saved.
+	var backup string
+	if old != nil && old.SecretStore == config.SecretStoreFile {
+		secretsPath, err := config.SecretsPath()
+		if err != nil {
+			return err
+		}
+		if err = os.Rename(secretsPath, secretsPath+".old"); err == nil {
+			backup = secretsPath + ".old"
+		} else if !os.IsNotExist(err) {
+			return fmt.Errorf("unable to set previous credentials aside: %w", err)
+		}
+
+		defer func() {
+			if backup != "" {
+				_ = os.Rename(backup, secretsPath)
+			}
+		}()
+	}
+
+	if err = saveConfig(path, cfg); err != nil {
+		return fmt.Errorf("unable to save configuration: %w", err)
+	}
+
+	if backup != "" {
+		err = os.Remove(backup)
+		backup = ""
+	}
+	// Keyring entries of the same bridge were just replaced.
+	if old != nil && old.SecretStore == config.SecretStoreKeyring &&
+		(cfg.SecretStore != config.SecretStoreKeyring || cfg.BridgeID != old.BridgeID) {
+		err = old.DeleteSecrets(nil)
+	}
+	if err != nil {
+		return fmt.Errorf("configuration was saved but previous credentials could not be deleted from %s: %w", old.SecretStore, err)
+	}
+
+	return nil
+}
+
+// selectBridge returns the bridge at the given address, or the first bridge
+// found on the local network if it is empty.
+func selectBridge(httpClient *http.Client, addr string) (*hue.Bridge, error) {
+	if addr != "" {
+		b, err := hue.GetBridge(httpClient, addr)
+		if err != nil {
+			return nil, fmt.Errorf("unable to connect to bridge at %s: %w", addr, err)
+		}
+		if b.ID == "" {
+			return nil, fmt.Errorf("%s did not return a bridge ID, is it a Hue bridge?", addr)
+		}
+		return b, nil
+	}
+
+	fmt.Println("Searching for a Hue bridge on your local network...")
+
 	bridges, err := hue.DiscoverBridges(httpClient)
 	if err != nil {
-		return fmt.Errorf("unable to discover Hue bridges: %w", err)
+		return nil, fmt.Errorf("unable to discover Hue bridges: %w", err)
 	}
 
 	if len(bridges) == 0 {
-		return errors.New("no Hue bridge found on your local network")
+		return nil, errors.New("no Hue bridge found on your local network, use --bridge to give its address")
 	}
 
 	// TODO: if multiple bridges are found, ask the user which bridge the CLI should connect to.
-	selectedBridge := bridges[0]
+	if len(bridges) > 1 {
+		fmt.Printf("Found %d Hue bridges, use --bridge to select another one\n", len(bridges))
+	}
 
-	fmt.Printf("Found Hue bridge %q at: %s\n", selectedBridge.Name, selectedBridge.IPAddr)
-	fmt.Println("Registering new user, please press the button on the bridge then press `Enter`")
-	fmt.Scanln()
+	return &bridges[0], nil
+}
+
+// importUser checks the given user is registered on the bridge at the given
+// URL and returns its credentials.
+func importUser(httpClient *http.Client, bridgeURL, username, clientKey string) (*hue.Credentials, error) {
+	client := hue.NewClient(bridgeURL, username, hue.WithHTTPClient(httpClient))
+
+	cfg, err := client.Config()
+	if err != nil {
+		return nil, fmt.Errorf("unable to check user: %w", err)
+	}
+	if !cfg.Registered(username) {
+		return nil, fmt.Errorf("user %q is not registered on the bridge", username)
+	}
+
+	return &hue.Credentials{Username: username, ClientKey: clientKey}, nil
+}
+
+// regenerateClientKey registers a new user on the configured bridge and
+// replaces the credentials of the configuration with its own, as the client
+// key of an existing user can not be retrieved.
+func regenerateClientKey(cfgPath string, wait time.Duration) error {
+	if err := checkNoOverrides(); err != nil {
+		return err
+	}
+
+	cfg, err := readConfigFile()
+	if err != nil {
+		return err
+	}
+
+	u, err := url.Parse(cfg.BridgeURL)
+	if err != nil {
+		return fmt.Errorf("invalid bridge URL %q: %w", cfg.BridgeURL, err)
+	}
+
+	httpClient := bridgeHTTPClient(cfg.CertFingerprint, cfg.BridgeID, cfg.VerifyBridgeCA)
+	creds, err := registerUser(httpClient, u.Host, wait)
+	if err != nil {
+		return err
+	}
+
+	if creds.ClientKey == "" {
+		return errors.New("the bridge did not return a client key, its firmware may be too old to support entertainment streaming")
+	}
+
+	cfg.ClientID = creds.Username
+	cfg.ClientKey = creds.ClientKey
+
+	fmt.Printf("Saving configuration to %q\n", cfgPath)
+
+	if err = saveConfig(cfgPath, cfg); err != nil {
+		return fmt.Errorf("unable to save configuration: %w", err)
+	}
+
+	return nil
+}
+
+// bridgeHTTPClient returns an HTTP client verifying the certificate of the
+// bridge with the given ID against the given fingerprint and, if verifyCA is
+// set, the Hue root CA.
+func bridgeHTTPClient(fingerprint, bridgeID string, verifyCA bool) *http.Client {
+	verifier := &hue.CertVerifier{Fingerprint: fingerprint}
+	if verifyCA {
+		verifier.BridgeID = bridgeID
+	}
 
+	return &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: verifier.TLSConfig(),
+		},
+	}
+}
+
+// registerUser registers a new user on the bridge at the given address once
+// its button has been pressed. If wait is set, registration is retried until
+// the button is pressed, for up to wait, instead of asking to press Enter.
+func registerUser(httpClient *http.Client, addr string, wait time.Duration) (*hue.Credentials, error) {
 	deviceType := "huectl"
 	hn, err := os.Hostname()
 	if err == nil {
 		deviceType += "#" + hn
 	}
 
-	clientID, err := hue.RegisterUser(httpClient, selectedBridge.IPAddr, deviceType)
+	if wait == 0 {
+		fmt.Println("Registering new user, please press the button on the bridge then press `Enter`")
+		fmt.Scanln()
+
+		creds, err := hue.RegisterUser(httpClient, addr, deviceType)
+		if err != nil {
+			return nil, fmt.Errorf("unable to register new user: %w", err)
+		}
+		return creds, nil
+	}
+
+	fmt.Printf("Registering new user, please press the button on the bridge within %s\n", wait)
+
+	ctx, cancel := context.WithTimeout(context.Background(), wait)
+	defer cancel()
+
+	creds, err := hue.WaitRegisterUser(ctx, httpClient, addr, deviceType, linkButtonPollInterval)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil, fmt.Errorf("the button of the bridge was not pressed within %s", wait)
+	}
 	if err != nil {
-		return fmt.Errorf("unable to register new user: %w", err)
+		return nil, fmt.Errorf("unable to register new user: %w", err)
 	}
 
-	cfg := &config.Config{
-		BridgeID:        selectedBridge.ID,
-		BridgeURL:       fmt.Sprintf("https://%s", bridges[0].IPAddr),
-		ClientID:        clientID,
-		CertFingerprint: selectedBridge.CertFingerprint,
+	return creds, nil
+}
+
+// checkSecretStore checks the given secret store can be used.
+func checkSecretStore(name, bridgeID string) error {
+	// The encrypted file can always be created, only check the keyring is
+	// available.
+	if name != config.SecretStoreKeyring {
+		return nil
 	}
 
-	fmt.Printf("Saving configuration to %q\n", cfgPath)
+	store, err := config.OpenSecretStore(name, bridgeID, nil)
+	if err != nil {
+		return err
+	}
 
-	if err = saveConfig(cfgPath, cfg); err != nil {
-		return fmt.Errorf("unable to save configuration: %w", err)
+	if _, err = store.Get(config.SecretClientID); err != nil && !errors.Is(err, config.ErrSecretNotFound) {
+		return fmt.Errorf("%w; use --secret-store=file if this system has no keyring", err)
 	}
 
 	return nil
 }
 
+// saveConfig writes the configuration to the given path, and its credentials
+// to its secret store.
 func saveConfig(path string, cfg *config.Config) error {
+	// Ask to confirm the passphrase when creating the secrets file, a typo
+	// would make it impossible to decrypt.
+	secretsPath, err := config.SecretsPath()
+	if err != nil {
+		return err
+	}
+	_, err = os.Stat(secretsPath)
+
+	fileCfg, err := cfg.SaveSecrets(passphrasePrompt(os.IsNotExist(err)))
+	if err != nil {
+		return fmt.Errorf("unable to store credentials: %w", err)
+	}
+
+	return writeConfigFile(path, fileCfg)
+}
+
+// writeConfigFile writes the configuration to the given path as is, leaving
+// its secret store untouched.
+func writeConfigFile(path string, cfg *config.Config) error {
 	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
 		return fmt.Errorf("unable to create configuration directory: %w", err)
 	}
@@ -95,10 +413,17 @@ func saveConfig(path string, cfg *config.Config) error {
 	if err != nil {
 		return fmt.Errorf("unable to create configuration file: %w", err)
 	}
+	defer f.Close()
+
+	// The configuration may hold credentials, make sure it is only readable by
+	// its owner even if the file was created with other permissions.
+	if err = f.Chmod(0600); err != nil {
+		return fmt.Errorf("unable to set permissions of configuration file: %w", err)
+	}
 
 	if err = yaml.NewEncoder(f).Encode(cfg); err != nil {
 		return fmt.Errorf("unable to serialize configuration: %w", err)
 	}
 
-	return nil
+	return f.Close()
 }
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/skwair/harmony/optional"
+	"github.com/skwair/huectl/pkg/hue"
+	"github.com/spf13/cobra"
+)
+
+const defaultBrightnessStep = 10
+
+func newDimLightCmd() *cobra.Command {
+	return newAdjustBrightnessCmd("dim", "Decrease the brightness of lights", -1)
+}
+
+func newBrightenLightCmd() *cobra.Command {
+	return newAdjustBrightnessCmd("brighten", "Increase the brightness of lights", 1)
+}
+
+// newAdjustBrightnessCmd returns a command changing the brightness of lights
+// by a percentage, in the direction given by sign.
+func newAdjustBrightnessCmd(use, short string, sign int) *cobra.Command {
+	var (
+		step        int
+		parallelism int
+	)
+
+	cmd := &cobra.Command{
+		Use:               use + " ID|NAME... [flags]",
+		Short:             short,
+		Example:           fmt.Sprintf("\thuectl light %s 1 2 --by=20", use),
+		Args:              expectLightID(),
+		ValidArgsFunction: completeLightIDs,
+		Run: func(_ *cobra.Command, args []string) {
+			must(runAdjustBrightnessCmd(args, sign*step, parallelism))
+		},
+	}
+
+	cmd.Flags().IntVar(&step, "by", defaultBrightnessStep, "Brightness percentage to change the lights by")
+	cmd.Flags().IntVarP(&parallelism, "parallel", "p", hue.DefaultBatchParallelism, "Maximum number of lights updated concurrently")
+
+	return cmd
+}
+
+func runAdjustBrightnessCmd(args []string, percent, parallelism int) error {
+	client, err := setupClient()
+	if err != nil {
+		return fmt.Errorf("unable to setup Hue client: %w", err)
+	}
+
+	ids, err := resolveLightIDs(client, args)
+	if err != nil {
+		return err
+	}
+
+	req := &hue.SetLightStateRequest{
+		BriInc: optional.NewInt(briFromPercent(percent)),
+	}
+	results := client.SetLightsState(ids, req, hue.WithParallelism(parallelism))
+
+	return reportBatch(ids, results)
+}
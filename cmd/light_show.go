@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"text/tabwriter"
+
+	"github.com/skwair/huectl/pkg/hue"
+	"github.com/spf13/cobra"
+)
+
+func newShowLightCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:               "show ID|NAME",
+		Aliases:           []string{"get"},
+		Short:             "Show detailed information about a light",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeLightIDs,
+		Run:               func(_ *cobra.Command, args []string) { must(runShowLightCmd(args[0])) },
+	}
+}
+
+func runShowLightCmd(ref string) error {
+	client, err := setupClient()
+	if err != nil {
+		return fmt.Errorf("unable to setup Hue client: %w", err)
+	}
+
+	ids, err := resolveLightIDs(client, []string{ref})
+	if err != nil {
+		return err
+	}
+
+	light, err := client.Light(ids[0])
+	if err != nil {
+		return fmt.Errorf("unable to get light %q: %w", ref, err)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 4, ' ', 0)
+	defer tw.Flush()
+
+	printLight(tw, light)
+
+	return nil
+}
+
+func printLight(tw *tabwriter.Writer, light *hue.Light) {
+	fmt.Fprintf(tw, "ID:\t%s\n", light.ID)
+	fmt.Fprintf(tw, "Name:\t%s\n", light.Name)
+	fmt.Fprintf(tw, "Type:\t%s\n", light.Type)
+	fmt.Fprintf(tw, "Product:\t%s (%s)\n", light.ProductName, light.ModelID)
+	fmt.Fprintf(tw, "Software version:\t%s\n", light.SoftWareVersion)
+	fmt.Fprintf(tw, "Reachable:\t%t\n", light.State.Reachable)
+	fmt.Fprintf(tw, "On:\t%t\n", light.State.On)
+
+	if light.IsDimmable() {
+		bri := math.Round(float64(light.State.Bri) / 254 * 100)
+		fmt.Fprintf(tw, "Brightness (%%):\t%d\n", int(bri))
+	}
+
+	if light.SupportsColor() {
+		fmt.Fprintf(tw, "Color mode:\t%s\n", light.State.ColorMode)
+		fmt.Fprintf(tw, "Hue:\t%d\n", light.State.Hue)
+		fmt.Fprintf(tw, "Saturation:\t%d\n", light.State.Sat)
+		fmt.Fprintf(tw, "XY:\t%g,%g\n", light.State.XY[0], light.State.XY[1])
+		fmt.Fprintf(tw, "Effect:\t%s\n", light.State.Effect)
+	}
+
+	if light.SupportsColorTemperature() {
+		ct := light.Capabilities.Control.Ct
+		fmt.Fprintf(tw, "Color temperature (mired):\t%d (%d-%d)\n", light.State.CT, ct.Min, ct.Max)
+	}
+}
@@ -4,74 +4,350 @@ import (
 	"errors"
 	"fmt"
 	"math"
-	"os"
+	"time"
 
 	"github.com/skwair/harmony/optional"
+	"github.com/skwair/huectl/pkg/colors"
 	"github.com/skwair/huectl/pkg/hue"
+	"github.com/skwair/huectl/pkg/palette"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 type setLightStateFlags struct {
 	On         bool
-	Brightness int
-	Hue        int
+	Off        bool
+	Brightness adjustableInt
+	Hue        adjustableInt
+	Saturation adjustableInt
+	CT         adjustableInt
+	XY         xyValue
+	Color      string
+	FromImage  string
+	Effect     *enumValue
+	Alert      *enumValue
+	Transition time.Duration
+
+	Strictness  *enumValue
+	Parallelism int
 }
 
+// stateFlags are the flags of the set command describing a light state.
+var stateFlags = []string{"on", "off", "bri", "hue", "sat", "ct", "xy", "color", "from-image", "effect", "alert", "transition"}
+
 const setLightStateExample = `
 	# Switch on the light 1 and set its brightness to 75%
 	huectl light set 1 --on --bri=75
 
+	# Lights can also be referred to by name
+	huectl light set Kitchen Desk --off
+
+	# Groups are expanded to their lights
+	huectl light set "Living room" --bri=50
+
 	# Set the color of the light 3 to blue
-	huectl light set 3 --hue=46920`
+	huectl light set 3 --hue=46920
+
+	# Dim the light 2 by 20% and make it a bit warmer
+	huectl light set 2 --bri=-20 --ct=+50
+
+	# Slowly switch off the lights 1 and 2
+	huectl light set 1 2 --off --transition=10s
+
+	# Make the light 4 blink once
+	huectl light set 4 --alert=select
+
+	# Set the light 5 to orange
+	huectl light set 5 --color=orange
+
+	# Set all lights to red, using a warm white on white ambiance lights
+	huectl light set 1 2 3 4 --hue=0 --strictness=convert
+
+	# Give lights the dominant colors of a picture
+	huectl light set 1 2 3 --from-image poster.jpg
+
+	# Give the lights of a room the dominant colors of a picture
+	huectl light set "Living room" --from-image poster.jpg`
 
 func newSetLightStateCmd() *cobra.Command {
-	var flags setLightStateFlags
+	flags := setLightStateFlags{
+		Effect: newEnumValue("colorloop", "none"),
+		Alert:  newEnumValue("select", "lselect", "none"),
+		Strictness: &enumValue{
+			value:   "reject",
+			allowed: []string{"reject", "clamp", "convert"},
+		},
+	}
 
 	cmd := &cobra.Command{
-		Use:     "set ID [flags]",
-		Short:   "Set the state of lights",
-		Example: setLightStateExample,
-		Args:    expectLightID(),
-		Run:     func(cmd *cobra.Command, args []string) { must(runSetLightStateCmd(cmd, args, &flags)) },
+		Use:               "set ID|NAME|GROUP... [flags]",
+		Short:             "Set the state of lights",
+		Example:           setLightStateExample,
+		Args:              expectLightID(),
+		ValidArgsFunction: completeLightIDs,
+		Run:               func(cmd *cobra.Command, args []string) { must(runSetLightStateCmd(cmd, args, &flags)) },
 	}
 
 	cmd.Flags().BoolVar(&flags.On, "on", false, "Sets the on/off state of the light")
-	cmd.Flags().IntVar(&flags.Brightness, "bri", 0, "Brightness percentage to set the light to")
-	cmd.Flags().IntVar(&flags.Hue, "hue", 0, "Color to set the light to, ranges from 0 to 65535")
+	cmd.Flags().BoolVar(&flags.Off, "off", false, "Switches the light off, same as --on=false")
+	cmd.Flags().Var(&flags.Brightness, "bri", "Brightness percentage to set the light to, or to add or remove if signed")
+	cmd.Flags().Var(&flags.Hue, "hue", "Color to set the light to, ranges from 0 to 65535, or to shift the current color by if signed")
+	cmd.Flags().Var(&flags.Saturation, "sat", "Saturation to set the light to, ranges from 0 to 254, or to shift the current saturation by if signed")
+	cmd.Flags().Var(&flags.CT, "ct", "Color temperature to set the light to in mireds, or to shift the current temperature by if signed (alias: --mired)")
+	cmd.Flags().Var(&flags.XY, "xy", "Color to set the light to, as CIE xy coordinates")
+	cmd.Flags().StringVar(&flags.Color, "color", "", "Color to set the light to, as a name (e.g. orange) or a hex code (e.g. #ffa500)")
+	cmd.Flags().StringVar(&flags.FromImage, "from-image", "", "Image whose dominant colors to give lights, each light getting a different one")
+	cmd.Flags().Var(flags.Effect, "effect", "Dynamic effect of the light")
+	cmd.Flags().Var(flags.Alert, "alert", "Alert effect of the light: a single (select) or 15 seconds of (lselect) breathe cycles")
+	cmd.Flags().DurationVar(&flags.Transition, "transition", 0, "Duration of the transition to the new state, with a precision of 100ms")
+	cmd.Flags().Var(flags.Strictness, "strictness", "What to do with values a light does not support: reject them, clamp them to its limits or convert colors to ones it can display")
+	cmd.Flags().IntVarP(&flags.Parallelism, "parallel", "p", hue.DefaultBatchParallelism, "Maximum number of lights updated concurrently")
+
+	_ = cmd.RegisterFlagCompletionFunc("color", completeColorNames)
+	_ = cmd.RegisterFlagCompletionFunc("from-image", completeImageFiles)
+	registerEnumCompletion(cmd, "effect", flags.Effect)
+	registerEnumCompletion(cmd, "alert", flags.Alert)
+	registerEnumCompletion(cmd, "strictness", flags.Strictness)
+
+	cmd.Flags().SetNormalizeFunc(func(_ *pflag.FlagSet, name string) pflag.NormalizedName {
+		if name == "mired" {
+			name = "ct"
+		}
+		return pflag.NormalizedName(name)
+	})
 
 	return cmd
 }
 
 func runSetLightStateCmd(cmd *cobra.Command, args []string, flags *setLightStateFlags) error {
-	if cmd.Flags().NFlag() == 0 {
+	if !stateFlagsChanged(cmd) {
 		return errors.New("no flags provided; nothing to do")
 	}
 
+	req, err := lightStateRequest(cmd, flags)
+	if err != nil {
+		return err
+	}
+
+	strictness, err := hue.ParseStrictness(flags.Strictness.value)
+	if err != nil {
+		return err
+	}
+
 	client, err := setupClient()
 	if err != nil {
 		return fmt.Errorf("unable to setup Hue client: %w", err)
 	}
 
-	for _, arg := range args {
-		var req hue.SetLightStateRequest
-		if cmd.Flags().Changed("on") {
-			req.On = optional.NewBool(flags.On)
+	ids, err := resolveLightOrGroupIDs(client, args)
+	if err != nil {
+		return err
+	}
+
+	// Capabilities of lights rarely change, check updates against the cached
+	// inventory rather than fetching lights again.
+	lights, err := inventoryLights(client, ids)
+	if err != nil {
+		return err
+	}
+
+	var imageReqs map[string]*hue.SetLightStateRequest
+	if cmd.Flags().Changed("from-image") {
+		if imageReqs, err = imageStateRequests(flags.FromImage, ids, lights, req); err != nil {
+			return err
 		}
+	}
 
-		if cmd.Flags().Changed("bri") {
-			bri := math.Round(254.0 / 100.0 * float64(flags.Brightness))
-			req.Bri = optional.NewInt(int(bri))
+	// Check the update is supported by each light before sending anything,
+	// the errors returned by the bridge otherwise are quite unhelpful.
+	reqs := make(map[string]*hue.SetLightStateRequest, len(ids))
+	rejected := make(map[string]hue.BatchResult)
+	for _, id := range ids {
+		light := hue.FindLight(lights, id)
+		if light == nil {
+			// Let the bridge report unknown lights.
+			reqs[id] = req
+			continue
 		}
 
-		if cmd.Flags().Changed("hue") {
-			req.Hue = optional.NewInt(flags.Hue)
+		lightReq := req
+		if imageReqs != nil {
+			lightReq = imageReqs[id]
 		}
 
-		if err = client.SetLightState(arg, &req); err != nil {
-			fmt.Fprintf(os.Stderr, "unable to toggle light %q: %v\n", arg, err)
+		validated, adjustments, err := hue.ValidateLightState(light, lightReq, strictness)
+		if err != nil {
+			rejected[id] = hue.BatchResult{Err: err}
 			continue
 		}
+
+		for _, adj := range adjustments {
+			fmt.Printf("light %s: %s\n", id, adj)
+		}
+		reqs[id] = validated
+	}
+
+	results := client.SetLightStates(reqs, hue.WithParallelism(flags.Parallelism))
+	for id, res := range rejected {
+		results[id] = res
+	}
+
+	return reportBatch(ids, results)
+}
+
+// lightStateRequest builds a state update from the flags that were set.
+func lightStateRequest(cmd *cobra.Command, flags *setLightStateFlags) (*hue.SetLightStateRequest, error) {
+	changed := cmd.Flags().Changed
+
+	var req hue.SetLightStateRequest
+	switch {
+	case changed("on") && changed("off"):
+		return nil, errors.New("--on and --off are mutually exclusive")
+	case changed("on"):
+		req.On = optional.NewBool(flags.On)
+	case changed("off"):
+		req.On = optional.NewBool(!flags.Off)
+	}
+
+	if changed("bri") {
+		bri := briFromPercent(flags.Brightness.value)
+		if flags.Brightness.relative {
+			req.BriInc = optional.NewInt(bri)
+		} else {
+			req.Bri = optional.NewInt(bri)
+		}
+	}
+
+	if changed("hue") {
+		if flags.Hue.relative {
+			req.HueInc = optional.NewInt(flags.Hue.value)
+		} else {
+			req.Hue = optional.NewInt(flags.Hue.value)
+		}
+	}
+
+	if changed("sat") {
+		if flags.Saturation.relative {
+			req.SatInc = optional.NewInt(flags.Saturation.value)
+		} else {
+			req.Sat = optional.NewInt(flags.Saturation.value)
+		}
 	}
 
-	return nil
+	if changed("ct") {
+		if flags.CT.relative {
+			req.CTInc = optional.NewInt(flags.CT.value)
+		} else {
+			req.CT = optional.NewInt(flags.CT.value)
+		}
+	}
+
+	if changed("xy") {
+		xy := [2]float32(flags.XY)
+		req.XY = &xy
+	}
+
+	if changed("color") {
+		if changed("xy") {
+			return nil, errors.New("--color and --xy are mutually exclusive")
+		}
+
+		c, err := colors.Parse(flags.Color)
+		if err != nil {
+			return nil, err
+		}
+
+		xy := hue.RGBToXY(c.R, c.G, c.B)
+		req.XY = &[2]float32{float32(xy[0]), float32(xy[1])}
+	}
+
+	if changed("from-image") {
+		for _, name := range []string{"hue", "sat", "ct", "xy", "color"} {
+			if changed(name) {
+				return nil, fmt.Errorf("--from-image and --%s are mutually exclusive", name)
+			}
+		}
+	}
+
+	if changed("effect") {
+		req.Effect = optional.NewString(flags.Effect.value)
+	}
+
+	if changed("alert") {
+		req.Alert = optional.NewString(flags.Alert.value)
+	}
+
+	if changed("transition") {
+		ds, err := deciseconds(flags.Transition)
+		if err != nil {
+			return nil, err
+		}
+		req.TransitionTime = optional.NewInt(ds)
+	}
+
+	return &req, nil
+}
+
+// imageStateRequests returns the updates giving each of the given lights a
+// different dominant color of an image, keeping the other attributes of req.
+func imageStateRequests(path string, ids []string, lights []hue.Light, req *hue.SetLightStateRequest) (map[string]*hue.SetLightStateRequest, error) {
+	img, err := palette.Load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []hue.Light
+	for _, id := range ids {
+		if l := hue.FindLight(lights, id); l != nil {
+			targets = append(targets, *l)
+		}
+	}
+
+	reqs, err := palette.Assign(palette.Extract(img, len(targets)), targets)
+	if err != nil {
+		return nil, err
+	}
+
+	// Attributes given explicitly take precedence over the ones of the image,
+	// e.g. to dim the colors with --bri.
+	for _, r := range reqs {
+		if req.On != nil {
+			r.On = req.On
+		}
+		if req.Bri != nil || req.BriInc != nil {
+			r.Bri, r.BriInc = req.Bri, req.BriInc
+		}
+		r.Effect, r.Alert, r.TransitionTime = req.Effect, req.Alert, req.TransitionTime
+	}
+
+	return reqs, nil
+}
+
+// deciseconds converts a transition duration to the multiple of 100ms
+// expected by the bridge.
+func deciseconds(d time.Duration) (int, error) {
+	ds := int(math.Round(d.Seconds() * 10))
+	if ds < 0 || ds > math.MaxUint16 {
+		return 0, fmt.Errorf("transition must be between 0s and %s", time.Duration(math.MaxUint16)*100*time.Millisecond)
+	}
+
+	return ds, nil
+}
+
+// stateFlagsChanged reports whether at least one flag describing a light state
+// was set, ignoring flags that only tune how the update is sent.
+func stateFlagsChanged(cmd *cobra.Command) bool {
+	for _, name := range stateFlags {
+		if cmd.Flags().Changed(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// briFromPercent converts a brightness percentage to the 0-254 scale used by
+// the bridge. Negative percentages are preserved for relative adjustments.
+func briFromPercent(percent int) int {
+	return int(math.Round(254.0 / 100.0 * float64(percent)))
 }
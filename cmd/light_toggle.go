@@ -2,32 +2,39 @@ package cmd
 
 import (
 	"fmt"
-	"os"
 
+	"github.com/skwair/huectl/pkg/hue"
 	"github.com/spf13/cobra"
 )
 
 func newToggleLightCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   "toggle",
-		Short: "Toggle lights",
-		Args:  expectLightID(),
-		Run:   func(_ *cobra.Command, args []string) { must(runLightToggleCmd(args)) },
+	var parallelism int
+
+	cmd := &cobra.Command{
+		Use:               "toggle ID|NAME...",
+		Short:             "Toggle lights",
+		Args:              expectLightID(),
+		ValidArgsFunction: completeLightIDs,
+		Run:               func(_ *cobra.Command, args []string) { must(runLightToggleCmd(args, parallelism)) },
 	}
+
+	cmd.Flags().IntVarP(&parallelism, "parallel", "p", hue.DefaultBatchParallelism, "Maximum number of lights toggled concurrently")
+
+	return cmd
 }
 
-func runLightToggleCmd(args []string) error {
+func runLightToggleCmd(args []string, parallelism int) error {
 	client, err := setupClient()
 	if err != nil {
 		return fmt.Errorf("unable to setup Hue client: %w", err)
 	}
 
-	for _, arg := range args {
-		if err = client.ToggleLight(arg); err != nil {
-			fmt.Fprintf(os.Stderr, "unable to toggle light %q: %v\n", arg, err)
-			continue
-		}
+	ids, err := resolveLightIDs(client, args)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	results := client.ToggleLights(ids, hue.WithParallelism(parallelism))
+
+	return reportBatch(ids, results)
 }
@@ -5,7 +5,9 @@ import (
 	"math"
 	"os"
 	"text/tabwriter"
+	"time"
 
+	"github.com/skwair/huectl/pkg/hue"
 	"github.com/spf13/cobra"
 )
 
@@ -16,29 +18,50 @@ func newLightsCmd() *cobra.Command {
 		Short:   "Manage Hue light bulbs",
 		Args:    cobra.NoArgs,
 		// If called with no sub-command, list lights instead of printing help.
-		Run: func(*cobra.Command, []string) { must(runListLightsCmd()) },
+		Run: func(*cobra.Command, []string) { must(runListLightsCmd(false)) },
 	}
 }
 
 func newListLightsCmd() *cobra.Command {
-	return &cobra.Command{
+	var offline bool
+
+	cmd := &cobra.Command{
 		Use:     "list",
 		Aliases: []string{"ls"},
 		Short:   "List available lights",
 		Args:    cobra.NoArgs,
-		Run:     func(*cobra.Command, []string) { must(runListLightsCmd()) },
+		Run:     func(*cobra.Command, []string) { must(runListLightsCmd(offline)) },
 	}
+
+	cmd.Flags().BoolVar(&offline, "offline", false, "List lights from the local cache instead of querying the bridge")
+
+	return cmd
 }
 
-func runListLightsCmd() error {
-	client, err := setupClient()
-	if err != nil {
-		return fmt.Errorf("unable to setup Hue client: %w", err)
-	}
+func runListLightsCmd(offline bool) error {
+	var lights []hue.Light
+	if offline {
+		c, err := setupCache(inventoryCacheTTL)
+		if err != nil {
+			return err
+		}
+
+		inv, err := c.Load()
+		if err != nil {
+			return fmt.Errorf("unable to load cached lights: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Showing lights cached %s ago\n", inv.Age().Round(time.Second))
+
+		lights = inv.Lights
+	} else {
+		client, err := setupClient()
+		if err != nil {
+			return fmt.Errorf("unable to setup Hue client: %w", err)
+		}
 
-	lights, err := client.Lights()
-	if err != nil {
-		return fmt.Errorf("unable to list lights: %w", err)
+		if lights, err = client.Lights(); err != nil {
+			return fmt.Errorf("unable to list lights: %w", err)
+		}
 	}
 
 	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 4, ' ', 0)
@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/skwair/huectl/pkg/mqtt"
+	"github.com/spf13/cobra"
+)
+
+type mqttFlags struct {
+	Broker          string
+	Username        string
+	Password        string
+	ClientID        string
+	Prefix          string
+	DiscoveryPrefix string
+	NoDiscovery     bool
+	Interval        time.Duration
+}
+
+const mqttExample = `
+	# Publish to a local Mosquitto broker, with Home Assistant discovery
+	huectl mqtt --broker tcp://localhost:1883
+
+	# Watch states and turn a light on
+	mosquitto_sub -t 'huectl/#' -v
+	mosquitto_pub -t huectl/<bridge ID>/light/1/set -m '{"state": "ON", "brightness": 127}'`
+
+func newMQTTCmd() *cobra.Command {
+	var flags mqttFlags
+
+	cmd := &cobra.Command{
+		Use:   "mqtt",
+		Short: "Bridges lights and sensors to an MQTT broker",
+		Long: `Publishes the state of lights and sensors to an MQTT broker and controls lights
+from the commands received on MQTT topics. Topics are rooted at <prefix>/<bridge ID>:
+
+  <root>/status                   "online" or "offline"
+  <root>/light/<id>/state         state of a light
+  <root>/light/<id>/availability  "offline" when the light is unreachable
+  <root>/light/<id>/set           commands for a light
+  <root>/sensor/<id>/state        state of a sensor
+
+States and commands of lights use the JSON schema of Home Assistant MQTT lights,
+e.g. {"state": "ON", "brightness": 254, "color_temp": 366, "transition": 2}.
+Home Assistant MQTT discovery configs are published as well, so lights and
+sensors show up in Home Assistant without any configuration.
+
+The password of the broker can also be set with the HUECTL_MQTT_PASSWORD
+environment variable.`,
+		Example: mqttExample,
+		Args:    cobra.NoArgs,
+		Run:     func(*cobra.Command, []string) { must(runMQTTCmd(&flags)) },
+	}
+
+	cmd.Flags().StringVar(&flags.Broker, "broker", "tcp://localhost:1883", "URL of the MQTT broker (tcp://, ssl:// or ws://)")
+	cmd.Flags().StringVar(&flags.Username, "username", "", "Username to connect to the broker")
+	cmd.Flags().StringVar(&flags.Password, "password", "", "Password to connect to the broker")
+	cmd.Flags().StringVar(&flags.ClientID, "client-id", "", "MQTT client ID (default huectl-<bridge ID>)")
+	cmd.Flags().StringVar(&flags.Prefix, "prefix", mqtt.DefaultPrefix, "Prefix of state and command topics")
+	cmd.Flags().StringVar(&flags.DiscoveryPrefix, "discovery-prefix", mqtt.DefaultDiscoveryPrefix, "Prefix of Home Assistant discovery topics")
+	cmd.Flags().BoolVar(&flags.NoDiscovery, "no-discovery", false, "Do not publish Home Assistant discovery configs")
+	cmd.Flags().DurationVar(&flags.Interval, "interval", mqtt.DefaultInterval, "How often to poll the bridge for state changes")
+
+	return cmd
+}
+
+func runMQTTCmd(flags *mqttFlags) error {
+	if flags.Interval <= 0 {
+		return fmt.Errorf("interval must be positive, got %s", flags.Interval)
+	}
+
+	cfg, err := readConfig()
+	if err != nil {
+		return err
+	}
+
+	client, err := setupDirectClient()
+	if err != nil {
+		return fmt.Errorf("unable to setup Hue client: %w", err)
+	}
+
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+
+	opts := []mqtt.Option{
+		mqtt.WithPrefix(flags.Prefix),
+		mqtt.WithDiscoveryPrefix(flags.DiscoveryPrefix),
+		mqtt.WithInterval(flags.Interval),
+		mqtt.WithLogger(logger),
+	}
+	if flags.NoDiscovery {
+		opts = append(opts, mqtt.WithoutDiscovery())
+	}
+
+	clientID := flags.ClientID
+	if clientID == "" {
+		clientID = "huectl-" + cfg.BridgeID
+	}
+
+	password := flags.Password
+	if password == "" {
+		password = os.Getenv("HUECTL_MQTT_PASSWORD")
+	}
+
+	mqttOpts := paho.NewClientOptions().
+		AddBroker(flags.Broker).
+		SetClientID(clientID).
+		SetUsername(flags.Username).
+		SetPassword(password).
+		SetAutoReconnect(true).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			logger.Printf("Connection to the MQTT broker lost: %v", err)
+		})
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	logger.Printf("Publishing to %s", flags.Broker)
+
+	err = mqtt.New(client, cfg.BridgeID, opts...).Run(ctx, mqttOpts)
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+
+	return err
+}
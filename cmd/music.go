@@ -0,0 +1,287 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/skwair/huectl/pkg/entertainment"
+	"github.com/skwair/huectl/pkg/hue"
+	"github.com/skwair/huectl/pkg/music"
+	"github.com/spf13/cobra"
+)
+
+type musicFlags struct {
+	Input       string
+	Format      string
+	Rate        int
+	Channels    int
+	Group       string
+	Preset      string
+	Sensitivity float64
+	Stream      bool
+	RateLimit   int
+}
+
+// pulseMonitorInput is the input capturing what is played on the default
+// PulseAudio (or PipeWire) output.
+const pulseMonitorInput = "pulse-monitor"
+
+// rawFormats are the raw PCM formats accepted by --format, named as by
+// parec and ffmpeg.
+var rawFormats = map[string]music.Format{
+	"u8":    {BitsPerSample: 8},
+	"s16le": {BitsPerSample: 16},
+	"s24le": {BitsPerSample: 24},
+	"s32le": {BitsPerSample: 32},
+	"f32le": {BitsPerSample: 32, Float: true},
+}
+
+const musicExample = `
+	# Make the living room react to what is playing on this computer
+	huectl music --input pulse-monitor --group "Living room"
+
+	# Play a file along with its light show
+	aplay song.wav & huectl music --input song.wav --group "Living room" --preset beats
+
+	# Stream raw audio decoded by ffmpeg to an entertainment group
+	ffmpeg -i song.mp3 -f s16le -ac 2 -ar 44100 - | huectl music --input - --group TV --stream`
+
+func newMusicCmd() *cobra.Command {
+	var flags musicFlags
+
+	cmd := &cobra.Command{
+		Use:   "music",
+		Short: "Makes lights react to music",
+		Long: `Analyzes audio and makes the lights of a group react to it: its loudness,
+bass, mids, treble and beats are mapped to colors by a preset, see
+"huectl music presets" for the available ones.
+
+Audio is read from the file given to --input, from the standard input if "-",
+or from what is playing on the default output with "pulse-monitor", which
+requires parec. WAV files are detected from their header; anything else is
+read as raw PCM whose format is given by --format, --rate and --channels.
+Files are played in real time so lights follow the music when it is played
+at the same time.
+
+By default, lights are updated through the REST API of the bridge, which only
+allows a few updates per second shared between lights. With --stream, the
+group must be an entertainment group, created with "huectl entertainment
+create", and lights are all updated 50 times per second.
+
+Lights are restored to the state they were in before starting at the end of
+the audio or when interrupted.`,
+		Example: musicExample,
+		Args:    cobra.NoArgs,
+		Run:     func(*cobra.Command, []string) { must(runMusicCmd(&flags)) },
+	}
+
+	cmd.Flags().StringVarP(&flags.Input, "input", "i", "", `Audio to play: a WAV or raw PCM file, "-" for the standard input or "pulse-monitor"`)
+	cmd.Flags().StringVar(&flags.Format, "format", "s16le", "Format of raw PCM samples, one of: u8, s16le, s24le, s32le, f32le")
+	cmd.Flags().IntVar(&flags.Rate, "rate", music.DefaultFormat.SampleRate, "Sample rate of raw PCM audio in Hz")
+	cmd.Flags().IntVar(&flags.Channels, "channels", music.DefaultFormat.Channels, "Number of channels of raw PCM audio")
+	cmd.Flags().StringVarP(&flags.Group, "group", "g", "", "Group whose lights react to the music, by ID or name")
+	cmd.Flags().StringVarP(&flags.Preset, "preset", "p", "pulse", "Preset mapping music to colors")
+	cmd.Flags().Float64Var(&flags.Sensitivity, "sensitivity", music.DefaultSensitivity, "Ratio to the recent bass level above which a beat is detected, lower to detect more beats")
+	cmd.Flags().BoolVar(&flags.Stream, "stream", false, "Use entertainment streaming instead of the REST API")
+	cmd.Flags().IntVar(&flags.RateLimit, "rate-limit", music.DefaultRESTRate, "Maximum number of light updates sent per second through the REST API")
+
+	_ = cmd.MarkFlagRequired("input")
+	_ = cmd.MarkFlagRequired("group")
+	_ = cmd.RegisterFlagCompletionFunc("group", completeGroups())
+	_ = cmd.RegisterFlagCompletionFunc("preset", completeMusicPresets)
+
+	cmd.AddCommand(newListMusicPresetsCmd())
+
+	return cmd
+}
+
+func newListMusicPresetsCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "presets",
+		Short: "Lists available presets",
+		Args:  cobra.NoArgs,
+		Run:   func(*cobra.Command, []string) { must(runListMusicPresetsCmd()) },
+	}
+}
+
+func runMusicCmd(flags *musicFlags) error {
+	preset, err := music.NewPreset(flags.Preset)
+	if err != nil {
+		return err
+	}
+
+	raw, ok := rawFormats[flags.Format]
+	if !ok {
+		return fmt.Errorf("unknown format %q", flags.Format)
+	}
+	raw.SampleRate = flags.Rate
+	raw.Channels = flags.Channels
+
+	client, err := setupDirectClient()
+	if err != nil {
+		return fmt.Errorf("unable to setup Hue client: %w", err)
+	}
+
+	groups, err := client.Groups()
+	if err != nil {
+		return fmt.Errorf("unable to list groups: %w", err)
+	}
+	group := hue.FindGroup(groups, flags.Group)
+	if group == nil {
+		return fmt.Errorf("unknown group %q", flags.Group)
+	}
+
+	lights, err := effectLights(client, nil, []string{group.ID})
+	if err != nil {
+		return err
+	}
+	if len(lights) == 0 {
+		return fmt.Errorf("group %q has no lights", group.Name)
+	}
+
+	input, closeInput, err := openMusicInput(flags.Input, raw)
+	if err != nil {
+		return err
+	}
+	defer closeInput()
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+
+	var (
+		output music.Output
+		stream *entertainment.Streamer
+	)
+	if flags.Stream {
+		ids := make([]int, 0, len(group.Lights))
+		for _, id := range group.Lights {
+			n, err := strconv.Atoi(id)
+			if err != nil {
+				return fmt.Errorf("invalid light ID %q", id)
+			}
+			ids = append(ids, n)
+		}
+
+		if stream, err = openMusicStream(ctx, client, group); err != nil {
+			return err
+		}
+		output = music.NewStreamOutput(stream, ids)
+	} else {
+		output = music.NewRESTOutput(client, lights, flags.RateLimit, logger)
+	}
+
+	player := music.NewPlayer(input, preset, output, music.WithSensitivity(flags.Sensitivity))
+	err = player.Run(ctx)
+
+	// Stop streaming before restoring lights, the bridge ignores REST
+	// updates to the lights of a group while streaming to it.
+	if stream != nil {
+		if cerr := stream.Close(); cerr != nil {
+			logger.Printf("Unable to stop streaming: %v", cerr)
+		}
+	}
+
+	for i := range lights {
+		l := &lights[i]
+		if _, rerr := client.SetLightState(l.ID, l.RestoreRequest()); rerr != nil {
+			logger.Printf("Unable to restore light %s: %v", l.Name, rerr)
+		}
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+
+	return err
+}
+
+// openMusicInput opens the given audio input, returning a function releasing
+// it once done.
+func openMusicInput(input string, raw music.Format) (*music.Reader, func(), error) {
+	var (
+		r       io.Reader
+		closeFn = func() {}
+	)
+
+	switch input {
+	case "-":
+		r = os.Stdin
+	case pulseMonitorInput:
+		cmd := exec.Command("parec",
+			"--device=@DEFAULT_MONITOR@",
+			"--format=s16le",
+			"--rate="+strconv.Itoa(music.DefaultFormat.SampleRate),
+			"--channels="+strconv.Itoa(music.DefaultFormat.Channels),
+		)
+		cmd.Stderr = os.Stderr
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to capture audio: %w", err)
+		}
+		if err = cmd.Start(); err != nil {
+			return nil, nil, fmt.Errorf("unable to capture audio, is parec installed? %w", err)
+		}
+		r = stdout
+		raw = music.DefaultFormat
+		closeFn = func() {
+			_ = cmd.Process.Kill()
+			_ = cmd.Wait()
+		}
+	default:
+		f, err := os.Open(input)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to open input: %w", err)
+		}
+		r = f
+		closeFn = func() { _ = f.Close() }
+	}
+
+	reader, err := music.NewReader(r, raw)
+	if err != nil {
+		closeFn()
+		return nil, nil, fmt.Errorf("unable to read audio: %w", err)
+	}
+
+	return reader, closeFn, nil
+}
+
+// openMusicStream starts streaming to the given entertainment group.
+func openMusicStream(ctx context.Context, client *hue.Client, group *hue.Group) (*entertainment.Streamer, error) {
+	if group.Type != hue.GroupTypeEntertainment {
+		return nil, fmt.Errorf("group %q is not an entertainment group, create one with \"huectl entertainment create\"", group.Name)
+	}
+
+	cfg, err := readConfigWithSecrets()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.ClientKey == "" {
+		return nil, errors.New(`no client key configured, run "huectl init --regenerate-key" to get one`)
+	}
+
+	s, err := entertainment.Open(ctx, client, group.ID, cfg.ClientKey, entertainment.WithColorSpace(entertainment.RGB))
+	if err != nil {
+		return nil, fmt.Errorf("unable to start streaming: %w", err)
+	}
+
+	return s, nil
+}
+
+func runListMusicPresetsCmd() error {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 4, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tDESCRIPTION")
+	for _, name := range music.PresetNames() {
+		fmt.Fprintf(tw, "%s\t%s\n", name, music.PresetHelp(name))
+	}
+
+	return tw.Flush()
+}
@@ -1,42 +1,152 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
+	"github.com/skwair/huectl/pkg/cache"
 	"github.com/skwair/huectl/pkg/config"
+	"github.com/skwair/huectl/pkg/daemon"
 	"github.com/skwair/huectl/pkg/hue"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 func Huectl() *cobra.Command {
 	rootCmd := &cobra.Command{
 		Use:   "huectl",
 		Short: "huectl controls a Philips Hue installation",
+		Long: `huectl controls a Philips Hue installation.
+
+Settings are read from the configuration file written by "huectl init". Global
+flags take precedence over environment variables, which take precedence over
+the configuration file:
+
+  --config            HUECTL_CONFIG             path of the configuration file
+  --bridge-url        HUECTL_BRIDGE_URL         URL of the bridge
+  --bridge-id         HUECTL_BRIDGE_ID          ID of the bridge
+  --cert-fingerprint  HUECTL_CERT_FINGERPRINT   fingerprint of its certificate
+  --client-id         HUECTL_CLIENT_ID          user registered on the bridge
+                      HUECTL_CLIENT_KEY         client key of this user
+
+No configuration file is needed when both the bridge URL and the client ID are
+given, e.g. in containers. Run "huectl config view" to show the effective
+configuration.`,
+		PersistentPreRun: func(*cobra.Command, []string) { config.SetPath(globalFlags.ConfigPath) },
 	}
 
+	flags := rootCmd.PersistentFlags()
+	flags.StringVar(&globalFlags.ConfigPath, "config", "", "Path of the configuration file")
+	flags.StringVar(&globalFlags.Overrides.BridgeURL, "bridge-url", "", "URL of the bridge, e.g. https://192.168.1.50")
+	flags.StringVar(&globalFlags.Overrides.BridgeID, "bridge-id", "", "ID of the bridge")
+	flags.StringVar(&globalFlags.Overrides.CertFingerprint, "cert-fingerprint", "", "SHA-256 fingerprint of the certificate of the bridge")
+	flags.StringVar(&globalFlags.Overrides.ClientID, "client-id", "", "User registered on the bridge, prefer HUECTL_CLIENT_ID as flags are visible to other users")
+
 	rootCmd.AddCommand(newVersionCmd())
 	rootCmd.AddCommand(newInitCmd())
+	rootCmd.AddCommand(newConfigCmd())
+	rootCmd.AddCommand(newBridgeCmd())
+	rootCmd.AddCommand(newDoctorCmd())
+	rootCmd.AddCommand(newCompletionCmd())
+	rootCmd.AddCommand(newCacheCmd())
+	rootCmd.AddCommand(newTUICmd())
+	rootCmd.AddCommand(newServeCmd())
+	rootCmd.AddCommand(newExporterCmd())
+	rootCmd.AddCommand(newMQTTCmd())
+	rootCmd.AddCommand(newDaemonCmd())
+	rootCmd.AddCommand(newAutomateCmd())
+	rootCmd.AddCommand(newAdaptiveCmd())
+	rootCmd.AddCommand(newEffectCmd())
+	rootCmd.AddCommand(newEntertainmentCmd())
+	rootCmd.AddCommand(newMusicCmd())
 
 	lightsCmd := newLightsCmd()
 	rootCmd.AddCommand(lightsCmd)
 
 	lightsCmd.AddCommand(newListLightsCmd())
+	lightsCmd.AddCommand(newShowLightCmd())
 	lightsCmd.AddCommand(newSetLightStateCmd())
 	lightsCmd.AddCommand(newToggleLightCmd())
+	lightsCmd.AddCommand(newDimLightCmd())
+	lightsCmd.AddCommand(newBrightenLightCmd())
+
+	rootCmd.AddCommand(newScenesCmd())
 
 	return rootCmd
 }
 
+// inventoryCacheTTL is how long the inventory cache is used to resolve names
+// before being refreshed.
+const inventoryCacheTTL = 10 * time.Minute
+
+// inventoryRefreshAge is the age from which the inventory cache is refreshed
+// when a resource can not be found in it.
+const inventoryRefreshAge = 5 * time.Second
+
+// signalContext returns a context canceled when the command is interrupted or
+// terminated, for long running commands to stop gracefully. The returned
+// function releases its resources and must be called once done.
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-sig:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(sig)
+		cancel()
+	}
+}
+
 func must(err error) {
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
+		if errors.Is(err, hue.ErrCertificateMismatch) {
+			fmt.Fprintln(os.Stderr, "The bridge presented an unexpected certificate, run `huectl bridge trust` for details.")
+		}
 		os.Exit(1)
 	}
 }
 
-func setupClient() (*hue.Client, error) {
+// globalFlags are the flags shared by all commands, overriding the
+// configuration file.
+var globalFlags struct {
+	ConfigPath string
+	Overrides  config.Overrides
+}
+
+// readConfig returns the effective configuration, with the global flags and
+// environment variables applied.
+func readConfig() (*config.Config, error) {
+	cfg, err := config.Load(globalFlags.Overrides)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.New("huectl is not initialized, please run `huectl init` first")
+		}
+
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// readConfigFile returns the configuration file as is, for commands updating
+// it. They should make sure no override is set first, see checkNoOverrides.
+func readConfigFile() (*config.Config, error) {
 	cfg, err := config.Read()
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -46,15 +156,300 @@ func setupClient() (*hue.Client, error) {
 		return nil, err
 	}
 
-	client := hue.NewClient(cfg.BridgeURL, cfg.ClientID, hue.WithCertFingerprint(cfg.CertFingerprint))
+	return cfg, nil
+}
+
+// checkNoOverrides returns an error if the configuration file is overridden
+// by global flags or environment variables, which commands updating it would
+// otherwise either ignore or write to it.
+func checkNoOverrides() error {
+	o := globalFlags.Overrides.Merge(config.EnvOverrides())
+	if o.IsZero() {
+		return nil
+	}
+
+	return errors.New("the configuration is overridden by flags or environment variables, unset them to update the configuration file")
+}
+
+// setupClient returns a client for the configured bridge. If the daemon is
+// running, requests are sent through it unless HUECTL_NO_DAEMON is set, or
+// another configuration is given by flags or environment variables.
+func setupClient(opts ...hue.ClientOption) (*hue.Client, error) {
+	if os.Getenv("HUECTL_NO_DAEMON") == "" && !configOverridden() {
+		if path, err := daemon.SocketPath(); err == nil {
+			if client, err := daemon.NewClient(path, opts...); err == nil {
+				return client, nil
+			}
+		}
+	}
+
+	return setupDirectClient(opts...)
+}
+
+// configOverridden reports whether the configuration used by the daemon may
+// differ from the one given to this command.
+func configOverridden() bool {
+	if globalFlags.ConfigPath != "" || os.Getenv(config.EnvConfig) != "" {
+		return true
+	}
+
+	return checkNoOverrides() != nil
+}
+
+// readConfigWithSecrets reads the configuration along with the credentials
+// kept in its secret store.
+func readConfigWithSecrets() (*config.Config, error) {
+	cfg, err := readConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = cfg.LoadSecrets(passphrasePrompt(false)); err != nil {
+		return nil, fmt.Errorf("unable to load credentials: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// passphrasePrompt returns a function asking the passphrase of the encrypted
+// secrets file on the terminal, unless given by HUECTL_PASSPHRASE. If confirm
+// is set, the passphrase is asked twice, e.g. when creating the file. The
+// passphrase is only asked once per returned function.
+func passphrasePrompt(confirm bool) config.PassphraseFunc {
+	var passphrase []byte
+
+	return func() ([]byte, error) {
+		if passphrase != nil {
+			return passphrase, nil
+		}
+
+		if p := os.Getenv(config.EnvPassphrase); p != "" {
+			passphrase = []byte(p)
+			return passphrase, nil
+		}
+
+		fd := int(os.Stdin.Fd())
+		if !term.IsTerminal(fd) {
+			return nil, fmt.Errorf("secrets are encrypted with a passphrase, set %s or run huectl from a terminal", config.EnvPassphrase)
+		}
+
+		read := func(prompt string) ([]byte, error) {
+			fmt.Fprint(os.Stderr, prompt)
+			defer fmt.Fprintln(os.Stderr)
+
+			p, err := term.ReadPassword(fd)
+			if err != nil {
+				return nil, fmt.Errorf("unable to read passphrase: %w", err)
+			}
+			return p, nil
+		}
+
+		p, err := read("Passphrase of the secrets file: ")
+		if err != nil {
+			return nil, err
+		}
+
+		if confirm {
+			again, err := read("Confirm passphrase: ")
+			if err != nil {
+				return nil, err
+			}
+			if !bytes.Equal(p, again) {
+				return nil, errors.New("passphrases do not match")
+			}
+		}
+
+		passphrase = p
+
+		return passphrase, nil
+	}
+}
+
+// setupDirectClient returns a client connecting to the configured bridge
+// directly. Long-running commands use it to hold their own connection.
+func setupDirectClient(opts ...hue.ClientOption) (*hue.Client, error) {
+	cfg, err := readConfigWithSecrets()
+	if err != nil {
+		return nil, err
+	}
+
+	tlsOpts := []hue.ClientOption{hue.WithCertFingerprint(cfg.CertFingerprint)}
+	if cfg.VerifyBridgeCA {
+		tlsOpts = append(tlsOpts, hue.WithBridgeCA(cfg.BridgeID))
+	}
+	// A fingerprint given by an override is not the one of the file.
+	if hue.IsLegacyFingerprint(cfg.CertFingerprint) && checkNoOverrides() == nil {
+		tlsOpts = append(tlsOpts, hue.WithFingerprintUpgrade(upgradeCertFingerprint))
+	}
+
+	client := hue.NewClient(cfg.BridgeURL, cfg.ClientID, append(tlsOpts, opts...)...)
 
 	return client, nil
 }
 
+// upgradeCertFingerprint replaces the legacy SHA-1 fingerprint pinned by the
+// configuration with the SHA-256 fingerprint of the same certificate.
+func upgradeCertFingerprint(fingerprint string) {
+	path, err := config.AbsolutePath()
+	if err == nil {
+		var cfg *config.Config
+		if cfg, err = config.Read(); err == nil {
+			cfg.CertFingerprint = fingerprint
+			err = writeConfigFile(path, cfg)
+		}
+	}
+
+	// The certificate matched, failing to upgrade its fingerprint is not
+	// worth failing the request.
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to upgrade certificate fingerprint to SHA-256: %v\n", err)
+	}
+}
+
+func setupCache(ttl time.Duration) (*cache.Cache, error) {
+	cfg, err := readConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return cache.New(cfg.BridgeID, ttl)
+}
+
+// resolveLightIDs returns the IDs of the given lights, which can be referred to
+// by ID or by name. Names are resolved using the inventory cache, which is
+// refreshed once if some of them can not be found.
+func resolveLightIDs(client *hue.Client, refs []string) ([]string, error) {
+	return resolveRefs(client, refs, "light", resolveLights)
+}
+
+// resolveLightOrGroupIDs is like resolveLightIDs, but also accepts group names,
+// which are expanded to the lights of the group. Light names take precedence
+// over group names and numeric references always refer to lights.
+func resolveLightOrGroupIDs(client *hue.Client, refs []string) ([]string, error) {
+	return resolveRefs(client, refs, "light or group", resolveLightsOrGroups)
+}
+
+// resolveRefs resolves refs with the given function, from the inventory cache.
+func resolveRefs(client *hue.Client, refs []string, kind string, resolve func(*cache.Inventory, []string) ([]string, string)) ([]string, error) {
+	if allNumeric(refs) {
+		return refs, nil
+	}
+
+	c, err := setupCache(inventoryCacheTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	inv, err := c.Inventory(client)
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve %s names: %w", kind, err)
+	}
+
+	// The light may have been added or renamed since the inventory was cached,
+	// try again with a fresh one unless it was just fetched.
+	ids, unknown := resolve(inv, refs)
+	if unknown != "" && inv.Age() > inventoryRefreshAge {
+		if inv, _, err = c.Refresh(client); err != nil {
+			return nil, fmt.Errorf("unable to resolve %s names: %w", kind, err)
+		}
+		ids, unknown = resolve(inv, refs)
+	}
+
+	if unknown != "" {
+		return nil, fmt.Errorf("unknown %s %q", kind, unknown)
+	}
+
+	return ids, nil
+}
+
+// inventoryLights returns the lights of the inventory cache, which is
+// refreshed once if some of the given lights can not be found. Lights that are
+// still missing are left out.
+func inventoryLights(client *hue.Client, ids []string) ([]hue.Light, error) {
+	c, err := setupCache(inventoryCacheTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	inv, err := c.Inventory(client)
+	if err != nil {
+		return nil, err
+	}
+
+	// Lights may have been added since the inventory was cached.
+	for _, id := range ids {
+		if inv.Light(id) == nil && inv.Age() > inventoryRefreshAge {
+			if inv, _, err = c.Refresh(client); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+
+	return inv.Lights, nil
+}
+
+// resolveLights returns the IDs of the given lights, or the first one that
+// could not be found.
+func resolveLights(inv *cache.Inventory, refs []string) (ids []string, unknown string) {
+	for _, ref := range refs {
+		light := inv.Light(ref)
+		if light == nil {
+			return nil, ref
+		}
+		ids = append(ids, light.ID)
+	}
+
+	return ids, ""
+}
+
+// resolveLightsOrGroups returns the IDs of the given lights and of the lights
+// of the given groups, without duplicates, or the first reference that could
+// not be found.
+func resolveLightsOrGroups(inv *cache.Inventory, refs []string) (ids []string, unknown string) {
+	seen := make(map[string]bool)
+	add := func(id string) {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	for _, ref := range refs {
+		if light := inv.Light(ref); light != nil {
+			add(light.ID)
+			continue
+		}
+
+		var group *hue.Group
+		if _, err := strconv.Atoi(ref); err != nil {
+			group = inv.Group(ref)
+		}
+		if group == nil {
+			return nil, ref
+		}
+		for _, id := range group.Lights {
+			add(id)
+		}
+	}
+
+	return ids, ""
+}
+
+func allNumeric(refs []string) bool {
+	for _, ref := range refs {
+		if _, err := strconv.Atoi(ref); err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
 func expectLightID() cobra.PositionalArgs {
 	return func(cmd *cobra.Command, args []string) error {
 		if len(args) < 1 {
-			return fmt.Errorf("at least one light id is required, e.g.: `%s 1`", cmd.CommandPath())
+			return fmt.Errorf("at least one light id or name is required, e.g.: `%s 1`", cmd.CommandPath())
 		}
 
 		return nil
@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/skwair/huectl/pkg/hue"
+	"github.com/skwair/huectl/pkg/palette"
+	"github.com/spf13/cobra"
+)
+
+func newScenesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "scenes",
+		Aliases: []string{"scene"},
+		Short:   "Manage scenes stored on the bridge",
+		Args:    cobra.NoArgs,
+		// If called with no sub-command, list scenes instead of printing help.
+		Run: func(*cobra.Command, []string) { must(runListScenesCmd()) },
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List scenes",
+		Args:    cobra.NoArgs,
+		Run:     func(*cobra.Command, []string) { must(runListScenesCmd()) },
+	})
+	cmd.AddCommand(newSceneFromImageCmd())
+
+	return cmd
+}
+
+type sceneFromImageFlags struct {
+	Group string
+	Name  string
+	Apply bool
+}
+
+func newSceneFromImageCmd() *cobra.Command {
+	var flags sceneFromImageFlags
+
+	cmd := &cobra.Command{
+		Use:   "from-image IMAGE",
+		Short: "Create a scene from the colors of an image",
+		Long: `Creates a scene giving each light of a group a different dominant color of
+an image, which can be a JPEG, PNG or GIF picture. Colors are clamped to what
+each light can display, and white ambiance lights get the closest color
+temperature.`,
+		Example: `  huectl scene from-image sunset.png --group "Living room" --apply`,
+		Args:    cobra.ExactArgs(1),
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) > 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			return completeImageFiles(cmd, args, toComplete)
+		},
+		Run: func(_ *cobra.Command, args []string) { must(runSceneFromImageCmd(args[0], &flags)) },
+	}
+
+	cmd.Flags().StringVarP(&flags.Group, "group", "g", "", "Group whose lights the scene applies to, by ID or name")
+	cmd.Flags().StringVarP(&flags.Name, "name", "n", "", "Name of the scene, the name of the image file by default")
+	cmd.Flags().BoolVar(&flags.Apply, "apply", false, "Recall the scene once created")
+
+	_ = cmd.MarkFlagRequired("group")
+	_ = cmd.RegisterFlagCompletionFunc("group", completeGroups())
+
+	return cmd
+}
+
+func runListScenesCmd() error {
+	client, err := setupClient()
+	if err != nil {
+		return fmt.Errorf("unable to setup Hue client: %w", err)
+	}
+
+	scenes, err := client.Scenes()
+	if err != nil {
+		return fmt.Errorf("unable to list scenes: %w", err)
+	}
+	sort.Slice(scenes, func(i, j int) bool { return scenes[i].Name < scenes[j].Name })
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 4, ' ', 0)
+	defer tw.Flush()
+
+	fmt.Fprintln(tw, "ID\tNAME\tGROUP\tLIGHTS")
+
+	for _, s := range scenes {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", s.ID, s.Name, s.Group, strings.Join(s.Lights, ", "))
+	}
+
+	return nil
+}
+
+// maxSceneNameLength is the longest scene name accepted by the bridge.
+const maxSceneNameLength = 32
+
+func runSceneFromImageCmd(path string, flags *sceneFromImageFlags) error {
+	name := flags.Name
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if name == "" || len(name) > maxSceneNameLength {
+		return fmt.Errorf("scene name must be 1 to %d characters long", maxSceneNameLength)
+	}
+
+	img, err := palette.Load(path)
+	if err != nil {
+		return err
+	}
+
+	client, err := setupClient()
+	if err != nil {
+		return fmt.Errorf("unable to setup Hue client: %w", err)
+	}
+
+	groups, err := client.Groups()
+	if err != nil {
+		return fmt.Errorf("unable to list groups: %w", err)
+	}
+	group := hue.FindGroup(groups, flags.Group)
+	if group == nil {
+		return fmt.Errorf("unknown group %q", flags.Group)
+	}
+
+	lights, err := effectLights(client, nil, []string{group.ID})
+	if err != nil {
+		return err
+	}
+	if len(lights) == 0 {
+		return errors.New("group has no lights")
+	}
+
+	states, err := palette.Assign(palette.Extract(img, len(lights)), lights)
+	if err != nil {
+		return err
+	}
+
+	id, err := client.CreateScene(&hue.CreateSceneRequest{
+		Name:        name,
+		Type:        hue.SceneTypeGroup,
+		Group:       group.ID,
+		LightStates: states,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to create scene: %w", err)
+	}
+
+	fmt.Printf("Created scene %s\n", id)
+
+	if flags.Apply {
+		res, err := client.RecallScene(group.ID, id)
+		if err == nil {
+			err = res.Err()
+		}
+		if err != nil {
+			return fmt.Errorf("unable to recall scene: %w", err)
+		}
+	}
+
+	return nil
+}
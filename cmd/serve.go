@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/skwair/huectl/pkg/gateway"
+	"github.com/spf13/cobra"
+)
+
+type serveFlags struct {
+	Listen    string
+	Tokens    []string
+	TokenFile string
+	NoAuth    bool
+}
+
+const serveExample = `
+	# Serve the API on port 8080 of all interfaces, accepting the tokens listed in a file
+	huectl serve --listen :8080 --token-file ~/.config/huectl/tokens
+
+	# Then, from another terminal
+	curl -H "Authorization: Bearer $TOKEN" http://localhost:8080/lights
+	curl -H "Authorization: Bearer $TOKEN" -X PATCH -d '{"on": true, "brightness": 50}' http://localhost:8080/lights/Kitchen
+	curl -H "Authorization: Bearer $TOKEN" -X POST http://localhost:8080/scenes/Relax/recall?group=Living`
+
+func newServeCmd() *cobra.Command {
+	var flags serveFlags
+
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serves a simple REST API to control lights",
+		Long: `Serves a simple REST API to control lights, backed by the Hue bridge:
+
+  GET   /lights                  list lights
+  GET   /lights/{light}          get a light, by ID or name
+  PATCH /lights/{light}          update the state of a light
+  GET   /scenes                  list scenes
+  POST  /scenes/{scene}/recall   recall a scene, by ID or name
+  GET   /openapi.json            the OpenAPI description of the API
+
+Requests must be authenticated with one of the configured tokens, sent as an
+"Authorization: Bearer <token>" header. If no token is configured, one is
+generated and printed on startup.`,
+		Example: serveExample,
+		Args:    cobra.NoArgs,
+		Run:     func(*cobra.Command, []string) { must(runServeCmd(&flags)) },
+	}
+
+	cmd.Flags().StringVar(&flags.Listen, "listen", "localhost:8080", "Address to listen on")
+	cmd.Flags().StringArrayVar(&flags.Tokens, "token", nil, "API token accepted by the server, can be repeated")
+	cmd.Flags().StringVar(&flags.TokenFile, "token-file", "", "File containing API tokens accepted by the server, one per line")
+	cmd.Flags().BoolVar(&flags.NoAuth, "no-auth", false, "Do not require API tokens, only use on trusted networks")
+
+	return cmd
+}
+
+func runServeCmd(flags *serveFlags) error {
+	client, err := setupDirectClient()
+	if err != nil {
+		return fmt.Errorf("unable to setup Hue client: %w", err)
+	}
+
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+
+	tokens := flags.Tokens
+	if flags.TokenFile != "" {
+		fileTokens, err := readTokenFile(flags.TokenFile)
+		if err != nil {
+			return err
+		}
+		tokens = append(tokens, fileTokens...)
+	}
+
+	switch {
+	case flags.NoAuth && len(tokens) > 0:
+		return fmt.Errorf("--no-auth can not be used with API tokens")
+	case flags.NoAuth:
+		logger.Println("WARNING: authentication is disabled, anyone who can reach the server controls your lights")
+	case len(tokens) == 0:
+		token, err := generateToken()
+		if err != nil {
+			return err
+		}
+		logger.Printf("No API token configured, generated one for this session: %s", token)
+		tokens = []string{token}
+	}
+
+	srv := &http.Server{
+		Addr:              flags.Listen,
+		Handler:           gateway.New(client, gateway.WithTokens(tokens...), gateway.WithLogger(logger)),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	logger.Printf("Listening on %s", flags.Listen)
+
+	return listenAndServe(ctx, srv)
+}
+
+// shutdownTimeout is how long in-flight requests are given to complete when
+// a server is stopped.
+const shutdownTimeout = 5 * time.Second
+
+// listenAndServe serves HTTP requests until the context is done, then shuts
+// the server down gracefully.
+func listenAndServe(ctx context.Context, srv *http.Server) error {
+	errc := make(chan error, 1)
+	go func() { errc <- srv.ListenAndServe() }()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		return fmt.Errorf("unable to shut down server: %w", err)
+	}
+
+	return nil
+}
+
+func readTokenFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open token file: %w", err)
+	}
+	defer f.Close()
+
+	var tokens []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		tokens = append(tokens, line)
+	}
+
+	if err = sc.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read token file: %w", err)
+	}
+
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("no token found in %q", path)
+	}
+
+	return tokens, nil
+}
+
+func generateToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("unable to generate API token: %w", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
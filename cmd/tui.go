@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/skwair/huectl/pkg/tui"
+	"github.com/spf13/cobra"
+)
+
+func newTUICmd() *cobra.Command {
+	var interval time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "tui",
+		Short: "Control lights from an interactive terminal interface",
+		Long: `Opens a full-screen interface listing rooms and lights with their live state.
+
+Keys:
+  ↑/↓ or j/k      select a light
+  ←/→ or h/l      switch room
+  space           toggle the selected light
+  +/-             brighten or dim the selected light
+  c               pick a color for the selected light
+  s               recall a scene of the current room
+  r               refresh now
+  q or Esc        quit`,
+		Args: cobra.NoArgs,
+		Run:  func(*cobra.Command, []string) { must(runTUICmd(interval)) },
+	}
+
+	cmd.Flags().DurationVar(&interval, "refresh", tui.DefaultRefreshInterval, "How often to refresh the state of lights")
+
+	return cmd
+}
+
+func runTUICmd(interval time.Duration) error {
+	client, err := setupDirectClient()
+	if err != nil {
+		return fmt.Errorf("unable to setup Hue client: %w", err)
+	}
+
+	screen, err := tcell.NewScreen()
+	if err != nil {
+		return fmt.Errorf("unable to open terminal: %w", err)
+	}
+
+	return tui.New(client, screen, tui.WithRefreshInterval(interval)).Run()
+}
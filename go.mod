@@ -1,9 +1,43 @@
 module github.com/skwair/huectl
 
-go 1.14
+go 1.17
 
 require (
+	github.com/eclipse/paho.mqtt.golang v1.3.0
+	github.com/gdamore/tcell/v2 v2.4.0
+	github.com/pion/dtls/v2 v2.2.7
+	github.com/pion/transport/v2 v2.2.1
+	github.com/prometheus/client_golang v1.7.1
+	github.com/robfig/cron/v3 v3.0.1
 	github.com/skwair/harmony v0.15.0
-	github.com/spf13/cobra v1.0.0
-	gopkg.in/yaml.v2 v2.2.4
+	github.com/spf13/cobra v1.2.1
+	github.com/spf13/pflag v1.0.5
+	github.com/zalando/go-keyring v0.2.1
+	golang.org/x/crypto v0.8.0
+	golang.org/x/term v0.7.0
+	gopkg.in/yaml.v2 v2.4.0
+)
+
+require (
+	github.com/alessio/shellescape v1.4.1 // indirect
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.1.1 // indirect
+	github.com/danieljoos/wincred v1.1.0 // indirect
+	github.com/gdamore/encoding v1.0.0 // indirect
+	github.com/godbus/dbus/v5 v5.0.6 // indirect
+	github.com/golang/protobuf v1.5.2 // indirect
+	github.com/gorilla/websocket v1.4.2 // indirect
+	github.com/inconshreveable/mousetrap v1.0.0 // indirect
+	github.com/lucasb-eyer/go-colorful v1.0.3 // indirect
+	github.com/mattn/go-runewidth v0.0.10 // indirect
+	github.com/matttproud/golang_protobuf_extensions v1.0.1 // indirect
+	github.com/pion/logging v0.2.2 // indirect
+	github.com/prometheus/client_model v0.2.0 // indirect
+	github.com/prometheus/common v0.10.0 // indirect
+	github.com/prometheus/procfs v0.1.3 // indirect
+	github.com/rivo/uniseg v0.1.0 // indirect
+	golang.org/x/net v0.9.0 // indirect
+	golang.org/x/sys v0.7.0 // indirect
+	golang.org/x/text v0.9.0 // indirect
+	google.golang.org/protobuf v1.26.0 // indirect
 )
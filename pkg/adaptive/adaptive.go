@@ -0,0 +1,395 @@
+// Package adaptive makes lights follow a natural daylight curve: warm and dim
+// at night, cool and bright at midday, computed from the position of the sun.
+package adaptive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/skwair/harmony/optional"
+	"github.com/skwair/huectl/pkg/hue"
+	"github.com/skwair/huectl/pkg/sun"
+)
+
+// Defaults used when no option is given to New.
+const (
+	DefaultInterval = time.Minute
+	DefaultHold     = 30 * time.Minute
+)
+
+// Curve sets the range of the targets computed by the engine. Color
+// temperatures are in mireds: the warmest is the highest.
+type Curve struct {
+	MinBrightness int // In percent.
+	MaxBrightness int // In percent.
+	WarmestCT     int
+	CoolestCT     int
+}
+
+// DefaultCurve goes from 2200K and 30% at night to 5000K and 100% at midday.
+var DefaultCurve = Curve{
+	MinBrightness: 30,
+	MaxBrightness: 100,
+	WarmestCT:     454,
+	CoolestCT:     200,
+}
+
+// Validate checks that the ranges of the curve are valid for the bridge.
+func (c Curve) Validate() error {
+	switch {
+	case c.MinBrightness < 1 || c.MaxBrightness > 100 || c.MinBrightness > c.MaxBrightness:
+		return fmt.Errorf("brightness must be between 1 and 100 with min <= max, got %d-%d", c.MinBrightness, c.MaxBrightness)
+	case c.CoolestCT < 153 || c.WarmestCT > 500 || c.CoolestCT > c.WarmestCT:
+		return fmt.Errorf("color temperatures must be between 153 and 500 mireds with coolest <= warmest, got %d-%d", c.CoolestCT, c.WarmestCT)
+	}
+
+	return nil
+}
+
+// Target is the state lights should be in at a given time.
+type Target struct {
+	Bri int // On the 1-254 scale of the bridge.
+	CT  int // In mireds.
+}
+
+// Target returns the state lights should be in at the given time and
+// location. The curve follows the elevation of the sun relative to its
+// elevation at solar noon, so it adapts to the season: lights are at their
+// warmest and dimmest while the sun is below the horizon.
+func (c Curve) Target(loc sun.Location, t time.Time) Target {
+	progress := 0.0
+	if noon := loc.NoonElevation(t); noon > 0 {
+		elevation := loc.Elevation(t)
+		progress = math.Max(0, math.Min(1, math.Sin(elevation*math.Pi/180)/math.Sin(noon*math.Pi/180)))
+	}
+
+	bri := float64(c.MinBrightness) + float64(c.MaxBrightness-c.MinBrightness)*progress
+	ct := float64(c.WarmestCT) - float64(c.WarmestCT-c.CoolestCT)*progress
+
+	return Target{
+		Bri: int(math.Max(1, math.Round(bri/100*254))),
+		CT:  int(math.Round(ct)),
+	}
+}
+
+// Engine periodically updates lights to follow the curve. Create one with
+// New and start it with Run.
+type Engine struct {
+	client   *hue.Client
+	location sun.Location
+	lights   []string
+	groups   []string
+
+	curve    Curve
+	interval time.Duration
+	hold     time.Duration
+	logger   *log.Logger
+
+	// applied holds what was last sent to each light, to notice when it is
+	// changed by someone else.
+	applied map[string]*applied
+}
+
+type applied struct {
+	state hue.LightState
+	// heldUntil is set when the light was changed manually: it is left alone
+	// until then.
+	heldUntil time.Time
+}
+
+// Option allows to customize an Engine.
+type Option func(*Engine)
+
+// WithLights adds lights to update, by ID or name.
+func WithLights(refs ...string) Option {
+	return func(e *Engine) {
+		e.lights = append(e.lights, refs...)
+	}
+}
+
+// WithGroups adds groups whose lights to update, by ID or name.
+func WithGroups(refs ...string) Option {
+	return func(e *Engine) {
+		e.groups = append(e.groups, refs...)
+	}
+}
+
+// WithCurve sets the range of brightness and color temperature, DefaultCurve
+// if not set.
+func WithCurve(c Curve) Option {
+	return func(e *Engine) {
+		e.curve = c
+	}
+}
+
+// WithInterval sets how often lights are updated, DefaultInterval if not set.
+// Updates transition over the whole interval so changes are not noticeable.
+func WithInterval(d time.Duration) Option {
+	return func(e *Engine) {
+		if d > 0 {
+			e.interval = d
+		}
+	}
+}
+
+// WithHold sets for how long a light that was changed manually is left alone,
+// DefaultHold if not set.
+func WithHold(d time.Duration) Option {
+	return func(e *Engine) {
+		if d > 0 {
+			e.hold = d
+		}
+	}
+}
+
+// WithLogger sets the logger used to report updates and errors. Nothing is
+// logged by default.
+func WithLogger(l *log.Logger) Option {
+	return func(e *Engine) {
+		e.logger = l
+	}
+}
+
+// New returns a new engine updating lights at the given location through the
+// given client.
+func New(client *hue.Client, loc sun.Location, opts ...Option) *Engine {
+	e := &Engine{
+		client:   client,
+		location: loc,
+		curve:    DefaultCurve,
+		interval: DefaultInterval,
+		hold:     DefaultHold,
+		applied:  make(map[string]*applied),
+	}
+
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	return e
+}
+
+// Run updates lights at every interval until the context is canceled.
+func (e *Engine) Run(ctx context.Context) error {
+	if len(e.lights) == 0 && len(e.groups) == 0 {
+		return errors.New("no light or group to update")
+	}
+
+	if err := e.curve.Validate(); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := e.update(time.Now()); err != nil {
+			e.logf("Unable to update lights: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// update sends the current target to the selected lights, skipping those
+// that are off, unreachable or were changed manually recently.
+func (e *Engine) update(now time.Time) error {
+	target := e.curve.Target(e.location, now)
+
+	lights, err := e.selectedLights()
+	if err != nil {
+		return err
+	}
+
+	req := hue.SetLightStateRequest{
+		Bri:            optional.NewInt(target.Bri),
+		CT:             optional.NewInt(target.CT),
+		TransitionTime: optional.NewInt(int(e.interval / (100 * time.Millisecond))),
+	}
+
+	reqs := make(map[string]*hue.SetLightStateRequest)
+	for i := range lights {
+		l := &lights[i]
+		if !l.IsDimmable() || !l.State.On || !l.State.Reachable {
+			continue
+		}
+
+		if e.heldManually(l, now) {
+			continue
+		}
+
+		lreq, _, err := hue.ValidateLightState(l, &req, hue.Convert)
+		if err != nil {
+			e.logf("Skipping light %s: %v", l.Name, err)
+			continue
+		}
+		reqs[l.ID] = lreq
+	}
+
+	if len(reqs) == 0 {
+		return nil
+	}
+
+	results := e.client.SetLightStates(reqs)
+
+	var updated []string
+	for id, res := range results {
+		if res.Failed() {
+			err := res.Err
+			if err == nil {
+				err = res.Update.Err()
+			}
+			e.logf("Unable to update light %s: %v", id, err)
+			continue
+		}
+		updated = append(updated, id)
+	}
+
+	if err = e.recordApplied(updated); err != nil {
+		return err
+	}
+
+	sort.Slice(updated, func(i, j int) bool { return hue.LessID(updated[i], updated[j]) })
+	e.logf("Set %d%% at %dK on lights %s", int(math.Round(float64(target.Bri)/254*100)), 1000000/target.CT, strings.Join(updated, ", "))
+
+	return nil
+}
+
+// heldManually reports whether the light was changed by someone else since it
+// was last updated, or less than the hold duration ago.
+func (e *Engine) heldManually(l *hue.Light, now time.Time) bool {
+	a, ok := e.applied[l.ID]
+	if !ok {
+		return false
+	}
+
+	if !a.heldUntil.IsZero() {
+		if now.Before(a.heldUntil) {
+			return true
+		}
+
+		// The hold is over: take the light back, comparing later changes to
+		// the state it was left in.
+		a.heldUntil = time.Time{}
+		a.state = l.State
+		return false
+	}
+
+	if changed(&a.state, &l.State) {
+		a.heldUntil = now.Add(e.hold)
+		e.logf("Light %s was changed manually, leaving it alone for %s", l.Name, e.hold)
+		return true
+	}
+
+	return false
+}
+
+// changed reports whether the light state differs from what was applied,
+// allowing for the rounding done by the bridge.
+func changed(applied, current *hue.LightState) bool {
+	if abs(applied.Bri-current.Bri) > 2 {
+		return true
+	}
+
+	if applied.ColorMode != current.ColorMode {
+		return true
+	}
+
+	switch applied.ColorMode {
+	case "ct":
+		return abs(applied.CT-current.CT) > 2
+	case "xy":
+		return math.Abs(applied.XY[0]-current.XY[0]) > 0.01 || math.Abs(applied.XY[1]-current.XY[1]) > 0.01
+	}
+
+	return false
+}
+
+// recordApplied records the state of the updated lights as reported by the
+// bridge, which is the target of their transition, to compare it later on.
+func (e *Engine) recordApplied(ids []string) error {
+	lights, err := e.client.Lights()
+	if err != nil {
+		return fmt.Errorf("unable to list lights: %w", err)
+	}
+
+	for _, id := range ids {
+		if l := hue.FindLight(lights, id); l != nil {
+			e.applied[id] = &applied{state: l.State}
+		}
+	}
+
+	return nil
+}
+
+// selectedLights returns the selected lights along with the lights of the
+// selected groups.
+func (e *Engine) selectedLights() ([]hue.Light, error) {
+	lights, err := e.client.Lights()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list lights: %w", err)
+	}
+
+	byID := make(map[string]*hue.Light, len(lights))
+	for i := range lights {
+		byID[lights[i].ID] = &lights[i]
+	}
+
+	selected := make(map[string]bool)
+	for _, ref := range e.lights {
+		l := hue.FindLight(lights, ref)
+		if l == nil {
+			return nil, fmt.Errorf("no light named %q", ref)
+		}
+		selected[l.ID] = true
+	}
+
+	if len(e.groups) > 0 {
+		groups, err := e.client.Groups()
+		if err != nil {
+			return nil, fmt.Errorf("unable to list groups: %w", err)
+		}
+
+		for _, ref := range e.groups {
+			g := hue.FindGroup(groups, ref)
+			if g == nil {
+				return nil, fmt.Errorf("no group named %q", ref)
+			}
+			for _, id := range g.Lights {
+				selected[id] = true
+			}
+		}
+	}
+
+	res := make([]hue.Light, 0, len(selected))
+	for id := range selected {
+		if l, ok := byID[id]; ok {
+			res = append(res, *l)
+		}
+	}
+
+	return res, nil
+}
+
+func (e *Engine) logf(format string, v ...interface{}) {
+	if e.logger != nil {
+		e.logger.Printf(format, v...)
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,259 @@
+package adaptive
+
+import (
+	"testing"
+	"time"
+
+	"github.com/skwair/harmony/optional"
+	"github.com/skwair/huectl/pkg/hue"
+	"github.com/skwair/huectl/pkg/hue/huetest"
+	"github.com/skwair/huectl/pkg/sun"
+)
+
+var (
+	paris  = sun.Location{Latitude: 48.8566, Longitude: 2.3522}
+	tromso = sun.Location{Latitude: 69.6492, Longitude: 18.9553}
+
+	cest = time.FixedZone("CEST", 2*60*60)
+)
+
+func TestCurveTarget(t *testing.T) {
+	custom := Curve{MinBrightness: 10, MaxBrightness: 50, WarmestCT: 400, CoolestCT: 250}
+
+	tests := []struct {
+		name     string
+		curve    Curve
+		location sun.Location
+		at       time.Time
+		want     Target
+	}{
+		{
+			name:     "night",
+			curve:    DefaultCurve,
+			location: paris,
+			at:       time.Date(2021, time.June, 21, 1, 0, 0, 0, cest),
+			want:     Target{Bri: 76, CT: 454},
+		},
+		{
+			name:     "solar noon",
+			curve:    DefaultCurve,
+			location: paris,
+			at:       time.Date(2021, time.June, 21, 13, 52, 0, 0, cest),
+			want:     Target{Bri: 254, CT: 200},
+		},
+		{
+			name:     "polar night",
+			curve:    DefaultCurve,
+			location: tromso,
+			at:       time.Date(2021, time.December, 21, 11, 0, 0, 0, time.UTC),
+			want:     Target{Bri: 76, CT: 454},
+		},
+		{
+			name:     "custom curve, night",
+			curve:    custom,
+			location: paris,
+			at:       time.Date(2021, time.June, 21, 1, 0, 0, 0, cest),
+			want:     Target{Bri: 25, CT: 400},
+		},
+		{
+			name:     "custom curve, solar noon",
+			curve:    custom,
+			location: paris,
+			at:       time.Date(2021, time.June, 21, 13, 52, 0, 0, cest),
+			want:     Target{Bri: 127, CT: 250},
+		},
+		{
+			name:     "lowest brightness",
+			curve:    Curve{MinBrightness: 0, MaxBrightness: 0, WarmestCT: 454, CoolestCT: 454},
+			location: paris,
+			at:       time.Date(2021, time.June, 21, 1, 0, 0, 0, cest),
+			want:     Target{Bri: 1, CT: 454},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.curve.Target(tt.location, tt.at); got != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCurveTargetFollowsTheSun(t *testing.T) {
+	// From sunrise to solar noon, lights get brighter and cooler.
+	prev := DefaultCurve.Target(paris, time.Date(2021, time.June, 21, 6, 0, 0, 0, cest))
+	for h := 7; h <= 13; h++ {
+		target := DefaultCurve.Target(paris, time.Date(2021, time.June, 21, h, 0, 0, 0, cest))
+		if target.Bri <= prev.Bri || target.CT >= prev.CT {
+			t.Errorf("expected %02d:00 to be brighter and cooler than an hour before, got %+v then %+v", h, prev, target)
+		}
+		prev = target
+	}
+}
+
+func TestCurveValidate(t *testing.T) {
+	tests := []struct {
+		curve   Curve
+		wantErr bool
+	}{
+		{curve: DefaultCurve},
+		{curve: Curve{MinBrightness: 0, MaxBrightness: 100, WarmestCT: 454, CoolestCT: 200}, wantErr: true},
+		{curve: Curve{MinBrightness: 80, MaxBrightness: 20, WarmestCT: 454, CoolestCT: 200}, wantErr: true},
+		{curve: Curve{MinBrightness: 30, MaxBrightness: 100, WarmestCT: 501, CoolestCT: 200}, wantErr: true},
+		{curve: Curve{MinBrightness: 30, MaxBrightness: 100, WarmestCT: 200, CoolestCT: 454}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		if err := tt.curve.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%+v: expected error %t, got %v", tt.curve, tt.wantErr, err)
+		}
+	}
+}
+
+func TestChanged(t *testing.T) {
+	applied := hue.LightState{Bri: 100, CT: 300, ColorMode: "ct"}
+
+	tests := []struct {
+		name    string
+		applied hue.LightState
+		current hue.LightState
+		want    bool
+	}{
+		{
+			name:    "same",
+			applied: applied,
+			current: applied,
+		},
+		{
+			name:    "rounded by the bridge",
+			applied: applied,
+			current: hue.LightState{Bri: 102, CT: 298, ColorMode: "ct"},
+		},
+		{
+			name:    "brightness",
+			applied: applied,
+			current: hue.LightState{Bri: 103, CT: 300, ColorMode: "ct"},
+			want:    true,
+		},
+		{
+			name:    "color temperature",
+			applied: applied,
+			current: hue.LightState{Bri: 100, CT: 303, ColorMode: "ct"},
+			want:    true,
+		},
+		{
+			name:    "color mode",
+			applied: applied,
+			current: hue.LightState{Bri: 100, CT: 300, ColorMode: "xy"},
+			want:    true,
+		},
+		{
+			name:    "xy rounded by the bridge",
+			applied: hue.LightState{Bri: 100, XY: [2]float64{0.45, 0.41}, ColorMode: "xy"},
+			current: hue.LightState{Bri: 100, XY: [2]float64{0.455, 0.405}, ColorMode: "xy"},
+		},
+		{
+			name:    "xy",
+			applied: hue.LightState{Bri: 100, XY: [2]float64{0.45, 0.41}, ColorMode: "xy"},
+			current: hue.LightState{Bri: 100, XY: [2]float64{0.45, 0.43}, ColorMode: "xy"},
+			want:    true,
+		},
+		{
+			name:    "dimmable light",
+			applied: hue.LightState{Bri: 100},
+			current: hue.LightState{Bri: 50},
+			want:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := changed(&tt.applied, &tt.current); got != tt.want {
+				t.Errorf("expected %t, got %t", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestHeldManually(t *testing.T) {
+	e := New(nil, paris, WithHold(30*time.Minute))
+
+	start := time.Date(2021, time.June, 21, 20, 0, 0, 0, cest)
+	light := &hue.Light{ID: "1", Name: "Desk", State: hue.LightState{Bri: 100, CT: 300, ColorMode: "ct"}}
+
+	if e.heldManually(light, start) {
+		t.Fatalf("expected a light never updated not to be held")
+	}
+
+	e.applied["1"] = &applied{state: light.State}
+	if e.heldManually(light, start) {
+		t.Fatalf("expected an unchanged light not to be held")
+	}
+
+	light.State.Bri = 200
+	if !e.heldManually(light, start) {
+		t.Fatalf("expected a light changed manually to be held")
+	}
+	if !e.heldManually(light, start.Add(29*time.Minute)) {
+		t.Fatalf("expected the light to be held for the hold duration")
+	}
+	if e.heldManually(light, start.Add(31*time.Minute)) {
+		t.Fatalf("expected the light to be released once the hold is over")
+	}
+
+	// Even if it could not be updated since, a new change must be noticed.
+	light.State.Bri = 50
+	if !e.heldManually(light, start.Add(32*time.Minute)) {
+		t.Fatalf("expected a light changed again after the hold to be held again")
+	}
+}
+
+func TestEngineUpdate(t *testing.T) {
+	b := huetest.NewBridge()
+	defer b.Close()
+
+	b.AddLight(hue.Light{
+		ID:    "1",
+		Name:  "Desk",
+		Type:  hue.LightTypeColorTemperature,
+		State: hue.LightState{On: true, Bri: 254, CT: 153, ColorMode: "ct", Reachable: true},
+	})
+	b.AddLight(hue.Light{
+		ID:    "2",
+		Name:  "Hall",
+		Type:  hue.LightTypeColorTemperature,
+		State: hue.LightState{Bri: 254, CT: 153, ColorMode: "ct", Reachable: true},
+	})
+
+	e := New(b.Client(), paris, WithLights("Desk", "Hall"), WithHold(30*time.Minute))
+	night := time.Date(2021, time.June, 21, 1, 0, 0, 0, cest)
+
+	if err := e.update(night); err != nil {
+		t.Fatalf("unable to update lights: %v", err)
+	}
+	if s := b.Light("1").State; s.Bri != 76 || s.CT != 454 {
+		t.Errorf("expected light 1 to follow the curve, got %+v", s)
+	}
+	if s := b.Light("2").State; s.Bri != 254 || s.CT != 153 {
+		t.Errorf("expected light 2, which is off, to be left alone, got %+v", s)
+	}
+
+	if _, err := b.Client().SetLightState("1", &hue.SetLightStateRequest{Bri: optional.NewInt(200)}); err != nil {
+		t.Fatalf("unable to change light 1: %v", err)
+	}
+
+	if err := e.update(night.Add(time.Minute)); err != nil {
+		t.Fatalf("unable to update lights: %v", err)
+	}
+	if s := b.Light("1").State; s.Bri != 200 {
+		t.Errorf("expected light 1 to be held after a manual change, got %+v", s)
+	}
+
+	if err := e.update(night.Add(31 * time.Minute)); err != nil {
+		t.Fatalf("unable to update lights: %v", err)
+	}
+	if s := b.Light("1").State; s.Bri != 76 || s.CT != 454 {
+		t.Errorf("expected light 1 to follow the curve again after the hold, got %+v", s)
+	}
+}
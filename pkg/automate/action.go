@@ -0,0 +1,281 @@
+package automate
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/skwair/harmony/optional"
+	"github.com/skwair/huectl/pkg/colors"
+	"github.com/skwair/huectl/pkg/hue"
+)
+
+// Action is an operation on lights, a group or a scene. Lights and groups can
+// be referred to by ID or name.
+//
+// To recall a scene, set Scene and optionally Group to pick the scene of a
+// given group. Otherwise, set either Lights or Group along with the state to
+// apply to them.
+type Action struct {
+	Lights []string `yaml:"lights"`
+	Group  string   `yaml:"group"`
+	Scene  string   `yaml:"scene"`
+
+	On *bool `yaml:"on"`
+	// Brightness in percent.
+	Brightness *int `yaml:"brightness"`
+	// Color as a name or a hex code, e.g. "orange" or "#ffa500".
+	Color string `yaml:"color"`
+	// CT is a color temperature, in mireds.
+	CT         *int          `yaml:"ct"`
+	Transition time.Duration `yaml:"transition"`
+}
+
+func (a *Action) hasState() bool {
+	return a.On != nil || a.Brightness != nil || a.Color != "" || a.CT != nil
+}
+
+func (a *Action) validate() error {
+	switch {
+	case a.Scene != "" && len(a.Lights) > 0:
+		return errors.New("a scene can not be recalled on lights, use a group instead")
+	case a.Scene != "" && a.hasState():
+		return errors.New("a scene can not be recalled along with a state")
+	case a.Scene == "" && len(a.Lights) == 0 && a.Group == "":
+		return errors.New("one of lights, group or scene must be set")
+	case a.Scene == "" && len(a.Lights) > 0 && a.Group != "":
+		return errors.New("only one of lights and group can be set")
+	case a.Scene == "" && !a.hasState():
+		return errors.New("no state to apply")
+	}
+
+	_, err := a.request()
+
+	return err
+}
+
+// request returns the state update described by the action.
+func (a *Action) request() (*hue.SetLightStateRequest, error) {
+	var req hue.SetLightStateRequest
+
+	if a.On != nil {
+		req.On = optional.NewBool(*a.On)
+	}
+
+	if a.Brightness != nil {
+		if *a.Brightness < 0 || *a.Brightness > 100 {
+			return nil, fmt.Errorf("brightness must be between 0 and 100, got %d", *a.Brightness)
+		}
+		req.Bri = optional.NewInt(int(math.Round(254.0 / 100.0 * float64(*a.Brightness))))
+	}
+
+	if a.Color != "" && a.CT != nil {
+		return nil, errors.New("only one of color and ct can be set")
+	}
+
+	if a.Color != "" {
+		c, err := colors.Parse(a.Color)
+		if err != nil {
+			return nil, err
+		}
+		xy := hue.RGBToXY(c.R, c.G, c.B)
+		req.XY = &[2]float32{float32(xy[0]), float32(xy[1])}
+	}
+
+	if a.CT != nil {
+		req.CT = optional.NewInt(*a.CT)
+	}
+
+	if a.Transition != 0 {
+		if a.Transition < 0 || a.Transition > math.MaxUint16*100*time.Millisecond {
+			return nil, fmt.Errorf("transition out of range: %s", a.Transition)
+		}
+		req.TransitionTime = optional.NewInt(int(a.Transition / (100 * time.Millisecond)))
+	}
+
+	return &req, nil
+}
+
+// String describes the action, e.g. `lights Kitchen, 2: on, brightness 50%`.
+func (a *Action) String() string {
+	if a.Scene != "" {
+		if a.Group != "" {
+			return fmt.Sprintf("recall scene %q of group %q", a.Scene, a.Group)
+		}
+		return fmt.Sprintf("recall scene %q", a.Scene)
+	}
+
+	var state []string
+	if a.On != nil {
+		if *a.On {
+			state = append(state, "on")
+		} else {
+			state = append(state, "off")
+		}
+	}
+	if a.Brightness != nil {
+		state = append(state, fmt.Sprintf("brightness %d%%", *a.Brightness))
+	}
+	if a.Color != "" {
+		state = append(state, "color "+a.Color)
+	}
+	if a.CT != nil {
+		state = append(state, fmt.Sprintf("ct %d", *a.CT))
+	}
+	if a.Transition != 0 {
+		state = append(state, "transition "+a.Transition.String())
+	}
+
+	target := fmt.Sprintf("group %q", a.Group)
+	if len(a.Lights) > 0 {
+		target = "lights " + strings.Join(a.Lights, ", ")
+	}
+
+	return target + ": " + strings.Join(state, ", ")
+}
+
+func (s *Scheduler) runAction(a *Action) error {
+	switch {
+	case a.Scene != "":
+		return s.recallScene(a)
+	case a.Group != "":
+		return s.setGroupState(a)
+	default:
+		return s.setLightsState(a)
+	}
+}
+
+func (s *Scheduler) recallScene(a *Action) error {
+	groupID := ""
+	if a.Group != "" {
+		g, err := s.findGroup(a.Group)
+		if err != nil {
+			return err
+		}
+		groupID = g.ID
+	}
+
+	scenes, err := s.client.Scenes()
+	if err != nil {
+		return fmt.Errorf("unable to list scenes: %w", err)
+	}
+
+	var matches []hue.Scene
+	for _, sc := range scenes {
+		if sc.ID == a.Scene {
+			matches = []hue.Scene{sc}
+			break
+		}
+		if strings.EqualFold(sc.Name, a.Scene) && (groupID == "" || sc.Group == groupID) {
+			matches = append(matches, sc)
+		}
+	}
+
+	switch {
+	case len(matches) == 0:
+		return fmt.Errorf("no scene named %q", a.Scene)
+	case len(matches) > 1:
+		return fmt.Errorf("%d scenes are named %q, set a group or use a scene ID", len(matches), a.Scene)
+	}
+
+	target := matches[0].Group
+	if target == "" {
+		target = groupID
+	}
+	if target == "" {
+		// Scenes not tied to a group (light scenes) are recalled on group 0,
+		// which contains all lights.
+		target = "0"
+	}
+
+	res, err := s.client.RecallScene(target, matches[0].ID)
+	if err != nil {
+		return err
+	}
+
+	return res.Err()
+}
+
+func (s *Scheduler) setGroupState(a *Action) error {
+	g, err := s.findGroup(a.Group)
+	if err != nil {
+		return err
+	}
+
+	req, err := a.request()
+	if err != nil {
+		return err
+	}
+
+	res, err := s.client.SetGroupState(g.ID, &hue.SetGroupStateRequest{SetLightStateRequest: *req})
+	if err != nil {
+		return err
+	}
+
+	return res.Err()
+}
+
+func (s *Scheduler) setLightsState(a *Action) error {
+	req, err := a.request()
+	if err != nil {
+		return err
+	}
+
+	lights, err := s.client.Lights()
+	if err != nil {
+		return fmt.Errorf("unable to list lights: %w", err)
+	}
+
+	reqs := make(map[string]*hue.SetLightStateRequest, len(a.Lights))
+	var ids []string
+	for _, ref := range a.Lights {
+		light := hue.FindLight(lights, ref)
+		if light == nil {
+			return fmt.Errorf("no light named %q", ref)
+		}
+
+		// Automations run unattended, adapt the state to each light rather
+		// than failing.
+		lreq, _, err := hue.ValidateLightState(light, req, hue.Convert)
+		if err != nil {
+			return fmt.Errorf("light %s: %w", light.Name, err)
+		}
+		reqs[light.ID] = lreq
+		ids = append(ids, light.ID)
+	}
+
+	results := s.client.SetLightStates(reqs)
+
+	var failed []string
+	for _, id := range ids {
+		r := results[id]
+		if r.Failed() {
+			err := r.Err
+			if err == nil {
+				err = r.Update.Err()
+			}
+			failed = append(failed, fmt.Sprintf("light %s: %v", id, err))
+		}
+	}
+	if len(failed) > 0 {
+		return errors.New(strings.Join(failed, "; "))
+	}
+
+	return nil
+}
+
+func (s *Scheduler) findGroup(ref string) (*hue.Group, error) {
+	groups, err := s.client.Groups()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list groups: %w", err)
+	}
+
+	g := hue.FindGroup(groups, ref)
+	if g == nil {
+		return nil, fmt.Errorf("no group named %q", ref)
+	}
+
+	return g, nil
+}
@@ -0,0 +1,332 @@
+// Package automate runs automations on the host: light, group and scene
+// operations triggered by cron expressions or by sunrise and sunset at a
+// configured location.
+package automate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/skwair/huectl/pkg/hue"
+	"github.com/skwair/huectl/pkg/sun"
+	"gopkg.in/yaml.v2"
+)
+
+// Config is the content of an automations file.
+type Config struct {
+	// Location is required to use sunrise and sunset triggers.
+	Location    *sun.Location `yaml:"location"`
+	Automations []Automation  `yaml:"automations"`
+}
+
+// Automation runs actions whenever its trigger fires.
+type Automation struct {
+	Name string `yaml:"name"`
+	// When is either a cron expression (e.g. "30 7 * * 1-5" or "@hourly"), or
+	// "sunrise" or "sunset" with an optional offset (e.g. "sunset-30m").
+	When    string   `yaml:"when"`
+	Actions []Action `yaml:"actions"`
+
+	trigger trigger
+}
+
+// trigger tells when an automation fires.
+type trigger interface {
+	// next returns the first time the trigger fires strictly after the given
+	// time, or false if it never fires again.
+	next(after time.Time) (time.Time, bool)
+}
+
+type cronTrigger struct {
+	schedule cron.Schedule
+}
+
+func (t *cronTrigger) next(after time.Time) (time.Time, bool) {
+	next := t.schedule.Next(after)
+	return next, !next.IsZero()
+}
+
+type sunTrigger struct {
+	location sun.Location
+	sunrise  bool
+	offset   time.Duration
+}
+
+func (t *sunTrigger) next(after time.Time) (time.Time, bool) {
+	// Start the day before in case a negative offset makes the event of the
+	// next day happen on the current one, and give up after a year as the sun
+	// may never rise or set near the poles.
+	day := after.AddDate(0, 0, -1)
+	for i := 0; i < 367; i++ {
+		event, ok := t.location.Sunset(day)
+		if t.sunrise {
+			event, ok = t.location.Sunrise(day)
+		}
+
+		if ok && event.Add(t.offset).After(after) {
+			return event.Add(t.offset), true
+		}
+
+		day = day.AddDate(0, 0, 1)
+	}
+
+	return time.Time{}, false
+}
+
+// parseTrigger parses the When field of an automation.
+func parseTrigger(when string, loc *sun.Location) (trigger, error) {
+	when = strings.TrimSpace(when)
+	lower := strings.ToLower(when)
+
+	for _, event := range []string{"sunrise", "sunset"} {
+		if !strings.HasPrefix(lower, event) {
+			continue
+		}
+
+		if loc == nil {
+			return nil, fmt.Errorf("%s triggers require a location", event)
+		}
+
+		var offset time.Duration
+		if rest := strings.TrimSpace(lower[len(event):]); rest != "" {
+			d, err := time.ParseDuration(strings.ReplaceAll(rest, " ", ""))
+			if err != nil {
+				return nil, fmt.Errorf("invalid offset %q: %w", rest, err)
+			}
+			offset = d
+		}
+
+		return &sunTrigger{location: *loc, sunrise: event == "sunrise", offset: offset}, nil
+	}
+
+	schedule, err := cron.ParseStandard(when)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron expression %q: %w", when, err)
+	}
+
+	return &cronTrigger{schedule: schedule}, nil
+}
+
+// Load reads and validates the automations file at the given path.
+func Load(path string) (*Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read automations file: %w", err)
+	}
+
+	var cfg Config
+	if err = yaml.UnmarshalStrict(b, &cfg); err != nil {
+		return nil, fmt.Errorf("unable to decode automations file: %w", err)
+	}
+
+	if err = cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+func (c *Config) validate() error {
+	if len(c.Automations) == 0 {
+		return errors.New("no automation defined")
+	}
+
+	if c.Location != nil {
+		if c.Location.Latitude < -90 || c.Location.Latitude > 90 {
+			return fmt.Errorf("latitude must be between -90 and 90, got %g", c.Location.Latitude)
+		}
+		if c.Location.Longitude < -180 || c.Location.Longitude > 180 {
+			return fmt.Errorf("longitude must be between -180 and 180, got %g", c.Location.Longitude)
+		}
+	}
+
+	for i := range c.Automations {
+		a := &c.Automations[i]
+		if a.Name == "" {
+			a.Name = fmt.Sprintf("automation #%d", i+1)
+		}
+
+		t, err := parseTrigger(a.When, c.Location)
+		if err != nil {
+			return fmt.Errorf("%s: %w", a.Name, err)
+		}
+		a.trigger = t
+
+		if len(a.Actions) == 0 {
+			return fmt.Errorf("%s: no action defined", a.Name)
+		}
+
+		for j := range a.Actions {
+			if err = a.Actions[j].validate(); err != nil {
+				return fmt.Errorf("%s: action #%d: %w", a.Name, j+1, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Firing is an upcoming run of an automation.
+type Firing struct {
+	Time       time.Time
+	Automation *Automation
+}
+
+// Scheduler runs automations. Create one with New and start it with Run.
+type Scheduler struct {
+	client      *hue.Client
+	automations []Automation
+	logger      *log.Logger
+}
+
+// Option allows to customize a Scheduler.
+type Option func(*Scheduler)
+
+// WithLogger sets the logger used to report firings and errors. Nothing is
+// logged by default.
+func WithLogger(l *log.Logger) Option {
+	return func(s *Scheduler) {
+		s.logger = l
+	}
+}
+
+// New returns a new scheduler running the automations of the given config
+// through the given client.
+func New(client *hue.Client, cfg *Config, opts ...Option) *Scheduler {
+	s := &Scheduler{
+		client:      client,
+		automations: cfg.Automations,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// Upcoming returns the next n firings after the given time, in order.
+func (s *Scheduler) Upcoming(after time.Time, n int) []Firing {
+	next := s.nextFirings(after)
+
+	var firings []Firing
+	for len(firings) < n && len(next) > 0 {
+		i := earliest(next)
+		firings = append(firings, Firing{Time: next[i], Automation: &s.automations[i]})
+
+		if t, ok := s.automations[i].trigger.next(next[i]); ok {
+			next[i] = t
+		} else {
+			delete(next, i)
+		}
+	}
+
+	return firings
+}
+
+// maxSleep bounds how long the scheduler sleeps at once, so firings are not
+// delayed much when the host is suspended or its clock changes.
+const maxSleep = time.Minute
+
+// Run runs automations until the context is canceled.
+func (s *Scheduler) Run(ctx context.Context) error {
+	next := s.nextFirings(time.Now())
+
+	for {
+		if len(next) == 0 {
+			return errors.New("no automation will ever fire again")
+		}
+
+		now := time.Now()
+		for _, i := range sortedIndexes(next) {
+			if next[i].After(now) {
+				continue
+			}
+
+			a := &s.automations[i]
+			s.logf("Running %s (scheduled at %s)", a.Name, next[i].Format(time.Kitchen))
+			s.runAutomation(a)
+
+			if t, ok := a.trigger.next(now); ok {
+				next[i] = t
+			} else {
+				delete(next, i)
+			}
+		}
+
+		if len(next) == 0 {
+			continue
+		}
+
+		wait := time.Until(next[earliest(next)])
+		if wait > maxSleep {
+			wait = maxSleep
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (s *Scheduler) runAutomation(a *Automation) {
+	for i := range a.Actions {
+		if err := s.runAction(&a.Actions[i]); err != nil {
+			s.logf("%s: %s: %v", a.Name, a.Actions[i].String(), err)
+		}
+	}
+}
+
+// nextFirings returns the next firing time of each automation after the given
+// time, indexed by automation.
+func (s *Scheduler) nextFirings(after time.Time) map[int]time.Time {
+	next := make(map[int]time.Time, len(s.automations))
+	for i := range s.automations {
+		if t, ok := s.automations[i].trigger.next(after); ok {
+			next[i] = t
+		}
+	}
+
+	return next
+}
+
+func (s *Scheduler) logf(format string, v ...interface{}) {
+	if s.logger != nil {
+		s.logger.Printf(format, v...)
+	}
+}
+
+// earliest returns the index of the earliest firing, the first automation
+// winning ties.
+func earliest(next map[int]time.Time) int {
+	idx := sortedIndexes(next)
+	best := idx[0]
+	for _, i := range idx[1:] {
+		if next[i].Before(next[best]) {
+			best = i
+		}
+	}
+
+	return best
+}
+
+func sortedIndexes(next map[int]time.Time) []int {
+	idx := make([]int, 0, len(next))
+	for i := range next {
+		idx = append(idx, i)
+	}
+	sort.Ints(idx)
+
+	return idx
+}
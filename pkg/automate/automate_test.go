@@ -0,0 +1,287 @@
+package automate
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skwair/huectl/pkg/sun"
+)
+
+var (
+	paris  = &sun.Location{Latitude: 48.8566, Longitude: 2.3522}
+	tromso = &sun.Location{Latitude: 69.6492, Longitude: 18.9553}
+
+	cest = time.FixedZone("CEST", 2*60*60)
+)
+
+func TestTriggerNext(t *testing.T) {
+	sunset, _ := paris.Sunset(time.Date(2021, time.June, 21, 12, 0, 0, 0, cest))
+	nextSunset, _ := paris.Sunset(time.Date(2021, time.June, 22, 12, 0, 0, 0, cest))
+	nextSunrise, _ := paris.Sunrise(time.Date(2021, time.June, 22, 12, 0, 0, 0, cest))
+
+	tests := []struct {
+		name     string
+		when     string
+		location *sun.Location
+		after    time.Time
+		want     time.Time
+	}{
+		{
+			name:  "cron, same day",
+			when:  "30 7 * * 1-5",
+			after: time.Date(2021, time.June, 21, 6, 0, 0, 0, cest),
+			want:  time.Date(2021, time.June, 21, 7, 30, 0, 0, cest),
+		},
+		{
+			name:  "cron, after the weekend",
+			when:  "30 7 * * 1-5",
+			after: time.Date(2021, time.June, 25, 8, 0, 0, 0, cest),
+			want:  time.Date(2021, time.June, 28, 7, 30, 0, 0, cest),
+		},
+		{
+			name:  "cron, strictly after",
+			when:  "@hourly",
+			after: time.Date(2021, time.June, 21, 6, 0, 0, 0, cest),
+			want:  time.Date(2021, time.June, 21, 7, 0, 0, 0, cest),
+		},
+		{
+			name:     "sunset",
+			when:     "sunset",
+			location: paris,
+			after:    time.Date(2021, time.June, 21, 12, 0, 0, 0, cest),
+			want:     sunset,
+		},
+		{
+			name:     "sunset with a negative offset",
+			when:     "sunset - 30m",
+			location: paris,
+			after:    time.Date(2021, time.June, 21, 12, 0, 0, 0, cest),
+			want:     sunset.Add(-30 * time.Minute),
+		},
+		{
+			name:     "sunset with a negative offset, already passed",
+			when:     "Sunset-30m",
+			location: paris,
+			after:    sunset.Add(-10 * time.Minute),
+			want:     nextSunset.Add(-30 * time.Minute),
+		},
+		{
+			name:     "sunrise with a positive offset",
+			when:     "sunrise+1h30m",
+			location: paris,
+			after:    time.Date(2021, time.June, 21, 12, 0, 0, 0, cest),
+			want:     nextSunrise.Add(90 * time.Minute),
+		},
+		{
+			// The sunrise of the next day, moved to the current one.
+			name:     "sunrise with an offset crossing midnight",
+			when:     "sunrise-6h",
+			location: paris,
+			after:    time.Date(2021, time.June, 21, 12, 0, 0, 0, cest),
+			want:     nextSunrise.Add(-6 * time.Hour),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trigger, err := parseTrigger(tt.when, tt.location)
+			if err != nil {
+				t.Fatalf("unable to parse trigger: %v", err)
+			}
+
+			next, ok := trigger.next(tt.after)
+			if !ok {
+				t.Fatalf("expected the trigger to fire")
+			}
+			if !next.Equal(tt.want) {
+				t.Errorf("expected the trigger to fire at %s, got %s", tt.want, next)
+			}
+		})
+	}
+}
+
+func TestSunTriggerPolarNight(t *testing.T) {
+	trigger, err := parseTrigger("sunrise", tromso)
+	if err != nil {
+		t.Fatalf("unable to parse trigger: %v", err)
+	}
+
+	// The sun does not rise in Tromsø from late November to mid-January.
+	after := time.Date(2021, time.December, 1, 12, 0, 0, 0, time.UTC)
+	next, ok := trigger.next(after)
+	if !ok {
+		t.Fatalf("expected the sun to rise again")
+	}
+	if next.Year() != 2022 || next.Month() != time.January {
+		t.Errorf("expected the first sunrise in January 2022, got %s", next)
+	}
+	if _, ok = tromso.Sunrise(next.AddDate(0, 0, -1)); ok {
+		t.Errorf("expected %s to be the first sunrise after the polar night", next)
+	}
+}
+
+func TestParseTriggerErrors(t *testing.T) {
+	tests := []struct {
+		when     string
+		location *sun.Location
+		wantErr  string
+	}{
+		{when: "sunset", wantErr: "sunset triggers require a location"},
+		{when: "sunrise+soon", location: paris, wantErr: "invalid offset"},
+		{when: "61 * * * *", wantErr: "invalid cron expression"},
+		{when: "", wantErr: "invalid cron expression"},
+	}
+
+	for _, tt := range tests {
+		if _, err := parseTrigger(tt.when, tt.location); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("parseTrigger(%q): expected an error containing %q, got %v", tt.when, tt.wantErr, err)
+		}
+	}
+}
+
+func TestSchedulerUpcoming(t *testing.T) {
+	on := true
+	cfg := &Config{
+		Location: paris,
+		Automations: []Automation{
+			{Name: "lights out", When: "0 23 * * *", Actions: []Action{{Group: "Living", On: new(bool)}}},
+			{Name: "evening", When: "sunset-30m", Actions: []Action{{Scene: "Relax", Group: "Living"}}},
+			{Name: "late", When: "0 23 * * *", Actions: []Action{{Lights: []string{"Desk"}, On: &on}}},
+		},
+	}
+	if err := cfg.validate(); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+
+	after := time.Date(2021, time.June, 21, 12, 0, 0, 0, cest)
+	sunset, _ := paris.Sunset(after)
+	nextSunset, _ := paris.Sunset(after.AddDate(0, 0, 1))
+
+	firings := New(nil, cfg).Upcoming(after, 5)
+
+	want := []struct {
+		name string
+		at   time.Time
+	}{
+		{"evening", sunset.Add(-30 * time.Minute)},
+		// Ties are broken by the order of the automations.
+		{"lights out", time.Date(2021, time.June, 21, 23, 0, 0, 0, cest)},
+		{"late", time.Date(2021, time.June, 21, 23, 0, 0, 0, cest)},
+		{"evening", nextSunset.Add(-30 * time.Minute)},
+		{"lights out", time.Date(2021, time.June, 22, 23, 0, 0, 0, cest)},
+	}
+	if len(firings) != len(want) {
+		t.Fatalf("expected %d firings, got %d", len(want), len(firings))
+	}
+	for i, f := range firings {
+		if f.Automation.Name != want[i].name || !f.Time.Equal(want[i].at) {
+			t.Errorf("firing #%d: expected %s at %s, got %s at %s", i+1, want[i].name, want[i].at, f.Automation.Name, f.Time)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{
+			name: "valid",
+			content: `
+location:
+  latitude: 48.8566
+  longitude: 2.3522
+automations:
+  - when: sunset
+    actions:
+      - group: Living
+        on: true
+        brightness: 80
+`,
+		},
+		{
+			name: "sun trigger without location",
+			content: `
+automations:
+  - name: evening
+    when: sunset
+    actions:
+      - scene: Relax
+`,
+			wantErr: "evening: sunset triggers require a location",
+		},
+		{
+			name: "invalid latitude",
+			content: `
+location:
+  latitude: 91
+  longitude: 0
+automations:
+  - when: "@daily"
+    actions:
+      - scene: Relax
+`,
+			wantErr: "latitude must be between -90 and 90",
+		},
+		{
+			name: "invalid action",
+			content: `
+automations:
+  - when: "@daily"
+    actions:
+      - lights: [Desk]
+        brightness: 120
+`,
+			wantErr: "automation #1: action #1: brightness must be between 0 and 100",
+		},
+		{
+			name: "unknown field",
+			content: `
+automations:
+  - when: "@daily"
+    action:
+      - scene: Relax
+`,
+			wantErr: "unable to decode automations file",
+		},
+	}
+
+	dir, err := ioutil.TempDir("", "automate")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "automations.yaml")
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ioutil.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatalf("unable to write automations file: %v", err)
+			}
+
+			cfg, err := Load(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected an error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unable to load automations: %v", err)
+			}
+
+			if name := cfg.Automations[0].Name; name != "automation #1" {
+				t.Errorf("expected a default name, got %q", name)
+			}
+			if cfg.Automations[0].trigger == nil {
+				t.Errorf("expected the trigger to be parsed")
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+// Package cache stores a local copy of the resources managed by a Hue bridge,
+// so they can be looked up without waiting for the bridge, e.g. to resolve
+// names, complete commands in a shell or list lights while offline.
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/skwair/huectl/pkg/hue"
+)
+
+// formatVersion is the version of the cache file format. Caches written with
+// another version are ignored.
+const formatVersion = 1
+
+// ErrNoInventory is returned by Load when there is no usable inventory cached
+// for the bridge.
+var ErrNoInventory = errors.New("no inventory cached for this bridge")
+
+// Inventory is a snapshot of the resources managed by a bridge.
+type Inventory struct {
+	Version   int         `json:"version"`
+	BridgeID  string      `json:"bridge_id"`
+	FetchedAt time.Time   `json:"fetched_at"`
+	ETag      string      `json:"etag"`
+	Lights    []hue.Light `json:"lights"`
+	Groups    []hue.Group `json:"groups"`
+	Scenes    []hue.Scene `json:"scenes"`
+}
+
+// Light returns the light with the given ID or, failing that, the light with
+// the given name, ignoring case. It returns nil if there is none.
+func (inv *Inventory) Light(ref string) *hue.Light { return hue.FindLight(inv.Lights, ref) }
+
+// Group returns the group with the given ID or, failing that, the group with
+// the given name, ignoring case. It returns nil if there is none.
+func (inv *Inventory) Group(ref string) *hue.Group { return hue.FindGroup(inv.Groups, ref) }
+
+// Scene returns the scene with the given ID or, failing that, the scene with
+// the given name, ignoring case. Scenes with the same name are common (one per
+// room), so group can be set to only consider scenes of this group.
+// It returns nil if there is none.
+func (inv *Inventory) Scene(ref, group string) *hue.Scene {
+	for i := range inv.Scenes {
+		if inv.Scenes[i].ID == ref {
+			return &inv.Scenes[i]
+		}
+	}
+
+	for i := range inv.Scenes {
+		s := &inv.Scenes[i]
+		if strings.EqualFold(s.Name, ref) && (group == "" || s.Group == group) {
+			return s
+		}
+	}
+
+	return nil
+}
+
+// Age returns how long ago the inventory was fetched from the bridge.
+func (inv *Inventory) Age() time.Duration { return time.Since(inv.FetchedAt) }
+
+// Cache is an inventory cache stored on disk. Create one with New.
+type Cache struct {
+	path     string
+	bridgeID string
+	ttl      time.Duration
+}
+
+// New returns a cache for the given bridge, stored in the user cache
+// directory, whose content is considered stale after the given TTL.
+func New(bridgeID string, ttl time.Duration) (*Cache, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return nil, fmt.Errorf("unable to find user cache dir: %w", err)
+	}
+
+	return &Cache{
+		path:     filepath.Join(dir, "huectl", "inventory.json"),
+		bridgeID: bridgeID,
+		ttl:      ttl,
+	}, nil
+}
+
+// Path returns the path of the cache file.
+func (c *Cache) Path() string { return c.path }
+
+// Inventory returns the cached inventory if it is fresh, or fetches it from
+// the bridge and updates the cache otherwise.
+func (c *Cache) Inventory(client *hue.Client) (*Inventory, error) {
+	inv, err := c.Load()
+	if err == nil && inv.Age() < c.ttl {
+		return inv, nil
+	}
+
+	inv, _, err = c.Refresh(client)
+	return inv, err
+}
+
+// Refresh fetches the inventory from the bridge and updates the cache,
+// regardless of its age. It also reports whether the lights, groups or scenes
+// were added, removed or renamed since the previous inventory.
+func (c *Cache) Refresh(client *hue.Client) (inv *Inventory, changed bool, err error) {
+	lights, err := client.Lights()
+	if err != nil {
+		return nil, false, fmt.Errorf("unable to list lights: %w", err)
+	}
+
+	groups, err := client.Groups()
+	if err != nil {
+		return nil, false, fmt.Errorf("unable to list groups: %w", err)
+	}
+
+	scenes, err := client.Scenes()
+	if err != nil {
+		return nil, false, fmt.Errorf("unable to list scenes: %w", err)
+	}
+
+	sort.Slice(lights, func(i, j int) bool { return hue.LessID(lights[i].ID, lights[j].ID) })
+	sort.Slice(groups, func(i, j int) bool { return hue.LessID(groups[i].ID, groups[j].ID) })
+	sort.Slice(scenes, func(i, j int) bool { return scenes[i].Name < scenes[j].Name })
+
+	inv = &Inventory{
+		Version:   formatVersion,
+		BridgeID:  c.bridgeID,
+		FetchedAt: time.Now(),
+		Lights:    lights,
+		Groups:    groups,
+		Scenes:    scenes,
+	}
+	inv.ETag = computeETag(inv)
+
+	changed = true
+	if prev, err := c.Load(); err == nil {
+		changed = prev.ETag != inv.ETag
+	}
+
+	// Failing to save the cache only makes the next lookup slower.
+	_ = c.save(inv)
+
+	return inv, changed, nil
+}
+
+// Load returns the cached inventory, whatever its age.
+// It returns ErrNoInventory if nothing usable is cached for the bridge.
+func (c *Cache) Load() (*Inventory, error) {
+	f, err := os.Open(c.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNoInventory
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var inv Inventory
+	if err = json.NewDecoder(f).Decode(&inv); err != nil {
+		return nil, fmt.Errorf("unable to decode cache: %w", err)
+	}
+
+	if inv.Version != formatVersion || inv.BridgeID != c.bridgeID {
+		return nil, ErrNoInventory
+	}
+
+	return &inv, nil
+}
+
+// Clear removes the cache file.
+func (c *Cache) Clear() error {
+	if err := os.Remove(c.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (c *Cache) save(inv *Inventory) error {
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return fmt.Errorf("unable to create cache directory: %w", err)
+	}
+
+	// Write to a temporary file first so concurrent readers, such as shell
+	// completions, never see a partially written cache.
+	tmp := c.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("unable to create cache file: %w", err)
+	}
+
+	if err = json.NewEncoder(f).Encode(inv); err != nil {
+		f.Close()
+		return fmt.Errorf("unable to serialize cache: %w", err)
+	}
+
+	if err = f.Close(); err != nil {
+		return fmt.Errorf("unable to write cache file: %w", err)
+	}
+
+	return os.Rename(tmp, c.path)
+}
+
+// computeETag identifies the structure of an inventory: which resources exist
+// and how they are named, ignoring states that change all the time.
+func computeETag(inv *Inventory) string {
+	h := sha256.New()
+	for _, l := range inv.Lights {
+		fmt.Fprintf(h, "light\x00%s\x00%s\x00", l.ID, l.Name)
+	}
+	for _, g := range inv.Groups {
+		fmt.Fprintf(h, "group\x00%s\x00%s\x00%s\x00", g.ID, g.Name, strings.Join(g.Lights, ","))
+	}
+	for _, s := range inv.Scenes {
+		fmt.Fprintf(h, "scene\x00%s\x00%s\x00%s\x00", s.ID, s.Name, s.LastUpdated)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
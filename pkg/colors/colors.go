@@ -0,0 +1,82 @@
+// Package colors resolves human friendly color names and hex codes to RGB
+// values that can be converted for Hue lights.
+package colors
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RGB is a sRGB color.
+type RGB struct {
+	R, G, B uint8
+}
+
+// Hex returns the color formatted as #rrggbb.
+func (c RGB) Hex() string { return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B) }
+
+// named is a subset of the CSS named colors, keeping those that render
+// reasonably on Hue lights.
+var named = map[string]RGB{
+	"amber":     {255, 191, 0},
+	"aqua":      {0, 255, 255},
+	"blue":      {0, 0, 255},
+	"coral":     {255, 127, 80},
+	"crimson":   {220, 20, 60},
+	"cyan":      {0, 255, 255},
+	"gold":      {255, 215, 0},
+	"green":     {0, 255, 0},
+	"indigo":    {75, 0, 130},
+	"lavender":  {230, 230, 250},
+	"lime":      {50, 205, 50},
+	"magenta":   {255, 0, 255},
+	"mint":      {152, 255, 152},
+	"orange":    {255, 165, 0},
+	"orchid":    {218, 112, 214},
+	"peach":     {255, 218, 185},
+	"pink":      {255, 192, 203},
+	"purple":    {128, 0, 128},
+	"red":       {255, 0, 0},
+	"salmon":    {250, 128, 114},
+	"skyblue":   {135, 206, 235},
+	"teal":      {0, 128, 128},
+	"turquoise": {64, 224, 208},
+	"violet":    {238, 130, 238},
+	"white":     {255, 255, 255},
+	"yellow":    {255, 255, 0},
+}
+
+// Names returns the sorted list of known color names.
+func Names() []string {
+	names := make([]string, 0, len(named))
+	for name := range named {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Parse returns the color matching the given name (e.g. "orange") or
+// hex code (e.g. "#ffa500" or "ffa500").
+func Parse(s string) (RGB, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+
+	if c, ok := named[s]; ok {
+		return c, nil
+	}
+
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) != 6 {
+		return RGB{}, fmt.Errorf("unknown color %q", s)
+	}
+
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return RGB{}, fmt.Errorf("unknown color %q", s)
+	}
+
+	return RGB{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v)}, nil
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -10,13 +11,204 @@ import (
 
 // Config is the configuration of the `huectl` CLI.
 type Config struct {
-	BridgeID        string `yaml:"bridge_id"`
-	BridgeURL       string `yaml:"bridge_url"`
-	ClientID        string `yaml:"client_id"`
+	BridgeID  string `yaml:"bridge_id"`
+	BridgeURL string `yaml:"bridge_url"`
+	ClientID  string `yaml:"client_id,omitempty"`
+	// CertFingerprint is the SHA-256 fingerprint of the certificate of the
+	// bridge, or the SHA-1 fingerprint for configurations created by earlier
+	// versions of huectl, replaced on first use.
 	CertFingerprint string `yaml:"cert_fingerprint"`
+	// VerifyBridgeCA is set when the certificate of the bridge is issued by
+	// the Signify root CA, requiring renewed certificates to be issued by it
+	// too.
+	VerifyBridgeCA bool `yaml:"verify_bridge_ca,omitempty"`
+	// ClientKey is the key used to stream to entertainment groups. It is
+	// empty for users registered before huectl requested one, see
+	// `huectl init --regenerate-key`.
+	ClientKey string `yaml:"client_key,omitempty"`
+	// SecretStore is where ClientID and ClientKey are stored, one of
+	// SecretStores. They are only written to the configuration file for
+	// SecretStorePlaintext, which is assumed when empty.
+	SecretStore string `yaml:"secret_store,omitempty"`
 }
 
-// Read reads the CLI configuration from the user configuration directory.
+// Environment variables overriding the configuration file, see Load. They
+// allow using huectl without running `huectl init` first, e.g. in containers.
+const (
+	// EnvConfig is the path of the configuration file, see AbsolutePath.
+	EnvConfig          = "HUECTL_CONFIG"
+	EnvBridgeURL       = "HUECTL_BRIDGE_URL"
+	EnvBridgeID        = "HUECTL_BRIDGE_ID"
+	EnvCertFingerprint = "HUECTL_CERT_FINGERPRINT"
+	// EnvClientID and EnvClientKey replace the credentials of the secret
+	// store, see Config.LoadSecrets.
+	EnvClientID  = "HUECTL_CLIENT_ID"
+	EnvClientKey = "HUECTL_CLIENT_KEY"
+)
+
+// EnvPassphrase is the environment variable giving the passphrase of the
+// encrypted secrets file, e.g. when huectl runs as a service.
+const EnvPassphrase = "HUECTL_PASSPHRASE"
+
+// LoadSecrets fills ClientID and ClientKey from the secret store of the
+// configuration, unless the client ID is already set, by a plaintext
+// configuration file or an override (see Load). The passphrase function is
+// only called for stores encrypted with a passphrase.
+func (c *Config) LoadSecrets(passphrase PassphraseFunc) error {
+	if c.ClientID != "" {
+		return nil
+	}
+
+	store, err := OpenSecretStore(c.SecretStore, c.BridgeID, passphrase)
+	if err != nil || store == nil {
+		return err
+	}
+
+	if c.ClientID, err = store.Get(SecretClientID); err != nil {
+		if errors.Is(err, ErrSecretNotFound) {
+			return fmt.Errorf("client ID not found in %s secret store, please run `huectl init` again", c.SecretStore)
+		}
+		return err
+	}
+
+	// Users registered before huectl requested a client key have none.
+	c.ClientKey, err = store.Get(SecretClientKey)
+	if err != nil && !errors.Is(err, ErrSecretNotFound) {
+		return err
+	}
+
+	return nil
+}
+
+// SaveSecrets writes ClientID and ClientKey to the secret store of the
+// configuration, and returns the configuration to write to the configuration
+// file, without them unless they are stored in plaintext.
+func (c *Config) SaveSecrets(passphrase PassphraseFunc) (*Config, error) {
+	store, err := OpenSecretStore(c.SecretStore, c.BridgeID, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if store == nil {
+		return c, nil
+	}
+
+	for name, v := range map[string]string{SecretClientID: c.ClientID, SecretClientKey: c.ClientKey} {
+		if v == "" {
+			err = store.Delete(name)
+		} else {
+			err = store.Set(name, v)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	fileCfg := *c
+	fileCfg.ClientID, fileCfg.ClientKey = "", ""
+
+	return &fileCfg, nil
+}
+
+// DeleteSecrets deletes the credentials from the secret store of the
+// configuration, e.g. after moving them to another one.
+func (c *Config) DeleteSecrets(passphrase PassphraseFunc) error {
+	store, err := OpenSecretStore(c.SecretStore, c.BridgeID, passphrase)
+	if err != nil || store == nil {
+		return err
+	}
+
+	for _, name := range []string{SecretClientID, SecretClientKey} {
+		if err = store.Delete(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Overrides are settings taking precedence over the configuration file, e.g.
+// given on the command line. Empty fields are ignored.
+type Overrides struct {
+	BridgeURL       string
+	BridgeID        string
+	CertFingerprint string
+	ClientID        string
+}
+
+// EnvOverrides returns the overrides given by environment variables.
+func EnvOverrides() Overrides {
+	return Overrides{
+		BridgeURL:       os.Getenv(EnvBridgeURL),
+		BridgeID:        os.Getenv(EnvBridgeID),
+		CertFingerprint: os.Getenv(EnvCertFingerprint),
+		ClientID:        os.Getenv(EnvClientID),
+	}
+}
+
+// Merge returns o, with its empty fields taken from other.
+func (o Overrides) Merge(other Overrides) Overrides {
+	pick := func(a, b string) string {
+		if a != "" {
+			return a
+		}
+		return b
+	}
+
+	return Overrides{
+		BridgeURL:       pick(o.BridgeURL, other.BridgeURL),
+		BridgeID:        pick(o.BridgeID, other.BridgeID),
+		CertFingerprint: pick(o.CertFingerprint, other.CertFingerprint),
+		ClientID:        pick(o.ClientID, other.ClientID),
+	}
+}
+
+// IsZero reports whether o overrides nothing.
+func (o Overrides) IsZero() bool {
+	return o == Overrides{}
+}
+
+// Load returns the effective configuration: the given overrides take
+// precedence over environment variables, which take precedence over the
+// configuration file. When the client ID is overridden, the client key is
+// taken from HUECTL_CLIENT_KEY, as a stored one would belong to another user.
+//
+// The configuration file may be missing if the bridge URL and client ID are
+// overridden, otherwise an error satisfying os.IsNotExist is returned.
+func Load(overrides Overrides) (*Config, error) {
+	cfg, err := Read()
+	missing := os.IsNotExist(err)
+	if err != nil && !missing {
+		return nil, err
+	}
+	if missing {
+		cfg = &Config{}
+	}
+
+	o := overrides.Merge(EnvOverrides())
+	if o.BridgeURL != "" {
+		cfg.BridgeURL = o.BridgeURL
+	}
+	if o.BridgeID != "" {
+		cfg.BridgeID = o.BridgeID
+	}
+	if o.CertFingerprint != "" {
+		cfg.CertFingerprint = o.CertFingerprint
+	}
+	if o.ClientID != "" {
+		cfg.ClientID, cfg.ClientKey = o.ClientID, os.Getenv(EnvClientKey)
+	}
+
+	if missing && (cfg.BridgeURL == "" || cfg.ClientID == "") {
+		if cfg.BridgeURL == "" && cfg.ClientID == "" {
+			return nil, err
+		}
+		return nil, fmt.Errorf("no configuration file found, both the bridge URL and the client ID must be given (%s, %s)", EnvBridgeURL, EnvClientID)
+	}
+
+	return cfg, nil
+}
+
+// Read reads the CLI configuration file, without applying any override.
 func Read() (*Config, error) {
 	cfgPath, err := AbsolutePath()
 	if err != nil {
@@ -40,8 +232,31 @@ func Read() (*Config, error) {
 	return &cfg, nil
 }
 
-// AbsolutePath returns the absolute path of the configuration file.
+// path is the path of the configuration file given to SetPath.
+var path string
+
+// SetPath sets the path of the configuration file, e.g. given on the command
+// line, taking precedence over HUECTL_CONFIG.
+func SetPath(p string) {
+	path = p
+}
+
+// AbsolutePath returns the absolute path of the configuration file: the one
+// given to SetPath or by HUECTL_CONFIG if any, in the user configuration
+// directory otherwise.
 func AbsolutePath() (string, error) {
+	p := path
+	if p == "" {
+		p = os.Getenv(EnvConfig)
+	}
+	if p != "" {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return "", fmt.Errorf("invalid config path %q: %w", p, err)
+		}
+		return abs, nil
+	}
+
 	cfgDir, err := os.UserConfigDir()
 	if err != nil {
 		return "", fmt.Errorf("unable to find user config dir: %w", err)
@@ -0,0 +1,352 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/zalando/go-keyring"
+	"golang.org/x/crypto/scrypt"
+)
+
+// ErrSecretNotFound is returned by secret stores when a secret does not exist.
+var ErrSecretNotFound = errors.New("secret not found")
+
+// SecretStore stores secrets, such as the credentials of the bridge user,
+// outside of the configuration file.
+type SecretStore interface {
+	// Get returns the secret with the given name, or ErrSecretNotFound.
+	Get(name string) (string, error)
+	// Set creates or replaces the secret with the given name.
+	Set(name, value string) error
+	// Delete deletes the secret with the given name, if it exists.
+	Delete(name string) error
+}
+
+// Secret stores, as set in Config.SecretStore.
+const (
+	// SecretStorePlaintext keeps secrets in the configuration file. It is
+	// used by configurations created before secret stores were supported.
+	SecretStorePlaintext = "plaintext"
+	// SecretStoreKeyring keeps secrets in the keyring of the system: the
+	// Secret Service (e.g. GNOME Keyring or KWallet) on Linux, the Keychain
+	// on macOS and the Credential Manager on Windows.
+	SecretStoreKeyring = "keyring"
+	// SecretStoreFile keeps secrets in a file encrypted with a passphrase.
+	SecretStoreFile = "file"
+)
+
+// SecretStores are the names of the supported secret stores.
+var SecretStores = []string{SecretStoreKeyring, SecretStoreFile, SecretStorePlaintext}
+
+// Names of the secrets stored by huectl.
+const (
+	SecretClientID  = "client_id"
+	SecretClientKey = "client_key"
+)
+
+// PassphraseFunc returns the passphrase of a secret store encrypted with a
+// passphrase. It is only called when the store is first accessed.
+type PassphraseFunc func() ([]byte, error)
+
+// OpenSecretStore returns the secret store with the given name, holding the
+// secrets of the given bridge, or nil for SecretStorePlaintext.
+func OpenSecretStore(name, bridgeID string, passphrase PassphraseFunc) (SecretStore, error) {
+	switch name {
+	case "", SecretStorePlaintext:
+		return nil, nil
+	case SecretStoreKeyring:
+		return NewKeyringStore(bridgeID), nil
+	case SecretStoreFile:
+		path, err := SecretsPath()
+		if err != nil {
+			return nil, err
+		}
+		return NewFileStore(path, passphrase), nil
+	default:
+		return nil, fmt.Errorf("unknown secret store %q", name)
+	}
+}
+
+// KeyringStore keeps secrets in the keyring of the system. Create one with
+// NewKeyringStore.
+type KeyringStore struct {
+	prefix string
+}
+
+// keyringService is the service secrets are stored under in the keyring.
+const keyringService = "huectl"
+
+// NewKeyringStore returns a store keeping the secrets of the given bridge in
+// the keyring of the system.
+func NewKeyringStore(bridgeID string) *KeyringStore {
+	return &KeyringStore{prefix: bridgeID + "/"}
+}
+
+// Get implements SecretStore.
+func (s *KeyringStore) Get(name string) (string, error) {
+	v, err := keyring.Get(keyringService, s.prefix+name)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return "", ErrSecretNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("unable to read secret from keyring: %w", err)
+	}
+
+	return v, nil
+}
+
+// Set implements SecretStore.
+func (s *KeyringStore) Set(name, value string) error {
+	if err := keyring.Set(keyringService, s.prefix+name, value); err != nil {
+		return fmt.Errorf("unable to write secret to keyring: %w", err)
+	}
+
+	return nil
+}
+
+// Delete implements SecretStore.
+func (s *KeyringStore) Delete(name string) error {
+	err := keyring.Delete(keyringService, s.prefix+name)
+	if err != nil && !errors.Is(err, keyring.ErrNotFound) {
+		return fmt.Errorf("unable to delete secret from keyring: %w", err)
+	}
+
+	return nil
+}
+
+// FileStore keeps secrets in a file encrypted with AES-GCM, using a key
+// derived from a passphrase with scrypt. Create one with NewFileStore.
+type FileStore struct {
+	path       string
+	passphrase PassphraseFunc
+
+	// Set once the file has been read.
+	loaded  bool
+	salt    []byte
+	key     []byte
+	secrets map[string]string
+}
+
+// secretsFile is the content of the file of a FileStore.
+type secretsFile struct {
+	Version int    `json:"version"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// Parameters of the key derivation, as recommended by the scrypt package for
+// interactive logins.
+const (
+	scryptN       = 1 << 15
+	scryptR       = 8
+	scryptP       = 1
+	scryptKeySize = 32
+	saltSize      = 16
+)
+
+// NewFileStore returns a store keeping secrets in the file at the given path,
+// encrypted with the passphrase returned by the given function.
+func NewFileStore(path string, passphrase PassphraseFunc) *FileStore {
+	return &FileStore{path: path, passphrase: passphrase}
+}
+
+// SecretsPath returns the absolute path of the encrypted secrets file.
+func SecretsPath() (string, error) {
+	cfgPath, err := AbsolutePath()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(filepath.Dir(cfgPath), "secrets.enc"), nil
+}
+
+// Get implements SecretStore.
+func (s *FileStore) Get(name string) (string, error) {
+	if err := s.load(); err != nil {
+		return "", err
+	}
+
+	v, ok := s.secrets[name]
+	if !ok {
+		return "", ErrSecretNotFound
+	}
+
+	return v, nil
+}
+
+// Set implements SecretStore.
+func (s *FileStore) Set(name, value string) error {
+	if err := s.load(); err != nil {
+		return err
+	}
+
+	s.secrets[name] = value
+
+	return s.save()
+}
+
+// Delete implements SecretStore.
+func (s *FileStore) Delete(name string) error {
+	if err := s.load(); err != nil {
+		return err
+	}
+
+	if _, ok := s.secrets[name]; !ok {
+		return nil
+	}
+	delete(s.secrets, name)
+
+	return s.save()
+}
+
+// load reads and decrypts the secrets file. A missing file is read as an
+// empty one, the passphrase only being asked when it is saved.
+func (s *FileStore) load() error {
+	if s.loaded {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		s.secrets = make(map[string]string)
+		s.loaded = true
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read secrets file: %w", err)
+	}
+
+	var f secretsFile
+	if err = json.Unmarshal(data, &f); err != nil {
+		return fmt.Errorf("unable to decode secrets file: %w", err)
+	}
+	if f.Version != 1 {
+		return fmt.Errorf("unsupported secrets file version %d", f.Version)
+	}
+
+	key, err := s.deriveKey(f.Salt)
+	if err != nil {
+		return err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+
+	plain, err := gcm.Open(nil, f.Nonce, f.Data, nil)
+	if err != nil {
+		return errors.New("unable to decrypt secrets file: wrong passphrase")
+	}
+
+	var secrets map[string]string
+	if err = json.Unmarshal(plain, &secrets); err != nil {
+		return fmt.Errorf("unable to decode secrets: %w", err)
+	}
+
+	s.salt, s.key, s.secrets, s.loaded = f.Salt, key, secrets, true
+
+	return nil
+}
+
+// save encrypts and writes the secrets file, or removes it once empty.
+func (s *FileStore) save() error {
+	if len(s.secrets) == 0 {
+		if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("unable to remove secrets file: %w", err)
+		}
+		return nil
+	}
+
+	if s.key == nil {
+		s.salt = make([]byte, saltSize)
+		if _, err := rand.Read(s.salt); err != nil {
+			return fmt.Errorf("unable to generate salt: %w", err)
+		}
+
+		key, err := s.deriveKey(s.salt)
+		if err != nil {
+			return err
+		}
+		s.key = key
+	}
+
+	gcm, err := newGCM(s.key)
+	if err != nil {
+		return err
+	}
+
+	plain, err := json.Marshal(s.secrets)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return fmt.Errorf("unable to generate nonce: %w", err)
+	}
+
+	data, err := json.Marshal(secretsFile{
+		Version: 1,
+		Salt:    s.salt,
+		Nonce:   nonce,
+		Data:    gcm.Seal(nil, nonce, plain, nil),
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return fmt.Errorf("unable to create secrets directory: %w", err)
+	}
+
+	// Write to a temporary file first so a failure never leaves a truncated
+	// file, losing all secrets.
+	tmp := s.path + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("unable to write secrets file: %w", err)
+	}
+	if err = os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("unable to write secrets file: %w", err)
+	}
+
+	return nil
+}
+
+func (s *FileStore) deriveKey(salt []byte) ([]byte, error) {
+	if s.passphrase == nil {
+		return nil, errors.New("secrets file is encrypted but no passphrase was given")
+	}
+
+	passphrase, err := s.passphrase()
+	if err != nil {
+		return nil, err
+	}
+	if len(passphrase) == 0 {
+		return nil, errors.New("passphrase must not be empty")
+	}
+
+	key, err := scrypt.Key(passphrase, salt, scryptN, scryptR, scryptP, scryptKeySize)
+	if err != nil {
+		return nil, fmt.Errorf("unable to derive key from passphrase: %w", err)
+	}
+
+	return key, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
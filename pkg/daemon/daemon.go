@@ -0,0 +1,263 @@
+// Package daemon implements a long-running process holding a persistent
+// connection to a Hue bridge, which short-lived CLI invocations talk to over a
+// Unix socket instead of connecting to the bridge themselves.
+//
+// The daemon proxies the bridge API as is: a client created with NewClient
+// sends its requests to the daemon, which forwards them to the bridge over a
+// keep-alive connection. Responses of GET requests are cached for a short
+// time, and the cache is cleared by any other request.
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skwair/huectl/pkg/hue"
+)
+
+// DefaultCacheTTL is how long responses of GET requests are cached by default.
+const DefaultCacheTTL = 2 * time.Second
+
+// dialTimeout is how long clients wait to connect to the daemon before
+// considering it is not running.
+const dialTimeout = 100 * time.Millisecond
+
+// ErrNotRunning is returned by NewClient when no daemon is listening.
+var ErrNotRunning = errors.New("daemon is not running")
+
+// Server proxies requests received on a Unix socket to a Hue bridge.
+// Create one with New and start it with Serve.
+type Server struct {
+	client *hue.Client
+	ttl    time.Duration
+	logger *log.Logger
+
+	mu    sync.Mutex
+	cache map[string]*cachedResponse
+}
+
+type cachedResponse struct {
+	status      int
+	contentType string
+	body        []byte
+	expiresAt   time.Time
+}
+
+// Option allows to customize a Server.
+type Option func(*Server)
+
+// WithCacheTTL sets how long responses of GET requests are cached,
+// DefaultCacheTTL if not set. A TTL of zero disables caching.
+func WithCacheTTL(d time.Duration) Option {
+	return func(s *Server) {
+		s.ttl = d
+	}
+}
+
+// WithLogger sets the logger used to log requests. Requests are not logged
+// by default.
+func WithLogger(l *log.Logger) Option {
+	return func(s *Server) {
+		s.logger = l
+	}
+}
+
+// New returns a new daemon forwarding requests to the bridge through the
+// given client.
+func New(client *hue.Client, opts ...Option) *Server {
+	s := &Server{
+		client: client,
+		ttl:    DefaultCacheTTL,
+		cache:  make(map[string]*cachedResponse),
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// Serve accepts connections on the listener until the context is canceled.
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	srv := &http.Server{Handler: s}
+
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+
+	err := srv.Serve(l)
+	if errors.Is(err, http.ErrServerClosed) {
+		return ctx.Err()
+	}
+
+	return err
+}
+
+// ServeHTTP implements the http.Handler interface. Requests are expected on
+// the same paths as the bridge API, /api/<client ID>/<endpoint>; the client ID
+// of the daemon is used whatever the one of the request.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 3)
+	if len(parts) != 3 || parts[0] != "api" {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	endpoint := "/" + parts[2]
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp, cached, err := s.forward(r.Method, endpoint, body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		s.logf("%s %s: %v", r.Method, endpoint, err)
+		return
+	}
+
+	if resp.contentType != "" {
+		w.Header().Set("Content-Type", resp.contentType)
+	}
+	w.WriteHeader(resp.status)
+	_, _ = w.Write(resp.body)
+
+	s.logf("%s %s %d %s (cached: %t)", r.Method, endpoint, resp.status, time.Since(start).Round(time.Millisecond), cached)
+}
+
+// forward sends the request to the bridge, or answers it from the cache.
+func (s *Server) forward(method, endpoint string, body []byte) (*cachedResponse, bool, error) {
+	if method == http.MethodGet {
+		s.mu.Lock()
+		resp, ok := s.cache[endpoint]
+		s.mu.Unlock()
+		if ok && time.Now().Before(resp.expiresAt) {
+			return resp, true, nil
+		}
+	} else {
+		// Anything else may change the state of the bridge.
+		s.mu.Lock()
+		s.cache = make(map[string]*cachedResponse)
+		s.mu.Unlock()
+	}
+
+	r, err := s.client.Do(method, endpoint, body)
+	if err != nil {
+		return nil, false, err
+	}
+	defer r.Body.Close()
+
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, false, err
+	}
+
+	resp := &cachedResponse{
+		status:      r.StatusCode,
+		contentType: r.Header.Get("Content-Type"),
+		body:        b,
+		expiresAt:   time.Now().Add(s.ttl),
+	}
+
+	if method == http.MethodGet && r.StatusCode == http.StatusOK && s.ttl > 0 {
+		s.mu.Lock()
+		s.cache[endpoint] = resp
+		s.mu.Unlock()
+	}
+
+	return resp, false, nil
+}
+
+func (s *Server) logf(format string, v ...interface{}) {
+	if s.logger != nil {
+		s.logger.Printf(format, v...)
+	}
+}
+
+// SocketPath returns the path of the Unix socket of the daemon, in
+// $XDG_RUNTIME_DIR if set or in the user cache directory otherwise.
+func SocketPath() (string, error) {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "huectl.sock"), nil
+	}
+
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to find user cache dir: %w", err)
+	}
+
+	return filepath.Join(dir, "huectl", "daemon.sock"), nil
+}
+
+// Listen listens on the Unix socket at the given path, only accessible to the
+// current user. A socket left behind by a daemon that did not exit cleanly is
+// replaced, but an error is returned if a daemon is already listening.
+func Listen(path string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("unable to create socket directory: %w", err)
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		if conn, err := net.DialTimeout("unix", path, dialTimeout); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("a daemon is already listening on %s", path)
+		}
+		if err = os.Remove(path); err != nil {
+			return nil, fmt.Errorf("unable to remove stale socket: %w", err)
+		}
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to listen on %s: %w", path, err)
+	}
+
+	if err = os.Chmod(path, 0600); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("unable to restrict access to socket: %w", err)
+	}
+
+	return l, nil
+}
+
+// NewClient returns a Hue client sending its requests through the daemon
+// listening on the Unix socket at the given path, or ErrNotRunning if there
+// is none.
+func NewClient(path string, opts ...hue.ClientOption) (*hue.Client, error) {
+	conn, err := net.DialTimeout("unix", path, dialTimeout)
+	if err != nil {
+		return nil, ErrNotRunning
+	}
+	conn.Close()
+
+	httpClient := &http.Client{
+		// Leave time for the daemon to wait for the bridge.
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		},
+	}
+
+	// The client ID is not needed, the daemon uses its own.
+	opts = append([]hue.ClientOption{hue.WithHTTPClient(httpClient)}, opts...)
+
+	return hue.NewClient("http://daemon", "-", opts...), nil
+}
@@ -0,0 +1,445 @@
+// Package doctor diagnoses the connection to a Hue bridge and the health of
+// the devices connected to it, from the configuration of huectl down to the
+// batteries of sensors.
+package doctor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/skwair/huectl/pkg/config"
+	"github.com/skwair/huectl/pkg/hue"
+)
+
+// Status is the outcome of a check.
+type Status string
+
+// Outcomes of checks, from best to worst.
+const (
+	StatusOK      Status = "ok"
+	StatusSkipped Status = "skipped"
+	StatusWarning Status = "warning"
+	StatusFailure Status = "failure"
+)
+
+// severity orders statuses to find the worst one of a report.
+var severity = map[Status]int{StatusOK: 0, StatusSkipped: 0, StatusWarning: 1, StatusFailure: 2}
+
+// Result is the result of a check.
+type Result struct {
+	Check   string   `json:"check"`
+	Status  Status   `json:"status"`
+	Message string   `json:"message"`
+	Details []string `json:"details,omitempty"`
+}
+
+// Report is the result of all checks.
+type Report struct {
+	// Status is the worst status of all checks.
+	Status Status   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+// Exit codes of a command reporting a Report. 1 is left for errors of the
+// command itself.
+const (
+	ExitCodeOK      = 0
+	ExitCodeWarning = 2
+	ExitCodeFailure = 3
+)
+
+// ExitCode returns the exit code of a command reporting r: ExitCodeOK if all
+// checks passed, ExitCodeWarning if some of them raised warnings and
+// ExitCodeFailure if some of them failed.
+func (r *Report) ExitCode() int {
+	switch r.Status {
+	case StatusWarning:
+		return ExitCodeWarning
+	case StatusFailure:
+		return ExitCodeFailure
+	default:
+		return ExitCodeOK
+	}
+}
+
+// Defaults of the options of a Doctor.
+const (
+	DefaultTimeout          = 5 * time.Second
+	DefaultBatteryThreshold = 20
+)
+
+// recommendedChannels are the Zigbee channels Hue bridges can use, chosen to
+// overlap as little as possible with common Wi-Fi channels.
+var recommendedChannels = []int{11, 15, 20, 25}
+
+// Doctor runs checks against a Hue bridge. Create one with New.
+type Doctor struct {
+	timeout          time.Duration
+	batteryThreshold int
+
+	// Set by checks for the following ones.
+	cfg    *config.Config
+	url    *url.URL
+	client *hue.Client
+	bridge *hue.BridgeConfig
+}
+
+// Option allows to customize a Doctor.
+type Option func(*Doctor)
+
+// WithTimeout sets how long to wait for the bridge to answer each check,
+// DefaultTimeout by default.
+func WithTimeout(d time.Duration) Option {
+	return func(doc *Doctor) {
+		doc.timeout = d
+	}
+}
+
+// WithBatteryThreshold sets the battery level, in percent, under which
+// sensors are reported, DefaultBatteryThreshold by default.
+func WithBatteryThreshold(percent int) Option {
+	return func(doc *Doctor) {
+		doc.batteryThreshold = percent
+	}
+}
+
+// New returns a new Doctor.
+func New(opts ...Option) *Doctor {
+	d := &Doctor{
+		timeout:          DefaultTimeout,
+		batteryThreshold: DefaultBatteryThreshold,
+	}
+
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	return d
+}
+
+// check is a check run by a Doctor. Checks run in order and the remaining
+// ones are skipped once one fails, as they depend on the previous ones.
+type check struct {
+	name string
+	run  func() Result
+}
+
+// Run loads the configuration with the given function and runs all checks
+// against its bridge, the configuration itself being checked first.
+func (d *Doctor) Run(load func() (*config.Config, error)) *Report {
+	checks := []check{
+		{"config", func() Result { return d.checkConfig(load) }},
+		{"network", d.checkNetwork},
+		{"tls", d.checkTLS},
+		{"user", d.checkUser},
+		{"software", d.checkSoftware},
+		{"zigbee", d.checkZigbee},
+		{"lights", d.checkLights},
+		{"sensors", d.checkSensors},
+	}
+
+	report := &Report{Status: StatusOK}
+	failed := ""
+	for _, c := range checks {
+		var res Result
+		if failed != "" {
+			res = Result{Status: StatusSkipped, Message: fmt.Sprintf("%s check failed", failed)}
+		} else {
+			res = c.run()
+		}
+		res.Check = c.name
+
+		if res.Status == StatusFailure && failed == "" {
+			failed = c.name
+		}
+		if severity[res.Status] > severity[report.Status] {
+			report.Status = res.Status
+		}
+
+		report.Checks = append(report.Checks, res)
+	}
+
+	return report
+}
+
+func (d *Doctor) checkConfig(load func() (*config.Config, error)) Result {
+	cfg, err := load()
+	if err != nil {
+		return failure("%v", err)
+	}
+
+	u, err := url.Parse(cfg.BridgeURL)
+	if err != nil {
+		return failure("invalid bridge URL %q: %v", cfg.BridgeURL, err)
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return failure("invalid bridge URL %q, expected e.g. https://192.168.1.50", cfg.BridgeURL)
+	}
+	if cfg.ClientID == "" {
+		return failure("no client ID configured")
+	}
+
+	d.cfg, d.url = cfg, u
+
+	verifier := &hue.CertVerifier{Fingerprint: cfg.CertFingerprint}
+	if cfg.VerifyBridgeCA {
+		verifier.BridgeID = cfg.BridgeID
+	}
+	d.client = hue.NewClient(cfg.BridgeURL, cfg.ClientID, hue.WithHTTPClient(&http.Client{
+		Timeout:   d.timeout,
+		Transport: &http.Transport{TLSClientConfig: verifier.TLSConfig()},
+	}))
+
+	switch {
+	case u.Scheme == "https" && cfg.CertFingerprint == "":
+		return warning("no certificate fingerprint pinned, the bridge is not authenticated")
+	case hue.IsLegacyFingerprint(cfg.CertFingerprint):
+		return warning("SHA-1 certificate fingerprint pinned, it is replaced by a SHA-256 one on next use")
+	}
+
+	return ok("bridge %s at %s", orUnknown(cfg.BridgeID), cfg.BridgeURL)
+}
+
+func (d *Doctor) checkNetwork() Result {
+	host, port := d.url.Hostname(), d.url.Port()
+	if port == "" {
+		port = "443"
+		if d.url.Scheme == "http" {
+			port = "80"
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+	defer cancel()
+
+	var details []string
+	if net.ParseIP(host) == nil {
+		addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+		if err != nil {
+			return failure("unable to resolve %s: %v", host, err)
+		}
+		details = append(details, fmt.Sprintf("%s resolves to %s", host, strings.Join(addrs, ", ")))
+	}
+
+	start := time.Now()
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return failure("unable to connect to %s: %v", net.JoinHostPort(host, port), err)
+	}
+	conn.Close()
+
+	res := ok("connected to %s in %s", net.JoinHostPort(host, port), time.Since(start).Round(time.Millisecond))
+	res.Details = details
+
+	return res
+}
+
+func (d *Doctor) checkTLS() Result {
+	if d.url.Scheme != "https" {
+		return warning("the bridge is reached over plain HTTP, requests are not encrypted")
+	}
+
+	certs, err := hue.FetchCertificates(d.url.Host, d.timeout)
+	if err != nil {
+		return failure("%v", err)
+	}
+	cert := certs[0]
+
+	details := []string{
+		"fingerprint " + hue.Fingerprint(cert.Raw),
+		"valid until " + cert.NotAfter.Format("2006-01-02"),
+	}
+	caErr := hue.VerifyBridgeCertificate(cert, certs[1:], d.cfg.BridgeID)
+	if caErr == nil {
+		details = append(details, "issued by the Hue root CA")
+	} else {
+		details = append(details, "not issued by the Hue root CA")
+	}
+
+	// Check the certificate the same way requests do.
+	verifier := &hue.CertVerifier{Fingerprint: d.cfg.CertFingerprint}
+	if d.cfg.VerifyBridgeCA {
+		verifier.BridgeID = d.cfg.BridgeID
+	}
+	raw := make([][]byte, len(certs))
+	for i, c := range certs {
+		raw[i] = c.Raw
+	}
+
+	var res Result
+	switch err = verifier.VerifyPeerCertificate(raw, nil); {
+	case errors.Is(err, hue.ErrCertificateMismatch):
+		res = failure("the certificate of the bridge does not match the pinned one, it may have been renewed or another host impersonates the bridge")
+	case err != nil:
+		res = failure("the certificate of the bridge is not trusted: %v", err)
+	case time.Now().After(cert.NotAfter):
+		res = warning("the certificate of the bridge expired on %s", cert.NotAfter.Format("2006-01-02"))
+	default:
+		res = ok("the certificate of the bridge matches the pinned one")
+	}
+	res.Details = details
+
+	return res
+}
+
+func (d *Doctor) checkUser() Result {
+	const notRegistered = "the user is not registered on the bridge, it may have been deleted"
+
+	bridge, err := d.client.Config()
+	if hue.HasErrorType(err, hue.ErrorTypeUnauthorizedUser) {
+		return failure(notRegistered)
+	}
+	if err != nil {
+		return failure("unable to get the configuration of the bridge: %v", err)
+	}
+
+	// Bridges return part of their configuration to unregistered users.
+	entry, registered := bridge.Whitelist[d.cfg.ClientID]
+	if !registered {
+		return failure(notRegistered)
+	}
+
+	d.bridge = bridge
+
+	res := ok("registered as %q", entry.Name)
+	if entry.LastUseDate != "" {
+		res.Details = append(res.Details, "last used on "+entry.LastUseDate)
+	}
+
+	return res
+}
+
+func (d *Doctor) checkSoftware() Result {
+	b := d.bridge
+	details := []string{fmt.Sprintf("%s, software %s, API %s", orUnknown(b.ModelID), orUnknown(b.SWVersion), orUnknown(b.APIVersion))}
+	if !b.SoftwareUpdate.AutoInstall.On {
+		details = append(details, "automatic updates are disabled")
+	}
+
+	var res Result
+	switch b.SoftwareUpdate.State {
+	case hue.SoftwareUpdateStateNoUpdates:
+		res = ok("up to date")
+	case hue.SoftwareUpdateStateTransferring:
+		res = ok("updates are being downloaded")
+	case hue.SoftwareUpdateStateAnyReadyToInstall, hue.SoftwareUpdateStateAllReadyToInstall:
+		res = warning("updates are ready to install")
+	case hue.SoftwareUpdateStateInstalling:
+		res = warning("updates are being installed, devices may be unavailable")
+	default:
+		res = warning("unknown update state %q", b.SoftwareUpdate.State)
+	}
+	res.Details = details
+
+	return res
+}
+
+func (d *Doctor) checkZigbee() Result {
+	ch := d.bridge.ZigbeeChannel
+	if ch == 0 {
+		return warning("unknown Zigbee channel")
+	}
+
+	for _, r := range recommendedChannels {
+		if ch == r {
+			return ok("channel %d", ch)
+		}
+	}
+
+	return warning("channel %d is not one of the channels recommended by Hue (11, 15, 20 and 25)", ch)
+}
+
+func (d *Doctor) checkLights() Result {
+	lights, err := d.client.Lights()
+	if err != nil {
+		return failure("unable to list lights: %v", err)
+	}
+	sort.Slice(lights, func(i, j int) bool { return hue.LessID(lights[i].ID, lights[j].ID) })
+
+	var unreachable []string
+	for _, l := range lights {
+		if !l.State.Reachable {
+			unreachable = append(unreachable, fmt.Sprintf("light %s (%s) is unreachable", l.ID, l.Name))
+		}
+	}
+
+	if len(unreachable) > 0 {
+		res := warning("%d of %d lights are unreachable", len(unreachable), len(lights))
+		res.Details = unreachable
+		return res
+	}
+
+	return ok("%d lights reachable", len(lights))
+}
+
+func (d *Doctor) checkSensors() Result {
+	sensors, err := d.client.Sensors()
+	if err != nil {
+		return failure("unable to list sensors: %v", err)
+	}
+	// Sort sensors so a device is always reported by the same one.
+	sort.Slice(sensors, func(i, j int) bool { return hue.LessID(sensors[i].ID, sensors[j].ID) })
+
+	var problems []string
+	devices := make(map[string]bool)
+	for _, s := range sensors {
+		// Sensors without unique ID are virtual (e.g. daylight), and motion
+		// sensors are made of several sensors: report each device once.
+		if s.UniqueID == "" || devices[deviceID(s.UniqueID)] {
+			continue
+		}
+		devices[deviceID(s.UniqueID)] = true
+
+		if s.Config.Reachable != nil && !*s.Config.Reachable {
+			problems = append(problems, fmt.Sprintf("sensor %s (%s) is unreachable", s.ID, s.Name))
+		}
+		if s.Config.Battery != nil && *s.Config.Battery < d.batteryThreshold {
+			problems = append(problems, fmt.Sprintf("sensor %s (%s) has a low battery (%d%%)", s.ID, s.Name, *s.Config.Battery))
+		}
+	}
+
+	if len(problems) > 0 {
+		res := warning("%d problems found on %d sensors", len(problems), len(devices))
+		res.Details = problems
+		return res
+	}
+
+	return ok("%d sensors reachable with enough battery", len(devices))
+}
+
+func ok(format string, args ...interface{}) Result {
+	return Result{Status: StatusOK, Message: fmt.Sprintf(format, args...)}
+}
+
+func warning(format string, args ...interface{}) Result {
+	return Result{Status: StatusWarning, Message: fmt.Sprintf(format, args...)}
+}
+
+func failure(format string, args ...interface{}) Result {
+	return Result{Status: StatusFailure, Message: fmt.Sprintf(format, args...)}
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+
+	return s
+}
+
+// deviceID returns the ID of the device a sensor belongs to, i.e. its MAC
+// address, from its unique ID.
+func deviceID(uniqueID string) string {
+	if i := strings.Index(uniqueID, "-"); i > 0 {
+		return uniqueID[:i]
+	}
+
+	return uniqueID
+}
@@ -0,0 +1,318 @@
+// Package effect implements light effects run from the client, such as fades,
+// a sunrise simulation or a candle flicker, by sending a sequence of states to
+// lights while respecting the rate limits of the bridge.
+//
+// Effects are pluggable: implement Effect and make it available by name with
+// Register.
+package effect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skwair/harmony/optional"
+	"github.com/skwair/huectl/pkg/colors"
+	"github.com/skwair/huectl/pkg/hue"
+)
+
+// Effect computes the states a light goes through.
+type Effect interface {
+	// Frame returns the state to send to the light at the given time since
+	// the effect started, along with the time to wait before the next frame.
+	// It returns false once the effect is over.
+	Frame(light *hue.Light, elapsed time.Duration) (Frame, bool)
+	// Persistent reports whether lights are left in the last state of the
+	// effect once it completes. They are restored to the state they were in
+	// before it started otherwise, and when the effect is interrupted.
+	Persistent() bool
+}
+
+// Frame is a state sent to a light by an effect.
+type Frame struct {
+	State *hue.SetLightStateRequest
+	// Next is the time to wait before the next frame.
+	Next time.Duration
+}
+
+// Params are the parameters given to effects when created. Effects only use
+// the ones relevant to them.
+type Params struct {
+	// Duration of the effect, 0 to run until interrupted when supported.
+	Duration time.Duration
+	// From and To are the start and end states of transitions.
+	From, To *State
+	// Color of single color effects.
+	Color *State
+	// Brightness of the effect, in percent.
+	Brightness int
+	// Frequency of repeating effects, in Hz.
+	Frequency float64
+	// Period of cyclic effects.
+	Period time.Duration
+}
+
+// Factory creates an effect from parameters.
+type Factory func(p Params) (Effect, error)
+
+type registration struct {
+	factory Factory
+	help    string
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]registration)
+)
+
+// Register makes an effect available under the given name, with a short help
+// text describing it and its parameters. It panics if the name is taken.
+func Register(name, help string, f Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, ok := registry[name]; ok {
+		panic("effect: " + name + " registered twice")
+	}
+	registry[name] = registration{factory: f, help: help}
+}
+
+// New returns the effect registered under the given name.
+func New(name string, p Params) (Effect, error) {
+	registryMu.RLock()
+	reg, ok := registry[name]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown effect %q, must be one of: %s", name, strings.Join(Names(), ", "))
+	}
+
+	return reg.factory(p)
+}
+
+// Names returns the names of the registered effects, sorted.
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Help returns the help text of the effect registered under the given name.
+func Help(name string) string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	return registry[name].help
+}
+
+// State is a light state used as a parameter of effects.
+type State struct {
+	// Bri on the 1-254 scale of the bridge, 0 if not set.
+	Bri int
+	// CT in mireds, 0 if not set.
+	CT int
+	// XY color, nil if not set.
+	XY *[2]float64
+}
+
+// ParseState parses a state given as a comma-separated list of a brightness
+// in percent ("50%"), a color temperature in Kelvin ("2700K") and a color name
+// or hex code ("orange", "#ffa500"), e.g. "10%,2200K".
+func ParseState(s string) (*State, error) {
+	var state State
+
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		switch {
+		case part == "":
+			continue
+		case strings.HasSuffix(part, "%"):
+			pct, err := strconv.Atoi(strings.TrimSuffix(part, "%"))
+			if err != nil || pct < 0 || pct > 100 {
+				return nil, fmt.Errorf("invalid brightness %q, must be between 0%% and 100%%", part)
+			}
+			state.Bri = brightnessToBri(pct)
+		case strings.HasSuffix(strings.ToUpper(part), "K"):
+			kelvin, err := strconv.Atoi(part[:len(part)-1])
+			if err != nil || kelvin < 2000 || kelvin > 6500 {
+				return nil, fmt.Errorf("invalid color temperature %q, must be between 2000K and 6500K", part)
+			}
+			state.CT = int(math.Round(1000000 / float64(kelvin)))
+		default:
+			c, err := colors.Parse(part)
+			if err != nil {
+				return nil, err
+			}
+			xy := hue.RGBToXY(c.R, c.G, c.B)
+			state.XY = &xy
+		}
+	}
+
+	if state.CT != 0 && state.XY != nil {
+		return nil, fmt.Errorf("invalid state %q: only one of a color temperature and a color can be set", s)
+	}
+
+	return &state, nil
+}
+
+// xy returns the color of the state as xy, converting its color temperature
+// if needed.
+func (s *State) xy() ([2]float64, bool) {
+	switch {
+	case s.XY != nil:
+		return *s.XY, true
+	case s.CT != 0:
+		return hue.MiredToXY(s.CT), true
+	default:
+		return [2]float64{}, false
+	}
+}
+
+// DefaultRateLimit is the number of light updates per second recommended by
+// the Hue developer documentation.
+const DefaultRateLimit = 10
+
+// Runner runs effects on lights. Create one with NewRunner.
+type Runner struct {
+	client    *hue.Client
+	rateLimit int
+	logger    *log.Logger
+}
+
+// RunnerOption allows to customize a Runner.
+type RunnerOption func(*Runner)
+
+// WithRateLimit sets the maximum number of updates sent to the bridge per
+// second, DefaultRateLimit if not set.
+func WithRateLimit(n int) RunnerOption {
+	return func(r *Runner) {
+		if n > 0 {
+			r.rateLimit = n
+		}
+	}
+}
+
+// WithLogger sets the logger used to report errors. Nothing is logged by
+// default.
+func WithLogger(l *log.Logger) RunnerOption {
+	return func(r *Runner) {
+		r.logger = l
+	}
+}
+
+// NewRunner returns a new runner controlling lights through the given client.
+func NewRunner(client *hue.Client, opts ...RunnerOption) *Runner {
+	r := &Runner{
+		client:    client,
+		rateLimit: DefaultRateLimit,
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// Run runs the effect on the given lights until it is over or the context
+// is canceled. Lights are updated concurrently, sharing the rate limit.
+func (r *Runner) Run(ctx context.Context, e Effect, lights []hue.Light) error {
+	if len(lights) == 0 {
+		return errors.New("no light to run the effect on")
+	}
+
+	limiter := time.NewTicker(time.Second / time.Duration(r.rateLimit))
+	defer limiter.Stop()
+
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	for i := range lights {
+		wg.Add(1)
+		go func(l *hue.Light) {
+			defer wg.Done()
+			r.runLight(ctx, e, l, start, limiter.C)
+		}(&lights[i])
+	}
+	wg.Wait()
+
+	if ctx.Err() == nil && e.Persistent() {
+		return nil
+	}
+
+	// Restore lights even when interrupted, without rate limiting as there
+	// is a single update per light.
+	for i := range lights {
+		r.send(&lights[i], lights[i].RestoreRequest())
+	}
+
+	return ctx.Err()
+}
+
+func (r *Runner) runLight(ctx context.Context, e Effect, l *hue.Light, start time.Time, limiter <-chan time.Time) {
+	for first := true; ; first = false {
+		frame, ok := e.Frame(l, time.Since(start))
+		if !ok {
+			return
+		}
+
+		if first {
+			req := *frame.State
+			req.On = optional.NewBool(true)
+			frame.State = &req
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-limiter:
+		}
+
+		r.send(l, frame.State)
+
+		timer := time.NewTimer(frame.Next)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+func (r *Runner) send(l *hue.Light, req *hue.SetLightStateRequest) {
+	req, _, err := hue.ValidateLightState(l, req, hue.Convert)
+	if err != nil {
+		r.logf("Light %s: %v", l.Name, err)
+		return
+	}
+
+	res, err := r.client.SetLightState(l.ID, req)
+	if err != nil {
+		r.logf("Unable to update light %s: %v", l.Name, err)
+		return
+	}
+	if err = res.Err(); err != nil {
+		r.logf("Light %s was partially updated: %v", l.Name, err)
+	}
+}
+
+func (r *Runner) logf(format string, v ...interface{}) {
+	if r.logger != nil {
+		r.logger.Printf(format, v...)
+	}
+}
@@ -0,0 +1,415 @@
+package effect
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/skwair/harmony/optional"
+	"github.com/skwair/huectl/pkg/hue"
+)
+
+func init() {
+	Register("fade", "Fades lights between two states over --duration, from --from (the current state by default) to --to.", newFade)
+	Register("sunrise", "Simulates a sunrise over --duration (30m by default), from a dim red to a bright cool white at --brightness. Lights stay on once it completes.", newSunrise)
+	Register("candle", "Flickers lights like a candle at --brightness (60% by default) until interrupted or for --duration. --color changes the color of the flame.", newCandle)
+	Register("strobe", "Flashes lights at --frequency (1Hz by default, 3Hz at most) for --duration (30s by default, 5m at most). --color sets the color of the flashes.", newStrobe)
+	Register("breathing", "Slowly dims and brightens lights up to --brightness with the given --period (8s by default) until interrupted or for --duration.", newBreathing)
+}
+
+// stepFor returns the time between frames of an effect lasting the given
+// duration, so that long effects do not flood the bridge with updates.
+func stepFor(d time.Duration) time.Duration {
+	step := d / 200
+	switch {
+	case step < time.Second:
+		return time.Second
+	case step > 10*time.Second:
+		return 10 * time.Second
+	}
+
+	return step
+}
+
+// transitionTime converts a duration to the multiples of 100ms used by the
+// bridge for transitions.
+func transitionTime(d time.Duration) *optional.Int {
+	return optional.NewInt(int(d / (100 * time.Millisecond)))
+}
+
+func brightnessToBri(pct int) int {
+	return int(math.Max(1, math.Round(float64(pct)/100*254)))
+}
+
+func validBrightness(pct int) error {
+	if pct < 1 || pct > 100 {
+		return fmt.Errorf("brightness must be between 1 and 100, got %d", pct)
+	}
+
+	return nil
+}
+
+func lerp(a, b, p float64) float64 {
+	return a + (b-a)*p
+}
+
+func lerpXY(a, b [2]float64, p float64) [2]float64 {
+	return [2]float64{lerp(a[0], b[0], p), lerp(a[1], b[1], p)}
+}
+
+// colorRequest sets the color of the given state on the request.
+func colorRequest(req *hue.SetLightStateRequest, s *State) {
+	switch {
+	case s == nil:
+	case s.XY != nil:
+		req.XY = &[2]float32{float32(s.XY[0]), float32(s.XY[1])}
+	case s.CT != 0:
+		req.CT = optional.NewInt(s.CT)
+	}
+}
+
+// fade linearly interpolates the brightness and color of lights between two
+// states.
+type fade struct {
+	duration time.Duration
+	step     time.Duration
+	from, to *State
+}
+
+func newFade(p Params) (Effect, error) {
+	switch {
+	case p.Duration <= 0:
+		return nil, errors.New("fade requires a duration")
+	case p.To == nil:
+		return nil, errors.New("fade requires a state to fade to")
+	}
+
+	return &fade{
+		duration: p.Duration,
+		step:     stepFor(p.Duration),
+		from:     p.From,
+		to:       p.To,
+	}, nil
+}
+
+func (f *fade) Persistent() bool { return true }
+
+func (f *fade) Frame(l *hue.Light, elapsed time.Duration) (Frame, bool) {
+	if elapsed >= f.duration {
+		return Frame{}, false
+	}
+
+	// Each frame targets the state at the next frame, and the bridge
+	// transitions smoothly to it in the meantime.
+	step := f.step
+	if remaining := f.duration - elapsed; remaining < step {
+		step = remaining
+	}
+	p := float64(elapsed+step) / float64(f.duration)
+
+	from := f.from
+	if from == nil {
+		from = currentState(l)
+	}
+
+	req := hue.SetLightStateRequest{TransitionTime: transitionTime(step)}
+
+	if from.Bri != 0 && f.to.Bri != 0 {
+		req.Bri = optional.NewInt(int(math.Round(lerp(float64(from.Bri), float64(f.to.Bri), p))))
+	} else if f.to.Bri != 0 {
+		req.Bri = optional.NewInt(f.to.Bri)
+	}
+
+	switch {
+	case from.CT != 0 && f.to.CT != 0:
+		req.CT = optional.NewInt(int(math.Round(lerp(float64(from.CT), float64(f.to.CT), p))))
+	case f.to.CT != 0 || f.to.XY != nil:
+		to, _ := f.to.xy()
+		xy := to
+		if start, ok := from.xy(); ok {
+			xy = lerpXY(start, to, p)
+		}
+		req.XY = &[2]float32{float32(xy[0]), float32(xy[1])}
+	}
+
+	return Frame{State: &req, Next: step}, true
+}
+
+// currentState returns the state of the light as a starting point for fades.
+// Lights that are off start from the lowest brightness.
+func currentState(l *hue.Light) *State {
+	s := State{Bri: l.State.Bri}
+	if !l.State.On || s.Bri == 0 {
+		s.Bri = 1
+	}
+
+	switch l.State.ColorMode {
+	case "ct":
+		s.CT = l.State.CT
+	case "xy", "hs":
+		xy := l.State.XY
+		s.XY = &xy
+	}
+
+	return &s
+}
+
+// sunriseStop is a point of the color ramp of a sunrise, as progress from 0
+// to 1.
+type sunriseStop struct {
+	progress float64
+	xy       [2]float64
+}
+
+var sunriseStops = []sunriseStop{
+	{0, [2]float64{0.6915, 0.3083}}, // Deep red.
+	{0.25, [2]float64{0.6, 0.38}},   // Orange.
+	{0.5, hue.MiredToXY(500)},       // Warmest white.
+	{1, hue.MiredToXY(250)},         // Cool white.
+}
+
+// sunrise ramps lights from a dim red to a bright white, going through
+// oranges and warm whites.
+type sunrise struct {
+	duration time.Duration
+	step     time.Duration
+	bri      int
+}
+
+func newSunrise(p Params) (Effect, error) {
+	if p.Duration == 0 {
+		p.Duration = 30 * time.Minute
+	}
+	if p.Duration < time.Minute {
+		return nil, fmt.Errorf("sunrise must last at least a minute, got %s", p.Duration)
+	}
+
+	if p.Brightness == 0 {
+		p.Brightness = 100
+	}
+	if err := validBrightness(p.Brightness); err != nil {
+		return nil, err
+	}
+
+	return &sunrise{
+		duration: p.Duration,
+		step:     stepFor(p.Duration),
+		bri:      brightnessToBri(p.Brightness),
+	}, nil
+}
+
+func (s *sunrise) Persistent() bool { return true }
+
+func (s *sunrise) Frame(l *hue.Light, elapsed time.Duration) (Frame, bool) {
+	if elapsed >= s.duration {
+		return Frame{}, false
+	}
+
+	step := s.step
+	if remaining := s.duration - elapsed; remaining < step {
+		step = remaining
+	}
+	p := float64(elapsed+step) / float64(s.duration)
+
+	// Brightness rises slowly at first, as the eye is more sensitive to
+	// changes in the dark.
+	req := hue.SetLightStateRequest{
+		Bri:            optional.NewInt(int(math.Max(1, math.Round(float64(s.bri)*p*p)))),
+		TransitionTime: transitionTime(step),
+	}
+
+	switch {
+	case l.SupportsColor():
+		// Keep the ramp inside the gamut of the light: interpolating between
+		// points clamped afterwards would make hues jump.
+		gamut := l.Gamut()
+		xy := gamut.Clamp(sunriseStops[0].xy)
+		for i := 1; i < len(sunriseStops); i++ {
+			prev, next := sunriseStops[i-1], sunriseStops[i]
+			if p <= next.progress {
+				q := (p - prev.progress) / (next.progress - prev.progress)
+				xy = lerpXY(gamut.Clamp(prev.xy), gamut.Clamp(next.xy), q)
+				break
+			}
+		}
+		req.XY = &[2]float32{float32(xy[0]), float32(xy[1])}
+	case l.SupportsColorTemperature():
+		ct := 500.0
+		if p > 0.5 {
+			ct = lerp(500, 250, (p-0.5)/0.5)
+		}
+		req.CT = optional.NewInt(int(math.Round(ct)))
+	}
+
+	return Frame{State: &req, Next: step}, true
+}
+
+// candle randomly flickers the brightness of lights around a warm color.
+type candle struct {
+	duration time.Duration
+	bri      int
+	color    *State
+}
+
+func newCandle(p Params) (Effect, error) {
+	if p.Brightness == 0 {
+		p.Brightness = 60
+	}
+	if err := validBrightness(p.Brightness); err != nil {
+		return nil, err
+	}
+
+	color := p.Color
+	if color == nil {
+		color = &State{CT: 500}
+	}
+
+	return &candle{
+		duration: p.Duration,
+		bri:      brightnessToBri(p.Brightness),
+		color:    color,
+	}, nil
+}
+
+func (c *candle) Persistent() bool { return false }
+
+func (c *candle) Frame(_ *hue.Light, elapsed time.Duration) (Frame, bool) {
+	if c.duration > 0 && elapsed >= c.duration {
+		return Frame{}, false
+	}
+
+	// The flame mostly burns steadily, with occasional deeper dips.
+	dip := 0.15 * rand.Float64()
+	if rand.Intn(5) == 0 {
+		dip = 0.15 + 0.25*rand.Float64()
+	}
+	transition := time.Duration(1+rand.Intn(3)) * 100 * time.Millisecond
+
+	req := hue.SetLightStateRequest{
+		Bri:            optional.NewInt(int(math.Max(1, math.Round(float64(c.bri)*(1-dip))))),
+		TransitionTime: transitionTime(transition),
+	}
+	colorRequest(&req, c.color)
+
+	return Frame{
+		State: &req,
+		Next:  transition + time.Duration(rand.Intn(300))*time.Millisecond,
+	}, true
+}
+
+// Safety limits of the strobe effect: flashing faster than 3 times per second
+// can trigger seizures in people with photosensitive epilepsy.
+const (
+	MaxStrobeFrequency = 3
+	MaxStrobeDuration  = 5 * time.Minute
+)
+
+// strobe alternates lights between full and minimum brightness.
+type strobe struct {
+	duration time.Duration
+	half     time.Duration
+	color    *State
+}
+
+func newStrobe(p Params) (Effect, error) {
+	if p.Frequency == 0 {
+		p.Frequency = 1
+	}
+	if p.Frequency < 0 || p.Frequency > MaxStrobeFrequency {
+		return nil, fmt.Errorf("strobe frequency must be between 0 and %dHz, got %gHz", MaxStrobeFrequency, p.Frequency)
+	}
+
+	if p.Duration == 0 {
+		p.Duration = 30 * time.Second
+	}
+	if p.Duration < 0 || p.Duration > MaxStrobeDuration {
+		return nil, fmt.Errorf("strobe can not last more than %s, got %s", MaxStrobeDuration, p.Duration)
+	}
+
+	return &strobe{
+		duration: p.Duration,
+		half:     time.Duration(float64(time.Second) / p.Frequency / 2),
+		color:    p.Color,
+	}, nil
+}
+
+func (s *strobe) Persistent() bool { return false }
+
+func (s *strobe) Frame(_ *hue.Light, elapsed time.Duration) (Frame, bool) {
+	if elapsed >= s.duration {
+		return Frame{}, false
+	}
+
+	bri := 254
+	if (elapsed/s.half)%2 == 1 {
+		bri = 1
+	}
+
+	req := hue.SetLightStateRequest{
+		Bri:            optional.NewInt(bri),
+		TransitionTime: optional.NewInt(0),
+	}
+	colorRequest(&req, s.color)
+
+	// Wait until the next half period rather than a fixed duration so
+	// flashes do not drift when updates are delayed by the rate limit.
+	next := s.half - elapsed%s.half
+
+	return Frame{State: &req, Next: next}, true
+}
+
+// breathing slowly dims and brightens lights.
+type breathing struct {
+	duration time.Duration
+	half     time.Duration
+	bri      int
+	color    *State
+}
+
+func newBreathing(p Params) (Effect, error) {
+	if p.Period == 0 {
+		p.Period = 8 * time.Second
+	}
+	if p.Period < 2*time.Second {
+		return nil, fmt.Errorf("breathing period must be at least 2s, got %s", p.Period)
+	}
+
+	if p.Brightness == 0 {
+		p.Brightness = 100
+	}
+	if err := validBrightness(p.Brightness); err != nil {
+		return nil, err
+	}
+
+	return &breathing{
+		duration: p.Duration,
+		half:     p.Period / 2,
+		bri:      brightnessToBri(p.Brightness),
+		color:    p.Color,
+	}, nil
+}
+
+func (b *breathing) Persistent() bool { return false }
+
+func (b *breathing) Frame(_ *hue.Light, elapsed time.Duration) (Frame, bool) {
+	if b.duration > 0 && elapsed >= b.duration {
+		return Frame{}, false
+	}
+
+	// Breathe in first, then alternate, each half period transitioning to
+	// the opposite brightness.
+	bri := b.bri
+	if (elapsed/b.half)%2 == 1 {
+		bri = int(math.Max(1, math.Round(float64(b.bri)*0.1)))
+	}
+
+	req := hue.SetLightStateRequest{
+		Bri:            optional.NewInt(bri),
+		TransitionTime: transitionTime(b.half),
+	}
+	colorRequest(&req, b.color)
+
+	return Frame{State: &req, Next: b.half - elapsed%b.half}, true
+}
@@ -0,0 +1,382 @@
+package effect
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skwair/huectl/pkg/hue"
+)
+
+// frameJSON returns the state of a frame as sent to the bridge.
+func frameJSON(t *testing.T, f Frame) string {
+	t.Helper()
+
+	b, err := json.Marshal(f.State)
+	if err != nil {
+		t.Fatalf("unable to marshal frame: %v", err)
+	}
+
+	return string(b)
+}
+
+// frames returns all the frames of an effect, which must complete.
+func frames(t *testing.T, e Effect, l *hue.Light) []Frame {
+	t.Helper()
+
+	var (
+		res     []Frame
+		elapsed time.Duration
+	)
+	for {
+		f, ok := e.Frame(l, elapsed)
+		if !ok {
+			return res
+		}
+		if f.Next <= 0 {
+			t.Fatalf("frame at %s does not wait before the next one", elapsed)
+		}
+		res = append(res, f)
+		elapsed += f.Next
+
+		if len(res) > 10000 {
+			t.Fatalf("effect does not complete")
+		}
+	}
+}
+
+func TestNewStrobe(t *testing.T) {
+	tests := []struct {
+		name     string
+		params   Params
+		wantErr  string
+		wantHalf time.Duration
+		wantDur  time.Duration
+	}{
+		{
+			name:     "defaults",
+			wantHalf: 500 * time.Millisecond,
+			wantDur:  30 * time.Second,
+		},
+		{
+			name:     "fastest",
+			params:   Params{Frequency: MaxStrobeFrequency, Duration: MaxStrobeDuration},
+			wantHalf: time.Second / 6,
+			wantDur:  MaxStrobeDuration,
+		},
+		{
+			name:     "slow",
+			params:   Params{Frequency: 0.5, Duration: time.Minute},
+			wantHalf: time.Second,
+			wantDur:  time.Minute,
+		},
+		{
+			name:    "too fast",
+			params:  Params{Frequency: MaxStrobeFrequency + 0.5},
+			wantErr: "strobe frequency must be between 0 and 3Hz, got 3.5Hz",
+		},
+		{
+			name:    "negative frequency",
+			params:  Params{Frequency: -1},
+			wantErr: "strobe frequency must be between 0 and 3Hz, got -1Hz",
+		},
+		{
+			name:    "too long",
+			params:  Params{Duration: MaxStrobeDuration + time.Second},
+			wantErr: "strobe can not last more than 5m0s, got 5m1s",
+		},
+		{
+			name:    "negative duration",
+			params:  Params{Duration: -time.Second},
+			wantErr: "strobe can not last more than 5m0s, got -1s",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := newStrobe(tt.params)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("expected error %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unable to create strobe: %v", err)
+			}
+
+			s := e.(*strobe)
+			if s.half != tt.wantHalf {
+				t.Errorf("expected flashes every %s, got %s", tt.wantHalf, s.half)
+			}
+			if s.duration != tt.wantDur {
+				t.Errorf("expected a duration of %s, got %s", tt.wantDur, s.duration)
+			}
+		})
+	}
+}
+
+func TestStrobeFrame(t *testing.T) {
+	e, err := newStrobe(Params{Frequency: 2, Duration: 10 * time.Second, Color: &State{CT: 250}})
+	if err != nil {
+		t.Fatalf("unable to create strobe: %v", err)
+	}
+
+	tests := []struct {
+		elapsed  time.Duration
+		wantJSON string
+		wantNext time.Duration
+		wantDone bool
+	}{
+		{elapsed: 0, wantJSON: `{"bri":254,"ct":250,"transitiontime":0}`, wantNext: 250 * time.Millisecond},
+		{elapsed: 300 * time.Millisecond, wantJSON: `{"bri":1,"ct":250,"transitiontime":0}`, wantNext: 200 * time.Millisecond},
+		{elapsed: 500 * time.Millisecond, wantJSON: `{"bri":254,"ct":250,"transitiontime":0}`, wantNext: 250 * time.Millisecond},
+		{elapsed: 10 * time.Second, wantDone: true},
+	}
+
+	for _, tt := range tests {
+		f, ok := e.Frame(&hue.Light{}, tt.elapsed)
+		if ok == tt.wantDone {
+			t.Fatalf("at %s: expected done to be %t", tt.elapsed, tt.wantDone)
+		}
+		if !ok {
+			continue
+		}
+		if got := frameJSON(t, f); got != tt.wantJSON {
+			t.Errorf("at %s: expected %s, got %s", tt.elapsed, tt.wantJSON, got)
+		}
+		if f.Next != tt.wantNext {
+			t.Errorf("at %s: expected the next frame in %s, got %s", tt.elapsed, tt.wantNext, f.Next)
+		}
+	}
+}
+
+func TestFadeFrame(t *testing.T) {
+	red := [2]float64{0.6915, 0.3083}
+	light := &hue.Light{State: hue.LightState{On: true, Bri: 100, CT: 300, ColorMode: "ct"}}
+
+	tests := []struct {
+		name     string
+		params   Params
+		light    *hue.Light
+		elapsed  time.Duration
+		wantJSON string
+		wantNext time.Duration
+	}{
+		{
+			name:     "first frame",
+			params:   Params{Duration: 100 * time.Second, From: &State{Bri: 1, CT: 500}, To: &State{Bri: 254, CT: 250}},
+			elapsed:  0,
+			wantJSON: `{"bri":4,"ct":498,"transitiontime":10}`,
+			wantNext: time.Second,
+		},
+		{
+			name:     "halfway",
+			params:   Params{Duration: 100 * time.Second, From: &State{Bri: 1, CT: 500}, To: &State{Bri: 254, CT: 250}},
+			elapsed:  49 * time.Second,
+			wantJSON: `{"bri":128,"ct":375,"transitiontime":10}`,
+			wantNext: time.Second,
+		},
+		{
+			name:     "last frame",
+			params:   Params{Duration: 100 * time.Second, From: &State{Bri: 1, CT: 500}, To: &State{Bri: 254, CT: 250}},
+			elapsed:  99500 * time.Millisecond,
+			wantJSON: `{"bri":254,"ct":250,"transitiontime":5}`,
+			wantNext: 500 * time.Millisecond,
+		},
+		{
+			// Frames are at most 10s apart.
+			name:     "long fade",
+			params:   Params{Duration: time.Hour, From: &State{Bri: 1}, To: &State{Bri: 201}},
+			elapsed:  0,
+			wantJSON: `{"bri":2,"transitiontime":100}`,
+			wantNext: 10 * time.Second,
+		},
+		{
+			name:     "from the current state",
+			params:   Params{Duration: 100 * time.Second, To: &State{Bri: 200, CT: 400}},
+			light:    light,
+			elapsed:  49 * time.Second,
+			wantJSON: `{"bri":150,"ct":350,"transitiontime":10}`,
+			wantNext: time.Second,
+		},
+		{
+			name:     "from a light that is off",
+			params:   Params{Duration: 100 * time.Second, To: &State{Bri: 201}},
+			light:    &hue.Light{State: hue.LightState{Bri: 150}},
+			elapsed:  49 * time.Second,
+			wantJSON: `{"bri":101,"transitiontime":10}`,
+			wantNext: time.Second,
+		},
+		{
+			name:     "from a color temperature to a color",
+			params:   Params{Duration: 100 * time.Second, From: &State{Bri: 100, CT: 250}, To: &State{Bri: 100, XY: &red}},
+			elapsed:  99 * time.Second,
+			wantJSON: `{"bri":100,"xy":[0.6915,0.3083],"transitiontime":10}`,
+			wantNext: time.Second,
+		},
+		{
+			name:     "to a color temperature without a starting color",
+			params:   Params{Duration: 100 * time.Second, From: &State{Bri: 100}, To: &State{CT: 500}},
+			elapsed:  0,
+			wantJSON: `{"xy":[0.5269026,0.41326487],"transitiontime":10}`,
+			wantNext: time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := newFade(tt.params)
+			if err != nil {
+				t.Fatalf("unable to create fade: %v", err)
+			}
+
+			l := tt.light
+			if l == nil {
+				l = &hue.Light{}
+			}
+
+			f, ok := e.Frame(l, tt.elapsed)
+			if !ok {
+				t.Fatalf("expected a frame")
+			}
+			if got := frameJSON(t, f); got != tt.wantJSON {
+				t.Errorf("expected %s, got %s", tt.wantJSON, got)
+			}
+			if f.Next != tt.wantNext {
+				t.Errorf("expected the next frame in %s, got %s", tt.wantNext, f.Next)
+			}
+
+			if _, ok = e.Frame(l, tt.params.Duration); ok {
+				t.Errorf("expected the fade to be over after its duration")
+			}
+		})
+	}
+}
+
+func TestNewFadeErrors(t *testing.T) {
+	if _, err := newFade(Params{To: &State{Bri: 1}}); err == nil {
+		t.Errorf("expected an error without a duration")
+	}
+	if _, err := newFade(Params{Duration: time.Minute}); err == nil {
+		t.Errorf("expected an error without a state to fade to")
+	}
+}
+
+func TestSunriseFrames(t *testing.T) {
+	tests := []struct {
+		name  string
+		light *hue.Light
+	}{
+		{
+			name:  "gamut A",
+			light: &hue.Light{Type: hue.LightTypeColor, Capabilities: hue.LightCapabilities{Control: hue.LightCapabilitiesControl{ColorGamutType: "A"}}},
+		},
+		{
+			name:  "gamut B",
+			light: &hue.Light{Type: hue.LightTypeExtendedColor, Capabilities: hue.LightCapabilities{Control: hue.LightCapabilitiesControl{ColorGamutType: "B"}}},
+		},
+		{
+			name:  "gamut C",
+			light: &hue.Light{Type: hue.LightTypeExtendedColor, Capabilities: hue.LightCapabilities{Control: hue.LightCapabilitiesControl{ColorGamutType: "C"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := newSunrise(Params{Duration: 10 * time.Minute, Brightness: 80})
+			if err != nil {
+				t.Fatalf("unable to create sunrise: %v", err)
+			}
+
+			gamut := tt.light.Gamut()
+			fs := frames(t, e, tt.light)
+			if len(fs) != 200 {
+				t.Fatalf("expected 200 frames, got %d", len(fs))
+			}
+
+			var prevBri int
+			for i, f := range fs {
+				var state struct {
+					Bri int
+					XY  [2]float64
+				}
+				if err = json.Unmarshal([]byte(frameJSON(t, f)), &state); err != nil {
+					t.Fatalf("unable to unmarshal frame: %v", err)
+				}
+
+				// Every color of the ramp must be displayable by the light.
+				if clamped := gamut.Clamp(state.XY); distance(clamped, state.XY) > 1e-4 {
+					t.Errorf("frame #%d: color %v is outside the gamut of the light", i, state.XY)
+				}
+				if state.Bri < prevBri {
+					t.Errorf("frame #%d: brightness decreased from %d to %d", i, prevBri, state.Bri)
+				}
+				prevBri = state.Bri
+
+				if i == len(fs)-1 {
+					if want := gamut.Clamp(hue.MiredToXY(250)); distance(want, state.XY) > 1e-4 {
+						t.Errorf("expected the sunrise to end on %v, got %v", want, state.XY)
+					}
+					if state.Bri != 203 {
+						t.Errorf("expected the sunrise to end at brightness 203, got %d", state.Bri)
+					}
+				}
+			}
+
+			first, _ := e.Frame(tt.light, 0)
+			if !strings.Contains(frameJSON(t, first), `"bri":1,`) {
+				t.Errorf("expected the sunrise to start at the lowest brightness, got %s", frameJSON(t, first))
+			}
+		})
+	}
+}
+
+func TestSunriseColorTemperature(t *testing.T) {
+	e, err := newSunrise(Params{Duration: 10 * time.Minute})
+	if err != nil {
+		t.Fatalf("unable to create sunrise: %v", err)
+	}
+
+	light := &hue.Light{Type: hue.LightTypeColorTemperature}
+
+	tests := []struct {
+		elapsed  time.Duration
+		wantJSON string
+	}{
+		{elapsed: 0, wantJSON: `{"bri":1,"ct":500,"transitiontime":30}`},
+		{elapsed: 4*time.Minute + 57*time.Second, wantJSON: `{"bri":64,"ct":500,"transitiontime":30}`},
+		{elapsed: 7*time.Minute + 27*time.Second, wantJSON: `{"bri":143,"ct":375,"transitiontime":30}`},
+		{elapsed: 9*time.Minute + 57*time.Second, wantJSON: `{"bri":254,"ct":250,"transitiontime":30}`},
+	}
+
+	for _, tt := range tests {
+		f, ok := e.Frame(light, tt.elapsed)
+		if !ok {
+			t.Fatalf("at %s: expected a frame", tt.elapsed)
+		}
+		if got := frameJSON(t, f); got != tt.wantJSON {
+			t.Errorf("at %s: expected %s, got %s", tt.elapsed, tt.wantJSON, got)
+		}
+	}
+
+	dimmable := &hue.Light{Type: hue.LightTypeDimmable}
+	if f, _ := e.Frame(dimmable, 0); frameJSON(t, f) != `{"bri":1,"transitiontime":30}` {
+		t.Errorf("expected only the brightness of dimmable lights to change, got %s", frameJSON(t, f))
+	}
+}
+
+func TestNewSunriseErrors(t *testing.T) {
+	if _, err := newSunrise(Params{Duration: 30 * time.Second}); err == nil {
+		t.Errorf("expected an error for a sunrise shorter than a minute")
+	}
+	if _, err := newSunrise(Params{Brightness: 101}); err == nil {
+		t.Errorf("expected an error for a brightness above 100%%")
+	}
+}
+
+func distance(a, b [2]float64) float64 {
+	return math.Hypot(a[0]-b[0], a[1]-b[1])
+}
@@ -0,0 +1,412 @@
+// Package entertainment streams colors to the lights of an entertainment group
+// using the Hue Entertainment API: HueStream messages sent over DTLS, which
+// update lights much faster than the REST API allows (e.g. to sync them with
+// a screen or music).
+package entertainment
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pion/dtls/v2"
+	"github.com/skwair/huectl/pkg/hue"
+)
+
+// Port is the UDP port bridges listen on for entertainment streaming.
+const Port = 2100
+
+// Limits of the rate at which messages are sent, in messages per second. The
+// bridge forwards updates to lights at 25Hz, sending more often makes up for
+// messages lost on the way.
+const (
+	MinRate     = 25
+	MaxRate     = 50
+	DefaultRate = 50
+)
+
+// ColorSpace is the color space of the colors sent to lights.
+type ColorSpace byte
+
+// Color spaces supported by the HueStream protocol.
+const (
+	RGB          ColorSpace = 0x00
+	XYBrightness ColorSpace = 0x01
+)
+
+// Color is a color in the color space of the streamer: red, green and blue,
+// or x, y and brightness, each from 0 to 1.
+type Color [3]float64
+
+// maxLights is the maximum number of lights updated by a single message, as
+// recommended by the protocol documentation.
+var maxLights = map[int]int{1: 10, 2: 20}
+
+// Streamer sends colors to the lights of an entertainment group. Create one
+// with Open, set colors with Set and send them with Run.
+type Streamer struct {
+	client     *hue.Client
+	groupID    string
+	clientKey  []byte
+	addr       string
+	version    int
+	identity   string
+	colorSpace ColorSpace
+	rate       int
+
+	conn net.Conn
+
+	mu     sync.Mutex
+	colors map[int]Color
+	seq    uint8
+}
+
+// Option allows to customize a Streamer.
+type Option func(*Streamer)
+
+// WithRate sets the number of messages sent per second, between MinRate and
+// MaxRate, DefaultRate if not set.
+func WithRate(hz int) Option {
+	return func(s *Streamer) {
+		s.rate = hz
+	}
+}
+
+// WithColorSpace sets the color space of colors given to Set, RGB if not set.
+func WithColorSpace(cs ColorSpace) Option {
+	return func(s *Streamer) {
+		s.colorSpace = cs
+	}
+}
+
+// WithAddr overrides the address of the streaming server of the bridge, the
+// host of the client on Port by default.
+func WithAddr(addr string) Option {
+	return func(s *Streamer) {
+		s.addr = addr
+	}
+}
+
+// WithProtocolV2 uses version 2 of the HueStream protocol, required to stream
+// to entertainment configurations of the v2 API. Lights are then referred to
+// by channel ID rather than light ID, the group ID given to Open is the ID of
+// the entertainment configuration, and the application ID of the user is used
+// to authenticate instead of its username.
+//
+// Streaming to the configuration must have been started with the v2 API,
+// which this package does not support, before calling Open.
+func WithProtocolV2(applicationID string) Option {
+	return func(s *Streamer) {
+		s.version = 2
+		s.identity = applicationID
+	}
+}
+
+// Open starts streaming to the given entertainment group and connects to the
+// bridge. The client key is the one returned by the bridge when registering
+// the user of the client, as a hex string.
+//
+// Nothing is sent until Run is called, and the bridge stops streaming by
+// itself if nothing is sent for 10 seconds. Call Close when done.
+func Open(ctx context.Context, client *hue.Client, groupID, clientKey string, opts ...Option) (*Streamer, error) {
+	s := &Streamer{
+		client:     client,
+		groupID:    groupID,
+		addr:       net.JoinHostPort(client.Host(), strconv.Itoa(Port)),
+		version:    1,
+		identity:   client.Username(),
+		colorSpace: RGB,
+		rate:       DefaultRate,
+		colors:     make(map[int]Color),
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+
+	key, err := hex.DecodeString(clientKey)
+	if err != nil || len(key) != 16 {
+		return nil, errors.New("invalid client key, must be 32 hexadecimal characters")
+	}
+	s.clientKey = key
+
+	if s.version == 1 {
+		if err = s.setActive(true); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = s.dial(ctx); err != nil {
+		if s.version == 1 {
+			_ = s.setActive(false)
+		}
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *Streamer) validate() error {
+	switch {
+	case s.rate < MinRate || s.rate > MaxRate:
+		return fmt.Errorf("rate must be between %d and %d messages per second, got %d", MinRate, MaxRate, s.rate)
+	case s.colorSpace != RGB && s.colorSpace != XYBrightness:
+		return fmt.Errorf("unknown color space %d", s.colorSpace)
+	case s.version == 2 && len(s.groupID) != 36:
+		return fmt.Errorf("invalid entertainment configuration ID %q", s.groupID)
+	case s.identity == "":
+		return errors.New("no identity to authenticate with")
+	}
+
+	return nil
+}
+
+func (s *Streamer) setActive(active bool) error {
+	res, err := s.client.SetStreamActive(s.groupID, active)
+	if err != nil {
+		return fmt.Errorf("unable to set streaming state of group %s: %w", s.groupID, err)
+	}
+
+	return res.Err()
+}
+
+func (s *Streamer) dial(ctx context.Context) error {
+	raddr, err := net.ResolveUDPAddr("udp", s.addr)
+	if err != nil {
+		return fmt.Errorf("unable to resolve streaming address: %w", err)
+	}
+
+	cfg := &dtls.Config{
+		PSK: func([]byte) ([]byte, error) {
+			return s.clientKey, nil
+		},
+		PSKIdentityHint: []byte(s.identity),
+		CipherSuites:    []dtls.CipherSuiteID{dtls.TLS_PSK_WITH_AES_128_GCM_SHA256},
+	}
+
+	// The bridge gives up on the handshake after 10 seconds anyway.
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	conn, err := dtls.DialWithContext(ctx, "udp", raddr, cfg)
+	if err != nil {
+		return fmt.Errorf("unable to connect to the streaming server of the bridge: %w", err)
+	}
+	s.conn = conn
+
+	return nil
+}
+
+// Set sets the color of the given light, or channel with version 2 of the
+// protocol. It is sent with the next message, along with the colors of the
+// other lights.
+func (s *Streamer) Set(id int, c Color) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.colors[id] = c
+}
+
+// SetAll sets the color of the given lights at once, so they are all sent
+// with the same message.
+func (s *Streamer) SetAll(colors map[int]Color) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, c := range colors {
+		s.colors[id] = c
+	}
+}
+
+// Run sends the colors set so far to the bridge at the configured rate until
+// the context is canceled or a message can not be sent.
+func (s *Streamer) Run(ctx context.Context) error {
+	ticker := time.NewTicker(time.Second / time.Duration(s.rate))
+	defer ticker.Stop()
+
+	for {
+		for _, msg := range s.messages() {
+			if _, err := s.conn.Write(msg); err != nil {
+				return fmt.Errorf("unable to send message to bridge: %w", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close disconnects from the bridge and stops streaming to the group, which
+// gives control of its lights back to the REST API.
+func (s *Streamer) Close() error {
+	err := s.conn.Close()
+
+	if s.version == 1 {
+		if aerr := s.setActive(false); err == nil {
+			err = aerr
+		}
+	}
+
+	return err
+}
+
+// messages returns the messages to send to update all lights, each one
+// holding up to the maximum number of lights allowed by the protocol.
+func (s *Streamer) messages() [][]byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]int, 0, len(s.colors))
+	for id := range s.colors {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var msgs [][]byte
+	max := maxLights[s.version]
+	for start := 0; start < len(ids); start += max {
+		end := start + max
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		colors := make([]LightColor, 0, end-start)
+		for _, id := range ids[start:end] {
+			colors = append(colors, LightColor{ID: id, Color: s.colors[id]})
+		}
+
+		msg := Message{
+			Version:    s.version,
+			Sequence:   s.seq,
+			ColorSpace: s.colorSpace,
+			ConfigID:   s.groupID,
+			Colors:     colors,
+		}
+		msgs = append(msgs, msg.Encode())
+		s.seq++
+	}
+
+	return msgs
+}
+
+// LightColor is the color of a light, or channel with version 2 of the
+// protocol, in a message.
+type LightColor struct {
+	ID    int
+	Color Color
+}
+
+// Message is a HueStream message.
+type Message struct {
+	// Version of the protocol, 1 or 2.
+	Version int
+	// Sequence number, ignored by the bridge.
+	Sequence   uint8
+	ColorSpace ColorSpace
+	// ConfigID is the ID of the entertainment configuration, only sent with
+	// version 2 of the protocol.
+	ConfigID string
+	Colors   []LightColor
+}
+
+// protocolName starts every HueStream message.
+const protocolName = "HueStream"
+
+// Encode encodes the message as sent to the bridge.
+func (m *Message) Encode() []byte {
+	b := make([]byte, 0, 52+len(m.Colors)*9)
+	b = append(b, protocolName...)
+	b = append(b, byte(m.Version), 0x00, m.Sequence, 0x00, 0x00, byte(m.ColorSpace), 0x00)
+
+	if m.Version == 2 {
+		b = append(b, m.ConfigID...)
+	}
+
+	for _, c := range m.Colors {
+		if m.Version == 2 {
+			b = append(b, byte(c.ID))
+		} else {
+			b = append(b, 0x00) // Device type: light.
+			b = appendUint16(b, uint16(c.ID))
+		}
+
+		for _, v := range c.Color {
+			b = appendUint16(b, uint16(math.Round(math.Max(0, math.Min(1, v))*0xffff)))
+		}
+	}
+
+	return b
+}
+
+// DecodeMessage decodes a HueStream message.
+func DecodeMessage(b []byte) (*Message, error) {
+	if len(b) < 16 || string(b[:9]) != protocolName {
+		return nil, errors.New("not a HueStream message")
+	}
+
+	m := Message{
+		Version:    int(b[9]),
+		Sequence:   b[11],
+		ColorSpace: ColorSpace(b[14]),
+	}
+	b = b[16:]
+
+	// Lights are a device type and an ID on 3 bytes with version 1, channels
+	// an ID on a single byte with version 2, followed by 3 values.
+	var size int
+	switch m.Version {
+	case 1:
+		size = 9
+	case 2:
+		if len(b) < 36 {
+			return nil, errors.New("message too short")
+		}
+		m.ConfigID, b = string(b[:36]), b[36:]
+		size = 7
+	default:
+		return nil, fmt.Errorf("unsupported protocol version %d", m.Version)
+	}
+
+	if len(b)%size != 0 {
+		return nil, errors.New("truncated message")
+	}
+
+	for ; len(b) > 0; b = b[size:] {
+		var c LightColor
+		values := b[size-6 : size]
+		if m.Version == 2 {
+			c.ID = int(b[0])
+		} else {
+			c.ID = int(binary.BigEndian.Uint16(b[1:3]))
+		}
+		for i := range c.Color {
+			c.Color[i] = float64(binary.BigEndian.Uint16(values[2*i:])) / 0xffff
+		}
+		m.Colors = append(m.Colors, c)
+	}
+
+	return &m, nil
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
@@ -0,0 +1,158 @@
+package entertainment_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/skwair/huectl/pkg/entertainment"
+	"github.com/skwair/huectl/pkg/hue"
+	"github.com/skwair/huectl/pkg/hue/huetest"
+)
+
+const configID = "1a8d99cc-967b-44f2-9202-43f976c0fa6b"
+
+func TestStreamer(t *testing.T) {
+	tests := []struct {
+		name    string
+		groupID string
+		opts    []entertainment.Option
+		lights  int
+	}{
+		{name: "v1", groupID: "1", lights: 3},
+		{name: "v1 several messages", groupID: "1", lights: 25},
+		{
+			name:    "v2",
+			groupID: configID,
+			opts:    []entertainment.Option{entertainment.WithProtocolV2(huetest.Username)},
+			lights:  21,
+		},
+		{
+			name:    "xy brightness",
+			groupID: "1",
+			opts:    []entertainment.Option{entertainment.WithColorSpace(entertainment.XYBrightness), entertainment.WithRate(entertainment.MinRate)},
+			lights:  2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := huetest.NewBridge()
+			defer b.Close()
+			b.AddGroup(hue.Group{ID: "1", Name: "TV", Type: hue.GroupTypeEntertainment, Stream: &hue.GroupStream{}})
+
+			srv, err := huetest.NewStreamServer()
+			if err != nil {
+				t.Fatalf("unable to start stream server: %v", err)
+			}
+			defer srv.Close()
+
+			client := b.Client()
+			opts := append([]entertainment.Option{entertainment.WithAddr(srv.Addr())}, tt.opts...)
+
+			s, err := entertainment.Open(context.Background(), client, tt.groupID, huetest.ClientKey, opts...)
+			if err != nil {
+				t.Fatalf("unable to open streamer: %v", err)
+			}
+
+			want := make(map[int]entertainment.Color, tt.lights)
+			for id := 0; id < tt.lights; id++ {
+				want[id] = entertainment.Color{float64(id) / 100, 0.5, 1}
+			}
+			s.SetAll(want)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			errc := make(chan error, 1)
+			go func() { errc <- s.Run(ctx) }()
+
+			deadline := time.Now().Add(5 * time.Second)
+			for len(srv.Colors()) < tt.lights && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			cancel()
+			if err = <-errc; err != context.Canceled {
+				t.Errorf("expected streaming to be canceled, got %v", err)
+			}
+			if err = s.Close(); err != nil {
+				t.Errorf("unable to close streamer: %v", err)
+			}
+
+			if err = srv.Err(); err != nil {
+				t.Fatalf("server received an invalid message: %v", err)
+			}
+			if srv.Messages() == 0 {
+				t.Fatal("server received no message")
+			}
+
+			got := srv.Colors()
+			if len(got) != len(want) {
+				t.Fatalf("expected colors of %d lights, got %d", len(want), len(got))
+			}
+			for id, c := range want {
+				for i := range c {
+					if d := got[id][i] - c[i]; d > 1.0/0xffff || d < -1.0/0xffff {
+						t.Errorf("expected light %d to be %v, got %v", id, c, got[id])
+						break
+					}
+				}
+			}
+
+			g, err := client.Group("1")
+			if err != nil {
+				t.Fatalf("unable to get group: %v", err)
+			}
+			if g.Stream.Active {
+				t.Error("expected streaming to be stopped")
+			}
+		})
+	}
+}
+
+func TestOpenErrors(t *testing.T) {
+	b := huetest.NewBridge()
+	defer b.Close()
+	b.AddGroup(hue.Group{ID: "1", Name: "TV", Type: hue.GroupTypeEntertainment, Stream: &hue.GroupStream{}})
+	b.AddGroup(hue.Group{ID: "2", Name: "Office", Type: hue.GroupTypeRoom})
+
+	srv, err := huetest.NewStreamServer()
+	if err != nil {
+		t.Fatalf("unable to start stream server: %v", err)
+	}
+	defer srv.Close()
+
+	tests := []struct {
+		name      string
+		groupID   string
+		clientKey string
+		opts      []entertainment.Option
+	}{
+		{name: "invalid client key", groupID: "1", clientKey: "not hex"},
+		{name: "wrong client key", groupID: "1", clientKey: "ffffffffffffffffffffffffffffffff"},
+		{name: "rate too high", groupID: "1", clientKey: huetest.ClientKey, opts: []entertainment.Option{entertainment.WithRate(entertainment.MaxRate + 1)}},
+		{name: "not an entertainment group", groupID: "2", clientKey: huetest.ClientKey},
+		{name: "invalid configuration ID", groupID: "1", clientKey: huetest.ClientKey, opts: []entertainment.Option{entertainment.WithProtocolV2(huetest.Username)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			opts := append([]entertainment.Option{entertainment.WithAddr(srv.Addr())}, tt.opts...)
+			s, err := entertainment.Open(ctx, b.Client(), tt.groupID, tt.clientKey, opts...)
+			if err == nil {
+				_ = s.Close()
+				t.Fatal("expected an error")
+			}
+
+			g, err := b.Client().Group("1")
+			if err != nil {
+				t.Fatalf("unable to get group: %v", err)
+			}
+			if g.Stream.Active {
+				t.Error("expected streaming to be stopped")
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package entertainment
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestMessageRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  Message
+		size int
+	}{
+		{
+			name: "v1 rgb",
+			msg: Message{
+				Version:    1,
+				Sequence:   7,
+				ColorSpace: RGB,
+				Colors: []LightColor{
+					{ID: 1, Color: Color{1, 0, 0}},
+					{ID: 300, Color: Color{0, 0.5, 1}},
+				},
+			},
+			size: 16 + 2*9,
+		},
+		{
+			name: "v2 xy brightness",
+			msg: Message{
+				Version:    2,
+				Sequence:   255,
+				ColorSpace: XYBrightness,
+				ConfigID:   "1a8d99cc-967b-44f2-9202-43f976c0fa6b",
+				Colors: []LightColor{
+					{ID: 0, Color: Color{0.3127, 0.329, 1}},
+					{ID: 12, Color: Color{0.7, 0.3, 0.25}},
+				},
+			},
+			size: 16 + 36 + 2*7,
+		},
+		{
+			name: "v1 without colors",
+			msg:  Message{Version: 1},
+			size: 16,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := tt.msg.Encode()
+			if len(b) != tt.size {
+				t.Fatalf("expected %d bytes, got %d", tt.size, len(b))
+			}
+
+			got, err := DecodeMessage(b)
+			if err != nil {
+				t.Fatalf("unable to decode message: %v", err)
+			}
+			assertMessage(t, got, &tt.msg)
+		})
+	}
+}
+
+func TestEncodeClampsValues(t *testing.T) {
+	msg := Message{Version: 1, Colors: []LightColor{{ID: 1, Color: Color{-1, 2, 0.5}}}}
+
+	got, err := DecodeMessage(msg.Encode())
+	if err != nil {
+		t.Fatalf("unable to decode message: %v", err)
+	}
+	assertColor(t, got.Colors[0].Color, Color{0, 1, 0.5})
+}
+
+func TestDecodeMessageErrors(t *testing.T) {
+	valid := (&Message{Version: 1, Colors: []LightColor{{ID: 1}}}).Encode()
+	v3 := append([]byte(nil), valid...)
+	v3[9] = 3
+
+	tests := []struct {
+		name string
+		b    []byte
+	}{
+		{name: "empty", b: nil},
+		{name: "wrong protocol", b: bytes.Replace(valid, []byte(protocolName), []byte("HueStrean"), 1)},
+		{name: "truncated", b: valid[:len(valid)-1]},
+		{name: "v2 without configuration ID", b: (&Message{Version: 2, ConfigID: "short"}).Encode()},
+		{name: "unsupported version", b: v3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeMessage(tt.b); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestStreamerMessages(t *testing.T) {
+	tests := []struct {
+		name    string
+		version int
+		lights  int
+		want    []int
+	}{
+		{name: "v1 single message", version: 1, lights: 10, want: []int{10}},
+		{name: "v1 split", version: 1, lights: 25, want: []int{10, 10, 5}},
+		{name: "v2 single message", version: 2, lights: 20, want: []int{20}},
+		{name: "v2 split", version: 2, lights: 21, want: []int{20, 1}},
+		{name: "no lights", version: 1, lights: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Streamer{
+				groupID:    "1a8d99cc-967b-44f2-9202-43f976c0fa6b",
+				version:    tt.version,
+				colorSpace: RGB,
+				colors:     make(map[int]Color),
+				seq:        254,
+			}
+			for id := 0; id < tt.lights; id++ {
+				s.Set(id, Color{float64(id) / 100, 0, 1})
+			}
+
+			var (
+				sizes []int
+				next  int
+			)
+			for i, b := range s.messages() {
+				msg, err := DecodeMessage(b)
+				if err != nil {
+					t.Fatalf("unable to decode message %d: %v", i, err)
+				}
+				if msg.Version != tt.version {
+					t.Errorf("expected version %d, got %d", tt.version, msg.Version)
+				}
+				if want := uint8(254 + i); msg.Sequence != want {
+					t.Errorf("expected sequence %d, got %d", want, msg.Sequence)
+				}
+
+				// Lights are sent in order, each one once.
+				for _, c := range msg.Colors {
+					if c.ID != next {
+						t.Fatalf("expected light %d, got %d", next, c.ID)
+					}
+					assertColor(t, c.Color, Color{float64(next) / 100, 0, 1})
+					next++
+				}
+				sizes = append(sizes, len(msg.Colors))
+			}
+
+			if !reflect.DeepEqual(sizes, tt.want) {
+				t.Errorf("expected messages of %v lights, got %v", tt.want, sizes)
+			}
+		})
+	}
+}
+
+func assertMessage(t *testing.T, got, want *Message) {
+	t.Helper()
+
+	if got.Version != want.Version || got.Sequence != want.Sequence || got.ColorSpace != want.ColorSpace || got.ConfigID != want.ConfigID {
+		t.Fatalf("expected message %+v, got %+v", want, got)
+	}
+	if len(got.Colors) != len(want.Colors) {
+		t.Fatalf("expected %d colors, got %d", len(want.Colors), len(got.Colors))
+	}
+	for i := range want.Colors {
+		if got.Colors[i].ID != want.Colors[i].ID {
+			t.Errorf("expected light %d, got %d", want.Colors[i].ID, got.Colors[i].ID)
+		}
+		assertColor(t, got.Colors[i].Color, want.Colors[i].Color)
+	}
+}
+
+// assertColor compares colors up to the precision of their encoding.
+func assertColor(t *testing.T, got, want Color) {
+	t.Helper()
+
+	for i := range want {
+		if math.Abs(got[i]-want[i]) > 1.0/0xffff {
+			t.Errorf("expected color %v, got %v", want, got)
+			return
+		}
+	}
+}
@@ -0,0 +1,321 @@
+// Package exporter periodically scrapes a Hue bridge and exposes the state of
+// its lights and sensors as Prometheus metrics.
+package exporter
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/skwair/huectl/pkg/hue"
+)
+
+// DefaultInterval is how often the bridge is scraped by default.
+const DefaultInterval = 15 * time.Second
+
+const namespace = "hue"
+
+var (
+	lightLabels  = []string{"id", "name", "room", "model"}
+	sensorLabels = []string{"id", "name", "room", "model", "type"}
+
+	lightOnDesc = prometheus.NewDesc(
+		"hue_light_on", "Whether the light is on (1) or off (0).", lightLabels, nil)
+	lightBrightnessDesc = prometheus.NewDesc(
+		"hue_light_brightness", "Brightness of the light, in percent.", lightLabels, nil)
+	lightReachableDesc = prometheus.NewDesc(
+		"hue_light_reachable", "Whether the light can be reached by the bridge (1) or not (0).", lightLabels, nil)
+	sensorTemperatureDesc = prometheus.NewDesc(
+		"hue_sensor_temperature_celsius", "Temperature measured by the sensor, in degrees Celsius.", sensorLabels, nil)
+	sensorLightLevelDesc = prometheus.NewDesc(
+		"hue_sensor_lightlevel_lux", "Illuminance measured by the sensor, in lux.", sensorLabels, nil)
+	sensorBatteryDesc = prometheus.NewDesc(
+		"hue_sensor_battery_percent", "Battery level of the sensor, in percent.", sensorLabels, nil)
+	sensorReachableDesc = prometheus.NewDesc(
+		"hue_sensor_reachable", "Whether the sensor can be reached by the bridge (1) or not (0).", sensorLabels, nil)
+	upDesc = prometheus.NewDesc(
+		"hue_up", "Whether the last scrape of the bridge succeeded (1) or not (0).", nil, nil)
+	lastScrapeDesc = prometheus.NewDesc(
+		"hue_last_scrape_timestamp_seconds", "Time of the last scrape of the bridge, successful or not.", nil, nil)
+)
+
+// Exporter scrapes a Hue bridge and serves the results as Prometheus metrics.
+// Create one with New, pass its ObserveRequest method to the Hue client with
+// hue.WithRequestObserver and start scraping with Run.
+type Exporter struct {
+	interval time.Duration
+	logger   *log.Logger
+	registry *prometheus.Registry
+
+	requestDuration *prometheus.HistogramVec
+	requestErrors   *prometheus.CounterVec
+	apiErrors       *prometheus.CounterVec
+
+	mu       sync.RWMutex
+	snapshot *snapshot
+	up       bool
+	scrapeAt time.Time
+}
+
+// snapshot is the state of the bridge as of the last successful scrape.
+type snapshot struct {
+	lights  []hue.Light
+	sensors []hue.Sensor
+	// lightRooms and sensorRooms map IDs to the name of the room they are in.
+	lightRooms  map[string]string
+	sensorRooms map[string]string
+}
+
+// Option allows to customize an Exporter.
+type Option func(*Exporter)
+
+// WithInterval sets how often the bridge is scraped, DefaultInterval if not set.
+func WithInterval(d time.Duration) Option {
+	return func(e *Exporter) {
+		if d > 0 {
+			e.interval = d
+		}
+	}
+}
+
+// WithLogger sets the logger used to report scrape errors. Errors are not
+// logged by default.
+func WithLogger(l *log.Logger) Option {
+	return func(e *Exporter) {
+		e.logger = l
+	}
+}
+
+// New returns a new exporter.
+func New(opts ...Option) *Exporter {
+	e := &Exporter{
+		interval: DefaultInterval,
+		registry: prometheus.NewRegistry(),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "bridge",
+			Name:      "request_duration_seconds",
+			Help:      "Duration of requests sent to the bridge.",
+			Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		}, []string{"method", "endpoint"}),
+		requestErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "bridge",
+			Name:      "request_errors_total",
+			Help:      "Number of requests sent to the bridge that failed before it could answer them.",
+		}, []string{"method", "endpoint"}),
+		apiErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "bridge",
+			Name:      "api_errors_total",
+			Help:      "Number of errors returned by the bridge for requests it rejected, by error type.",
+		}, []string{"method", "endpoint", "type"}),
+	}
+
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	e.registry.MustRegister(
+		e,
+		e.requestDuration,
+		e.requestErrors,
+		e.apiErrors,
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	)
+
+	return e
+}
+
+// Handler returns the HTTP handler serving the metrics.
+func (e *Exporter) Handler() http.Handler {
+	return promhttp.HandlerFor(e.registry, promhttp.HandlerOpts{})
+}
+
+// ObserveRequest records the duration and the outcome of a request sent to
+// the bridge. It implements hue.RequestObserver.
+func (e *Exporter) ObserveRequest(method, endpoint string, d time.Duration, err error) {
+	endpoint = normalizeEndpoint(endpoint)
+
+	e.requestDuration.WithLabelValues(method, endpoint).Observe(d.Seconds())
+
+	var es hue.ErrorSet
+	switch {
+	case errors.As(err, &es):
+		for _, apiErr := range es {
+			e.apiErrors.WithLabelValues(method, endpoint, strconv.Itoa(apiErr.Type)).Inc()
+		}
+	case err != nil:
+		e.requestErrors.WithLabelValues(method, endpoint).Inc()
+	}
+}
+
+// normalizeEndpoint replaces resource IDs in an endpoint with a placeholder
+// to keep the cardinality of the endpoint label bounded,
+// e.g. /lights/1/state becomes /lights/{id}/state.
+func normalizeEndpoint(endpoint string) string {
+	parts := strings.Split(strings.Trim(endpoint, "/"), "/")
+	if len(parts) > 1 {
+		parts[1] = "{id}"
+	}
+
+	return "/" + strings.Join(parts, "/")
+}
+
+// Run scrapes the bridge through the given client right away, then at every
+// interval, until the context is canceled.
+func (e *Exporter) Run(ctx context.Context, client *hue.Client) error {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		e.scrape(client)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (e *Exporter) scrape(client *hue.Client) {
+	snap, err := fetch(client)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.scrapeAt = time.Now()
+	e.up = err == nil
+	if err != nil {
+		// Do not keep serving the state of lights from before the bridge
+		// became unreachable, it would be misleading.
+		e.snapshot = nil
+		if e.logger != nil {
+			e.logger.Printf("Unable to scrape the bridge: %v", err)
+		}
+		return
+	}
+	e.snapshot = snap
+}
+
+func fetch(client *hue.Client) (*snapshot, error) {
+	lights, err := client.Lights()
+	if err != nil {
+		return nil, err
+	}
+
+	sensors, err := client.Sensors()
+	if err != nil {
+		return nil, err
+	}
+
+	groups, err := client.Groups()
+	if err != nil {
+		return nil, err
+	}
+
+	snap := &snapshot{
+		lights:      lights,
+		sensors:     sensors,
+		lightRooms:  make(map[string]string),
+		sensorRooms: make(map[string]string),
+	}
+
+	for _, g := range groups {
+		// A light or a sensor can only belong to a single room.
+		if g.Type != hue.GroupTypeRoom {
+			continue
+		}
+		for _, id := range g.Lights {
+			snap.lightRooms[id] = g.Name
+		}
+		for _, id := range g.Sensors {
+			snap.sensorRooms[id] = g.Name
+		}
+	}
+
+	return snap, nil
+}
+
+// Describe implements the prometheus.Collector interface.
+func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		lightOnDesc,
+		lightBrightnessDesc,
+		lightReachableDesc,
+		sensorTemperatureDesc,
+		sensorLightLevelDesc,
+		sensorBatteryDesc,
+		sensorReachableDesc,
+		upDesc,
+		lastScrapeDesc,
+	} {
+		ch <- desc
+	}
+}
+
+// Collect implements the prometheus.Collector interface. It reports the
+// state of the bridge as of the last scrape; the bridge is not queried.
+func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.scrapeAt.IsZero() {
+		// Nothing was scraped yet.
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(upDesc, prometheus.GaugeValue, boolValue(e.up))
+	ch <- prometheus.MustNewConstMetric(lastScrapeDesc, prometheus.GaugeValue, float64(e.scrapeAt.UnixNano())/1e9)
+
+	if e.snapshot == nil {
+		return
+	}
+
+	for i := range e.snapshot.lights {
+		l := &e.snapshot.lights[i]
+		labels := []string{l.ID, l.Name, e.snapshot.lightRooms[l.ID], l.ModelID}
+
+		ch <- prometheus.MustNewConstMetric(lightOnDesc, prometheus.GaugeValue, boolValue(l.State.On), labels...)
+		ch <- prometheus.MustNewConstMetric(lightReachableDesc, prometheus.GaugeValue, boolValue(l.State.Reachable), labels...)
+		if l.IsDimmable() {
+			bri := math.Round(float64(l.State.Bri) / 254 * 100)
+			ch <- prometheus.MustNewConstMetric(lightBrightnessDesc, prometheus.GaugeValue, bri, labels...)
+		}
+	}
+
+	for i := range e.snapshot.sensors {
+		s := &e.snapshot.sensors[i]
+		labels := []string{s.ID, s.Name, e.snapshot.sensorRooms[s.ID], s.ModelID, s.Type}
+
+		if t, ok := s.TemperatureCelsius(); ok {
+			ch <- prometheus.MustNewConstMetric(sensorTemperatureDesc, prometheus.GaugeValue, t, labels...)
+		}
+		if lux, ok := s.LightLevelLux(); ok {
+			ch <- prometheus.MustNewConstMetric(sensorLightLevelDesc, prometheus.GaugeValue, lux, labels...)
+		}
+		if s.Config.Battery != nil {
+			ch <- prometheus.MustNewConstMetric(sensorBatteryDesc, prometheus.GaugeValue, float64(*s.Config.Battery), labels...)
+		}
+		if s.Config.Reachable != nil {
+			ch <- prometheus.MustNewConstMetric(sensorReachableDesc, prometheus.GaugeValue, boolValue(*s.Config.Reachable), labels...)
+		}
+	}
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
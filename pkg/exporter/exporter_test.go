@@ -0,0 +1,223 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skwair/huectl/pkg/hue"
+	"github.com/skwair/huectl/pkg/hue/huetest"
+)
+
+func newTestBridge() *huetest.Bridge {
+	intPtr := func(v int) *int { return &v }
+	boolPtr := func(v bool) *bool { return &v }
+
+	b := huetest.NewBridge()
+	b.AddLight(hue.Light{
+		ID:      "1",
+		Name:    "Desk",
+		Type:    hue.LightTypeExtendedColor,
+		ModelID: "LCT015",
+		State:   hue.LightState{On: true, Bri: 127, Reachable: true},
+	})
+	b.AddLight(hue.Light{
+		ID:      "2",
+		Name:    "Plug",
+		Type:    hue.LightTypeOnOffPlug,
+		ModelID: "LOM001",
+		State:   hue.LightState{},
+	})
+	b.AddSensor(hue.Sensor{
+		ID:      "5",
+		Name:    "Hall temperature",
+		Type:    hue.SensorTypeTemperature,
+		ModelID: "SML001",
+		State:   hue.SensorState{Temperature: intPtr(2150)},
+		Config:  hue.SensorConfig{Reachable: boolPtr(true), Battery: intPtr(80)},
+	})
+	b.AddSensor(hue.Sensor{
+		ID:      "6",
+		Name:    "Hall light level",
+		Type:    hue.SensorTypeLightLevel,
+		ModelID: "SML001",
+		State:   hue.SensorState{LightLevel: intPtr(20001)},
+		Config:  hue.SensorConfig{Reachable: boolPtr(false)},
+	})
+	b.AddGroup(hue.Group{ID: "1", Name: "Office", Type: hue.GroupTypeRoom, Lights: []string{"1"}})
+	b.AddGroup(hue.Group{ID: "2", Name: "Hall", Type: hue.GroupTypeRoom, Sensors: []string{"5", "6"}})
+	b.AddGroup(hue.Group{ID: "3", Name: "Everything", Type: hue.GroupTypeLightGroup, Lights: []string{"1", "2"}})
+
+	return b
+}
+
+// metrics returns the lines of the metrics served by the exporter.
+func metrics(t *testing.T, e *Exporter) map[string]bool {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	e.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	body, err := ioutil.ReadAll(w.Body)
+	if err != nil {
+		t.Fatalf("unable to read metrics: %v", err)
+	}
+
+	lines := make(map[string]bool)
+	for _, l := range strings.Split(string(body), "\n") {
+		if !strings.HasPrefix(l, "#") {
+			lines[l] = true
+		}
+	}
+
+	return lines
+}
+
+func hasPrefix(lines map[string]bool, prefix string) bool {
+	for l := range lines {
+		if strings.HasPrefix(l, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestExporterCollect(t *testing.T) {
+	b := newTestBridge()
+	defer b.Close()
+
+	e := New()
+
+	if lines := metrics(t, e); hasPrefix(lines, "hue_") {
+		t.Errorf("expected no bridge metrics before the first scrape")
+	}
+
+	e.scrape(b.Client())
+	lines := metrics(t, e)
+
+	for _, want := range []string{
+		"hue_up 1",
+		`hue_light_on{id="1",model="LCT015",name="Desk",room="Office"} 1`,
+		`hue_light_reachable{id="1",model="LCT015",name="Desk",room="Office"} 1`,
+		`hue_light_brightness{id="1",model="LCT015",name="Desk",room="Office"} 50`,
+		`hue_light_on{id="2",model="LOM001",name="Plug",room=""} 0`,
+		`hue_light_reachable{id="2",model="LOM001",name="Plug",room=""} 0`,
+		`hue_sensor_temperature_celsius{id="5",model="SML001",name="Hall temperature",room="Hall",type="ZLLTemperature"} 21.5`,
+		`hue_sensor_battery_percent{id="5",model="SML001",name="Hall temperature",room="Hall",type="ZLLTemperature"} 80`,
+		`hue_sensor_reachable{id="5",model="SML001",name="Hall temperature",room="Hall",type="ZLLTemperature"} 1`,
+		`hue_sensor_lightlevel_lux{id="6",model="SML001",name="Hall light level",room="Hall",type="ZLLLightLevel"} 100`,
+		`hue_sensor_reachable{id="6",model="SML001",name="Hall light level",room="Hall",type="ZLLLightLevel"} 0`,
+	} {
+		if !lines[want] {
+			t.Errorf("missing metric %s", want)
+		}
+	}
+
+	for _, unwanted := range []string{
+		// Plugs can not be dimmed.
+		`hue_light_brightness{id="2"`,
+		// Light level sensors do not report their battery.
+		`hue_sensor_battery_percent{id="6"`,
+	} {
+		if hasPrefix(lines, unwanted) {
+			t.Errorf("unexpected metric %s", unwanted)
+		}
+	}
+	if !hasPrefix(lines, "hue_last_scrape_timestamp_seconds ") {
+		t.Errorf("missing last scrape timestamp")
+	}
+
+	// Once the bridge is unreachable, its state must no longer be reported.
+	b.Close()
+	e.scrape(b.Client())
+	lines = metrics(t, e)
+
+	if !lines["hue_up 0"] {
+		t.Errorf("expected the bridge to be reported down")
+	}
+	if hasPrefix(lines, "hue_light_") || hasPrefix(lines, "hue_sensor_") {
+		t.Errorf("expected no light nor sensor metrics while the bridge is down")
+	}
+}
+
+func TestExporterObserveRequest(t *testing.T) {
+	e := New()
+
+	e.ObserveRequest(http.MethodGet, "/lights", 20*time.Millisecond, nil)
+	e.ObserveRequest(http.MethodPut, "/lights/1/state", 30*time.Millisecond, hue.ErrorSet{{Type: 201}, {Type: 201}, {Type: 7}})
+	e.ObserveRequest(http.MethodPut, "/lights/12/state", time.Second, errors.New("connection refused"))
+
+	lines := metrics(t, e)
+
+	for _, want := range []string{
+		`hue_bridge_request_duration_seconds_count{endpoint="/lights",method="GET"} 1`,
+		`hue_bridge_request_duration_seconds_count{endpoint="/lights/{id}/state",method="PUT"} 2`,
+		`hue_bridge_request_duration_seconds_bucket{endpoint="/lights/{id}/state",method="PUT",le="0.05"} 1`,
+		`hue_bridge_api_errors_total{endpoint="/lights/{id}/state",method="PUT",type="201"} 2`,
+		`hue_bridge_api_errors_total{endpoint="/lights/{id}/state",method="PUT",type="7"} 1`,
+		`hue_bridge_request_errors_total{endpoint="/lights/{id}/state",method="PUT"} 1`,
+	} {
+		if !lines[want] {
+			t.Errorf("missing metric %s", want)
+		}
+	}
+
+	if hasPrefix(lines, `hue_bridge_request_errors_total{endpoint="/lights",`) {
+		t.Errorf("unexpected request error for a successful request")
+	}
+}
+
+func TestNormalizeEndpoint(t *testing.T) {
+	tests := map[string]string{
+		"/lights":                      "/lights",
+		"/lights/12":                   "/lights/{id}",
+		"/lights/12/state":             "/lights/{id}/state",
+		"/groups/0/action":             "/groups/{id}/action",
+		"/scenes/AbCdEf/lightstates/3": "/scenes/{id}/lightstates/3",
+	}
+
+	for endpoint, want := range tests {
+		if got := normalizeEndpoint(endpoint); got != want {
+			t.Errorf("normalizeEndpoint(%q): expected %q, got %q", endpoint, want, got)
+		}
+	}
+}
+
+func TestExporterRun(t *testing.T) {
+	b := newTestBridge()
+	defer b.Close()
+
+	e := New(WithInterval(10 * time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- e.Run(ctx, b.Client()) }()
+
+	// Each scrape sends 3 requests: lights, sensors and groups.
+	deadline := time.Now().Add(5 * time.Second)
+	for b.Requests() < 6 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the bridge to be scraped periodically, got %d requests", b.Requests())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected Run to stop with the context, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Run did not stop once the context was canceled")
+	}
+}
@@ -0,0 +1,223 @@
+// Package gateway exposes a Hue bridge through a small, authenticated
+// REST/JSON API that is simpler to consume than the bridge's own v1 API.
+package gateway
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/skwair/huectl/pkg/hue"
+)
+
+// Server is an http.Handler serving the gateway API. Create one with New.
+type Server struct {
+	client *hue.Client
+	tokens [][]byte
+	logger *log.Logger
+}
+
+// Option allows to customize a Server.
+type Option func(*Server)
+
+// WithTokens sets the API tokens accepted by the server. Requests must send
+// one of them in an "Authorization: Bearer <token>" header. If no token is
+// set, requests are not authenticated.
+func WithTokens(tokens ...string) Option {
+	return func(s *Server) {
+		for _, t := range tokens {
+			s.tokens = append(s.tokens, []byte(t))
+		}
+	}
+}
+
+// WithLogger sets the logger used to log requests. Requests are not logged
+// by default.
+func WithLogger(l *log.Logger) Option {
+	return func(s *Server) {
+		s.logger = l
+	}
+}
+
+// New returns a new gateway server controlling the bridge through the given
+// client.
+func New(client *hue.Client, opts ...Option) *Server {
+	s := &Server{client: client}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+	s.route(rec, r)
+
+	if s.logger != nil {
+		s.logger.Printf("%s %s %s %d %s", r.RemoteAddr, r.Method, r.URL.Path, rec.status, time.Since(start).Round(time.Millisecond))
+	}
+}
+
+func (s *Server) route(w http.ResponseWriter, r *http.Request) {
+	// The API description is public so clients can be generated from it.
+	if r.URL.Path == "/openapi.json" {
+		allowMethods(w, r, http.MethodGet)
+		if r.Method == http.MethodGet {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(openAPIDocument))
+		}
+		return
+	}
+
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="huectl"`)
+		writeError(w, http.StatusUnauthorized, errors.New("missing or invalid API token"))
+		return
+	}
+
+	parts, err := splitPath(r.URL.EscapedPath())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	switch {
+	case match(parts, "lights"):
+		if allowMethods(w, r, http.MethodGet) {
+			s.listLights(w)
+		}
+	case match(parts, "lights", "*"):
+		if allowMethods(w, r, http.MethodGet, http.MethodPatch) {
+			if r.Method == http.MethodGet {
+				s.getLight(w, parts[1])
+			} else {
+				s.patchLight(w, r, parts[1])
+			}
+		}
+	case match(parts, "scenes"):
+		if allowMethods(w, r, http.MethodGet) {
+			s.listScenes(w)
+		}
+	case match(parts, "scenes", "*", "recall"):
+		if allowMethods(w, r, http.MethodPost) {
+			s.recallScene(w, r, parts[1])
+		}
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("no such endpoint: %s", r.URL.Path))
+	}
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	if len(s.tokens) == 0 {
+		return true
+	}
+
+	const prefix = "Bearer "
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, prefix) {
+		return false
+	}
+	given := []byte(strings.TrimPrefix(auth, prefix))
+
+	ok := false
+	for _, token := range s.tokens {
+		// Compare against every token so timing does not tell which one matched.
+		if subtle.ConstantTimeCompare(given, token) == 1 {
+			ok = true
+		}
+	}
+
+	return ok
+}
+
+// splitPath splits an escaped URL path into its unescaped elements, so names
+// containing slashes can be given as %2F.
+func splitPath(escaped string) ([]string, error) {
+	parts := strings.Split(strings.Trim(escaped, "/"), "/")
+	for i, p := range parts {
+		unescaped, err := url.PathUnescape(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path: %w", err)
+		}
+		parts[i] = unescaped
+	}
+
+	return parts, nil
+}
+
+func match(parts []string, pattern ...string) bool {
+	if len(parts) != len(pattern) {
+		return false
+	}
+
+	for i := range parts {
+		if pattern[i] != "*" && parts[i] != pattern[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// allowMethods reports whether the request method is one of the given ones,
+// writing a 405 response otherwise.
+func allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if r.Method == m {
+			return true
+		}
+	}
+
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+
+	return false
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+// writeBridgeError reports an error returned by the bridge. API errors are the
+// caller's fault (e.g. an invalid value), others mean the bridge is unreachable.
+func writeBridgeError(w http.ResponseWriter, err error) {
+	var apiErrs hue.ErrorSet
+	if errors.As(err, &apiErrs) {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	writeError(w, http.StatusBadGateway, fmt.Errorf("bridge: %w", err))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// statusRecorder records the status code of a response for logging.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
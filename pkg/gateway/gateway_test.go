@@ -0,0 +1,312 @@
+package gateway_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/skwair/huectl/pkg/gateway"
+	"github.com/skwair/huectl/pkg/hue"
+	"github.com/skwair/huectl/pkg/hue/huetest"
+)
+
+const token = "secret"
+
+func newTestBridge() *huetest.Bridge {
+	b := huetest.NewBridge()
+	b.AddLight(hue.Light{
+		ID:    "1",
+		Name:  "Desk",
+		Type:  hue.LightTypeExtendedColor,
+		State: hue.LightState{On: true, Bri: 254, Reachable: true},
+	})
+	b.AddLight(hue.Light{
+		ID:    "2",
+		Name:  "Living/Lamp",
+		Type:  hue.LightTypeDimmable,
+		State: hue.LightState{Bri: 200, Reachable: true},
+	})
+	b.AddGroup(hue.Group{ID: "1", Name: "Office", Type: hue.GroupTypeRoom, Lights: []string{"2"}})
+	b.AddScene(
+		hue.Scene{ID: "abc", Name: "Relax", Group: "1", Lights: []string{"2"}},
+		map[string]hue.LightState{"2": {On: true, Bri: 42}},
+	)
+
+	return b
+}
+
+// do sends a request to the server, authenticated with the given token if
+// it is not empty.
+func do(srv http.Handler, method, path, token, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, r)
+
+	return w
+}
+
+func TestServerAuthentication(t *testing.T) {
+	b := newTestBridge()
+	defer b.Close()
+
+	tests := []struct {
+		name       string
+		opts       []gateway.Option
+		path       string
+		header     string
+		wantStatus int
+	}{
+		{
+			name:       "valid token",
+			opts:       []gateway.Option{gateway.WithTokens("other", token)},
+			path:       "/lights",
+			header:     "Bearer " + token,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "missing token",
+			opts:       []gateway.Option{gateway.WithTokens(token)},
+			path:       "/lights",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "invalid token",
+			opts:       []gateway.Option{gateway.WithTokens(token)},
+			path:       "/lights",
+			header:     "Bearer " + token + "x",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "not a bearer token",
+			opts:       []gateway.Option{gateway.WithTokens(token)},
+			path:       "/lights",
+			header:     "Basic " + token,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "public API description",
+			opts:       []gateway.Option{gateway.WithTokens(token)},
+			path:       "/openapi.json",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "no token configured",
+			path:       "/lights",
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := gateway.New(b.Client(), tt.opts...)
+
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			srv.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body)
+			}
+			if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Errorf("expected a WWW-Authenticate header")
+			}
+		})
+	}
+}
+
+func TestServerPatchLight(t *testing.T) {
+	tests := []struct {
+		name            string
+		light           string
+		body            string
+		wantStatus      int
+		wantApplied     []string
+		wantRejected    map[string]string
+		wantAdjustments []string
+		wantState       hue.LightState
+	}{
+		{
+			name:            "update",
+			light:           "Desk",
+			body:            `{"brightness": 50, "ct": 1000}`,
+			wantStatus:      http.StatusOK,
+			wantApplied:     []string{"bri", "ct"},
+			wantAdjustments: []string{"clamped ct from 1000 to 500"},
+			wantState:       hue.LightState{On: true, Bri: 127, CT: 500, ColorMode: "ct", Reachable: true},
+		},
+		{
+			name:            "unsupported attribute",
+			light:           "Living%2FLamp",
+			body:            `{"on": true, "ct": 300}`,
+			wantStatus:      http.StatusOK,
+			wantApplied:     []string{"on"},
+			wantAdjustments: []string{"dropped ct, not supported by this dimmable light"},
+			wantState:       hue.LightState{On: true, Bri: 200, Reachable: true},
+		},
+		{
+			name:         "partially applied",
+			light:        "2",
+			body:         `{"on": false, "brightness": 10}`,
+			wantStatus:   http.StatusOK,
+			wantApplied:  []string{"on"},
+			wantRejected: map[string]string{"bri": "parameter, bri, is not modifiable. Device is set to off."},
+			wantState:    hue.LightState{Bri: 200, Reachable: true},
+		},
+		{
+			name:       "rejected by the bridge",
+			light:      "2",
+			body:       `{"brightness": 10}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "brightness out of range",
+			light:      "Desk",
+			body:       `{"brightness": 101}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "several colors",
+			light:      "Desk",
+			body:       `{"color": "red", "ct": 300}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "unknown color",
+			light:      "Desk",
+			body:       `{"color": "nope"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid transition",
+			light:      "Desk",
+			body:       `{"on": false, "transition": "soon"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid body",
+			light:      "Desk",
+			body:       `{"on": `,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "unknown light",
+			light:      "Kitchen",
+			body:       `{"on": true}`,
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestBridge()
+			defer b.Close()
+
+			srv := gateway.New(b.Client(), gateway.WithTokens(token))
+			w := do(srv, http.MethodPatch, "/lights/"+tt.light, token, tt.body)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body)
+			}
+			if w.Code != http.StatusOK {
+				var res struct{ Error string }
+				if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || res.Error == "" {
+					t.Errorf("expected an error message, got %s", w.Body)
+				}
+				return
+			}
+
+			var res gateway.PatchResult
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+				t.Fatalf("unable to decode response: %v", err)
+			}
+			if !reflect.DeepEqual(res.Applied, tt.wantApplied) {
+				t.Errorf("expected applied %v, got %v", tt.wantApplied, res.Applied)
+			}
+			if !reflect.DeepEqual(res.Rejected, tt.wantRejected) {
+				t.Errorf("expected rejected %v, got %v", tt.wantRejected, res.Rejected)
+			}
+			if !reflect.DeepEqual(res.Adjustments, tt.wantAdjustments) {
+				t.Errorf("expected adjustments %v, got %v", tt.wantAdjustments, res.Adjustments)
+			}
+			if got := b.Light(res.Light.ID).State; got != tt.wantState {
+				t.Errorf("expected state %+v, got %+v", tt.wantState, got)
+			}
+		})
+	}
+}
+
+func TestServerRecallScene(t *testing.T) {
+	b := newTestBridge()
+	defer b.Close()
+
+	srv := gateway.New(b.Client(), gateway.WithTokens(token))
+
+	if w := do(srv, http.MethodPost, "/scenes/Relax/recall?group=Kitchen", token, ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d for an unknown group, got %d", http.StatusNotFound, w.Code)
+	}
+	if w := do(srv, http.MethodGet, "/scenes/Relax/recall", token, ""); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status %d for a GET request, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+
+	if w := do(srv, http.MethodPost, "/scenes/relax/recall?group=Office", token, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusNoContent, w.Code, w.Body)
+	}
+	if s := b.Light("2").State; !s.On || s.Bri != 42 {
+		t.Errorf("expected the scene to be recalled, got %+v", s)
+	}
+}
+
+func TestServerOpenAPI(t *testing.T) {
+	b := newTestBridge()
+	defer b.Close()
+
+	srv := gateway.New(b.Client(), gateway.WithTokens(token))
+
+	w := do(srv, http.MethodGet, "/openapi.json", "", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected a JSON content type, got %q", ct)
+	}
+
+	var doc struct {
+		OpenAPI string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid OpenAPI document: %v", err)
+	}
+	if doc.OpenAPI != "3.0.3" {
+		t.Errorf("expected OpenAPI version 3.0.3, got %q", doc.OpenAPI)
+	}
+
+	// Every endpoint served must be described.
+	endpoints := map[string][]string{
+		"/lights":                {"get"},
+		"/lights/{light}":        {"get", "patch"},
+		"/scenes":                {"get"},
+		"/scenes/{scene}/recall": {"post"},
+	}
+	for path, methods := range endpoints {
+		for _, m := range methods {
+			if _, ok := doc.Paths[path][m]; !ok {
+				t.Errorf("missing %s %s in the OpenAPI document", strings.ToUpper(m), path)
+			}
+		}
+	}
+
+	if w = do(srv, http.MethodPost, "/openapi.json", "", ""); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status %d for a POST request, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+}
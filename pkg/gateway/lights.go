@@ -0,0 +1,236 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/skwair/harmony/optional"
+	"github.com/skwair/huectl/pkg/colors"
+	"github.com/skwair/huectl/pkg/hue"
+)
+
+// Light is the representation of a light returned by the API.
+type Light struct {
+	ID         string      `json:"id"`
+	Name       string      `json:"name"`
+	Type       string      `json:"type"`
+	Model      string      `json:"model"`
+	On         bool        `json:"on"`
+	Reachable  bool        `json:"reachable"`
+	Brightness *int        `json:"brightness,omitempty"`
+	ColorMode  string      `json:"color_mode,omitempty"`
+	XY         *[2]float64 `json:"xy,omitempty"`
+	CT         *int        `json:"ct,omitempty"`
+}
+
+func newLight(l *hue.Light) Light {
+	light := Light{
+		ID:        l.ID,
+		Name:      l.Name,
+		Type:      l.Type,
+		Model:     l.ModelID,
+		On:        l.State.On,
+		Reachable: l.State.Reachable,
+	}
+
+	if l.IsDimmable() {
+		bri := int(math.Round(float64(l.State.Bri) / 254 * 100))
+		light.Brightness = &bri
+	}
+
+	if l.SupportsColor() || l.SupportsColorTemperature() {
+		light.ColorMode = l.State.ColorMode
+	}
+
+	if l.SupportsColor() {
+		xy := l.State.XY
+		light.XY = &xy
+	}
+
+	if l.SupportsColorTemperature() {
+		ct := l.State.CT
+		light.CT = &ct
+	}
+
+	return light
+}
+
+// LightPatch is the body of a PATCH request on a light.
+// Only the given fields are updated.
+type LightPatch struct {
+	On *bool `json:"on"`
+	// Brightness in percent.
+	Brightness *int `json:"brightness"`
+	// Color as a name or a hex code, e.g. "orange" or "#ffa500".
+	Color *string `json:"color"`
+	// XY is a color as CIE xy coordinates.
+	XY *[2]float64 `json:"xy"`
+	// CT is a color temperature, in mireds.
+	CT *int `json:"ct"`
+	// Transition is the duration of the transition to the new state, e.g. "1.5s".
+	Transition *string `json:"transition"`
+}
+
+// request converts the patch to a state update.
+func (p *LightPatch) request() (*hue.SetLightStateRequest, error) {
+	var req hue.SetLightStateRequest
+
+	if p.On != nil {
+		req.On = optional.NewBool(*p.On)
+	}
+
+	if p.Brightness != nil {
+		if *p.Brightness < 0 || *p.Brightness > 100 {
+			return nil, fmt.Errorf("brightness must be between 0 and 100, got %d", *p.Brightness)
+		}
+		req.Bri = optional.NewInt(int(math.Round(254.0 / 100.0 * float64(*p.Brightness))))
+	}
+
+	var set int
+	if p.Color != nil {
+		c, err := colors.Parse(*p.Color)
+		if err != nil {
+			return nil, err
+		}
+		xy := hue.RGBToXY(c.R, c.G, c.B)
+		req.XY = &[2]float32{float32(xy[0]), float32(xy[1])}
+		set++
+	}
+
+	if p.XY != nil {
+		req.XY = &[2]float32{float32(p.XY[0]), float32(p.XY[1])}
+		set++
+	}
+
+	if p.CT != nil {
+		req.CT = optional.NewInt(*p.CT)
+		set++
+	}
+
+	if set > 1 {
+		return nil, fmt.Errorf("only one of color, xy and ct can be set")
+	}
+
+	if p.Transition != nil {
+		d, err := time.ParseDuration(*p.Transition)
+		if err != nil {
+			return nil, fmt.Errorf("invalid transition: %w", err)
+		}
+		if d < 0 || d > math.MaxUint16*100*time.Millisecond {
+			return nil, fmt.Errorf("transition out of range: %s", d)
+		}
+		req.TransitionTime = optional.NewInt(int(d / (100 * time.Millisecond)))
+	}
+
+	return &req, nil
+}
+
+// PatchResult is the response to a PATCH request on a light.
+type PatchResult struct {
+	Light       Light             `json:"light"`
+	Applied     []string          `json:"applied"`
+	Rejected    map[string]string `json:"rejected,omitempty"`
+	Adjustments []string          `json:"adjustments,omitempty"`
+}
+
+func (s *Server) listLights(w http.ResponseWriter) {
+	lights, err := s.client.Lights()
+	if err != nil {
+		writeBridgeError(w, err)
+		return
+	}
+
+	sort.Slice(lights, func(i, j int) bool { return lights[i].Name < lights[j].Name })
+
+	res := make([]Light, 0, len(lights))
+	for i := range lights {
+		res = append(res, newLight(&lights[i]))
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (s *Server) getLight(w http.ResponseWriter, ref string) {
+	light, ok := s.findLight(w, ref)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newLight(light))
+}
+
+func (s *Server) patchLight(w http.ResponseWriter, r *http.Request, ref string) {
+	var patch LightPatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid body: %w", err))
+		return
+	}
+
+	req, err := patch.request()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	light, ok := s.findLight(w, ref)
+	if !ok {
+		return
+	}
+
+	req, adjustments, err := hue.ValidateLightState(light, req, hue.Convert)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	res, err := s.client.SetLightState(light.ID, req)
+	if err != nil {
+		writeBridgeError(w, err)
+		return
+	}
+
+	updated, err := s.client.Light(light.ID)
+	if err != nil {
+		writeBridgeError(w, err)
+		return
+	}
+
+	result := PatchResult{
+		Light:       newLight(updated),
+		Applied:     []string{},
+		Adjustments: adjustments,
+	}
+	for _, attr := range res.Applied {
+		result.Applied = append(result.Applied, attr.Name())
+	}
+	if len(res.Rejected) > 0 {
+		result.Rejected = make(map[string]string, len(res.Rejected))
+		for _, e := range res.Rejected {
+			result.Rejected[e.Attribute()] = e.Description
+		}
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// findLight returns the light with the given ID or name, writing a 404
+// response if there is none.
+func (s *Server) findLight(w http.ResponseWriter, ref string) (*hue.Light, bool) {
+	lights, err := s.client.Lights()
+	if err != nil {
+		writeBridgeError(w, err)
+		return nil, false
+	}
+
+	light := hue.FindLight(lights, ref)
+	if light == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no light named %q", ref))
+		return nil, false
+	}
+
+	return light, true
+}
@@ -0,0 +1,149 @@
+package gateway
+
+// openAPIDocument describes the gateway API, served at /openapi.json.
+const openAPIDocument = `{
+  "openapi": "3.0.3",
+  "info": {
+    "title": "huectl gateway",
+    "description": "A simple REST API to control the lights of a Philips Hue bridge.",
+    "version": "1.0.0"
+  },
+  "security": [{"bearerAuth": []}],
+  "paths": {
+    "/lights": {
+      "get": {
+        "summary": "List lights",
+        "responses": {
+          "200": {
+            "description": "All the lights of the bridge, sorted by name.",
+            "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Light"}}}}
+          },
+          "401": {"$ref": "#/components/responses/Unauthorized"},
+          "502": {"$ref": "#/components/responses/BridgeError"}
+        }
+      }
+    },
+    "/lights/{light}": {
+      "parameters": [{"$ref": "#/components/parameters/Light"}],
+      "get": {
+        "summary": "Get a light",
+        "responses": {
+          "200": {"description": "The light.", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Light"}}}},
+          "401": {"$ref": "#/components/responses/Unauthorized"},
+          "404": {"$ref": "#/components/responses/NotFound"},
+          "502": {"$ref": "#/components/responses/BridgeError"}
+        }
+      },
+      "patch": {
+        "summary": "Update the state of a light",
+        "description": "Only the given fields are updated. Colors the light can not display are converted to the closest ones it can.",
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/LightPatch"}}}
+        },
+        "responses": {
+          "200": {"description": "The outcome of the update.", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/PatchResult"}}}},
+          "400": {"$ref": "#/components/responses/BadRequest"},
+          "401": {"$ref": "#/components/responses/Unauthorized"},
+          "404": {"$ref": "#/components/responses/NotFound"},
+          "422": {"$ref": "#/components/responses/BadRequest"},
+          "502": {"$ref": "#/components/responses/BridgeError"}
+        }
+      }
+    },
+    "/scenes": {
+      "get": {
+        "summary": "List scenes",
+        "responses": {
+          "200": {
+            "description": "All the scenes of the bridge, sorted by name.",
+            "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Scene"}}}}
+          },
+          "401": {"$ref": "#/components/responses/Unauthorized"},
+          "502": {"$ref": "#/components/responses/BridgeError"}
+        }
+      }
+    },
+    "/scenes/{scene}/recall": {
+      "parameters": [
+        {"name": "scene", "in": "path", "required": true, "description": "ID or name of the scene.", "schema": {"type": "string"}},
+        {"name": "group", "in": "query", "required": false, "description": "ID or name of the group of the scene, when several scenes have the same name.", "schema": {"type": "string"}}
+      ],
+      "post": {
+        "summary": "Recall a scene",
+        "responses": {
+          "204": {"description": "The scene was recalled."},
+          "401": {"$ref": "#/components/responses/Unauthorized"},
+          "404": {"$ref": "#/components/responses/NotFound"},
+          "409": {"$ref": "#/components/responses/BadRequest"},
+          "502": {"$ref": "#/components/responses/BridgeError"}
+        }
+      }
+    }
+  },
+  "components": {
+    "securitySchemes": {
+      "bearerAuth": {"type": "http", "scheme": "bearer"}
+    },
+    "parameters": {
+      "Light": {"name": "light", "in": "path", "required": true, "description": "ID or name of the light.", "schema": {"type": "string"}}
+    },
+    "responses": {
+      "BadRequest": {"description": "The request is invalid.", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}},
+      "Unauthorized": {"description": "The API token is missing or invalid.", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}},
+      "NotFound": {"description": "The resource does not exist.", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}},
+      "BridgeError": {"description": "The bridge could not be reached.", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}}
+    },
+    "schemas": {
+      "Error": {
+        "type": "object",
+        "properties": {"error": {"type": "string"}}
+      },
+      "Light": {
+        "type": "object",
+        "properties": {
+          "id": {"type": "string"},
+          "name": {"type": "string"},
+          "type": {"type": "string", "example": "Extended color light"},
+          "model": {"type": "string"},
+          "on": {"type": "boolean"},
+          "reachable": {"type": "boolean"},
+          "brightness": {"type": "integer", "minimum": 0, "maximum": 100, "description": "Brightness in percent, only for dimmable lights."},
+          "color_mode": {"type": "string", "enum": ["hs", "xy", "ct"]},
+          "xy": {"type": "array", "items": {"type": "number"}, "minItems": 2, "maxItems": 2, "description": "Color as CIE xy coordinates, only for color lights."},
+          "ct": {"type": "integer", "description": "Color temperature in mireds, only for white ambiance lights."}
+        }
+      },
+      "LightPatch": {
+        "type": "object",
+        "properties": {
+          "on": {"type": "boolean"},
+          "brightness": {"type": "integer", "minimum": 0, "maximum": 100},
+          "color": {"type": "string", "description": "Color name or hex code, e.g. orange or #ffa500."},
+          "xy": {"type": "array", "items": {"type": "number"}, "minItems": 2, "maxItems": 2},
+          "ct": {"type": "integer", "description": "Color temperature in mireds."},
+          "transition": {"type": "string", "description": "Duration of the transition, e.g. 1.5s."}
+        }
+      },
+      "PatchResult": {
+        "type": "object",
+        "properties": {
+          "light": {"$ref": "#/components/schemas/Light"},
+          "applied": {"type": "array", "items": {"type": "string"}, "description": "Attributes that were updated."},
+          "rejected": {"type": "object", "additionalProperties": {"type": "string"}, "description": "Attributes the bridge refused to update, with the reason."},
+          "adjustments": {"type": "array", "items": {"type": "string"}, "description": "Changes made to fit the capabilities of the light."}
+        }
+      },
+      "Scene": {
+        "type": "object",
+        "properties": {
+          "id": {"type": "string"},
+          "name": {"type": "string"},
+          "group": {"type": "string"},
+          "lights": {"type": "array", "items": {"type": "string"}}
+        }
+      }
+    }
+  }
+}
+`
@@ -0,0 +1,100 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/skwair/huectl/pkg/hue"
+)
+
+// Scene is the representation of a scene returned by the API.
+type Scene struct {
+	ID     string   `json:"id"`
+	Name   string   `json:"name"`
+	Group  string   `json:"group,omitempty"`
+	Lights []string `json:"lights"`
+}
+
+func (s *Server) listScenes(w http.ResponseWriter) {
+	scenes, err := s.client.Scenes()
+	if err != nil {
+		writeBridgeError(w, err)
+		return
+	}
+
+	sort.Slice(scenes, func(i, j int) bool { return scenes[i].Name < scenes[j].Name })
+
+	res := make([]Scene, 0, len(scenes))
+	for _, sc := range scenes {
+		res = append(res, Scene{ID: sc.ID, Name: sc.Name, Group: sc.Group, Lights: sc.Lights})
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+// recallScene recalls the scene with the given ID or name. Several rooms
+// commonly have scenes with the same name, so the "group" query parameter
+// can be used to pick the scene of a given group, by ID or name.
+func (s *Server) recallScene(w http.ResponseWriter, r *http.Request, ref string) {
+	scenes, err := s.client.Scenes()
+	if err != nil {
+		writeBridgeError(w, err)
+		return
+	}
+
+	groupID := ""
+	if group := r.URL.Query().Get("group"); group != "" {
+		groups, err := s.client.Groups()
+		if err != nil {
+			writeBridgeError(w, err)
+			return
+		}
+
+		g := hue.FindGroup(groups, group)
+		if g == nil {
+			writeError(w, http.StatusNotFound, fmt.Errorf("no group named %q", group))
+			return
+		}
+		groupID = g.ID
+	}
+
+	var matches []hue.Scene
+	for _, sc := range scenes {
+		if sc.ID == ref {
+			matches = []hue.Scene{sc}
+			break
+		}
+		if strings.EqualFold(sc.Name, ref) && (groupID == "" || sc.Group == groupID) {
+			matches = append(matches, sc)
+		}
+	}
+
+	switch {
+	case len(matches) == 0:
+		writeError(w, http.StatusNotFound, fmt.Errorf("no scene named %q", ref))
+		return
+	case len(matches) > 1:
+		writeError(w, http.StatusConflict, fmt.Errorf("%d scenes are named %q, use the group parameter or a scene ID", len(matches), ref))
+		return
+	}
+
+	scene := matches[0]
+	target := scene.Group
+	if target == "" {
+		target = "0"
+	}
+
+	res, err := s.client.RecallScene(target, scene.ID)
+	if err != nil {
+		writeBridgeError(w, err)
+		return
+	}
+	if err = res.Err(); err != nil {
+		writeBridgeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
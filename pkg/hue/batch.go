@@ -0,0 +1,111 @@
+package hue
+
+import (
+	"sort"
+	"sync"
+)
+
+// DefaultBatchParallelism is the default number of concurrent requests sent
+// to the bridge by batch operations. Bridges start dropping commands when
+// receiving more than about ten light updates per second, so keep it low.
+const DefaultBatchParallelism = 4
+
+// BatchResult is the outcome of an operation on a single light of a batch.
+type BatchResult struct {
+	// Update is the result of the state update, nil if Err is set.
+	Update *UpdateResult
+	// Err is set if the operation failed entirely for this light.
+	Err error
+}
+
+// Failed reports whether the operation failed, even partially, for this light.
+func (r BatchResult) Failed() bool {
+	return r.Err != nil || (r.Update != nil && len(r.Update.Rejected) > 0)
+}
+
+// BatchOption allows to customize a batch operation.
+type BatchOption func(*batchOptions)
+
+type batchOptions struct {
+	parallelism int
+}
+
+// WithParallelism sets the maximum number of concurrent requests sent to the
+// bridge during a batch operation. Values lower than 1 are ignored.
+func WithParallelism(n int) BatchOption {
+	return func(o *batchOptions) {
+		if n > 0 {
+			o.parallelism = n
+		}
+	}
+}
+
+// SetLightsState applies the given state to all the specified lights
+// concurrently. It returns a result for each distinct light ID.
+func (c *Client) SetLightsState(ids []string, req *SetLightStateRequest, opts ...BatchOption) map[string]BatchResult {
+	return c.batch(ids, opts, func(id string) (*UpdateResult, error) {
+		return c.SetLightState(id, req)
+	})
+}
+
+// SetLightStates applies a distinct state to each light concurrently,
+// reqs being indexed by light ID. It returns a result for each light.
+func (c *Client) SetLightStates(reqs map[string]*SetLightStateRequest, opts ...BatchOption) map[string]BatchResult {
+	ids := make([]string, 0, len(reqs))
+	for id := range reqs {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return LessID(ids[i], ids[j]) })
+
+	return c.batch(ids, opts, func(id string) (*UpdateResult, error) {
+		return c.SetLightState(id, reqs[id])
+	})
+}
+
+// ToggleLights toggles all the specified lights concurrently. It returns a
+// result for each distinct light ID.
+func (c *Client) ToggleLights(ids []string, opts ...BatchOption) map[string]BatchResult {
+	return c.batch(ids, opts, c.ToggleLight)
+}
+
+// batch runs fn for each distinct ID, with bounded parallelism.
+func (c *Client) batch(ids []string, opts []BatchOption, fn func(id string) (*UpdateResult, error)) map[string]BatchResult {
+	o := batchOptions{parallelism: DefaultBatchParallelism}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		sem     = make(chan struct{}, o.parallelism)
+		seen    = make(map[string]bool, len(ids))
+		results = make(map[string]BatchResult, len(ids))
+	)
+
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(id string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			res, err := fn(id)
+
+			mu.Lock()
+			results[id] = BatchResult{Update: res, Err: err}
+			mu.Unlock()
+		}(id)
+	}
+
+	wg.Wait()
+
+	return results
+}
@@ -1,9 +1,9 @@
 package hue
 
 import (
-	"crypto/sha1"
-	"encoding/hex"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -14,10 +14,15 @@ const hueDiscoveryURL = "https://discovery.meethue.com"
 
 // Bridge is a Hue bridge, discovered on a local network by DiscoverBridges.
 type Bridge struct {
-	ID              string
-	IPAddr          string
-	Name            string
+	ID     string
+	IPAddr string
+	Name   string
+	// CertFingerprint is the SHA-256 fingerprint of the certificate of the
+	// bridge, to pin with WithCertFingerprint.
 	CertFingerprint string
+	// Certificates are the certificate of the bridge and its intermediates,
+	// if any, e.g. to check it with VerifyBridgeCertificate.
+	Certificates []*x509.Certificate
 }
 
 // DiscoverBridges searches for Hue bridges on the local network using Philips'
@@ -45,55 +50,49 @@ func DiscoverBridges(httpClient *http.Client) ([]Bridge, error) {
 
 	var bridges []Bridge
 	for _, info := range bridgeInfos {
-		name, fp, err := pingBridge(httpClient, info.IPAddr)
+		b, err := GetBridge(httpClient, info.IPAddr)
 		if err != nil {
 			fmt.Printf("unable to ping bridge %q at %s: %v, skipping it\n", info.ID, info.IPAddr, err)
 			continue
 		}
 
-		bridges = append(bridges, Bridge{
-			ID:              info.ID,
-			IPAddr:          info.IPAddr,
-			Name:            name,
-			CertFingerprint: fp,
-		})
+		b.ID = info.ID
+		bridges = append(bridges, *b)
 	}
 
 	return bridges, nil
 }
 
-func pingBridge(httpClient *http.Client, ip string) (name, fingerprint string, err error) {
-	resp, err := httpClient.Get(fmt.Sprintf("https://%s/api/config", ip))
+// GetBridge returns the Hue bridge at the given address, as a host name or IP
+// address with an optional port, e.g. when its address is known and discovery
+// is not needed. The given HTTP client must accept the certificate of the
+// bridge, which can not be verified before it is pinned.
+func GetBridge(httpClient *http.Client, addr string) (*Bridge, error) {
+	resp, err := httpClient.Get(fmt.Sprintf("https://%s/api/config", addr))
 	if err != nil {
-		return "", "", fmt.Errorf("unable to get Hue bridge information: %w", err)
+		return nil, fmt.Errorf("unable to get Hue bridge information: %w", err)
 	}
 	defer resp.Body.Close()
 
 	var b struct {
-		Name string `json:"name"`
+		Name     string `json:"name"`
+		BridgeID string `json:"bridgeid"`
 	}
 	if err = json.NewDecoder(resp.Body).Decode(&b); err != nil {
-		return "", "", fmt.Errorf("unable to decode Hue bridge information: %w", err)
+		return nil, fmt.Errorf("unable to decode Hue bridge information: %w", err)
 	}
 
-	if len(resp.TLS.PeerCertificates) != 1 {
-		return "", "", fmt.Errorf("expected exactly one peer certificate; got %d", len(resp.TLS.PeerCertificates))
+	if resp.TLS == nil || len(resp.TLS.PeerCertificates) == 0 {
+		return nil, errors.New("bridge did not present a certificate")
 	}
-
-	return b.Name, computeFingerprint(resp.TLS.PeerCertificates[0].Raw), nil
-}
-
-func computeFingerprint(d []byte) string {
-	sum := sha1.Sum(d)
-
-	var s strings.Builder
-	for i, byt := range sum {
-		s.WriteString(hex.EncodeToString([]byte{byt}))
-
-		if i+1 < len(sum) {
-			s.WriteByte(':')
-		}
-	}
-
-	return s.String()
+	certs := resp.TLS.PeerCertificates
+
+	return &Bridge{
+		// The discovery service returns lowercase IDs, use the same ones.
+		ID:              strings.ToLower(b.BridgeID),
+		IPAddr:          addr,
+		Name:            b.Name,
+		CertFingerprint: Fingerprint(certs[0].Raw),
+		Certificates:    certs,
+	}, nil
 }
@@ -0,0 +1,40 @@
+package hue
+
+import "math"
+
+// Light types, as reported by the bridge in Light.Type.
+const (
+	LightTypeOnOffPlug        = "On/Off plug-in unit"
+	LightTypeOnOff            = "On/Off light"
+	LightTypeDimmable         = "Dimmable light"
+	LightTypeColorTemperature = "Color temperature light"
+	LightTypeColor            = "Color light"
+	LightTypeExtendedColor    = "Extended color light"
+)
+
+// IsDimmable reports whether the brightness of the light can be changed.
+func (l *Light) IsDimmable() bool {
+	return l.Type != LightTypeOnOffPlug && l.Type != LightTypeOnOff
+}
+
+// SupportsColor reports whether the light can display colors, using either
+// hue and saturation or xy coordinates.
+func (l *Light) SupportsColor() bool {
+	return l.Type == LightTypeColor ||
+		l.Type == LightTypeExtendedColor ||
+		l.Capabilities.Control.ColorGamutType != ""
+}
+
+// SupportsColorTemperature reports whether the color temperature of the
+// light can be changed.
+func (l *Light) SupportsColorTemperature() bool {
+	return l.Type == LightTypeColorTemperature ||
+		l.Type == LightTypeExtendedColor ||
+		l.Capabilities.Control.Ct.Max > 0
+}
+
+// MinBrightness returns the lowest brightness the light can be set to, on the
+// 1-254 scale of the bridge, according to its minimum dim level.
+func (l *Light) MinBrightness() int {
+	return int(math.Max(1, math.Ceil(float64(l.Capabilities.Control.MinDimLevel)*254/100000)))
+}
@@ -9,10 +9,11 @@ import (
 // Client is a client that can interact with the API exposed by a Hue bridge.
 // Create one with NewClient.
 type Client struct {
-	url             string
-	id              string
-	httpClient      *http.Client
-	certFingerprint string
+	url        string
+	id         string
+	httpClient *http.Client
+	verifier   *CertVerifier
+	observer   RequestObserver
 }
 
 var defaultHTTPClient = &http.Client{
@@ -36,6 +37,17 @@ func NewClient(url, id string, opts ...ClientOption) *Client {
 		opt(c)
 	}
 
+	// Certificates are verified by the default HTTP client only, custom ones
+	// can use a CertVerifier in their own TLS configuration.
+	if c.verifier != nil && c.httpClient == defaultHTTPClient {
+		c.httpClient = &http.Client{
+			Timeout: defaultHTTPClient.Timeout,
+			Transport: &http.Transport{
+				TLSClientConfig: c.verifier.TLSConfig(),
+			},
+		}
+	}
+
 	return c
 }
 
@@ -49,10 +61,54 @@ func WithHTTPClient(client *http.Client) ClientOption {
 	}
 }
 
-// WithCertFingerprint enables TLS certificate fingerprint verification on each request to the bridge.
-// Has no effect on non-encrypted connections.
+// WithCertFingerprint pins the certificate of the bridge to the given SHA-256
+// fingerprint (or legacy SHA-1 fingerprint, see WithFingerprintUpgrade): it is
+// verified during the TLS handshake, before any request is sent. Has no effect
+// on non-encrypted connections or with WithHTTPClient.
 func WithCertFingerprint(fp string) ClientOption {
 	return func(c *Client) {
-		c.certFingerprint = fp
+		c.certVerifier().Fingerprint = fp
+	}
+}
+
+// WithBridgeCA requires the certificate of the bridge to be issued by the
+// Signify root CA to the bridge with the given ID, which is only the case for
+// recent bridges. Has no effect on non-encrypted connections or with
+// WithHTTPClient.
+func WithBridgeCA(bridgeID string) ClientOption {
+	return func(c *Client) {
+		c.certVerifier().BridgeID = bridgeID
+	}
+}
+
+// WithFingerprintUpgrade registers a function called with the SHA-256
+// fingerprint of the certificate of the bridge when it matched the legacy
+// SHA-1 fingerprint given to WithCertFingerprint, so it can be pinned instead.
+func WithFingerprintUpgrade(fn func(fingerprint string)) ClientOption {
+	return func(c *Client) {
+		c.certVerifier().OnUpgrade = fn
+	}
+}
+
+func (c *Client) certVerifier() *CertVerifier {
+	if c.verifier == nil {
+		c.verifier = &CertVerifier{}
+	}
+
+	return c.verifier
+}
+
+// RequestObserver is called after each request sent to the bridge with the
+// HTTP method and the endpoint of the request (e.g. /lights/1/state), how long
+// it took and the error it returned, if any. Requests rejected by the API
+// itself are reported with an ErrorSet, updates only partially applied are not
+// reported as errors.
+type RequestObserver func(method, endpoint string, d time.Duration, err error)
+
+// WithRequestObserver registers a function called after each request sent to
+// the bridge, e.g. to collect metrics.
+func WithRequestObserver(o RequestObserver) ClientOption {
+	return func(c *Client) {
+		c.observer = o
 	}
 }
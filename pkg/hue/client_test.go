@@ -0,0 +1,380 @@
+package hue_test
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/skwair/harmony/optional"
+	"github.com/skwair/huectl/pkg/hue"
+	"github.com/skwair/huectl/pkg/hue/huetest"
+)
+
+func newTestBridge() *huetest.Bridge {
+	b := huetest.NewBridge()
+	b.AddLight(hue.Light{
+		ID:    "1",
+		Name:  "Desk",
+		Type:  hue.LightTypeExtendedColor,
+		State: hue.LightState{On: true, Bri: 100, Reachable: true},
+		Capabilities: hue.LightCapabilities{
+			Streaming: hue.LightCapabilitiesStreaming{Renderer: true},
+		},
+	})
+	b.AddLight(hue.Light{
+		ID:    "2",
+		Name:  "Lamp",
+		Type:  hue.LightTypeDimmable,
+		State: hue.LightState{Bri: 200, Reachable: true},
+	})
+	b.AddGroup(hue.Group{ID: "1", Name: "Office", Type: hue.GroupTypeRoom, Lights: []string{"1", "2"}})
+
+	return b
+}
+
+func TestClientSetLightState(t *testing.T) {
+	tests := []struct {
+		name      string
+		id        string
+		req       *hue.SetLightStateRequest
+		applied   []string
+		rejected  []string
+		errType   int
+		wantState hue.LightState
+	}{
+		{
+			name:      "light on",
+			id:        "1",
+			req:       &hue.SetLightStateRequest{Bri: optional.NewInt(50), CT: optional.NewInt(300)},
+			applied:   []string{"bri", "ct"},
+			wantState: hue.LightState{On: true, Bri: 50, CT: 300, ColorMode: "ct", Reachable: true},
+		},
+		{
+			name:      "increment",
+			id:        "1",
+			req:       &hue.SetLightStateRequest{BriInc: optional.NewInt(254)},
+			applied:   []string{"bri"},
+			wantState: hue.LightState{On: true, Bri: 254, Reachable: true},
+		},
+		{
+			name:      "light off",
+			id:        "2",
+			req:       &hue.SetLightStateRequest{Bri: optional.NewInt(50)},
+			errType:   201,
+			wantState: hue.LightState{Bri: 200, Reachable: true},
+		},
+		{
+			name:      "partial",
+			id:        "2",
+			req:       &hue.SetLightStateRequest{On: optional.NewBool(false), Bri: optional.NewInt(50)},
+			applied:   []string{"on"},
+			rejected:  []string{"bri"},
+			wantState: hue.LightState{Bri: 200, Reachable: true},
+		},
+		{
+			name:    "unknown light",
+			id:      "3",
+			req:     &hue.SetLightStateRequest{On: optional.NewBool(true)},
+			errType: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestBridge()
+			defer b.Close()
+
+			res, err := b.Client().SetLightState(tt.id, tt.req)
+			if tt.errType != 0 {
+				if !hue.HasErrorType(err, tt.errType) {
+					t.Fatalf("expected an error of type %d, got %v", tt.errType, err)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				var applied, rejected []string
+				for _, a := range res.Applied {
+					applied = append(applied, a.Name())
+				}
+				for _, e := range res.Rejected {
+					rejected = append(rejected, e.Attribute())
+				}
+				if !reflect.DeepEqual(applied, tt.applied) {
+					t.Errorf("expected %v to be applied, got %v", tt.applied, applied)
+				}
+				if !reflect.DeepEqual(rejected, tt.rejected) {
+					t.Errorf("expected %v to be rejected, got %v", tt.rejected, rejected)
+				}
+			}
+
+			if l := b.Light(tt.id); l != nil && l.State != tt.wantState {
+				t.Errorf("expected state %+v, got %+v", tt.wantState, l.State)
+			}
+		})
+	}
+}
+
+func TestClientInventory(t *testing.T) {
+	b := newTestBridge()
+	defer b.Close()
+
+	client := b.Client()
+
+	lights, err := client.Lights()
+	if err != nil {
+		t.Fatalf("unable to list lights: %v", err)
+	}
+	var names []string
+	for _, l := range lights {
+		names = append(names, l.ID+":"+l.Name)
+	}
+	sort.Strings(names)
+	if want := []string{"1:Desk", "2:Lamp"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("expected lights %v, got %v", want, names)
+	}
+
+	group, err := client.Group("1")
+	if err != nil {
+		t.Fatalf("unable to get group: %v", err)
+	}
+	if group.Name != "Office" || !reflect.DeepEqual(group.Lights, []string{"1", "2"}) {
+		t.Errorf("unexpected group %+v", group)
+	}
+
+	if _, err = hue.NewClient(b.URL(), "unknown").Lights(); !hue.HasErrorType(err, hue.ErrorTypeUnauthorizedUser) {
+		t.Errorf("expected an unauthorized user error, got %v", err)
+	}
+}
+
+func TestClientScenes(t *testing.T) {
+	b := newTestBridge()
+	defer b.Close()
+
+	b.AddScene(
+		hue.Scene{ID: "abc", Name: "Relax", Group: "1", Lights: []string{"1", "2"}},
+		map[string]hue.LightState{"1": {On: true, Bri: 42}, "2": {On: true, Bri: 24}},
+	)
+
+	client := b.Client()
+
+	scenes, err := client.Scenes()
+	if err != nil {
+		t.Fatalf("unable to list scenes: %v", err)
+	}
+	if len(scenes) != 1 || scenes[0].ID != "abc" || !reflect.DeepEqual(scenes[0].Lights, []string{"1", "2"}) {
+		t.Fatalf("unexpected scenes %+v", scenes)
+	}
+
+	res, err := client.RecallScene("1", "abc")
+	if err != nil {
+		t.Fatalf("unable to recall scene: %v", err)
+	}
+	if err = res.Err(); err != nil {
+		t.Fatalf("scene partially recalled: %v", err)
+	}
+
+	for lid, bri := range map[string]int{"1": 42, "2": 24} {
+		if l := b.Light(lid); !l.State.On || l.State.Bri != bri {
+			t.Errorf("expected light %s to be on at %d, got %+v", lid, bri, l.State)
+		}
+	}
+}
+
+func TestClientCreateScene(t *testing.T) {
+	b := newTestBridge()
+	defer b.Close()
+
+	client := b.Client()
+
+	id, err := client.CreateScene(&hue.CreateSceneRequest{
+		Name:  "Relax",
+		Type:  hue.SceneTypeGroup,
+		Group: "1",
+		LightStates: map[string]*hue.SetLightStateRequest{
+			"1": {On: optional.NewBool(true), Bri: optional.NewInt(42)},
+			"2": {On: optional.NewBool(true), Bri: optional.NewInt(24)},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unable to create scene: %v", err)
+	}
+
+	scenes, err := client.Scenes()
+	if err != nil {
+		t.Fatalf("unable to list scenes: %v", err)
+	}
+	if len(scenes) != 1 || scenes[0].ID != id || scenes[0].Type != hue.SceneTypeGroup || !reflect.DeepEqual(scenes[0].Lights, []string{"1", "2"}) {
+		t.Fatalf("unexpected scenes %+v", scenes)
+	}
+
+	if _, err = client.RecallScene("1", id); err != nil {
+		t.Fatalf("unable to recall scene: %v", err)
+	}
+	for lid, bri := range map[string]int{"1": 42, "2": 24} {
+		if l := b.Light(lid); !l.State.On || l.State.Bri != bri {
+			t.Errorf("expected light %s to be on at %d, got %+v", lid, bri, l.State)
+		}
+	}
+
+	if _, err = client.CreateScene(&hue.CreateSceneRequest{Name: "Nowhere", Type: hue.SceneTypeGroup, Group: "9"}); !hue.HasErrorType(err, 7) {
+		t.Errorf("expected an invalid value error, got %v", err)
+	}
+}
+
+func TestClientToggleLights(t *testing.T) {
+	b := newTestBridge()
+	defer b.Close()
+
+	results := b.Client().ToggleLights([]string{"1", "2", "3"})
+
+	for id, wantOn := range map[string]bool{"1": false, "2": true} {
+		if err := results[id].Err; err != nil {
+			t.Errorf("unable to toggle light %s: %v", id, err)
+		}
+		if on := b.Light(id).State.On; on != wantOn {
+			t.Errorf("expected light %s to be on %t, got %t", id, wantOn, on)
+		}
+	}
+	if !hue.HasErrorType(results["3"].Err, 3) {
+		t.Errorf("expected an error of type 3 for an unknown light, got %v", results["3"].Err)
+	}
+}
+
+func TestClientEntertainmentGroups(t *testing.T) {
+	tests := []struct {
+		name    string
+		lights  []string
+		wantErr bool
+	}{
+		{name: "streaming light", lights: []string{"1"}},
+		{name: "non-streaming light", lights: []string{"1", "2"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestBridge()
+			defer b.Close()
+
+			client := b.Client()
+
+			id, err := client.CreateEntertainmentGroup("TV", hue.EntertainmentClassTV, tt.lights)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unable to create group: %v", err)
+			}
+
+			res, err := client.SetStreamActive(id, true)
+			if err != nil {
+				t.Fatalf("unable to start streaming: %v", err)
+			}
+			if err = res.Err(); err != nil {
+				t.Fatalf("streaming partially started: %v", err)
+			}
+
+			groups, err := client.EntertainmentGroups()
+			if err != nil {
+				t.Fatalf("unable to list entertainment groups: %v", err)
+			}
+			if len(groups) != 1 || groups[0].ID != id || !groups[0].Stream.Active || groups[0].Stream.Owner != huetest.Username {
+				t.Fatalf("unexpected entertainment groups %+v", groups)
+			}
+
+			if err = client.DeleteGroup(id); err != nil {
+				t.Fatalf("unable to delete group: %v", err)
+			}
+		})
+	}
+}
+
+func TestClientSoftwareUpdate(t *testing.T) {
+	tests := []struct {
+		name          string
+		state         string
+		lightState    string
+		wantState     string
+		wantLightDone bool
+	}{
+		{
+			name:          "ready to install",
+			state:         hue.SoftwareUpdateStateAllReadyToInstall,
+			lightState:    hue.DeviceUpdateStateReadyToInstall,
+			wantState:     hue.SoftwareUpdateStateNoUpdates,
+			wantLightDone: true,
+		},
+		{
+			name:       "transferring",
+			state:      hue.SoftwareUpdateStateTransferring,
+			lightState: hue.DeviceUpdateStateTransferring,
+			wantState:  hue.SoftwareUpdateStateTransferring,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := huetest.NewBridge()
+			defer b.Close()
+
+			b.AddLight(hue.Light{ID: "1", SoftWareUpdate: hue.LightSoftwareUpdate{State: tt.lightState}})
+			b.SetSoftwareUpdate(hue.SoftwareUpdate{State: tt.state})
+
+			client := b.Client()
+
+			if _, err := client.InstallUpdates(); err != nil {
+				t.Fatalf("unable to install updates: %v", err)
+			}
+
+			su, err := client.SoftwareUpdate()
+			if err != nil {
+				t.Fatalf("unable to get software update: %v", err)
+			}
+			if su.State != tt.wantState {
+				t.Errorf("expected state %q, got %q", tt.wantState, su.State)
+			}
+
+			done := b.Light("1").SoftWareUpdate.State == hue.DeviceUpdateStateNoUpdates
+			if done != tt.wantLightDone {
+				t.Errorf("expected light update done to be %t, got %t", tt.wantLightDone, done)
+			}
+		})
+	}
+}
+
+func TestClientRequestObserver(t *testing.T) {
+	b := newTestBridge()
+	defer b.Close()
+
+	var errs []error
+	client := hue.NewClient(b.URL(), huetest.Username, hue.WithRequestObserver(func(_, _ string, _ time.Duration, err error) {
+		errs = append(errs, err)
+	}))
+
+	if _, err := client.Lights(); err != nil {
+		t.Fatalf("unable to list lights: %v", err)
+	}
+	// Partially applied.
+	if _, err := client.SetLightState("2", &hue.SetLightStateRequest{On: optional.NewBool(false), Bri: optional.NewInt(50)}); err != nil {
+		t.Fatalf("unable to set light state: %v", err)
+	}
+	// Rejected, the error must still reach the caller.
+	if _, err := client.SetLightState("3", &hue.SetLightStateRequest{On: optional.NewBool(true)}); !hue.HasErrorType(err, 3) {
+		t.Fatalf("expected an error of type 3, got %v", err)
+	}
+
+	if len(errs) != 3 {
+		t.Fatalf("expected 3 requests to be observed, got %d", len(errs))
+	}
+	if errs[0] != nil || errs[1] != nil {
+		t.Errorf("expected successful requests to be observed without error, got %v and %v", errs[0], errs[1])
+	}
+	if !hue.HasErrorType(errs[2], 3) {
+		t.Errorf("expected the rejected request to be observed with an error of type 3, got %v", errs[2])
+	}
+}
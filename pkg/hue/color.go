@@ -0,0 +1,182 @@
+package hue
+
+import (
+	"math"
+)
+
+// Gamut is a color gamut: a triangle in the CIE xy color space, given as
+// its red, green and blue corners. Colors outside of it cannot be displayed
+// by a light.
+type Gamut [3][2]float64
+
+// Color gamuts used by Hue lights, see LightCapabilitiesControl.ColorGamutType.
+var (
+	GamutA = Gamut{{0.704, 0.296}, {0.2151, 0.7106}, {0.138, 0.08}}
+	GamutB = Gamut{{0.675, 0.322}, {0.409, 0.518}, {0.167, 0.04}}
+	GamutC = Gamut{{0.6915, 0.3083}, {0.17, 0.7}, {0.1532, 0.0475}}
+)
+
+// Gamut returns the color gamut of the light. Lights reporting no gamut
+// are assumed to support the widest one, gamut C.
+func (l *Light) Gamut() Gamut {
+	ctrl := l.Capabilities.Control
+	if ctrl.ColorGamut != ([3][2]float64{}) {
+		return Gamut(ctrl.ColorGamut)
+	}
+
+	switch ctrl.ColorGamutType {
+	case "A":
+		return GamutA
+	case "B":
+		return GamutB
+	default:
+		return GamutC
+	}
+}
+
+// Contains reports whether the given xy color is inside the gamut.
+func (g Gamut) Contains(xy [2]float64) bool {
+	d1 := cross(g[0], g[1], xy)
+	d2 := cross(g[1], g[2], xy)
+	d3 := cross(g[2], g[0], xy)
+
+	hasNeg := d1 < 0 || d2 < 0 || d3 < 0
+	hasPos := d1 > 0 || d2 > 0 || d3 > 0
+
+	return !(hasNeg && hasPos)
+}
+
+// Clamp returns the given xy color if it is inside the gamut, or the closest
+// color on the edges of the gamut otherwise.
+func (g Gamut) Clamp(xy [2]float64) [2]float64 {
+	if g.Contains(xy) {
+		return xy
+	}
+
+	var (
+		closest [2]float64
+		minDist = math.Inf(1)
+	)
+	for i := range g {
+		p := closestOnSegment(g[i], g[(i+1)%3], xy)
+		if d := math.Hypot(p[0]-xy[0], p[1]-xy[1]); d < minDist {
+			closest, minDist = p, d
+		}
+	}
+
+	return closest
+}
+
+func cross(a, b, p [2]float64) float64 {
+	return (p[0]-b[0])*(a[1]-b[1]) - (a[0]-b[0])*(p[1]-b[1])
+}
+
+func closestOnSegment(a, b, p [2]float64) [2]float64 {
+	ab := [2]float64{b[0] - a[0], b[1] - a[1]}
+	t := ((p[0]-a[0])*ab[0] + (p[1]-a[1])*ab[1]) / (ab[0]*ab[0] + ab[1]*ab[1])
+	t = math.Max(0, math.Min(1, t))
+
+	return [2]float64{a[0] + t*ab[0], a[1] + t*ab[1]}
+}
+
+// RGBToXY converts a sRGB color to CIE xy coordinates, using the wide gamut
+// conversion recommended by Philips.
+func RGBToXY(r, g, b uint8) [2]float64 {
+	rl, gl, bl := linearize(r), linearize(g), linearize(b)
+
+	x := rl*0.664511 + gl*0.154324 + bl*0.162028
+	y := rl*0.283881 + gl*0.668433 + bl*0.047685
+	z := rl*0.000088 + gl*0.072310 + bl*0.986039
+
+	sum := x + y + z
+	if sum == 0 {
+		// Black has no chromaticity, use the white point instead.
+		return [2]float64{0.3127, 0.3290}
+	}
+
+	return [2]float64{x / sum, y / sum}
+}
+
+// linearize applies the inverse sRGB gamma correction to a color channel.
+func linearize(c uint8) float64 {
+	v := float64(c) / 255
+	if v > 0.04045 {
+		return math.Pow((v+0.055)/1.055, 2.4)
+	}
+
+	return v / 12.92
+}
+
+// HueSatToXY converts a hue (0 to 65535) and saturation (0 to 254), as
+// used by the bridge, to CIE xy coordinates.
+func HueSatToXY(hue, sat int) [2]float64 {
+	h := float64(hue) / 65535 * 6
+	s := math.Max(0, math.Min(1, float64(sat)/254))
+
+	// HSV to RGB with a full value.
+	f := h - math.Floor(h)
+	p, q, t := 1-s, 1-s*f, 1-s*(1-f)
+
+	var r, g, b float64
+	switch int(h) % 6 {
+	case 0:
+		r, g, b = 1, t, p
+	case 1:
+		r, g, b = q, 1, p
+	case 2:
+		r, g, b = p, 1, t
+	case 3:
+		r, g, b = p, q, 1
+	case 4:
+		r, g, b = t, p, 1
+	default:
+		r, g, b = 1, p, q
+	}
+
+	return RGBToXY(uint8(math.Round(r*255)), uint8(math.Round(g*255)), uint8(math.Round(b*255)))
+}
+
+// XYToMired approximates the color temperature of a CIE xy color, in mireds,
+// as the closest point of the Planckian locus within the 153 to 500 mireds
+// range supported by Hue lights. Saturated colors are mapped to the nearest
+// end of the range, e.g. red to the warmest white.
+func XYToMired(xy [2]float64) int {
+	var (
+		closest = defaultMinCT
+		minDist = math.Inf(1)
+	)
+	for mired := defaultMinCT; mired <= defaultMaxCT; mired++ {
+		p := MiredToXY(mired)
+		if d := math.Hypot(p[0]-xy[0], p[1]-xy[1]); d < minDist {
+			closest, minDist = mired, d
+		}
+	}
+
+	return closest
+}
+
+// MiredToXY returns the CIE xy coordinates of the given color temperature,
+// in mireds, using an approximation of the Planckian locus.
+func MiredToXY(mired int) [2]float64 {
+	t := 1e6 / math.Max(1, float64(mired))
+	t = math.Max(1667, math.Min(25000, t))
+
+	var x float64
+	if t <= 4000 {
+		x = -0.2661239e9/(t*t*t) - 0.2343589e6/(t*t) + 0.8776956e3/t + 0.179910
+	} else {
+		x = -3.0258469e9/(t*t*t) + 2.1070379e6/(t*t) + 0.2226347e3/t + 0.240390
+	}
+
+	var y float64
+	switch {
+	case t <= 2222:
+		y = -1.1063814*x*x*x - 1.34811020*x*x + 2.18555832*x - 0.20219683
+	case t <= 4000:
+		y = -0.9549476*x*x*x - 1.37418593*x*x + 2.09137015*x - 0.16748867
+	default:
+		y = 3.0817580*x*x*x - 5.87338670*x*x + 3.75112997*x - 0.37001483
+	}
+
+	return [2]float64{x, y}
+}
@@ -0,0 +1,104 @@
+package hue
+
+import (
+	"math"
+	"testing"
+)
+
+func closeTo(a, b [2]float64, tolerance float64) bool {
+	return math.Abs(a[0]-b[0]) <= tolerance && math.Abs(a[1]-b[1]) <= tolerance
+}
+
+func TestGamutClamp(t *testing.T) {
+	tests := []struct {
+		name  string
+		gamut Gamut
+		xy    [2]float64
+		want  [2]float64
+	}{
+		{name: "inside", gamut: GamutC, xy: [2]float64{0.3, 0.3}, want: [2]float64{0.3, 0.3}},
+		{name: "corner", gamut: GamutC, xy: [2]float64{0, 0}, want: [2]float64{0.1532, 0.0475}},
+		{name: "beyond red", gamut: GamutA, xy: [2]float64{0.8, 0.3}, want: [2]float64{0.704, 0.296}},
+		{name: "edge", gamut: GamutB, xy: [2]float64{0.1, 0.4}, want: [2]float64{0.2984, 0.2996}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.gamut.Clamp(tt.xy)
+			if !closeTo(got, tt.want, 1e-4) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestLightGamut(t *testing.T) {
+	custom := [3][2]float64{{0.6, 0.3}, {0.2, 0.6}, {0.15, 0.05}}
+
+	tests := []struct {
+		name string
+		ctrl LightCapabilitiesControl
+		want Gamut
+	}{
+		{name: "type A", ctrl: LightCapabilitiesControl{ColorGamutType: "A"}, want: GamutA},
+		{name: "type B", ctrl: LightCapabilitiesControl{ColorGamutType: "B"}, want: GamutB},
+		{name: "unknown", want: GamutC},
+		{name: "reported", ctrl: LightCapabilitiesControl{ColorGamutType: "A", ColorGamut: custom}, want: Gamut(custom)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &Light{Capabilities: LightCapabilities{Control: tt.ctrl}}
+			if got := l.Gamut(); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRGBToXY(t *testing.T) {
+	tests := []struct {
+		name    string
+		r, g, b uint8
+		want    [2]float64
+	}{
+		{name: "white", r: 255, g: 255, b: 255, want: [2]float64{0.3227, 0.329}},
+		{name: "black", want: [2]float64{0.3127, 0.329}},
+		{name: "red", r: 255, want: [2]float64{0.7006, 0.2993}},
+		{name: "green", g: 255, want: [2]float64{0.1724, 0.7468}},
+		{name: "blue", b: 255, want: [2]float64{0.1355, 0.0399}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RGBToXY(tt.r, tt.g, tt.b); !closeTo(got, tt.want, 1e-4) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestHueSatToXY(t *testing.T) {
+	if got, want := HueSatToXY(0, 254), RGBToXY(255, 0, 0); got != want {
+		t.Errorf("expected red at %v, got %v", want, got)
+	}
+	if got, want := HueSatToXY(46920, 0), RGBToXY(255, 255, 255); got != want {
+		t.Errorf("expected white without saturation at %v, got %v", want, got)
+	}
+}
+
+func TestMiredConversions(t *testing.T) {
+	for _, mired := range []int{153, 250, 366, 454, 500} {
+		if got := XYToMired(MiredToXY(mired)); got != mired {
+			t.Errorf("expected %d mireds, got %d", mired, got)
+		}
+	}
+
+	// Saturated colors map to the nearest end of the range.
+	if got := XYToMired(RGBToXY(255, 0, 0)); got != defaultMaxCT {
+		t.Errorf("expected red to map to %d mireds, got %d", defaultMaxCT, got)
+	}
+	if got := XYToMired(RGBToXY(0, 0, 255)); got != defaultMinCT {
+		t.Errorf("expected blue to map to %d mireds, got %d", defaultMinCT, got)
+	}
+}
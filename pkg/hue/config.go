@@ -0,0 +1,140 @@
+package hue
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// BridgeConfig is the configuration of a Hue bridge.
+type BridgeConfig struct {
+	Name          string `json:"name"`
+	BridgeID      string `json:"bridgeid"`
+	ModelID       string `json:"modelid"`
+	SWVersion     string `json:"swversion"`
+	APIVersion    string `json:"apiversion"`
+	IPAddress     string `json:"ipaddress"`
+	ZigbeeChannel int    `json:"zigbeechannel"`
+	// SoftwareUpdate is only returned to registered users.
+	SoftwareUpdate SoftwareUpdate `json:"swupdate2"`
+	// Whitelist holds the users registered on the bridge, indexed by user
+	// name. It is only returned to registered users.
+	Whitelist map[string]WhitelistEntry `json:"whitelist"`
+}
+
+// WhitelistEntry is a user registered on a Hue bridge.
+type WhitelistEntry struct {
+	Name        string `json:"name"`
+	CreateDate  string `json:"create date"`
+	LastUseDate string `json:"last use date"`
+}
+
+// SoftwareUpdate is the state of the software updates of a bridge and of the
+// devices connected to it.
+type SoftwareUpdate struct {
+	// State is the state of updates of all devices, one of the
+	// SoftwareUpdateState constants.
+	State string `json:"state"`
+	// CheckForUpdate is set while the bridge checks for updates.
+	CheckForUpdate bool                      `json:"checkforupdate"`
+	LastChange     string                    `json:"lastchange"`
+	Bridge         SoftwareUpdateBridge      `json:"bridge"`
+	AutoInstall    SoftwareUpdateAutoInstall `json:"autoinstall"`
+}
+
+// SoftwareUpdateBridge is the state of the software update of the bridge
+// itself.
+type SoftwareUpdateBridge struct {
+	// State is one of the DeviceUpdateState constants.
+	State       string `json:"state"`
+	LastInstall string `json:"lastinstall"`
+}
+
+// SoftwareUpdateAutoInstall configures the automatic installation of updates.
+type SoftwareUpdateAutoInstall struct {
+	On         bool   `json:"on"`
+	UpdateTime string `json:"updatetime"`
+}
+
+// States of software updates, as reported in SoftwareUpdate.State.
+const (
+	SoftwareUpdateStateNoUpdates         = "noupdates"
+	SoftwareUpdateStateTransferring      = "transferring"
+	SoftwareUpdateStateAnyReadyToInstall = "anyreadytoinstall"
+	SoftwareUpdateStateAllReadyToInstall = "allreadytoinstall"
+	SoftwareUpdateStateInstalling        = "installing"
+)
+
+// States of the software update of a single device, as reported in
+// SoftwareUpdateBridge.State for the bridge and LightSoftwareUpdate.State for
+// lights.
+const (
+	DeviceUpdateStateNoUpdates      = "noupdates"
+	DeviceUpdateStateTransferring   = "transferring"
+	DeviceUpdateStateReadyToInstall = "readytoinstall"
+	DeviceUpdateStateInstalling     = "installing"
+)
+
+// Config returns the configuration of the bridge. Unlike other requests, it
+// does not fail when the user is not registered, but only a few attributes
+// are returned then: check whether the user is in the whitelist to know.
+func (c *Client) Config() (*BridgeConfig, error) {
+	resp, err := c.doReq(http.MethodGet, "/config", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var cfg BridgeConfig
+	if err = decode(resp.Body, &cfg); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+// Registered reports whether the given user is registered on the bridge.
+func (c *BridgeConfig) Registered(username string) bool {
+	_, ok := c.Whitelist[username]
+	return ok
+}
+
+// SoftwareUpdate returns the state of the software updates of the bridge and
+// of the devices connected to it, see /config/swupdate2. The state of each
+// light is reported in Light.SoftWareUpdate.
+func (c *Client) SoftwareUpdate() (*SoftwareUpdate, error) {
+	cfg, err := c.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	return &cfg.SoftwareUpdate, nil
+}
+
+// CheckForUpdates makes the bridge check for software updates of itself and
+// of the devices connected to it. SoftwareUpdate.CheckForUpdate is set until
+// the check is over, which may take a few minutes.
+func (c *Client) CheckForUpdates() (*UpdateResult, error) {
+	return c.setSoftwareUpdate(map[string]bool{"checkforupdate": true})
+}
+
+// InstallUpdates makes the bridge install the software updates ready to be
+// installed, as reported by SoftwareUpdate.State. The bridge may restart
+// while installing its own update, failing requests for a while.
+func (c *Client) InstallUpdates() (*UpdateResult, error) {
+	return c.setSoftwareUpdate(map[string]bool{"install": true})
+}
+
+func (c *Client) setSoftwareUpdate(attrs map[string]bool) (*UpdateResult, error) {
+	b, err := json.Marshal(map[string]interface{}{"swupdate2": attrs})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.doReq(http.MethodPut, "/config", b)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return decodeUpdate(resp.Body)
+}
@@ -0,0 +1,161 @@
+package hue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+)
+
+// GroupStream is the streaming state of an entertainment group.
+type GroupStream struct {
+	ProxyMode string `json:"proxymode"`
+	ProxyNode string `json:"proxynode"`
+	Active    bool   `json:"active"`
+	// Owner is the username of the application streaming to the group, if
+	// any.
+	Owner string `json:"owner"`
+}
+
+// Location is the position of a light in an entertainment area, each
+// coordinate going from -1 to 1: x from left to right, y from back (the
+// wall of the screen) to front and z from bottom to top.
+type Location [3]float64
+
+// Entertainment group classes, as set in Group.Class.
+const (
+	EntertainmentClassTV    = "TV"
+	EntertainmentClassOther = "Other"
+)
+
+// EntertainmentGroups returns the entertainment groups of the bridge, sorted
+// by ID.
+func (c *Client) EntertainmentGroups() ([]Group, error) {
+	groups, err := c.Groups()
+	if err != nil {
+		return nil, err
+	}
+
+	var res []Group
+	for _, g := range groups {
+		if g.Type == GroupTypeEntertainment {
+			res = append(res, g)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return LessID(res[i].ID, res[j].ID) })
+
+	return res, nil
+}
+
+// CreateEntertainmentGroup creates an entertainment group with the given name,
+// class (EntertainmentClassTV or EntertainmentClassOther) and lights, and
+// returns its ID. Only lights supporting streaming (see
+// LightCapabilitiesStreaming.Renderer) can be part of it. The bridge places
+// lights at default locations, change them with SetGroupLocations.
+func (c *Client) CreateEntertainmentGroup(name, class string, lights []string) (string, error) {
+	req := struct {
+		Name   string   `json:"name"`
+		Type   string   `json:"type"`
+		Class  string   `json:"class"`
+		Lights []string `json:"lights"`
+	}{
+		Name:   name,
+		Type:   GroupTypeEntertainment,
+		Class:  class,
+		Lights: lights,
+	}
+	b, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := c.doReq(http.MethodPost, "/groups", b)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var res []struct {
+		Success struct {
+			ID string `json:"id"`
+		} `json:"success"`
+	}
+	if err = decode(resp.Body, &res); err != nil {
+		return "", err
+	}
+
+	if len(res) == 0 || res[0].Success.ID == "" {
+		return "", errors.New("bridge did not return the ID of the new group")
+	}
+
+	return res[0].Success.ID, nil
+}
+
+// SetGroupLocations sets the location of the lights of an entertainment
+// group, indexed by light ID.
+func (c *Client) SetGroupLocations(id string, locations map[string]Location) (*UpdateResult, error) {
+	b, err := json.Marshal(map[string]interface{}{"locations": locations})
+	if err != nil {
+		return nil, err
+	}
+
+	return c.setGroupAttributes(id, b)
+}
+
+// SetStreamActive starts or stops streaming to the given entertainment group.
+// Streaming must be started before connecting to the bridge with DTLS, and
+// the bridge stops it by itself after 10 seconds without receiving anything.
+func (c *Client) SetStreamActive(id string, active bool) (*UpdateResult, error) {
+	b, err := json.Marshal(map[string]interface{}{"stream": map[string]bool{"active": active}})
+	if err != nil {
+		return nil, err
+	}
+
+	return c.setGroupAttributes(id, b)
+}
+
+func (c *Client) setGroupAttributes(id string, body []byte) (*UpdateResult, error) {
+	endpoint := fmt.Sprintf("/groups/%s", id)
+	resp, err := c.doReq(http.MethodPut, endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return decodeUpdate(resp.Body)
+}
+
+// DeleteGroup deletes the given group. Lights are left untouched.
+func (c *Client) DeleteGroup(id string) error {
+	endpoint := fmt.Sprintf("/groups/%s", id)
+	resp, err := c.doReq(http.MethodDelete, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// The bridge answers with a success message rather than an attribute.
+	var res []struct {
+		Success string `json:"success"`
+	}
+
+	return decode(resp.Body, &res)
+}
+
+// Host returns the host name or IP address of the bridge, e.g. to connect to
+// its entertainment streaming port.
+func (c *Client) Host() string {
+	u, err := url.Parse(c.url)
+	if err != nil {
+		return ""
+	}
+
+	return u.Hostname()
+}
+
+// Username returns the username the client is authenticated with.
+func (c *Client) Username() string {
+	return c.id
+}
@@ -3,8 +3,10 @@ package hue
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"io"
 	"io/ioutil"
+	"path"
 	"strings"
 )
 
@@ -15,7 +17,10 @@ type ErrorSet []Error
 func (s ErrorSet) Error() string {
 	var sb strings.Builder
 
-	for _, err := range s {
+	for i, err := range s {
+		if i > 0 {
+			sb.WriteString("; ")
+		}
 		sb.WriteString(err.Error())
 	}
 
@@ -36,30 +41,34 @@ type Error struct {
 // Error implements the `error` interface.
 func (e Error) Error() string { return e.Description }
 
-func decode(r io.Reader, v interface{}) error {
-	data, err := ioutil.ReadAll(r)
-	if err != nil {
-		return err
-	}
+// Types of API errors, see https://developers.meethue.com/develop/hue-api/error-messages/.
+const (
+	ErrorTypeUnauthorizedUser     = 1
+	ErrorTypeLinkButtonNotPressed = 101
+)
 
-	if bytes.HasPrefix(data, []byte(`[{"error":{`)) {
-		var errs []errResp
-		if err = json.Unmarshal(data, &errs); err != nil {
-			return err
-		}
+// HasErrorType reports whether err is an ErrorSet holding an error of the
+// given type.
+func HasErrorType(err error, typ int) bool {
+	var es ErrorSet
+	if !errors.As(err, &es) {
+		return false
+	}
 
-		var es ErrorSet
-		for _, e := range errs {
-			es = append(es, e.Error)
+	for _, e := range es {
+		if e.Type == typ {
+			return true
 		}
-
-		return es
 	}
 
-	return json.Unmarshal(data, v)
+	return false
 }
 
-func decodeErr(r io.Reader) error {
+// Attribute returns the name of the attribute this error relates to,
+// which is the last element of its address, e.g. "bri".
+func (e Error) Attribute() string { return path.Base(e.Address) }
+
+func decode(r io.Reader, v interface{}) error {
 	data, err := ioutil.ReadAll(r)
 	if err != nil {
 		return err
@@ -79,5 +88,5 @@ func decodeErr(r io.Reader) error {
 		return es
 	}
 
-	return nil
+	return json.Unmarshal(data, v)
 }
@@ -0,0 +1,125 @@
+package hue
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/skwair/harmony/optional"
+)
+
+// Group is a group of lights, such as a room or a zone.
+type Group struct {
+	ID      string     `json:"id"`
+	Name    string     `json:"name"`
+	Lights  []string   `json:"lights"`
+	Sensors []string   `json:"sensors"`
+	Type    string     `json:"type"`
+	Class   string     `json:"class"`
+	State   GroupState `json:"state"`
+	Action  LightState `json:"action"`
+	Recycle bool       `json:"recycle"`
+
+	// Locations and Stream are only set on entertainment groups.
+	Locations map[string]Location `json:"locations,omitempty"`
+	Stream    *GroupStream        `json:"stream,omitempty"`
+}
+
+// GroupState summarizes the on/off state of the lights of a group.
+type GroupState struct {
+	AllOn bool `json:"all_on"`
+	AnyOn bool `json:"any_on"`
+}
+
+// Group types, as reported by the bridge in Group.Type.
+const (
+	GroupTypeRoom          = "Room"
+	GroupTypeZone          = "Zone"
+	GroupTypeLightGroup    = "LightGroup"
+	GroupTypeEntertainment = "Entertainment"
+)
+
+// Groups returns the list of all groups managed by this bridge.
+func (c *Client) Groups() ([]Group, error) {
+	resp, err := c.doReq(http.MethodGet, "/groups", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var res map[string]Group
+	if err = decode(resp.Body, &res); err != nil {
+		return nil, err
+	}
+
+	var groups []Group
+	for id, g := range res {
+		g.ID = id
+		groups = append(groups, g)
+	}
+
+	return groups, nil
+}
+
+// Group returns information about the specified group.
+func (c *Client) Group(id string) (*Group, error) {
+	endpoint := fmt.Sprintf("/groups/%s", id)
+	resp, err := c.doReq(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var group Group
+	if err = decode(resp.Body, &group); err != nil {
+		return nil, err
+	}
+	group.ID = id
+
+	return &group, nil
+}
+
+// SetGroupStateRequest describes a state update applied to all the lights of a
+// group at once. Only explicitly set fields with be updated.
+type SetGroupStateRequest struct {
+	SetLightStateRequest
+	// Scene recalls the given scene instead of setting the light attributes.
+	Scene *optional.String `json:"scene,omitempty"`
+}
+
+// SetGroupState sets the state of all the lights of the specified group.
+// Group "0" is a special group containing all the lights of the bridge.
+func (c *Client) SetGroupState(id string, req *SetGroupStateRequest) (*UpdateResult, error) {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := fmt.Sprintf("/groups/%s/action", id)
+	resp, err := c.doReq(http.MethodPut, endpoint, b)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return decodeUpdate(resp.Body)
+}
+
+// FindGroup returns the group with the given ID or, failing that, the group
+// with the given name, ignoring case. It returns nil if there is none.
+func FindGroup(groups []Group, ref string) *Group {
+	for i := range groups {
+		if groups[i].ID == ref {
+			return &groups[i]
+		}
+	}
+
+	for i := range groups {
+		if strings.EqualFold(groups[i].Name, ref) {
+			return &groups[i]
+		}
+	}
+
+	return nil
+}
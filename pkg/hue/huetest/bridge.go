@@ -0,0 +1,589 @@
+// Package huetest provides a fake Hue bridge, serving the parts of the v1 API
+// used by huectl from memory, to exercise code built on hue.Client without
+// real hardware.
+package huetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/skwair/huectl/pkg/hue"
+)
+
+// Username is the only user accepted by the fake bridge.
+const Username = "huetest"
+
+// Bridge is a fake Hue bridge listening on a local HTTP server.
+// Create one with NewBridge and stop it with Close.
+type Bridge struct {
+	srv *httptest.Server
+
+	mu          sync.Mutex
+	lights      map[string]*hue.Light
+	groups      map[string]*hue.Group
+	scenes      map[string]*hue.Scene
+	sensors     map[string]*hue.Sensor
+	sceneStates map[string]map[string]hue.LightState
+	config      hue.BridgeConfig
+	requests    int
+}
+
+// NewBridge starts a new fake bridge with no resources.
+func NewBridge() *Bridge {
+	b := &Bridge{
+		lights:      make(map[string]*hue.Light),
+		groups:      make(map[string]*hue.Group),
+		scenes:      make(map[string]*hue.Scene),
+		sensors:     make(map[string]*hue.Sensor),
+		sceneStates: make(map[string]map[string]hue.LightState),
+		config: hue.BridgeConfig{
+			Name:          "huetest",
+			BridgeID:      "001788FFFE000000",
+			ModelID:       "BSB002",
+			SWVersion:     "1953188020",
+			APIVersion:    "1.53.0",
+			ZigbeeChannel: 25,
+			SoftwareUpdate: hue.SoftwareUpdate{
+				State:  hue.SoftwareUpdateStateNoUpdates,
+				Bridge: hue.SoftwareUpdateBridge{State: hue.DeviceUpdateStateNoUpdates},
+			},
+			Whitelist: map[string]hue.WhitelistEntry{Username: {Name: "huetest#test"}},
+		},
+	}
+	b.srv = httptest.NewServer(http.HandlerFunc(b.serveHTTP))
+
+	return b
+}
+
+// URL returns the base URL of the bridge, to use with hue.NewClient.
+func (b *Bridge) URL() string { return b.srv.URL }
+
+// Client returns a client connected to the bridge.
+func (b *Bridge) Client() *hue.Client { return hue.NewClient(b.srv.URL, Username) }
+
+// Close stops the bridge.
+func (b *Bridge) Close() { b.srv.Close() }
+
+// AddLight adds a light to the bridge, using its ID field as ID.
+func (b *Bridge) AddLight(l hue.Light) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lights[l.ID] = &l
+}
+
+// AddGroup adds a group to the bridge, using its ID field as ID.
+func (b *Bridge) AddGroup(g hue.Group) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.groups[g.ID] = &g
+}
+
+// AddScene adds a scene to the bridge, using its ID field as ID. Recalling
+// the scene applies the given states, indexed by light ID.
+func (b *Bridge) AddScene(s hue.Scene, states map[string]hue.LightState) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.scenes[s.ID] = &s
+	b.sceneStates[s.ID] = states
+}
+
+// AddSensor adds a sensor to the bridge, using its ID field as ID.
+func (b *Bridge) AddSensor(s hue.Sensor) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.sensors[s.ID] = &s
+}
+
+// SetSoftwareUpdate sets the state of the software updates of the bridge. The
+// state of lights is set by AddLight. Updates ready to install are installed
+// when asked to, which completes on the next read of the state.
+func (b *Bridge) SetSoftwareUpdate(su hue.SoftwareUpdate) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.config.SoftwareUpdate = su
+}
+
+// Light returns the current state of the given light, or nil if there is none.
+func (b *Bridge) Light(id string) *hue.Light {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	l, ok := b.lights[id]
+	if !ok {
+		return nil
+	}
+	cpy := *l
+
+	return &cpy
+}
+
+// Requests returns the number of API requests served so far.
+func (b *Bridge) Requests() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.requests
+}
+
+func (b *Bridge) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.requests++
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 2 || parts[0] != "api" || parts[1] != Username {
+		writeError(w, 1, r.URL.Path, "unauthorized user")
+		return
+	}
+	parts = parts[2:]
+
+	var body map[string]json.RawMessage
+	if r.Method == http.MethodPut || r.Method == http.MethodPost {
+		data, err := ioutil.ReadAll(r.Body)
+		if err == nil {
+			err = json.Unmarshal(data, &body)
+		}
+		if err != nil {
+			writeError(w, 2, r.URL.Path, "body contains invalid json")
+			return
+		}
+	}
+
+	switch {
+	case r.Method == http.MethodGet && match(parts, "lights"):
+		writeJSON(w, b.lights)
+	case r.Method == http.MethodGet && match(parts, "lights", "*"):
+		if l, ok := b.lights[parts[1]]; ok {
+			writeJSON(w, l)
+			return
+		}
+		writeNotAvailable(w, "/lights/"+parts[1])
+	case r.Method == http.MethodPut && match(parts, "lights", "*", "state"):
+		l, ok := b.lights[parts[1]]
+		if !ok {
+			writeNotAvailable(w, "/lights/"+parts[1]+"/state")
+			return
+		}
+		writeJSON(w, applyState(l, "/lights/"+l.ID+"/state", body))
+	case r.Method == http.MethodGet && match(parts, "groups"):
+		writeJSON(w, b.groups)
+	case r.Method == http.MethodGet && match(parts, "groups", "*"):
+		if g, ok := b.groups[parts[1]]; ok {
+			writeJSON(w, g)
+			return
+		}
+		writeNotAvailable(w, "/groups/"+parts[1])
+	case r.Method == http.MethodPost && match(parts, "groups"):
+		b.createGroup(w, body)
+	case r.Method == http.MethodPut && match(parts, "groups", "*"):
+		b.setGroupAttributes(w, parts[1], body)
+	case r.Method == http.MethodDelete && match(parts, "groups", "*"):
+		if _, ok := b.groups[parts[1]]; !ok {
+			writeNotAvailable(w, "/groups/"+parts[1])
+			return
+		}
+		delete(b.groups, parts[1])
+		writeJSON(w, []interface{}{map[string]string{"success": "/groups/" + parts[1] + " deleted"}})
+	case r.Method == http.MethodPut && match(parts, "groups", "*", "action"):
+		b.groupAction(w, parts[1], body)
+	case r.Method == http.MethodGet && match(parts, "scenes"):
+		writeJSON(w, b.scenes)
+	case r.Method == http.MethodPost && match(parts, "scenes"):
+		b.createScene(w, body)
+	case r.Method == http.MethodGet && match(parts, "sensors"):
+		writeJSON(w, b.sensors)
+	case r.Method == http.MethodGet && match(parts, "config"):
+		b.advanceUpdates()
+		writeJSON(w, b.config)
+	case r.Method == http.MethodPut && match(parts, "config"):
+		b.setConfig(w, body)
+	default:
+		writeError(w, 4, r.URL.Path, fmt.Sprintf("method, %s, not available for resource, %s", r.Method, r.URL.Path))
+	}
+}
+
+func (b *Bridge) setConfig(w http.ResponseWriter, body map[string]json.RawMessage) {
+	var su map[string]bool
+	if raw, ok := body["swupdate2"]; !ok || json.Unmarshal(raw, &su) != nil {
+		writeError(w, 7, "/config", "invalid value for parameter, only swupdate2 is supported")
+		return
+	}
+
+	var resps []interface{}
+	for _, attr := range []string{"checkforupdate", "install"} {
+		v, ok := su[attr]
+		if !ok {
+			continue
+		}
+		if v {
+			b.startUpdate(attr)
+		}
+		resps = append(resps, successResp("/config/swupdate2/"+attr, v))
+	}
+
+	writeJSON(w, resps)
+}
+
+// startUpdate starts checking for updates or installing them.
+func (b *Bridge) startUpdate(action string) {
+	su := &b.config.SoftwareUpdate
+	if action == "checkforupdate" {
+		su.CheckForUpdate = true
+		return
+	}
+
+	if su.State != hue.SoftwareUpdateStateAnyReadyToInstall && su.State != hue.SoftwareUpdateStateAllReadyToInstall {
+		return
+	}
+
+	su.State = hue.SoftwareUpdateStateInstalling
+	if su.Bridge.State == hue.DeviceUpdateStateReadyToInstall {
+		su.Bridge.State = hue.DeviceUpdateStateInstalling
+	}
+	for _, l := range b.lights {
+		if l.SoftWareUpdate.State == hue.DeviceUpdateStateReadyToInstall {
+			l.SoftWareUpdate.State = hue.DeviceUpdateStateInstalling
+		}
+	}
+}
+
+// advanceUpdates completes the update check and installation in progress.
+func (b *Bridge) advanceUpdates() {
+	su := &b.config.SoftwareUpdate
+	su.CheckForUpdate = false
+
+	if su.State != hue.SoftwareUpdateStateInstalling {
+		return
+	}
+
+	su.State = hue.SoftwareUpdateStateNoUpdates
+	if su.Bridge.State == hue.DeviceUpdateStateInstalling {
+		su.Bridge.State = hue.DeviceUpdateStateNoUpdates
+	}
+	for _, l := range b.lights {
+		if l.SoftWareUpdate.State == hue.DeviceUpdateStateInstalling {
+			l.SoftWareUpdate.State = hue.DeviceUpdateStateNoUpdates
+		}
+	}
+}
+
+func (b *Bridge) createGroup(w http.ResponseWriter, body map[string]json.RawMessage) {
+	var g hue.Group
+	for attr, dst := range map[string]interface{}{"name": &g.Name, "type": &g.Type, "class": &g.Class, "lights": &g.Lights} {
+		if raw, ok := body[attr]; ok {
+			_ = json.Unmarshal(raw, dst)
+		}
+	}
+
+	// Like a real bridge, entertainment groups only accept lights supporting
+	// streaming and place them at default locations.
+	if g.Type == hue.GroupTypeEntertainment {
+		g.Stream = &hue.GroupStream{ProxyMode: "auto"}
+		g.Locations = make(map[string]hue.Location)
+		for _, lid := range g.Lights {
+			l, ok := b.lights[lid]
+			if !ok || !l.Capabilities.Streaming.Renderer {
+				writeError(w, 7, "/groups/lights", fmt.Sprintf("invalid value, %s, for parameter, lights", lid))
+				return
+			}
+			g.Locations[lid] = hue.Location{}
+		}
+	}
+
+	for i := 1; ; i++ {
+		if _, ok := b.groups[strconv.Itoa(i)]; !ok {
+			g.ID = strconv.Itoa(i)
+			break
+		}
+	}
+	b.groups[g.ID] = &g
+
+	writeJSON(w, []interface{}{map[string]interface{}{"success": map[string]string{"id": g.ID}}})
+}
+
+func (b *Bridge) createScene(w http.ResponseWriter, body map[string]json.RawMessage) {
+	var (
+		s      hue.Scene
+		states map[string]hue.LightState
+	)
+	for attr, dst := range map[string]interface{}{"name": &s.Name, "type": &s.Type, "group": &s.Group, "lights": &s.Lights, "recycle": &s.Recycle, "lightstates": &states} {
+		if raw, ok := body[attr]; ok {
+			_ = json.Unmarshal(raw, dst)
+		}
+	}
+
+	if s.Type == hue.SceneTypeGroup {
+		g, ok := b.groups[s.Group]
+		if !ok {
+			writeError(w, 7, "/scenes/group", fmt.Sprintf("invalid value, %s, for parameter, group", s.Group))
+			return
+		}
+		s.Lights = g.Lights
+	}
+
+	for lid := range states {
+		if _, ok := b.lights[lid]; !ok {
+			writeError(w, 7, "/scenes/lightstates", fmt.Sprintf("invalid value, %s, for parameter, lightstates", lid))
+			return
+		}
+	}
+
+	for i := 1; ; i++ {
+		if _, ok := b.scenes[strconv.Itoa(i)]; !ok {
+			s.ID = strconv.Itoa(i)
+			break
+		}
+	}
+	s.Owner = Username
+	b.scenes[s.ID] = &s
+	b.sceneStates[s.ID] = states
+
+	writeJSON(w, []interface{}{map[string]interface{}{"success": map[string]string{"id": s.ID}}})
+}
+
+func (b *Bridge) setGroupAttributes(w http.ResponseWriter, id string, body map[string]json.RawMessage) {
+	addr := "/groups/" + id
+	g, ok := b.groups[id]
+	if !ok {
+		writeNotAvailable(w, addr)
+		return
+	}
+
+	var resps []interface{}
+	for _, attr := range sortedKeys(body) {
+		raw := body[attr]
+		switch attr {
+		case "name":
+			_ = json.Unmarshal(raw, &g.Name)
+			resps = append(resps, successResp(addr+"/name", g.Name))
+		case "lights":
+			_ = json.Unmarshal(raw, &g.Lights)
+			resps = append(resps, successResp(addr+"/lights", g.Lights))
+		case "locations":
+			var locations map[string]hue.Location
+			_ = json.Unmarshal(raw, &locations)
+			for lid, loc := range locations {
+				g.Locations[lid] = loc
+				resps = append(resps, successResp(addr+"/locations/"+lid, loc))
+			}
+		case "stream":
+			var stream struct {
+				Active bool `json:"active"`
+			}
+			_ = json.Unmarshal(raw, &stream)
+			if g.Stream == nil {
+				resps = append(resps, errorResp(6, addr+"/stream", "parameter, stream, not available"))
+				continue
+			}
+			g.Stream.Active = stream.Active
+			g.Stream.Owner = ""
+			if stream.Active {
+				g.Stream.Owner = Username
+			}
+			resps = append(resps, successResp(addr+"/stream/active", stream.Active))
+		default:
+			resps = append(resps, errorResp(6, addr+"/"+attr, fmt.Sprintf("parameter, %s, not available", attr)))
+		}
+	}
+
+	writeJSON(w, resps)
+}
+
+func (b *Bridge) groupAction(w http.ResponseWriter, id string, body map[string]json.RawMessage) {
+	addr := "/groups/" + id + "/action"
+
+	var lightIDs []string
+	if id == "0" {
+		for lid := range b.lights {
+			lightIDs = append(lightIDs, lid)
+		}
+		sort.Slice(lightIDs, func(i, j int) bool { return hue.LessID(lightIDs[i], lightIDs[j]) })
+	} else {
+		g, ok := b.groups[id]
+		if !ok {
+			writeNotAvailable(w, addr)
+			return
+		}
+		lightIDs = g.Lights
+	}
+
+	if raw, ok := body["scene"]; ok {
+		var sceneID string
+		_ = json.Unmarshal(raw, &sceneID)
+
+		states, ok := b.sceneStates[sceneID]
+		if !ok {
+			writeError(w, 7, addr+"/scene", fmt.Sprintf("invalid value, %s, for parameter, scene", sceneID))
+			return
+		}
+
+		for lid, state := range states {
+			if l, ok := b.lights[lid]; ok {
+				reachable := l.State.Reachable
+				l.State = state
+				l.State.Reachable = reachable
+			}
+		}
+
+		writeJSON(w, []interface{}{successResp(addr+"/scene", sceneID)})
+		return
+	}
+
+	// The bridge reports a single result for the whole group.
+	for _, lid := range lightIDs {
+		if l, ok := b.lights[lid]; ok {
+			applyState(l, "", body)
+		}
+	}
+
+	var resps []interface{}
+	for _, attr := range sortedKeys(body) {
+		var v interface{}
+		_ = json.Unmarshal(body[attr], &v)
+		resps = append(resps, successResp(addr+"/"+attr, v))
+	}
+	writeJSON(w, resps)
+}
+
+// applyState updates the state of a light and returns the per-attribute
+// responses, rejecting changes made to a light that is off like a real bridge.
+func applyState(l *hue.Light, addr string, body map[string]json.RawMessage) []interface{} {
+	s := &l.State
+
+	on := s.On
+	if raw, ok := body["on"]; ok {
+		_ = json.Unmarshal(raw, &on)
+	}
+
+	var resps []interface{}
+	for _, attr := range sortedKeys(body) {
+		raw := body[attr]
+		if attr != "on" && !on {
+			resps = append(resps, errorResp(201, addr+"/"+attr, fmt.Sprintf("parameter, %s, is not modifiable. Device is set to off.", attr)))
+			continue
+		}
+
+		var value interface{}
+		switch attr {
+		case "on":
+			s.On = on
+			value = on
+		case "bri":
+			_ = json.Unmarshal(raw, &s.Bri)
+			value = s.Bri
+		case "hue":
+			_ = json.Unmarshal(raw, &s.Hue)
+			s.ColorMode, value = "hs", s.Hue
+		case "sat":
+			_ = json.Unmarshal(raw, &s.Sat)
+			s.ColorMode, value = "hs", s.Sat
+		case "ct":
+			_ = json.Unmarshal(raw, &s.CT)
+			s.ColorMode, value = "ct", s.CT
+		case "xy":
+			_ = json.Unmarshal(raw, &s.XY)
+			s.ColorMode, value = "xy", s.XY
+		case "effect":
+			_ = json.Unmarshal(raw, &s.Effect)
+			value = s.Effect
+		case "alert":
+			_ = json.Unmarshal(raw, &s.Alert)
+			value = s.Alert
+		case "bri_inc":
+			s.Bri = clamp(s.Bri+unmarshalInt(raw), 1, 254)
+			attr, value = "bri", s.Bri
+		case "hue_inc":
+			s.Hue = (s.Hue + unmarshalInt(raw) + 65536) % 65536
+			attr, value = "hue", s.Hue
+		case "sat_inc":
+			s.Sat = clamp(s.Sat+unmarshalInt(raw), 0, 254)
+			attr, value = "sat", s.Sat
+		case "ct_inc":
+			s.CT = clamp(s.CT+unmarshalInt(raw), 153, 500)
+			attr, value = "ct", s.CT
+		case "transitiontime":
+			value = unmarshalInt(raw)
+		default:
+			resps = append(resps, errorResp(6, addr+"/"+attr, fmt.Sprintf("parameter, %s, not available", attr)))
+			continue
+		}
+
+		resps = append(resps, successResp(addr+"/"+attr, value))
+	}
+
+	return resps
+}
+
+func match(parts []string, pattern ...string) bool {
+	if len(parts) != len(pattern) {
+		return false
+	}
+
+	for i := range parts {
+		if pattern[i] != "*" && parts[i] != pattern[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func sortedKeys(m map[string]json.RawMessage) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func unmarshalInt(raw json.RawMessage) int {
+	var i int
+	_ = json.Unmarshal(raw, &i)
+	return i
+}
+
+func clamp(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+func successResp(addr string, value interface{}) interface{} {
+	return map[string]interface{}{"success": map[string]interface{}{addr: value}}
+}
+
+func errorResp(typ int, addr, desc string) interface{} {
+	return map[string]interface{}{"error": hue.Error{Type: typ, Address: addr, Description: desc}}
+}
+
+func writeError(w http.ResponseWriter, typ int, addr, desc string) {
+	writeJSON(w, []interface{}{errorResp(typ, addr, desc)})
+}
+
+func writeNotAvailable(w http.ResponseWriter, addr string) {
+	writeError(w, 3, addr, fmt.Sprintf("resource, %s, not available", addr))
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
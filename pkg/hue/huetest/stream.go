@@ -0,0 +1,143 @@
+package huetest
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pion/dtls/v2"
+	"github.com/pion/transport/v2/udp"
+	"github.com/skwair/huectl/pkg/entertainment"
+)
+
+// ClientKey is the client key of Username, to connect to a StreamServer.
+const ClientKey = "0123456789abcdef0123456789abcdef"
+
+// StreamServer is a stand-in for the entertainment streaming server of a
+// bridge: it accepts DTLS connections authenticated with Username and
+// ClientKey and records the colors it receives. Create one with
+// NewStreamServer and stop it with Close.
+type StreamServer struct {
+	l   net.Listener
+	cfg *dtls.Config
+
+	mu       sync.Mutex
+	messages int
+	colors   map[int]entertainment.Color
+	err      error
+}
+
+// NewStreamServer starts a new streaming server on a random local port.
+func NewStreamServer() (*StreamServer, error) {
+	key, _ := hex.DecodeString(ClientKey)
+
+	cfg := &dtls.Config{
+		PSK: func(identity []byte) ([]byte, error) {
+			if string(identity) != Username {
+				return nil, errors.New("unknown identity")
+			}
+			return key, nil
+		},
+		CipherSuites: []dtls.CipherSuiteID{dtls.TLS_PSK_WITH_AES_128_GCM_SHA256},
+	}
+
+	// Handshakes are done by serve rather than by a DTLS listener, which
+	// does them one at a time: a client failing to authenticate would block
+	// the others until it times out.
+	l, err := udp.Listen("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &StreamServer{
+		l:      l,
+		cfg:    cfg,
+		colors: make(map[int]entertainment.Color),
+	}
+	go s.accept()
+
+	return s, nil
+}
+
+// Addr returns the address of the server, to use with entertainment.WithAddr.
+func (s *StreamServer) Addr() string { return s.l.Addr().String() }
+
+// Close stops the server.
+func (s *StreamServer) Close() error { return s.l.Close() }
+
+// Messages returns the number of messages received so far.
+func (s *StreamServer) Messages() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.messages
+}
+
+// Colors returns the last color received for each light or channel.
+func (s *StreamServer) Colors() map[int]entertainment.Color {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := make(map[int]entertainment.Color, len(s.colors))
+	for id, c := range s.colors {
+		res[id] = c
+	}
+
+	return res
+}
+
+// Err returns the first invalid message error, if any.
+func (s *StreamServer) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.err
+}
+
+func (s *StreamServer) accept() {
+	for {
+		conn, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+		go s.serve(conn)
+	}
+}
+
+func (s *StreamServer) serve(udpConn net.Conn) {
+	defer udpConn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	conn, err := dtls.ServerWithContext(ctx, udpConn, s.cfg)
+	cancel()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	buf := make([]byte, 8192)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return
+		}
+
+		msg, err := entertainment.DecodeMessage(buf[:n])
+
+		s.mu.Lock()
+		if err != nil {
+			if s.err == nil {
+				s.err = err
+			}
+		} else {
+			s.messages++
+			for _, c := range msg.Colors {
+				s.colors[c.ID] = c.Color
+			}
+		}
+		s.mu.Unlock()
+	}
+}
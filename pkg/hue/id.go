@@ -0,0 +1,11 @@
+package hue
+
+// LessID reports whether the resource ID a sorts before b. IDs given by the
+// bridge are numeric and ordered numerically, e.g. "2" before "10".
+func LessID(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+
+	return a < b
+}
@@ -0,0 +1,18 @@
+package hue_test
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/skwair/huectl/pkg/hue"
+)
+
+func TestLessID(t *testing.T) {
+	ids := []string{"10", "2", "1", "21", "3"}
+	sort.Slice(ids, func(i, j int) bool { return hue.LessID(ids[i], ids[j]) })
+
+	if want := []string{"1", "2", "3", "10", "21"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("expected %v, got %v", want, ids)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/skwair/harmony/optional"
 )
@@ -41,8 +42,9 @@ type LightState struct {
 }
 
 type LightSoftwareUpdate struct {
+	// State is one of the DeviceUpdateState constants.
 	State       string `json:"state"`
-	LastInstall string `json:"last_install"`
+	LastInstall string `json:"lastinstall"`
 }
 
 type LightCapabilities struct {
@@ -52,6 +54,8 @@ type LightCapabilities struct {
 }
 
 type LightCapabilitiesControl struct {
+	// MinDimLevel is the lowest output of the light, in thousandths of a
+	// percent of its maximum output, e.g. 1000 for 1%. See MinBrightness.
 	MinDimLevel    int                        `json:"mindimlevel"`
 	MaxLumen       int                        `json:"maxlumen"`
 	ColorGamutType string                     `json:"colorgamuttype"`
@@ -114,12 +118,16 @@ func (c *Client) Light(id string) (*Light, error) {
 	if err = decode(resp.Body, &light); err != nil {
 		return nil, err
 	}
+	light.ID = id
 
 	return &light, nil
 }
 
 // SetLightStateRequest describes a light state update.
 // Only explicitly set fields with be updated.
+// The *Inc fields increment or decrement the current value of their attribute
+// instead of setting it. They are ignored by the bridge if the corresponding
+// absolute attribute is also set.
 type SetLightStateRequest struct {
 	On             *optional.Bool   `json:"on,omitempty"`
 	Bri            *optional.Int    `json:"bri,omitempty"`
@@ -130,31 +138,64 @@ type SetLightStateRequest struct {
 	Alert          *optional.String `json:"alert,omitempty"`
 	Effect         *optional.String `json:"effect,omitempty"`
 	TransitionTime *optional.Int    `json:"transitiontime,omitempty"`
+	BriInc         *optional.Int    `json:"bri_inc,omitempty"` // -254 to 254.
+	HueInc         *optional.Int    `json:"hue_inc,omitempty"` // -65534 to 65534.
+	SatInc         *optional.Int    `json:"sat_inc,omitempty"` // -254 to 254.
+	CTInc          *optional.Int    `json:"ct_inc,omitempty"`  // -65534 to 65534.
+	XYInc          *[2]float32      `json:"xy_inc,omitempty"`  // -0.5 to 0.5 for both coordinates.
 }
 
-// SetLightState sets the state of the specified light bulb.
-func (c *Client) SetLightState(id string, req *SetLightStateRequest) error {
+// RestoreRequest returns the update bringing the light back to its current
+// state, e.g. after running an effect on it, with a short transition.
+func (l *Light) RestoreRequest() *SetLightStateRequest {
+	req := SetLightStateRequest{
+		On:             optional.NewBool(l.State.On),
+		TransitionTime: optional.NewInt(4),
+	}
+
+	if !l.State.On {
+		return &req
+	}
+
+	if l.IsDimmable() {
+		req.Bri = optional.NewInt(l.State.Bri)
+	}
+
+	switch l.State.ColorMode {
+	case "ct":
+		req.CT = optional.NewInt(l.State.CT)
+	case "xy", "hs":
+		req.XY = &[2]float32{float32(l.State.XY[0]), float32(l.State.XY[1])}
+	}
+
+	return &req
+}
+
+// SetLightState sets the state of the specified light bulb. The returned
+// result lists which attributes were applied and which were rejected by the
+// bridge. If none could be applied, an ErrorSet is returned instead.
+func (c *Client) SetLightState(id string, req *SetLightStateRequest) (*UpdateResult, error) {
 	b, err := json.Marshal(req)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	endpoint := fmt.Sprintf("/lights/%s/state", id)
 	resp, err := c.doReq(http.MethodPut, endpoint, b)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	return decodeErr(resp.Body)
+	return decodeUpdate(resp.Body)
 }
 
 // ToggleLight first queries the state of the specified light bulb then
 // switches it on if it was off or off if it was on.
-func (c *Client) ToggleLight(id string) error {
+func (c *Client) ToggleLight(id string) (*UpdateResult, error) {
 	light, err := c.Light(id)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	state := &SetLightStateRequest{
@@ -162,3 +203,21 @@ func (c *Client) ToggleLight(id string) error {
 	}
 	return c.SetLightState(id, state)
 }
+
+// FindLight returns the light with the given ID or, failing that, the light
+// with the given name, ignoring case. It returns nil if there is none.
+func FindLight(lights []Light, ref string) *Light {
+	for i := range lights {
+		if lights[i].ID == ref {
+			return &lights[i]
+		}
+	}
+
+	for i := range lights {
+		if strings.EqualFold(lights[i].Name, ref) {
+			return &lights[i]
+		}
+	}
+
+	return nil
+}
@@ -2,29 +2,84 @@ package hue
 
 import (
 	"bytes"
-	"errors"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"time"
 )
 
+// Do sends a raw request to the given endpoint of the bridge API
+// (e.g. GET /lights) and returns the response as is. It is meant for proxying
+// requests to the bridge; use the typed methods of the client otherwise.
+// The caller must close the body of the response.
+func (c *Client) Do(method, endpoint string, body []byte) (*http.Response, error) {
+	return c.doReq(method, endpoint, body)
+}
+
 func (c *Client) doReq(method, endpoint string, body []byte) (*http.Response, error) {
-	url := fmt.Sprintf("%s/api/%s%s", c.url, c.id, endpoint)
-	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if c.observer == nil {
+		return c.send(method, endpoint, body)
+	}
+
+	start := time.Now()
+	resp, err := c.send(method, endpoint, body)
 	if err != nil {
+		c.observer(method, endpoint, time.Since(start), err)
 		return nil, err
 	}
 
-	resp, err := c.httpClient.Do(req)
+	// The bridge reports errors in the body of successful responses, read it
+	// to let the observer know about them and hand a copy to the caller.
+	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	d := time.Since(start)
 	if err != nil {
+		c.observer(method, endpoint, d, err)
 		return nil, err
 	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(data))
 
-	if resp.TLS != nil && c.certFingerprint != "" {
-		fp := computeFingerprint(resp.TLS.PeerCertificates[0].Raw)
-		if c.certFingerprint != fp {
-			return nil, errors.New("certificate fingerprint mismatch")
-		}
+	// Avoid reporting a nil ErrorSet as a non-nil error.
+	err = nil
+	if es := apiErrors(data); es != nil {
+		err = es
 	}
+	c.observer(method, endpoint, d, err)
 
 	return resp, nil
 }
+
+// apiErrors returns the errors held by the body of a response if the bridge
+// rejected the request as a whole, or nil if it did not.
+func apiErrors(data []byte) ErrorSet {
+	if !bytes.HasPrefix(data, []byte(`[{"error":{`)) {
+		return nil
+	}
+
+	var resps []updateResp
+	if err := json.Unmarshal(data, &resps); err != nil {
+		return nil
+	}
+
+	var es ErrorSet
+	for _, resp := range resps {
+		// Updates partially applied are not errors.
+		if resp.Error == nil {
+			return nil
+		}
+		es = append(es, *resp.Error)
+	}
+
+	return es
+}
+
+func (c *Client) send(method, endpoint string, body []byte) (*http.Response, error) {
+	url := fmt.Sprintf("%s/api/%s%s", c.url, c.id, endpoint)
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	return c.httpClient.Do(req)
+}
@@ -0,0 +1,105 @@
+package hue
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/skwair/harmony/optional"
+)
+
+// Scene is a set of light states stored on the bridge that can be recalled.
+type Scene struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Type        string   `json:"type"`
+	Group       string   `json:"group"`
+	Lights      []string `json:"lights"`
+	Owner       string   `json:"owner"`
+	Recycle     bool     `json:"recycle"`
+	Locked      bool     `json:"locked"`
+	LastUpdated string   `json:"lastupdated"`
+	Version     int      `json:"version"`
+}
+
+// Scenes returns the list of all scenes stored on this bridge.
+func (c *Client) Scenes() ([]Scene, error) {
+	resp, err := c.doReq(http.MethodGet, "/scenes", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var res map[string]Scene
+	if err = decode(resp.Body, &res); err != nil {
+		return nil, err
+	}
+
+	var scenes []Scene
+	for id, s := range res {
+		s.ID = id
+		scenes = append(scenes, s)
+	}
+
+	return scenes, nil
+}
+
+// RecallScene applies the specified scene to the lights of the given group.
+// Scenes are typically recalled on the group they belong to (Scene.Group), or
+// on group "0" for scenes that are not attached to a group.
+func (c *Client) RecallScene(groupID, sceneID string) (*UpdateResult, error) {
+	return c.SetGroupState(groupID, &SetGroupStateRequest{
+		Scene: optional.NewString(sceneID),
+	})
+}
+
+// Scene types, as given in CreateSceneRequest.Type.
+const (
+	// SceneTypeLight scenes apply to a list of lights.
+	SceneTypeLight = "LightScene"
+	// SceneTypeGroup scenes apply to the lights of a group, and are
+	// deleted along with it.
+	SceneTypeGroup = "GroupScene"
+)
+
+// CreateSceneRequest describes a scene to create.
+type CreateSceneRequest struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Group is the ID of the group of GroupScene scenes.
+	Group string `json:"group,omitempty"`
+	// Lights are the IDs of the lights of LightScene scenes.
+	Lights  []string `json:"lights,omitempty"`
+	Recycle bool     `json:"recycle"`
+	// LightStates are the states the scene applies, indexed by light ID.
+	LightStates map[string]*SetLightStateRequest `json:"lightstates"`
+}
+
+// CreateScene creates a scene and returns its ID.
+func (c *Client) CreateScene(req *CreateSceneRequest) (string, error) {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := c.doReq(http.MethodPost, "/scenes", b)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var res []struct {
+		Success struct {
+			ID string `json:"id"`
+		} `json:"success"`
+	}
+	if err = decode(resp.Body, &res); err != nil {
+		return "", err
+	}
+
+	if len(res) == 0 || res[0].Success.ID == "" {
+		return "", errors.New("bridge did not return the ID of the new scene")
+	}
+
+	return res[0].Success.ID, nil
+}
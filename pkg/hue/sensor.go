@@ -0,0 +1,93 @@
+package hue
+
+import (
+	"math"
+	"net/http"
+)
+
+// Sensor is a sensor connected to the bridge, such as a motion sensor or a
+// switch. Motion sensors appear as three sensors: presence, temperature and
+// light level.
+type Sensor struct {
+	ID               string       `json:"id"`
+	Name             string       `json:"name"`
+	Type             string       `json:"type"`
+	ModelID          string       `json:"modelid"`
+	ManufacturerName string       `json:"manufacturername"`
+	ProductName      string       `json:"productname"`
+	UniqueID         string       `json:"uniqueid"`
+	SoftWareVersion  string       `json:"swversion"`
+	State            SensorState  `json:"state"`
+	Config           SensorConfig `json:"config"`
+}
+
+// SensorState is the state of a sensor. Fields depend on the type of the
+// sensor and are nil when not reported.
+type SensorState struct {
+	// Temperature in hundredths of a degree Celsius.
+	Temperature *int `json:"temperature"`
+	// LightLevel is 10000 * log10(lux) + 1.
+	LightLevel  *int   `json:"lightlevel"`
+	Dark        *bool  `json:"dark"`
+	Daylight    *bool  `json:"daylight"`
+	Presence    *bool  `json:"presence"`
+	ButtonEvent *int   `json:"buttonevent"`
+	LastUpdated string `json:"lastupdated"`
+}
+
+// SensorConfig is the configuration of a sensor.
+type SensorConfig struct {
+	On        bool  `json:"on"`
+	Reachable *bool `json:"reachable"`
+	// Battery level in percent, nil for sensors without battery.
+	Battery *int `json:"battery"`
+}
+
+// Sensor types, as reported by the bridge in Sensor.Type.
+const (
+	SensorTypePresence    = "ZLLPresence"
+	SensorTypeTemperature = "ZLLTemperature"
+	SensorTypeLightLevel  = "ZLLLightLevel"
+	SensorTypeSwitch      = "ZLLSwitch"
+	SensorTypeDaylight    = "Daylight"
+)
+
+// TemperatureCelsius returns the temperature measured by the sensor, if any.
+func (s *Sensor) TemperatureCelsius() (float64, bool) {
+	if s.State.Temperature == nil {
+		return 0, false
+	}
+
+	return float64(*s.State.Temperature) / 100, true
+}
+
+// LightLevelLux returns the illuminance measured by the sensor, if any.
+func (s *Sensor) LightLevelLux() (float64, bool) {
+	if s.State.LightLevel == nil {
+		return 0, false
+	}
+
+	return math.Pow(10, float64(*s.State.LightLevel-1)/10000), true
+}
+
+// Sensors returns the list of all sensors connected to this bridge.
+func (c *Client) Sensors() ([]Sensor, error) {
+	resp, err := c.doReq(http.MethodGet, "/sensors", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var res map[string]Sensor
+	if err = decode(resp.Body, &res); err != nil {
+		return nil, err
+	}
+
+	var sensors []Sensor
+	for id, s := range res {
+		s.ID = id
+		sensors = append(sensors, s)
+	}
+
+	return sensors, nil
+}
@@ -0,0 +1,198 @@
+package hue
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hueRootCA is the certificate of the Signify (Philips Hue) private CA that
+// signs the certificates of recent bridges, whose common name is the ID of
+// the bridge.
+const hueRootCA = `-----BEGIN CERTIFICATE-----
+MIICMjCCAdigAwIBAgIUO7FSLbaxikuXAljzVaurLXWmFw4wCgYIKoZIzj0EAwIw
+OTELMAkGA1UEBhMCTkwxFDASBgNVBAoMC1BoaWxpcHMgSHVlMRQwEgYDVQQDDAty
+b290LWJyaWRnZTAiGA8yMDE3MDEwMTAwMDAwMFoYDzIwMzgwMTE5MDMxNDA3WjA5
+MQswCQYDVQQGEwJOTDEUMBIGA1UECgwLUGhpbGlwcyBIdWUxFDASBgNVBAMMC3Jv
+b3QtYnJpZGdlMFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAEjNw2tx2AplOf9x86
+aTdvEcL1FU65QDxziKvBpW9XXSIcibAeQiKxegpq8Exbr9v6LBnYbna2VcaK0G22
+jOKkTqOBuTCBtjAPBgNVHRMBAf8EBTADAQH/MA4GA1UdDwEB/wQEAwIBhjAdBgNV
+HQ4EFgQUZ2ONTFrDT6o8ItRnKfqWKnHFGmQwdAYDVR0jBG0wa4AUZ2ONTFrDT6o8
+ItRnKfqWKnHFGmShPaQ7MDkxCzAJBgNVBAYTAk5MMRQwEgYDVQQKDAtQaGlsaXBz
+IEh1ZTEUMBIGA1UEAwwLcm9vdC1icmlkZ2WCFDuxUi22sYpLlwJY81Wrqy11phcO
+MAoGCCqGSM49BAMCA0gAMEUCIEBYYEOsa07TH7E5MJnGw557lVkORgit2Rm1h3B2
+sFgDAiEA1Fj/C3AN5psFMjo0//mrQebo0eKd3aWRx+pQY08mk48=
+-----END CERTIFICATE-----`
+
+var (
+	hueRootsOnce sync.Once
+	hueRoots     *x509.CertPool
+)
+
+// ErrCertificateMismatch is returned when the certificate of a bridge does
+// not match the pinned fingerprint, e.g. when another host impersonates it or
+// when the bridge renewed its certificate.
+var ErrCertificateMismatch = errors.New("certificate fingerprint mismatch")
+
+// Fingerprint returns the SHA-256 fingerprint of a DER encoded certificate,
+// as colon separated hexadecimal bytes.
+func Fingerprint(cert []byte) string {
+	sum := sha256.Sum256(cert)
+	return formatFingerprint(sum[:])
+}
+
+// legacyFingerprint returns the SHA-1 fingerprint of a DER encoded
+// certificate, as pinned by earlier versions of huectl.
+func legacyFingerprint(cert []byte) string {
+	sum := sha1.Sum(cert)
+	return formatFingerprint(sum[:])
+}
+
+func formatFingerprint(sum []byte) string {
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = hex.EncodeToString([]byte{b})
+	}
+
+	return strings.Join(parts, ":")
+}
+
+// IsLegacyFingerprint reports whether the given fingerprint is a SHA-1
+// fingerprint, which should be replaced by a SHA-256 one.
+func IsLegacyFingerprint(fp string) bool {
+	return len(fp) == len(legacyFingerprint(nil))
+}
+
+// VerifyBridgeCertificate verifies the certificate was issued to the bridge
+// with the given ID by the Signify root CA. Only recent bridges have such a
+// certificate, older ones use a self-signed certificate.
+func VerifyBridgeCertificate(cert *x509.Certificate, intermediates []*x509.Certificate, bridgeID string) error {
+	hueRootsOnce.Do(func() {
+		hueRoots = x509.NewCertPool()
+		hueRoots.AppendCertsFromPEM([]byte(hueRootCA))
+	})
+
+	pool := x509.NewCertPool()
+	for _, c := range intermediates {
+		pool.AddCert(c)
+	}
+
+	// Bridge certificates have no subject alternative names, so they can not
+	// be checked against the host name: the ID is checked instead.
+	if _, err := cert.Verify(x509.VerifyOptions{Roots: hueRoots, Intermediates: pool}); err != nil {
+		return fmt.Errorf("certificate not issued by the Hue root CA: %w", err)
+	}
+
+	if !strings.EqualFold(cert.Subject.CommonName, bridgeID) {
+		return fmt.Errorf("certificate issued to bridge %q, expected %q", cert.Subject.CommonName, bridgeID)
+	}
+
+	return nil
+}
+
+// CertVerifier verifies the certificate of a bridge during the TLS handshake,
+// before anything is sent to it. Bridges use certificates that can not be
+// verified with the usual system roots, so they are pinned instead.
+type CertVerifier struct {
+	// Fingerprint is the fingerprint the certificate must have. Legacy SHA-1
+	// fingerprints are accepted, see OnUpgrade.
+	Fingerprint string
+	// BridgeID, if set, requires the certificate to be issued by the Signify
+	// root CA to the bridge with this ID, see VerifyBridgeCertificate.
+	BridgeID string
+	// OnUpgrade, if set, is called once with the SHA-256 fingerprint of the
+	// certificate when it matched a legacy SHA-1 Fingerprint, so it can be
+	// pinned instead.
+	OnUpgrade func(fingerprint string)
+
+	upgradeOnce sync.Once
+}
+
+// TLSConfig returns a TLS configuration verifying certificates with v.
+func (v *CertVerifier) TLSConfig() *tls.Config {
+	return &tls.Config{
+		// Verification is entirely done by VerifyPeerCertificate, bridge
+		// certificates can not be verified by the standard library.
+		InsecureSkipVerify:    true,
+		VerifyPeerCertificate: v.VerifyPeerCertificate,
+	}
+}
+
+// VerifyPeerCertificate verifies the certificate chain sent by a bridge, and
+// can be used as tls.Config.VerifyPeerCertificate.
+func (v *CertVerifier) VerifyPeerCertificate(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	if len(rawCerts) == 0 {
+		return errors.New("bridge did not present a certificate")
+	}
+
+	if v.BridgeID != "" {
+		certs := make([]*x509.Certificate, len(rawCerts))
+		for i, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return fmt.Errorf("unable to parse certificate: %w", err)
+			}
+			certs[i] = cert
+		}
+
+		if err := VerifyBridgeCertificate(certs[0], certs[1:], v.BridgeID); err != nil {
+			return err
+		}
+	}
+
+	if v.Fingerprint == "" {
+		return nil
+	}
+
+	if IsLegacyFingerprint(v.Fingerprint) {
+		if !equalFingerprints(legacyFingerprint(rawCerts[0]), v.Fingerprint) {
+			return ErrCertificateMismatch
+		}
+
+		if v.OnUpgrade != nil {
+			v.upgradeOnce.Do(func() { v.OnUpgrade(Fingerprint(rawCerts[0])) })
+		}
+		return nil
+	}
+
+	if !equalFingerprints(Fingerprint(rawCerts[0]), v.Fingerprint) {
+		return ErrCertificateMismatch
+	}
+
+	return nil
+}
+
+// FetchCertificates connects to the bridge at the given address, as a host
+// name or IP address with an optional port, and returns the certificate chain
+// it presents without verifying it, e.g. to show it before pinning it.
+func FetchCertificates(addr string, timeout time.Duration) ([]*x509.Certificate, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "443")
+	}
+
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to bridge: %w", err)
+	}
+	defer conn.Close()
+
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil, errors.New("bridge did not present a certificate")
+	}
+
+	return certs, nil
+}
+
+func equalFingerprints(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(strings.ToLower(a)), []byte(strings.ToLower(b))) == 1
+}
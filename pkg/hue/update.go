@@ -0,0 +1,96 @@
+package hue
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+)
+
+// UpdateResult is the outcome of a state update sent to the bridge.
+// The bridge reports the result of each attribute separately, so an update
+// can be partially applied: some attributes are set while others are rejected
+// (e.g. the brightness of a light that is switched off).
+type UpdateResult struct {
+	// Applied lists attributes that were successfully updated.
+	Applied []AppliedAttribute
+	// Rejected lists errors for attributes that could not be updated.
+	Rejected ErrorSet
+}
+
+// AppliedAttribute is an attribute successfully updated by the bridge.
+type AppliedAttribute struct {
+	// Address is the full resource address of the attribute,
+	// e.g. /lights/1/state/bri.
+	Address string
+	// Value is the new value of the attribute, as reported by the bridge.
+	Value interface{}
+}
+
+// Name returns the name of the attribute, e.g. "bri".
+func (a AppliedAttribute) Name() string { return path.Base(a.Address) }
+
+// Partial reports whether some, but not all, attributes were applied.
+func (r *UpdateResult) Partial() bool {
+	return len(r.Applied) > 0 && len(r.Rejected) > 0
+}
+
+// Err returns the rejected attributes as an error, or nil if every
+// attribute was applied.
+func (r *UpdateResult) Err() error {
+	if len(r.Rejected) == 0 {
+		return nil
+	}
+
+	return r.Rejected
+}
+
+type updateResp struct {
+	Success map[string]interface{} `json:"success"`
+	Error   *Error                 `json:"error"`
+}
+
+// decodeUpdate decodes the response of a PUT request, which is a list of
+// per-attribute success or error objects. If nothing was applied, the
+// errors are returned as an ErrorSet instead of a result.
+func decodeUpdate(r io.Reader) (*UpdateResult, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var resps []updateResp
+	if err = json.Unmarshal(data, &resps); err != nil {
+		return nil, err
+	}
+
+	var res UpdateResult
+	for _, resp := range resps {
+		if resp.Error != nil {
+			res.Rejected = append(res.Rejected, *resp.Error)
+			continue
+		}
+
+		// Each success object holds a single address, but sort them anyway
+		// to get a stable output should the bridge send more.
+		addrs := make([]string, 0, len(resp.Success))
+		for addr := range resp.Success {
+			addrs = append(addrs, addr)
+		}
+		sort.Strings(addrs)
+
+		for _, addr := range addrs {
+			res.Applied = append(res.Applied, AppliedAttribute{
+				Address: addr,
+				Value:   resp.Success[addr],
+			})
+		}
+	}
+
+	if len(res.Applied) == 0 && len(res.Rejected) > 0 {
+		return nil, res.Rejected
+	}
+
+	return &res, nil
+}
@@ -2,47 +2,93 @@ package hue
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"time"
 )
 
-// RegisterUser registers a new user on the Hue bridge at the given address.
+// Credentials are the credentials of a user registered on a Hue bridge.
+type Credentials struct {
+	// Username identifies the user in requests to the REST API.
+	Username string
+	// ClientKey is the pre-shared key used to stream to entertainment groups,
+	// as a hex string. The bridge only returns it when the user is
+	// registered, it can not be retrieved later on.
+	ClientKey string
+}
+
+// RegisterUser registers a new user on the Hue bridge at the given address and
+// returns its credentials.
 // The bridge needs to be in "link" mode, i.e. the button must have been pressed
 // in the last 30 seconds for the registration to work.
 // The device type is an identifier for this new user and must have the following
 // format: <application_name>#<device_name>. See https://developers.meethue.com/develop/hue-api/7-configuration-api/#create-user
 // for more information.
-func RegisterUser(httpClient *http.Client, addr, deviceType string) (username string, err error) {
+func RegisterUser(httpClient *http.Client, addr, deviceType string) (*Credentials, error) {
 	registerReq := struct {
-		DeviceType string `json:"devicetype"`
+		DeviceType        string `json:"devicetype"`
+		GenerateClientKey bool   `json:"generateclientkey"`
 	}{
-		DeviceType: deviceType,
+		DeviceType:        deviceType,
+		GenerateClientKey: true,
 	}
 	b, err := json.Marshal(registerReq)
 	if err != nil {
-		return "", fmt.Errorf("unable to marshal register user request body: %w", err)
+		return nil, fmt.Errorf("unable to marshal register user request body: %w", err)
 	}
 
 	resp, err := httpClient.Post(fmt.Sprintf("https://%s/api", addr), "application/json", bytes.NewReader(b))
 	if err != nil {
-		return "", fmt.Errorf("unable to send second register user request: %w", err)
+		return nil, fmt.Errorf("unable to send register user request: %w", err)
 	}
 	defer resp.Body.Close()
 
-	registerResp := make([]struct {
+	var registerResp []struct {
 		Success struct {
-			Username string `json:"username"`
+			Username  string `json:"username"`
+			ClientKey string `json:"clientkey"`
 		} `json:"success"`
-	}, 1)
-	if err = json.NewDecoder(resp.Body).Decode(&registerResp); err != nil {
-		return "", fmt.Errorf("unable to decode register response: %w", err)
+	}
+	if err = decode(resp.Body, &registerResp); err != nil {
+		// Report errors returned by the bridge as is, such as the link
+		// button not being pressed.
+		var apiErrs ErrorSet
+		if errors.As(err, &apiErrs) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("unable to decode register response: %w", err)
 	}
 
 	if len(registerResp) == 0 || registerResp[0].Success.Username == "" {
-		return "", errors.New("failed to register new user")
+		return nil, errors.New("failed to register new user")
 	}
 
-	return registerResp[0].Success.Username, nil
+	return &Credentials{
+		Username:  registerResp[0].Success.Username,
+		ClientKey: registerResp[0].Success.ClientKey,
+	}, nil
+}
+
+// WaitRegisterUser is like RegisterUser, but tries again every interval while
+// the link button of the bridge has not been pressed, until it is or the
+// context is done.
+func WaitRegisterUser(ctx context.Context, httpClient *http.Client, addr, deviceType string, interval time.Duration) (*Credentials, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		creds, err := RegisterUser(httpClient, addr, deviceType)
+		if !HasErrorType(err, ErrorTypeLinkButtonNotPressed) {
+			return creds, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
 }
@@ -0,0 +1,353 @@
+package hue
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/skwair/harmony/optional"
+)
+
+// Strictness controls how ValidateLightState handles updates that a light
+// cannot fully apply.
+type Strictness int
+
+const (
+	// Reject returns an error for any unsupported attribute or out of range value.
+	Reject Strictness = iota
+	// Clamp brings out of range values within the limits of the light and
+	// drops attributes it does not support.
+	Clamp
+	// Convert behaves like Clamp, but first converts colors the light cannot
+	// display to the closest ones it can, e.g. a hue to a color temperature
+	// for white ambiance lights.
+	Convert
+)
+
+// ParseStrictness returns the strictness matching the given name:
+// "reject", "clamp" or "convert".
+func ParseStrictness(s string) (Strictness, error) {
+	switch s {
+	case "reject":
+		return Reject, nil
+	case "clamp":
+		return Clamp, nil
+	case "convert":
+		return Convert, nil
+	default:
+		return 0, fmt.Errorf("unknown strictness %q", s)
+	}
+}
+
+// Default color temperature range of lights not reporting theirs, in mireds.
+const (
+	defaultMinCT = 153
+	defaultMaxCT = 500
+)
+
+// ValidationError is returned by ValidateLightState when an update is rejected.
+type ValidationError struct {
+	Problems []string
+}
+
+// Error implements the `error` interface.
+func (e *ValidationError) Error() string { return strings.Join(e.Problems, "; ") }
+
+// ValidateLightState checks the given update against the type and the
+// capabilities of the light. It returns the update to send, adjusted according
+// to the strictness, along with a description of each adjustment that was made.
+// The given request is never modified.
+func ValidateLightState(light *Light, req *SetLightStateRequest, strictness Strictness) (*SetLightStateRequest, []string, error) {
+	// Optional values can not be read back, so work on a plain copy of the update.
+	vals, err := newLightStateValues(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	v := validation{light: light, strictness: strictness}
+	v.checkDimming(vals)
+	v.checkColor(vals)
+	v.checkColorTemperature(vals)
+	v.checkRanges(vals)
+
+	if len(v.problems) > 0 {
+		return nil, nil, &ValidationError{Problems: v.problems}
+	}
+
+	return vals.request(), v.adjustments, nil
+}
+
+type validation struct {
+	light       *Light
+	strictness  Strictness
+	problems    []string
+	adjustments []string
+}
+
+// unsupported records that the light can not apply the given attribute.
+// It reports whether the attribute must be dropped from the update.
+func (v *validation) unsupported(attr string, set bool) bool {
+	if !set {
+		return false
+	}
+
+	if v.strictness == Reject {
+		v.problems = append(v.problems, fmt.Sprintf("%s not supported by this %s", attr, strings.ToLower(v.light.Type)))
+		return false
+	}
+
+	v.adjustments = append(v.adjustments, fmt.Sprintf("dropped %s, not supported by this %s", attr, strings.ToLower(v.light.Type)))
+	return true
+}
+
+// checkRange ensures *val is between min and max, clamping it if allowed.
+func (v *validation) checkRange(attr string, val *int, min, max int) {
+	if val == nil || (*val >= min && *val <= max) {
+		return
+	}
+
+	if v.strictness == Reject {
+		v.problems = append(v.problems, fmt.Sprintf("%s must be between %d and %d, got %d", attr, min, max, *val))
+		return
+	}
+
+	clamped := int(math.Max(float64(min), math.Min(float64(max), float64(*val))))
+	v.adjustments = append(v.adjustments, fmt.Sprintf("clamped %s from %d to %d", attr, *val, clamped))
+	*val = clamped
+}
+
+func (v *validation) checkDimming(vals *lightStateValues) {
+	if v.light.IsDimmable() {
+		return
+	}
+
+	if v.unsupported("bri", vals.Bri != nil) {
+		vals.Bri = nil
+	}
+	if v.unsupported("bri_inc", vals.BriInc != nil) {
+		vals.BriInc = nil
+	}
+	if v.unsupported("transitiontime", vals.TransitionTime != nil) {
+		vals.TransitionTime = nil
+	}
+}
+
+func (v *validation) checkColor(vals *lightStateValues) {
+	if v.light.SupportsColor() {
+		return
+	}
+
+	if v.strictness == Convert && v.light.SupportsColorTemperature() && vals.CT == nil {
+		var (
+			xy   [2]float64
+			from string
+		)
+		switch {
+		case vals.XY != nil:
+			xy, from = [2]float64{float64(vals.XY[0]), float64(vals.XY[1])}, "xy"
+		case vals.Hue != nil:
+			sat := 254
+			if vals.Sat != nil {
+				sat = *vals.Sat
+			}
+			xy, from = HueSatToXY(*vals.Hue, sat), "hue"
+		}
+
+		if from != "" {
+			ct := XYToMired(xy)
+			vals.CT = &ct
+			vals.XY, vals.Hue, vals.Sat = nil, nil, nil
+			v.adjustments = append(v.adjustments, fmt.Sprintf("converted %s to ct %d", from, ct))
+		}
+	}
+
+	if v.unsupported("hue", vals.Hue != nil) {
+		vals.Hue = nil
+	}
+	if v.unsupported("hue_inc", vals.HueInc != nil) {
+		vals.HueInc = nil
+	}
+	if v.unsupported("sat", vals.Sat != nil) {
+		vals.Sat = nil
+	}
+	if v.unsupported("sat_inc", vals.SatInc != nil) {
+		vals.SatInc = nil
+	}
+	if v.unsupported("xy", vals.XY != nil) {
+		vals.XY = nil
+	}
+	if v.unsupported("xy_inc", vals.XYInc != nil) {
+		vals.XYInc = nil
+	}
+	if v.unsupported("effect", vals.Effect != nil) {
+		vals.Effect = nil
+	}
+}
+
+func (v *validation) checkColorTemperature(vals *lightStateValues) {
+	if v.light.SupportsColorTemperature() {
+		return
+	}
+
+	if v.strictness == Convert && v.light.SupportsColor() && vals.CT != nil && vals.XY == nil && vals.Hue == nil {
+		xy := v.light.Gamut().Clamp(MiredToXY(*vals.CT))
+		vals.XY = &[2]float32{float32(xy[0]), float32(xy[1])}
+		v.adjustments = append(v.adjustments, fmt.Sprintf("converted ct %d to xy %.4f,%.4f", *vals.CT, xy[0], xy[1]))
+		vals.CT = nil
+	}
+
+	if v.unsupported("ct", vals.CT != nil) {
+		vals.CT = nil
+	}
+	if v.unsupported("ct_inc", vals.CTInc != nil) {
+		vals.CTInc = nil
+	}
+}
+
+// checkMinDimLevel ensures the brightness is not below the minimum dim level
+// of the light, clamping it if allowed. A brightness of 0, which the bridge
+// does not accept, is always raised to the minimum dim level as it can only
+// mean the lowest brightness of the light.
+func (v *validation) checkMinDimLevel(vals *lightStateValues) {
+	minBri := v.light.MinBrightness()
+	if vals.Bri == nil || *vals.Bri < 0 || *vals.Bri >= minBri {
+		return
+	}
+
+	if *vals.Bri == 0 {
+		v.adjustments = append(v.adjustments, fmt.Sprintf("raised bri from 0 to %d, the minimum dim level of this light", minBri))
+		*vals.Bri = minBri
+		return
+	}
+
+	if v.strictness == Reject {
+		v.problems = append(v.problems, fmt.Sprintf("bri must be at least %d, the minimum dim level of this light, got %d", minBri, *vals.Bri))
+		return
+	}
+
+	v.adjustments = append(v.adjustments, fmt.Sprintf("clamped bri from %d to %d, the minimum dim level of this light", *vals.Bri, minBri))
+	*vals.Bri = minBri
+}
+
+func (v *validation) checkRanges(vals *lightStateValues) {
+	v.checkMinDimLevel(vals)
+	v.checkRange("bri", vals.Bri, 1, 254)
+	v.checkRange("hue", vals.Hue, 0, 65535)
+	v.checkRange("sat", vals.Sat, 0, 254)
+	v.checkRange("transitiontime", vals.TransitionTime, 0, 65535)
+	v.checkRange("bri_inc", vals.BriInc, -254, 254)
+	v.checkRange("sat_inc", vals.SatInc, -254, 254)
+	v.checkRange("hue_inc", vals.HueInc, -65534, 65534)
+	v.checkRange("ct_inc", vals.CTInc, -65534, 65534)
+
+	minCT, maxCT := defaultMinCT, defaultMaxCT
+	if ct := v.light.Capabilities.Control.Ct; ct.Max > 0 {
+		minCT, maxCT = ct.Min, ct.Max
+	}
+	v.checkRange("ct", vals.CT, minCT, maxCT)
+
+	if vals.XY != nil && v.light.SupportsColor() {
+		xy := [2]float64{float64(vals.XY[0]), float64(vals.XY[1])}
+		clamped := v.light.Gamut().Clamp(xy)
+
+		// Allow for the imprecision of float32 coordinates.
+		if math.Hypot(clamped[0]-xy[0], clamped[1]-xy[1]) > 1e-4 {
+			if v.strictness == Reject {
+				v.problems = append(v.problems, fmt.Sprintf("xy %.4f,%.4f is outside of the color gamut of this light", xy[0], xy[1]))
+			} else {
+				vals.XY = &[2]float32{float32(clamped[0]), float32(clamped[1])}
+				v.adjustments = append(v.adjustments, fmt.Sprintf("clamped xy from %.4f,%.4f to %.4f,%.4f", xy[0], xy[1], clamped[0], clamped[1]))
+			}
+		}
+	}
+
+	if vals.XYInc != nil {
+		for i := range vals.XYInc {
+			inc := vals.XYInc[i]
+			if inc >= -0.5 && inc <= 0.5 {
+				continue
+			}
+
+			if v.strictness == Reject {
+				v.problems = append(v.problems, fmt.Sprintf("xy_inc must be between -0.5 and 0.5, got %g", inc))
+			} else {
+				vals.XYInc[i] = float32(math.Max(-0.5, math.Min(0.5, float64(inc))))
+				v.adjustments = append(v.adjustments, fmt.Sprintf("clamped xy_inc from %g to %g", inc, vals.XYInc[i]))
+			}
+		}
+	}
+}
+
+// lightStateValues mirrors SetLightStateRequest with plain pointers so
+// its values can be inspected and adjusted.
+type lightStateValues struct {
+	On             *bool       `json:"on"`
+	Bri            *int        `json:"bri"`
+	Hue            *int        `json:"hue"`
+	Sat            *int        `json:"sat"`
+	XY             *[2]float32 `json:"xy"`
+	CT             *int        `json:"ct"`
+	Alert          *string     `json:"alert"`
+	Effect         *string     `json:"effect"`
+	TransitionTime *int        `json:"transitiontime"`
+	BriInc         *int        `json:"bri_inc"`
+	HueInc         *int        `json:"hue_inc"`
+	SatInc         *int        `json:"sat_inc"`
+	CTInc          *int        `json:"ct_inc"`
+	XYInc          *[2]float32 `json:"xy_inc"`
+}
+
+func newLightStateValues(req *SetLightStateRequest) (*lightStateValues, error) {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var vals lightStateValues
+	if err = json.Unmarshal(b, &vals); err != nil {
+		return nil, err
+	}
+
+	return &vals, nil
+}
+
+func (vals *lightStateValues) request() *SetLightStateRequest {
+	return &SetLightStateRequest{
+		On:             optionalBool(vals.On),
+		Bri:            optionalInt(vals.Bri),
+		Hue:            optionalInt(vals.Hue),
+		Sat:            optionalInt(vals.Sat),
+		XY:             vals.XY,
+		CT:             optionalInt(vals.CT),
+		Alert:          optionalString(vals.Alert),
+		Effect:         optionalString(vals.Effect),
+		TransitionTime: optionalInt(vals.TransitionTime),
+		BriInc:         optionalInt(vals.BriInc),
+		HueInc:         optionalInt(vals.HueInc),
+		SatInc:         optionalInt(vals.SatInc),
+		CTInc:          optionalInt(vals.CTInc),
+		XYInc:          vals.XYInc,
+	}
+}
+
+func optionalBool(b *bool) *optional.Bool {
+	if b == nil {
+		return nil
+	}
+	return optional.NewBool(*b)
+}
+
+func optionalInt(i *int) *optional.Int {
+	if i == nil {
+		return nil
+	}
+	return optional.NewInt(*i)
+}
+
+func optionalString(s *string) *optional.String {
+	if s == nil {
+		return nil
+	}
+	return optional.NewString(*s)
+}
@@ -0,0 +1,167 @@
+package hue
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/skwair/harmony/optional"
+)
+
+func TestValidateLightState(t *testing.T) {
+	color := &Light{
+		Type: LightTypeExtendedColor,
+		Capabilities: LightCapabilities{
+			Control: LightCapabilitiesControl{
+				MinDimLevel:    2000,
+				ColorGamutType: "C",
+				Ct:             LightCapabilitiesControlCt{Min: 153, Max: 454},
+			},
+		},
+	}
+	ambiance := &Light{Type: LightTypeColorTemperature}
+	plug := &Light{Type: LightTypeOnOffPlug}
+
+	tests := []struct {
+		name        string
+		light       *Light
+		req         *SetLightStateRequest
+		strictness  Strictness
+		want        string
+		adjustments []string
+		wantErr     bool
+	}{
+		{
+			name:       "valid",
+			light:      color,
+			req:        &SetLightStateRequest{On: optional.NewBool(true), Bri: optional.NewInt(100), CT: optional.NewInt(300)},
+			strictness: Reject,
+			want:       `{"on":true,"bri":100,"ct":300}`,
+		},
+		{
+			name:       "below minimum dim level rejected",
+			light:      color,
+			req:        &SetLightStateRequest{Bri: optional.NewInt(1)},
+			strictness: Reject,
+			wantErr:    true,
+		},
+		{
+			name:        "below minimum dim level clamped",
+			light:       color,
+			req:         &SetLightStateRequest{Bri: optional.NewInt(1)},
+			strictness:  Clamp,
+			want:        `{"bri":6}`,
+			adjustments: []string{"clamped bri from 1 to 6, the minimum dim level of this light"},
+		},
+		{
+			name:        "zero brightness raised to minimum dim level",
+			light:       color,
+			req:         &SetLightStateRequest{Bri: optional.NewInt(0)},
+			strictness:  Reject,
+			want:        `{"bri":6}`,
+			adjustments: []string{"raised bri from 0 to 6, the minimum dim level of this light"},
+		},
+		{
+			name:       "no minimum dim level",
+			light:      ambiance,
+			req:        &SetLightStateRequest{Bri: optional.NewInt(1)},
+			strictness: Reject,
+			want:       `{"bri":1}`,
+		},
+		{
+			name:        "zero brightness without minimum dim level",
+			light:       ambiance,
+			req:         &SetLightStateRequest{Bri: optional.NewInt(0)},
+			strictness:  Reject,
+			want:        `{"bri":1}`,
+			adjustments: []string{"raised bri from 0 to 1, the minimum dim level of this light"},
+		},
+		{
+			name:       "negative brightness rejected",
+			light:      color,
+			req:        &SetLightStateRequest{Bri: optional.NewInt(-1)},
+			strictness: Reject,
+			wantErr:    true,
+		},
+		{
+			name:       "xy outside of gamut rejected",
+			light:      color,
+			req:        &SetLightStateRequest{XY: &[2]float32{0.8, 0.1}},
+			strictness: Reject,
+			wantErr:    true,
+		},
+		{
+			name:        "xy outside of gamut clamped",
+			light:       color,
+			req:         &SetLightStateRequest{XY: &[2]float32{0, 0}},
+			strictness:  Clamp,
+			want:        `{"xy":[0.1532,0.0475]}`,
+			adjustments: []string{"clamped xy from 0.0000,0.0000 to 0.1532,0.0475"},
+		},
+		{
+			name:        "ct converted",
+			light:       &Light{Type: LightTypeColor},
+			req:         &SetLightStateRequest{CT: optional.NewInt(500)},
+			strictness:  Convert,
+			want:        `{"xy":[0.5269026,0.41326487]}`,
+			adjustments: []string{"converted ct 500 to xy 0.5269,0.4133"},
+		},
+		{
+			name:        "color temperature clamped",
+			light:       color,
+			req:         &SetLightStateRequest{CT: optional.NewInt(500)},
+			strictness:  Clamp,
+			want:        `{"ct":454}`,
+			adjustments: []string{"clamped ct from 500 to 454"},
+		},
+		{
+			name:        "hue converted",
+			light:       ambiance,
+			req:         &SetLightStateRequest{Hue: optional.NewInt(0), Sat: optional.NewInt(0)},
+			strictness:  Convert,
+			want:        `{"ct":165}`,
+			adjustments: []string{"converted hue to ct 165"},
+		},
+		{
+			name:       "unsupported brightness rejected",
+			light:      plug,
+			req:        &SetLightStateRequest{Bri: optional.NewInt(100)},
+			strictness: Reject,
+			wantErr:    true,
+		},
+		{
+			name:        "unsupported brightness dropped",
+			light:       plug,
+			req:         &SetLightStateRequest{On: optional.NewBool(true), Bri: optional.NewInt(100)},
+			strictness:  Clamp,
+			want:        `{"on":true}`,
+			adjustments: []string{"dropped bri, not supported by this on/off plug-in unit"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, adjustments, err := ValidateLightState(tt.light, tt.req, tt.strictness)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			got, err := json.Marshal(req)
+			if err != nil {
+				t.Fatalf("unable to encode request: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+			if !reflect.DeepEqual(adjustments, tt.adjustments) {
+				t.Errorf("expected adjustments %q, got %q", tt.adjustments, adjustments)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/skwair/harmony/optional"
+	"github.com/skwair/huectl/pkg/hue"
+)
+
+// lightCommand is a command sent by Home Assistant to a JSON schema light.
+type lightCommand struct {
+	State      *string  `json:"state"`
+	Brightness *int     `json:"brightness"`
+	ColorTemp  *int     `json:"color_temp"`
+	Color      *xyJSON  `json:"color"`
+	Transition *float64 `json:"transition"`
+	Flash      *string  `json:"flash"`
+	Effect     *string  `json:"effect"`
+}
+
+// request converts the command to a light state update.
+func (c *lightCommand) request() (*hue.SetLightStateRequest, error) {
+	var req hue.SetLightStateRequest
+
+	if c.State != nil {
+		switch strings.ToUpper(*c.State) {
+		case "ON":
+			req.On = optional.NewBool(true)
+		case "OFF":
+			req.On = optional.NewBool(false)
+		default:
+			return nil, fmt.Errorf("invalid state %q", *c.State)
+		}
+	}
+
+	if c.Brightness != nil {
+		// Brightness is sent on the 0-254 scale set in discovery configs, but
+		// the bridge does not accept 0.
+		bri := *c.Brightness
+		if bri < 1 {
+			bri = 1
+		}
+		req.Bri = optional.NewInt(bri)
+	}
+
+	if c.ColorTemp != nil {
+		req.CT = optional.NewInt(*c.ColorTemp)
+	}
+
+	if c.Color != nil {
+		req.XY = &[2]float32{float32(c.Color.X), float32(c.Color.Y)}
+	}
+
+	if c.Transition != nil {
+		req.TransitionTime = optional.NewInt(int(math.Round(*c.Transition * 10)))
+	}
+
+	if c.Flash != nil {
+		switch *c.Flash {
+		case "short":
+			req.Alert = optional.NewString("select")
+		case "long":
+			req.Alert = optional.NewString("lselect")
+		default:
+			return nil, fmt.Errorf("invalid flash %q", *c.Flash)
+		}
+	}
+
+	if c.Effect != nil {
+		req.Effect = optional.NewString(*c.Effect)
+	}
+
+	return &req, nil
+}
+
+// handleCommand applies a command received on <root>/light/<id>/set and
+// publishes the updated state of the light.
+func (b *Bridge) handleCommand(_ paho.Client, msg paho.Message) {
+	id := strings.TrimSuffix(strings.TrimPrefix(msg.Topic(), b.root()+"/light/"), "/set")
+
+	b.mu.Lock()
+	light, ok := b.lights[id]
+	b.mu.Unlock()
+	if !ok {
+		b.logf("Ignoring command for unknown light %q", id)
+		return
+	}
+
+	var cmd lightCommand
+	if err := json.Unmarshal(msg.Payload(), &cmd); err != nil {
+		b.logf("Ignoring invalid command for light %s: %v", id, err)
+		return
+	}
+
+	req, err := cmd.request()
+	if err != nil {
+		b.logf("Ignoring invalid command for light %s: %v", id, err)
+		return
+	}
+
+	req, _, err = hue.ValidateLightState(&light, req, hue.Convert)
+	if err != nil {
+		b.logf("Ignoring invalid command for light %s: %v", id, err)
+		return
+	}
+
+	res, err := b.client.SetLightState(id, req)
+	if err != nil {
+		b.logf("Unable to update light %s: %v", id, err)
+		return
+	}
+	if err = res.Err(); err != nil {
+		b.logf("Light %s was partially updated: %v", id, err)
+	}
+
+	updated, err := b.client.Light(id)
+	if err != nil {
+		b.logf("Unable to fetch light %s: %v", id, err)
+		return
+	}
+
+	b.mu.Lock()
+	b.lights[id] = *updated
+	b.mu.Unlock()
+
+	b.publishLight(updated)
+}
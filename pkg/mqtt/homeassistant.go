@@ -0,0 +1,287 @@
+package mqtt
+
+import (
+	"math"
+
+	"github.com/skwair/huectl/pkg/hue"
+)
+
+// Color modes of Home Assistant lights.
+const (
+	colorModeOnOff      = "onoff"
+	colorModeBrightness = "brightness"
+	colorModeColorTemp  = "color_temp"
+	colorModeXY         = "xy"
+)
+
+// lightState is the state of a light, as expected by Home Assistant JSON
+// schema lights.
+type lightState struct {
+	State      string  `json:"state"`
+	ColorMode  string  `json:"color_mode"`
+	Brightness *int    `json:"brightness,omitempty"`
+	ColorTemp  *int    `json:"color_temp,omitempty"`
+	Color      *xyJSON `json:"color,omitempty"`
+}
+
+type xyJSON struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+func newLightState(l *hue.Light) *lightState {
+	state := lightState{State: "OFF", ColorMode: lightColorMode(l)}
+	if l.State.On {
+		state.State = "ON"
+	}
+
+	if l.IsDimmable() {
+		bri := l.State.Bri
+		state.Brightness = &bri
+	}
+
+	if l.SupportsColorTemperature() {
+		ct := l.State.CT
+		state.ColorTemp = &ct
+	}
+
+	if l.SupportsColor() {
+		state.Color = &xyJSON{X: l.State.XY[0], Y: l.State.XY[1]}
+	}
+
+	return &state
+}
+
+// lightColorMode returns the color mode the light is currently in.
+func lightColorMode(l *hue.Light) string {
+	switch {
+	case l.State.ColorMode == "ct" && l.SupportsColorTemperature():
+		return colorModeColorTemp
+	case l.SupportsColor():
+		// Lights in hs mode also report their color as xy.
+		return colorModeXY
+	case l.SupportsColorTemperature():
+		return colorModeColorTemp
+	case l.IsDimmable():
+		return colorModeBrightness
+	default:
+		return colorModeOnOff
+	}
+}
+
+// supportedColorModes returns the color modes supported by the light.
+func supportedColorModes(l *hue.Light) []string {
+	var modes []string
+	if l.SupportsColorTemperature() {
+		modes = append(modes, colorModeColorTemp)
+	}
+	if l.SupportsColor() {
+		modes = append(modes, colorModeXY)
+	}
+
+	switch {
+	case len(modes) > 0:
+		return modes
+	case l.IsDimmable():
+		return []string{colorModeBrightness}
+	default:
+		return []string{colorModeOnOff}
+	}
+}
+
+// sensorState is the state of a sensor, with only the fields it reports.
+type sensorState struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	Illuminance *float64 `json:"illuminance,omitempty"`
+	Presence    *bool    `json:"presence,omitempty"`
+	Battery     *int     `json:"battery,omitempty"`
+}
+
+func newSensorState(s *hue.Sensor, withBattery bool) *sensorState {
+	var state sensorState
+
+	if t, ok := s.TemperatureCelsius(); ok {
+		state.Temperature = &t
+	}
+
+	if lux, ok := s.LightLevelLux(); ok {
+		lux = math.Round(lux*10) / 10
+		state.Illuminance = &lux
+	}
+
+	state.Presence = s.State.Presence
+
+	if withBattery {
+		state.Battery = s.Config.Battery
+	}
+
+	return &state
+}
+
+func (s *sensorState) empty() bool {
+	return s.Temperature == nil && s.Illuminance == nil && s.Presence == nil && s.Battery == nil
+}
+
+// device describes the physical device an entity belongs to, so Home
+// Assistant can group entities, e.g. the different parts of a motion sensor.
+type device struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Model        string   `json:"model,omitempty"`
+	Manufacturer string   `json:"manufacturer,omitempty"`
+	SWVersion    string   `json:"sw_version,omitempty"`
+}
+
+type availability struct {
+	Topic string `json:"topic"`
+}
+
+// lightConfig is the discovery config of a Home Assistant JSON schema light.
+type lightConfig struct {
+	Name                string         `json:"name"`
+	UniqueID            string         `json:"unique_id"`
+	Schema              string         `json:"schema"`
+	StateTopic          string         `json:"state_topic"`
+	CommandTopic        string         `json:"command_topic"`
+	Availability        []availability `json:"availability"`
+	AvailabilityMode    string         `json:"availability_mode"`
+	Brightness          bool           `json:"brightness"`
+	BrightnessScale     int            `json:"brightness_scale,omitempty"`
+	ColorMode           bool           `json:"color_mode"`
+	SupportedColorModes []string       `json:"supported_color_modes"`
+	MinMireds           int            `json:"min_mireds,omitempty"`
+	MaxMireds           int            `json:"max_mireds,omitempty"`
+	Flash               bool           `json:"flash"`
+	Effect              bool           `json:"effect,omitempty"`
+	EffectList          []string       `json:"effect_list,omitempty"`
+	Device              device         `json:"device"`
+}
+
+// lightDiscovery returns the discovery topic and config of a light.
+func (b *Bridge) lightDiscovery(l *hue.Light) (string, interface{}) {
+	objectID := "light_" + l.ID
+
+	cfg := lightConfig{
+		Name:         l.Name,
+		UniqueID:     b.uniqueID(l.UniqueID, objectID),
+		Schema:       "json",
+		StateTopic:   b.lightTopic(l.ID) + "/state",
+		CommandTopic: b.lightTopic(l.ID) + "/set",
+		Availability: []availability{
+			{Topic: b.statusTopic()},
+			{Topic: b.lightTopic(l.ID) + "/availability"},
+		},
+		AvailabilityMode:    "all",
+		Brightness:          l.IsDimmable(),
+		ColorMode:           true,
+		SupportedColorModes: supportedColorModes(l),
+		Flash:               true,
+		Device:              b.device(l.UniqueID, objectID, l.Name, l.ModelID, l.ManufacturerName, l.SoftWareVersion),
+	}
+
+	if cfg.Brightness {
+		cfg.BrightnessScale = 254
+	}
+
+	if l.SupportsColorTemperature() {
+		cfg.MinMireds, cfg.MaxMireds = l.Capabilities.Control.Ct.Min, l.Capabilities.Control.Ct.Max
+	}
+
+	if l.SupportsColor() {
+		cfg.Effect = true
+		cfg.EffectList = []string{"colorloop", "none"}
+	}
+
+	return b.discoveryTopic("light", objectID), &cfg
+}
+
+// sensorConfig is the discovery config of a Home Assistant sensor or binary
+// sensor.
+type sensorConfig struct {
+	Name              string         `json:"name"`
+	UniqueID          string         `json:"unique_id"`
+	StateTopic        string         `json:"state_topic"`
+	ValueTemplate     string         `json:"value_template"`
+	DeviceClass       string         `json:"device_class"`
+	UnitOfMeasurement string         `json:"unit_of_measurement,omitempty"`
+	StateClass        string         `json:"state_class,omitempty"`
+	Availability      []availability `json:"availability"`
+	Device            device         `json:"device"`
+}
+
+type discovery struct {
+	topic  string
+	config interface{}
+}
+
+// sensorDiscovery returns the discovery topics and configs of a sensor, one
+// per value it reports.
+func (b *Bridge) sensorDiscovery(s *hue.Sensor, state *sensorState) []discovery {
+	var res []discovery
+
+	add := func(component, attr, name, class, unit, template string) {
+		objectID := "sensor_" + s.ID + "_" + attr
+
+		cfg := sensorConfig{
+			Name:              s.Name + " " + name,
+			UniqueID:          b.uniqueID(s.UniqueID+"-"+attr, objectID),
+			StateTopic:        b.sensorTopic(s.ID) + "/state",
+			ValueTemplate:     template,
+			DeviceClass:       class,
+			UnitOfMeasurement: unit,
+			Availability:      []availability{{Topic: b.statusTopic()}},
+			Device:            b.device(s.UniqueID, objectID, s.Name, s.ModelID, s.ManufacturerName, s.SoftWareVersion),
+		}
+		if component == "sensor" {
+			cfg.StateClass = "measurement"
+		}
+
+		res = append(res, discovery{topic: b.discoveryTopic(component, objectID), config: &cfg})
+	}
+
+	if state.Temperature != nil {
+		add("sensor", "temperature", "temperature", "temperature", "°C", "{{ value_json.temperature }}")
+	}
+	if state.Illuminance != nil {
+		add("sensor", "illuminance", "illuminance", "illuminance", "lx", "{{ value_json.illuminance }}")
+	}
+	if state.Presence != nil {
+		add("binary_sensor", "presence", "motion", "motion", "", "{{ 'ON' if value_json.presence else 'OFF' }}")
+	}
+	if state.Battery != nil {
+		add("sensor", "battery", "battery", "battery", "%", "{{ value_json.battery }}")
+	}
+
+	return res
+}
+
+// discoveryTopic returns the topic of the discovery config of an entity,
+// <discovery prefix>/<component>/<node ID>/<object ID>/config.
+func (b *Bridge) discoveryTopic(component, objectID string) string {
+	return b.discoveryPrefix + "/" + component + "/huectl_" + b.bridgeID + "/" + objectID + "/config"
+}
+
+// uniqueID returns a unique ID for an entity, based on the unique ID of the
+// device if it has one so it survives the device being re-paired.
+func (b *Bridge) uniqueID(deviceUniqueID, objectID string) string {
+	if deviceUniqueID != "" {
+		return "huectl_" + deviceUniqueID
+	}
+
+	return "huectl_" + b.bridgeID + "_" + objectID
+}
+
+func (b *Bridge) device(uniqueID, objectID, name, model, manufacturer, swVersion string) device {
+	id := "huectl_" + b.bridgeID + "_" + objectID
+	if uniqueID != "" {
+		id = "huectl_" + deviceID(uniqueID)
+	}
+
+	return device{
+		Identifiers:  []string{id},
+		Name:         name,
+		Model:        model,
+		Manufacturer: manufacturer,
+		SWVersion:    swVersion,
+	}
+}
@@ -0,0 +1,360 @@
+// Package mqtt bridges a Hue bridge to an MQTT broker: the state of lights
+// and sensors is published to MQTT topics, lights can be controlled through
+// command topics, and Home Assistant MQTT discovery configs are published so
+// they show up in Home Assistant automatically.
+//
+// Topics are rooted at <prefix>/<bridge ID>:
+//
+//	<root>/status                   "online" or "offline" (retained, last will)
+//	<root>/light/<id>/state         state of a light (retained)
+//	<root>/light/<id>/availability  "offline" when unreachable (retained)
+//	<root>/light/<id>/set           commands for a light
+//	<root>/sensor/<id>/state        state of a sensor (retained)
+//
+// Light states and commands use the JSON schema of Home Assistant MQTT lights.
+package mqtt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/skwair/huectl/pkg/hue"
+)
+
+// Defaults used when no option is given to New.
+const (
+	DefaultPrefix          = "huectl"
+	DefaultDiscoveryPrefix = "homeassistant"
+	DefaultInterval        = 5 * time.Second
+)
+
+const (
+	payloadOnline  = "online"
+	payloadOffline = "offline"
+
+	// Home Assistant uses QoS 1 for discovery and commands; retained states
+	// are published with it too so they are not lost on reconnection.
+	qos = 1
+
+	publishTimeout = 10 * time.Second
+)
+
+// Bridge publishes the state of a Hue bridge to MQTT and applies the commands
+// it receives. Create one with New and start it with Run.
+type Bridge struct {
+	client   *hue.Client
+	bridgeID string
+
+	prefix          string
+	discoveryPrefix string
+	discovery       bool
+	interval        time.Duration
+	logger          *log.Logger
+
+	mqtt paho.Client
+
+	mu     sync.Mutex
+	lights map[string]hue.Light
+	// published holds the last payload published on each state topic, so
+	// states are only published when they change.
+	published map[string][]byte
+	// announced holds the discovery topics already published.
+	announced map[string]bool
+}
+
+// Option allows to customize a Bridge.
+type Option func(*Bridge)
+
+// WithPrefix sets the prefix of the topics the bridge publishes to and
+// subscribes to, DefaultPrefix if not set.
+func WithPrefix(prefix string) Option {
+	return func(b *Bridge) {
+		if prefix != "" {
+			b.prefix = strings.TrimSuffix(prefix, "/")
+		}
+	}
+}
+
+// WithDiscoveryPrefix sets the prefix of Home Assistant discovery topics,
+// DefaultDiscoveryPrefix if not set.
+func WithDiscoveryPrefix(prefix string) Option {
+	return func(b *Bridge) {
+		if prefix != "" {
+			b.discoveryPrefix = strings.TrimSuffix(prefix, "/")
+		}
+	}
+}
+
+// WithoutDiscovery disables publishing Home Assistant discovery configs.
+func WithoutDiscovery() Option {
+	return func(b *Bridge) {
+		b.discovery = false
+	}
+}
+
+// WithInterval sets how often the state of lights and sensors is polled from
+// the Hue bridge, DefaultInterval if not set.
+func WithInterval(d time.Duration) Option {
+	return func(b *Bridge) {
+		if d > 0 {
+			b.interval = d
+		}
+	}
+}
+
+// WithLogger sets the logger used to report errors and commands. Nothing is
+// logged by default.
+func WithLogger(l *log.Logger) Option {
+	return func(b *Bridge) {
+		b.logger = l
+	}
+}
+
+// New returns a new MQTT bridge for the Hue bridge with the given ID,
+// controlled through the given client.
+func New(client *hue.Client, bridgeID string, opts ...Option) *Bridge {
+	b := &Bridge{
+		client:          client,
+		bridgeID:        strings.ToLower(bridgeID),
+		prefix:          DefaultPrefix,
+		discoveryPrefix: DefaultDiscoveryPrefix,
+		discovery:       true,
+		interval:        DefaultInterval,
+		lights:          make(map[string]hue.Light),
+		published:       make(map[string][]byte),
+		announced:       make(map[string]bool),
+	}
+
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	return b
+}
+
+// Run connects to the MQTT broker with the given options and publishes the
+// state of the Hue bridge until the context is canceled. The last will of the
+// connection and its connection handler are set by Run: on every
+// (re)connection, the bridge subscribes to command topics and publishes
+// discovery configs and states again.
+func (b *Bridge) Run(ctx context.Context, opts *paho.ClientOptions) error {
+	opts.SetWill(b.statusTopic(), payloadOffline, qos, true)
+	opts.SetOnConnectHandler(b.onConnect)
+	// Commands are handled concurrently, handlers would block each other
+	// while waiting for the Hue bridge otherwise.
+	opts.SetOrderMatters(false)
+
+	b.mqtt = paho.NewClient(opts)
+	if err := wait(b.mqtt.Connect()); err != nil {
+		return fmt.Errorf("unable to connect to MQTT broker: %w", err)
+	}
+
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			// The last will is only sent on unexpected disconnections.
+			_ = wait(b.mqtt.Publish(b.statusTopic(), qos, true, payloadOffline))
+			b.mqtt.Disconnect(250)
+			return ctx.Err()
+		case <-ticker.C:
+			b.poll()
+		}
+	}
+}
+
+func (b *Bridge) onConnect(c paho.Client) {
+	// The broker may have lost retained messages, publish everything again.
+	b.mu.Lock()
+	b.published = make(map[string][]byte)
+	b.announced = make(map[string]bool)
+	b.mu.Unlock()
+
+	topic := b.root() + "/light/+/set"
+	if err := wait(c.Subscribe(topic, qos, b.handleCommand)); err != nil {
+		b.logf("Unable to subscribe to %s: %v", topic, err)
+	}
+
+	if err := wait(c.Publish(b.statusTopic(), qos, true, payloadOnline)); err != nil {
+		b.logf("Unable to publish status: %v", err)
+	}
+
+	b.poll()
+}
+
+// poll fetches the state of lights and sensors and publishes what changed.
+func (b *Bridge) poll() {
+	lights, err := b.client.Lights()
+	if err != nil {
+		b.logf("Unable to fetch lights: %v", err)
+		return
+	}
+
+	sensors, err := b.client.Sensors()
+	if err != nil {
+		b.logf("Unable to fetch sensors: %v", err)
+		return
+	}
+
+	b.mu.Lock()
+	b.lights = make(map[string]hue.Light, len(lights))
+	for _, l := range lights {
+		b.lights[l.ID] = l
+	}
+	b.mu.Unlock()
+
+	for i := range lights {
+		b.publishLight(&lights[i])
+	}
+
+	// Sort sensors so the battery of a device is always exposed by the same one.
+	sort.Slice(sensors, func(i, j int) bool { return hue.LessID(sensors[i].ID, sensors[j].ID) })
+
+	batteries := make(map[string]bool)
+	for i := range sensors {
+		s := &sensors[i]
+		// Sensors without unique ID are virtual (e.g. daylight), skip them.
+		if s.UniqueID == "" {
+			continue
+		}
+
+		// Motion sensors are made of several sensors reporting the same
+		// battery, only expose it once per device.
+		device := deviceID(s.UniqueID)
+		withBattery := s.Config.Battery != nil && !batteries[device]
+		if withBattery {
+			batteries[device] = true
+		}
+
+		b.publishSensor(s, withBattery)
+	}
+}
+
+func (b *Bridge) publishLight(l *hue.Light) {
+	if b.discovery {
+		b.announce(b.lightDiscovery(l))
+	}
+
+	availability := payloadOffline
+	if l.State.Reachable {
+		availability = payloadOnline
+	}
+
+	b.publishState(b.lightTopic(l.ID)+"/availability", []byte(availability))
+	b.publishJSON(b.lightTopic(l.ID)+"/state", newLightState(l))
+}
+
+func (b *Bridge) publishSensor(s *hue.Sensor, withBattery bool) {
+	state := newSensorState(s, withBattery)
+	if state.empty() {
+		return
+	}
+
+	if b.discovery {
+		for _, d := range b.sensorDiscovery(s, state) {
+			b.announce(d.topic, d.config)
+		}
+	}
+
+	b.publishJSON(b.sensorTopic(s.ID)+"/state", state)
+}
+
+// publishState publishes a retained state, unless it did not change since it
+// was last published.
+func (b *Bridge) publishState(topic string, payload []byte) {
+	b.mu.Lock()
+	unchanged := bytes.Equal(b.published[topic], payload)
+	b.mu.Unlock()
+	if unchanged {
+		return
+	}
+
+	if err := wait(b.mqtt.Publish(topic, qos, true, payload)); err != nil {
+		b.logf("Unable to publish to %s: %v", topic, err)
+		return
+	}
+
+	b.mu.Lock()
+	b.published[topic] = payload
+	b.mu.Unlock()
+}
+
+// publishJSON is like publishState, for states encoded as JSON.
+func (b *Bridge) publishJSON(topic string, v interface{}) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		b.logf("Unable to encode state for %s: %v", topic, err)
+		return
+	}
+
+	b.publishState(topic, payload)
+}
+
+// announce publishes a retained discovery config, once per connection.
+func (b *Bridge) announce(topic string, config interface{}) {
+	b.mu.Lock()
+	done := b.announced[topic]
+	b.mu.Unlock()
+	if done {
+		return
+	}
+
+	payload, err := json.Marshal(config)
+	if err != nil {
+		b.logf("Unable to encode discovery config for %s: %v", topic, err)
+		return
+	}
+
+	if err = wait(b.mqtt.Publish(topic, qos, true, payload)); err != nil {
+		b.logf("Unable to publish to %s: %v", topic, err)
+		return
+	}
+
+	b.mu.Lock()
+	b.announced[topic] = true
+	b.mu.Unlock()
+}
+
+func (b *Bridge) root() string { return b.prefix + "/" + b.bridgeID }
+
+func (b *Bridge) statusTopic() string { return b.root() + "/status" }
+
+func (b *Bridge) lightTopic(id string) string { return b.root() + "/light/" + id }
+
+func (b *Bridge) sensorTopic(id string) string { return b.root() + "/sensor/" + id }
+
+func (b *Bridge) logf(format string, v ...interface{}) {
+	if b.logger != nil {
+		b.logger.Printf(format, v...)
+	}
+}
+
+// wait waits for an MQTT operation to complete and returns its error.
+func wait(t paho.Token) error {
+	if !t.WaitTimeout(publishTimeout) {
+		return fmt.Errorf("timed out after %s", publishTimeout)
+	}
+
+	return t.Error()
+}
+
+// deviceID returns the ID of the physical device a light or a sensor belongs
+// to from its unique ID, which is made of the MAC address of the device
+// followed by an endpoint, e.g. 00:17:88:01:02:03:04:05-02-0406.
+func deviceID(uniqueID string) string {
+	if i := strings.Index(uniqueID, "-"); i > 0 {
+		return uniqueID[:i]
+	}
+
+	return uniqueID
+}
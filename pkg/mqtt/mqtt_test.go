@@ -0,0 +1,441 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/skwair/huectl/pkg/hue"
+	"github.com/skwair/huectl/pkg/hue/huetest"
+)
+
+// stubClient is an MQTT client recording what is published and subscribed
+// to, without a broker. Methods not used by Bridge are left unimplemented.
+type stubClient struct {
+	paho.Client
+
+	mu        sync.Mutex
+	published map[string]string
+	retained  map[string]bool
+	count     int
+	handlers  map[string]paho.MessageHandler
+}
+
+func newStubClient() *stubClient {
+	return &stubClient{
+		published: make(map[string]string),
+		retained:  make(map[string]bool),
+		handlers:  make(map[string]paho.MessageHandler),
+	}
+}
+
+func (c *stubClient) Publish(topic string, _ byte, retained bool, payload interface{}) paho.Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch p := payload.(type) {
+	case string:
+		c.published[topic] = p
+	case []byte:
+		c.published[topic] = string(p)
+	}
+	c.retained[topic] = retained
+	c.count++
+
+	return doneToken{}
+}
+
+func (c *stubClient) Subscribe(topic string, _ byte, callback paho.MessageHandler) paho.Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.handlers[topic] = callback
+
+	return doneToken{}
+}
+
+// reset forgets what was published so far.
+func (c *stubClient) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.published = make(map[string]string)
+	c.count = 0
+}
+
+// payload unmarshals the payload last published on the given topic.
+func (c *stubClient) payload(t *testing.T, topic string) map[string]interface{} {
+	t.Helper()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	raw, ok := c.published[topic]
+	if !ok {
+		t.Fatalf("nothing published on %s", topic)
+	}
+
+	var v map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &v); err != nil {
+		t.Fatalf("invalid JSON published on %s: %v", topic, err)
+	}
+
+	return v
+}
+
+type doneToken struct{}
+
+func (doneToken) Wait() bool                     { return true }
+func (doneToken) WaitTimeout(time.Duration) bool { return true }
+func (doneToken) Error() error                   { return nil }
+func (doneToken) Done() <-chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}
+
+type stubMessage struct {
+	paho.Message
+
+	topic   string
+	payload []byte
+}
+
+func (m stubMessage) Topic() string   { return m.topic }
+func (m stubMessage) Payload() []byte { return m.payload }
+
+func intPtr(i int) *int    { return &i }
+func boolPtr(b bool) *bool { return &b }
+
+// newTestBridge returns a fake Hue bridge with a light of each kind and a
+// motion sensor, and an MQTT bridge connected to it through a stub client.
+func newTestBridge() (*huetest.Bridge, *Bridge, *stubClient) {
+	hb := huetest.NewBridge()
+	hb.AddLight(hue.Light{
+		ID:       "1",
+		Name:     "Desk",
+		Type:     hue.LightTypeExtendedColor,
+		UniqueID: "00:17:88:01:00:00:00:01-0b",
+		ModelID:  "LCT015",
+		State:    hue.LightState{On: true, Bri: 200, CT: 366, XY: [2]float64{0.4, 0.4}, ColorMode: "ct", Reachable: true},
+		Capabilities: hue.LightCapabilities{
+			Control: hue.LightCapabilitiesControl{ColorGamutType: "C", Ct: hue.LightCapabilitiesControlCt{Min: 153, Max: 500}},
+		},
+	})
+	hb.AddLight(hue.Light{
+		ID:    "2",
+		Name:  "Lamp",
+		Type:  hue.LightTypeDimmable,
+		State: hue.LightState{Bri: 100, Reachable: true},
+	})
+	hb.AddLight(hue.Light{
+		ID:   "10",
+		Name: "Plug",
+		Type: hue.LightTypeOnOffPlug,
+	})
+
+	// A motion sensor is made of several sensors of the same device.
+	hb.AddSensor(hue.Sensor{
+		ID:       "4",
+		Name:     "Hallway",
+		Type:     hue.SensorTypePresence,
+		UniqueID: "00:17:88:01:00:00:00:02-02-0406",
+		State:    hue.SensorState{Presence: boolPtr(true)},
+		Config:   hue.SensorConfig{Battery: intPtr(80)},
+	})
+	hb.AddSensor(hue.Sensor{
+		ID:       "5",
+		Name:     "Hallway",
+		Type:     hue.SensorTypeTemperature,
+		UniqueID: "00:17:88:01:00:00:00:02-02-0402",
+		State:    hue.SensorState{Temperature: intPtr(2150)},
+		Config:   hue.SensorConfig{Battery: intPtr(80)},
+	})
+	hb.AddSensor(hue.Sensor{
+		ID:    "1",
+		Name:  "Daylight",
+		Type:  hue.SensorTypeDaylight,
+		State: hue.SensorState{Daylight: boolPtr(true)},
+	})
+
+	stub := newStubClient()
+	b := New(hb.Client(), "001788FFFE000000")
+	b.mqtt = stub
+
+	return hb, b, stub
+}
+
+func TestLightCommandRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    string
+		wantErr bool
+	}{
+		{name: "on", payload: `{"state":"ON"}`, want: `{"on":true}`},
+		{name: "off lower case", payload: `{"state":"off"}`, want: `{"on":false}`},
+		{name: "brightness", payload: `{"state":"ON","brightness":128}`, want: `{"on":true,"bri":128}`},
+		{name: "zero brightness", payload: `{"brightness":0}`, want: `{"bri":1}`},
+		{name: "color temperature", payload: `{"color_temp":250}`, want: `{"ct":250}`},
+		{name: "color", payload: `{"color":{"x":0.5,"y":0.25}}`, want: `{"xy":[0.5,0.25]}`},
+		{name: "transition", payload: `{"transition":1.26}`, want: `{"transitiontime":13}`},
+		{name: "short flash", payload: `{"flash":"short"}`, want: `{"alert":"select"}`},
+		{name: "long flash", payload: `{"flash":"long"}`, want: `{"alert":"lselect"}`},
+		{name: "effect", payload: `{"effect":"colorloop"}`, want: `{"effect":"colorloop"}`},
+		{name: "empty", payload: `{}`, want: `{}`},
+		{name: "invalid state", payload: `{"state":"TOGGLE"}`, wantErr: true},
+		{name: "invalid flash", payload: `{"flash":"forever"}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cmd lightCommand
+			if err := json.Unmarshal([]byte(tt.payload), &cmd); err != nil {
+				t.Fatalf("invalid payload: %v", err)
+			}
+
+			req, err := cmd.request()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			got, err := json.Marshal(req)
+			if err != nil {
+				t.Fatalf("unable to encode request: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestLightDiscovery(t *testing.T) {
+	tests := []struct {
+		light  string
+		object string
+		want   map[string]interface{}
+	}{
+		{
+			light:  "1",
+			object: "light_1",
+			want: map[string]interface{}{
+				"name":                  "Desk",
+				"unique_id":             "huectl_00:17:88:01:00:00:00:01-0b",
+				"schema":                "json",
+				"state_topic":           "huectl/001788fffe000000/light/1/state",
+				"command_topic":         "huectl/001788fffe000000/light/1/set",
+				"brightness":            true,
+				"brightness_scale":      254.0,
+				"supported_color_modes": []interface{}{"color_temp", "xy"},
+				"min_mireds":            153.0,
+				"max_mireds":            500.0,
+				"effect":                true,
+				"effect_list":           []interface{}{"colorloop", "none"},
+			},
+		},
+		{
+			light:  "2",
+			object: "light_2",
+			want: map[string]interface{}{
+				"name":                  "Lamp",
+				"unique_id":             "huectl_001788fffe000000_light_2",
+				"brightness":            true,
+				"brightness_scale":      254.0,
+				"supported_color_modes": []interface{}{"brightness"},
+			},
+		},
+		{
+			light:  "10",
+			object: "light_10",
+			want: map[string]interface{}{
+				"name":                  "Plug",
+				"brightness":            false,
+				"supported_color_modes": []interface{}{"onoff"},
+			},
+		},
+	}
+
+	hb, b, stub := newTestBridge()
+	defer hb.Close()
+
+	b.onConnect(stub)
+
+	for _, tt := range tests {
+		t.Run(tt.light, func(t *testing.T) {
+			cfg := stub.payload(t, "homeassistant/light/huectl_001788fffe000000/"+tt.object+"/config")
+			for attr, want := range tt.want {
+				if got := cfg[attr]; !reflect.DeepEqual(got, want) {
+					t.Errorf("expected %s to be %v, got %v", attr, want, got)
+				}
+			}
+
+			// Attributes not supported by the light are omitted.
+			for _, attr := range []string{"brightness_scale", "min_mireds", "max_mireds", "effect", "effect_list"} {
+				if _, ok := tt.want[attr]; !ok {
+					if v, ok := cfg[attr]; ok {
+						t.Errorf("expected no %s, got %v", attr, v)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSensorDiscovery(t *testing.T) {
+	hb, b, stub := newTestBridge()
+	defer hb.Close()
+
+	b.onConnect(stub)
+
+	var topics []string
+	for topic := range stub.published {
+		if strings.HasPrefix(topic, "homeassistant/") && !strings.Contains(topic, "/light/") {
+			topics = append(topics, topic)
+		}
+	}
+	sort.Strings(topics)
+
+	// The battery of the motion sensor is only exposed once, and the
+	// daylight sensor is virtual.
+	want := []string{
+		"homeassistant/binary_sensor/huectl_001788fffe000000/sensor_4_presence/config",
+		"homeassistant/sensor/huectl_001788fffe000000/sensor_4_battery/config",
+		"homeassistant/sensor/huectl_001788fffe000000/sensor_5_temperature/config",
+	}
+	if !reflect.DeepEqual(topics, want) {
+		t.Fatalf("expected discovery topics %v, got %v", want, topics)
+	}
+
+	temp := stub.payload(t, want[2])
+	for attr, v := range map[string]interface{}{
+		"name":                "Hallway temperature",
+		"unique_id":           "huectl_00:17:88:01:00:00:00:02-02-0402-temperature",
+		"state_topic":         "huectl/001788fffe000000/sensor/5/state",
+		"device_class":        "temperature",
+		"unit_of_measurement": "°C",
+		"state_class":         "measurement",
+	} {
+		if got := temp[attr]; got != v {
+			t.Errorf("expected %s to be %v, got %v", attr, v, got)
+		}
+	}
+
+	// Entities of the same physical device share its identifier.
+	for _, topic := range want {
+		dev := stub.payload(t, topic)["device"].(map[string]interface{})
+		if ids := dev["identifiers"].([]interface{}); len(ids) != 1 || ids[0] != "huectl_00:17:88:01:00:00:00:02" {
+			t.Errorf("unexpected device identifiers %v for %s", ids, topic)
+		}
+	}
+
+	if state := stub.payload(t, "huectl/001788fffe000000/sensor/5/state"); state["temperature"] != 21.5 {
+		t.Errorf("expected a temperature of 21.5, got %v", state["temperature"])
+	}
+}
+
+func TestStates(t *testing.T) {
+	hb, b, stub := newTestBridge()
+	defer hb.Close()
+
+	b.onConnect(stub)
+
+	if got := stub.published["huectl/001788fffe000000/status"]; got != payloadOnline || !stub.retained["huectl/001788fffe000000/status"] {
+		t.Errorf("expected a retained online status, got %q", got)
+	}
+	if got := stub.published["huectl/001788fffe000000/light/10/availability"]; got != payloadOffline {
+		t.Errorf("expected the unreachable light to be offline, got %q", got)
+	}
+
+	tests := []struct {
+		light string
+		want  string
+	}{
+		{light: "1", want: `{"state":"ON","color_mode":"color_temp","brightness":200,"color_temp":366,"color":{"x":0.4,"y":0.4}}`},
+		{light: "2", want: `{"state":"OFF","color_mode":"brightness","brightness":100}`},
+		{light: "10", want: `{"state":"OFF","color_mode":"onoff"}`},
+	}
+	for _, tt := range tests {
+		if got := stub.published["huectl/001788fffe000000/light/"+tt.light+"/state"]; got != tt.want {
+			t.Errorf("expected state of light %s to be %s, got %s", tt.light, tt.want, got)
+		}
+	}
+
+	// Nothing changed, nothing is published again.
+	stub.reset()
+	b.poll()
+	if stub.count != 0 {
+		t.Errorf("expected nothing to be published, got %v", stub.published)
+	}
+}
+
+func TestHandleCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		light   string
+		payload string
+		want    hue.LightState
+	}{
+		{
+			name:    "turn on",
+			light:   "2",
+			payload: `{"state":"ON","brightness":42}`,
+			want:    hue.LightState{On: true, Bri: 42, Reachable: true},
+		},
+		{
+			name:    "color temperature clamped",
+			light:   "1",
+			payload: `{"color_temp":1000}`,
+			want:    hue.LightState{On: true, Bri: 200, CT: 500, XY: [2]float64{0.4, 0.4}, ColorMode: "ct", Reachable: true},
+		},
+		{
+			name:    "invalid command ignored",
+			light:   "2",
+			payload: `{"state":"TOGGLE"}`,
+			want:    hue.LightState{Bri: 100, Reachable: true},
+		},
+		{
+			name:    "invalid JSON ignored",
+			light:   "2",
+			payload: `{"state":`,
+			want:    hue.LightState{Bri: 100, Reachable: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hb, b, stub := newTestBridge()
+			defer hb.Close()
+
+			b.onConnect(stub)
+			stub.reset()
+
+			handler := stub.handlers["huectl/001788fffe000000/light/+/set"]
+			if handler == nil {
+				t.Fatal("not subscribed to commands")
+			}
+			topic := "huectl/001788fffe000000/light/" + tt.light
+			handler(stub, stubMessage{topic: topic + "/set", payload: []byte(tt.payload)})
+
+			if got := hb.Light(tt.light).State; got != tt.want {
+				t.Errorf("expected state %+v, got %+v", tt.want, got)
+			}
+
+			_, published := stub.published[topic+"/state"]
+			if changed := tt.want != (hue.LightState{Bri: 100, Reachable: true}); published != changed {
+				t.Errorf("expected the state to be published: %t, got %t", changed, published)
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package music
+
+import (
+	"math"
+	"math/cmplx"
+	"time"
+)
+
+// Features describe a short window of audio. Levels go from 0 to 1, relative
+// to the loudest recent windows so quiet and loud music both use the whole
+// range.
+type Features struct {
+	// Time is the start of the window since the start of the audio.
+	Time time.Duration
+	// Level is the overall loudness.
+	Level float64
+	// Bass, Mid and Treble are the loudness of low (up to 250Hz), medium (up
+	// to 4kHz) and high frequencies.
+	Bass, Mid, Treble float64
+	// Beat is set when the window starts a beat, detected as a sudden rise of
+	// low frequencies.
+	Beat bool
+}
+
+// Analyzer extracts features from windows of audio. Create one with
+// NewAnalyzer.
+type Analyzer struct {
+	sampleRate  int
+	size        int
+	window      []float64
+	sensitivity float64
+
+	samples int
+
+	level, bass, mid, treble gain
+
+	// history holds the bass energy of recent windows, to detect beats.
+	history  []float64
+	next     int
+	lastBeat time.Duration
+}
+
+// gain normalizes a value by the highest recent value, which decays slowly so
+// the level adapts when music gets quieter.
+type gain struct {
+	peak float64
+}
+
+// gainDecay is applied to peaks at every window, halving them in about 4s.
+const gainDecay = 0.996
+
+// silence is the energy below which audio is considered silent, so noise is
+// not amplified.
+const silence = 1e-4
+
+func (g *gain) normalize(v float64) float64 {
+	g.peak = math.Max(v, g.peak*gainDecay)
+	if g.peak < silence {
+		return 0
+	}
+
+	return v / g.peak
+}
+
+// Beat detection parameters.
+const (
+	// minBeatInterval is the time between two beats at 240 BPM, the fastest
+	// tempo detected.
+	minBeatInterval = 250 * time.Millisecond
+	// historyDuration is the duration of the bass history used to compute
+	// the average energy beats are compared to.
+	historyDuration = time.Second
+)
+
+// DefaultSensitivity is how much the bass energy of a window must exceed the
+// average of the last second to be a beat.
+const DefaultSensitivity = 1.4
+
+// NewAnalyzer returns an analyzer of audio sampled at the given rate. The
+// sensitivity is the ratio to the recent average energy of low frequencies
+// above which a beat is detected, DefaultSensitivity if 0: lower it to
+// detect more beats.
+func NewAnalyzer(sampleRate int, sensitivity float64) *Analyzer {
+	if sensitivity <= 0 {
+		sensitivity = DefaultSensitivity
+	}
+
+	// Windows of about 23ms, as a power of 2 for the FFT: 1024 samples at
+	// 44.1kHz.
+	size := 1
+	for size < sampleRate/43 {
+		size *= 2
+	}
+
+	window := make([]float64, size)
+	for i := range window {
+		// Hann window, reducing the leakage of frequencies between bins.
+		window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(size-1))
+	}
+
+	windowDuration := time.Duration(size) * time.Second / time.Duration(sampleRate)
+
+	return &Analyzer{
+		sampleRate:  sampleRate,
+		size:        size,
+		window:      window,
+		sensitivity: sensitivity,
+		history:     make([]float64, int(historyDuration/windowDuration)),
+		lastBeat:    -minBeatInterval,
+	}
+}
+
+// WindowSize returns the number of samples expected by Analyze.
+func (a *Analyzer) WindowSize() int { return a.size }
+
+// Analyze returns the features of the given window of samples, which must hold
+// WindowSize samples. Windows must be given in order.
+func (a *Analyzer) Analyze(samples []float64) Features {
+	f := Features{Time: time.Duration(a.samples) * time.Second / time.Duration(a.sampleRate)}
+	a.samples += len(samples)
+
+	var sum float64
+	bins := make([]complex128, a.size)
+	for i, s := range samples {
+		sum += s * s
+		bins[i] = complex(s*a.window[i], 0)
+	}
+	rms := math.Sqrt(sum / float64(len(samples)))
+
+	fft(bins)
+
+	// Only the first half of the bins are meaningful for real samples.
+	binWidth := float64(a.sampleRate) / float64(a.size)
+	var bass, mid, treble float64
+	for i := 1; i < a.size/2; i++ {
+		freq := float64(i) * binWidth
+		energy := math.Pow(cmplx.Abs(bins[i]), 2) / float64(a.size)
+		switch {
+		case freq < 20:
+		case freq < 250:
+			bass += energy
+		case freq < 4000:
+			mid += energy
+		case freq < 16000:
+			treble += energy
+		}
+	}
+
+	f.Level = a.level.normalize(rms)
+	f.Bass = a.bass.normalize(bass)
+	f.Mid = a.mid.normalize(mid)
+	f.Treble = a.treble.normalize(treble)
+	f.Beat = a.detectBeat(bass, f.Time)
+
+	return f
+}
+
+// detectBeat reports whether the bass energy of a window is a beat, and adds
+// it to the history.
+func (a *Analyzer) detectBeat(energy float64, t time.Duration) bool {
+	var avg float64
+	for _, e := range a.history {
+		avg += e
+	}
+	avg /= float64(len(a.history))
+
+	a.history[a.next] = energy
+	a.next = (a.next + 1) % len(a.history)
+
+	// Ignore rises that are small compared to the loudest recent bass, they
+	// are more likely noise than beats.
+	if energy < silence || energy < a.bass.peak*0.1 {
+		return false
+	}
+
+	if energy > avg*a.sensitivity && t-a.lastBeat >= minBeatInterval {
+		a.lastBeat = t
+		return true
+	}
+
+	return false
+}
+
+// fft computes the discrete Fourier transform of x in place, whose length
+// must be a power of 2.
+func fft(x []complex128) {
+	n := len(x)
+
+	// Reorder elements in bit reversed order.
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				even, odd := x[start+k], w*x[start+k+size/2]
+				x[start+k] = even + odd
+				x[start+k+size/2] = even - odd
+				w *= step
+			}
+		}
+	}
+}
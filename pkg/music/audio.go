@@ -0,0 +1,193 @@
+package music
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Format describes raw PCM audio.
+type Format struct {
+	SampleRate    int
+	Channels      int
+	BitsPerSample int // 8, 16, 24 or 32.
+	// Float is set for 32 bits floating point samples, integer samples are
+	// used otherwise.
+	Float bool
+}
+
+// DefaultFormat is the format of CD audio, also used by default by most tools
+// capturing audio, e.g. parec.
+var DefaultFormat = Format{SampleRate: 44100, Channels: 2, BitsPerSample: 16}
+
+func (f Format) validate() error {
+	switch {
+	case f.SampleRate < 8000 || f.SampleRate > 192000:
+		return fmt.Errorf("unsupported sample rate %dHz", f.SampleRate)
+	case f.Channels < 1 || f.Channels > 8:
+		return fmt.Errorf("unsupported number of channels %d", f.Channels)
+	case f.Float && f.BitsPerSample != 32:
+		return fmt.Errorf("unsupported floating point samples of %d bits", f.BitsPerSample)
+	case f.BitsPerSample != 8 && f.BitsPerSample != 16 && f.BitsPerSample != 24 && f.BitsPerSample != 32:
+		return fmt.Errorf("unsupported samples of %d bits", f.BitsPerSample)
+	}
+
+	return nil
+}
+
+// Reader reads audio samples, mixed down to mono. Create one with NewReader.
+type Reader struct {
+	r      *bufio.Reader
+	format Format
+	frame  []byte
+}
+
+// NewReader returns a reader decoding audio from r. WAV files are detected
+// from their header, which gives their format; anything else is read as raw
+// PCM in the given format.
+func NewReader(r io.Reader, raw Format) (*Reader, error) {
+	br := bufio.NewReaderSize(r, 64*1024)
+
+	format := raw
+	if header, err := br.Peek(4); err == nil && string(header) == "RIFF" {
+		if format, err = readWAVHeader(br); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := format.validate(); err != nil {
+		return nil, err
+	}
+
+	return &Reader{
+		r:      br,
+		format: format,
+		frame:  make([]byte, format.Channels*format.BitsPerSample/8),
+	}, nil
+}
+
+// Format returns the format of the audio.
+func (r *Reader) Format() Format { return r.format }
+
+// Read reads samples into buf, each one from -1 to 1, and returns how many
+// were read. It returns io.EOF at the end of the audio.
+func (r *Reader) Read(buf []float64) (int, error) {
+	size := r.format.BitsPerSample / 8
+
+	for i := range buf {
+		if _, err := io.ReadFull(r.r, r.frame); err != nil {
+			if i > 0 && (err == io.EOF || err == io.ErrUnexpectedEOF) {
+				return i, nil
+			}
+			if err == io.ErrUnexpectedEOF {
+				err = io.EOF
+			}
+			return i, err
+		}
+
+		var sum float64
+		for c := 0; c < r.format.Channels; c++ {
+			sum += r.sample(r.frame[c*size : (c+1)*size])
+		}
+		buf[i] = sum / float64(r.format.Channels)
+	}
+
+	return len(buf), nil
+}
+
+// sample decodes a little endian sample.
+func (r *Reader) sample(b []byte) float64 {
+	switch r.format.BitsPerSample {
+	case 8:
+		// 8 bits samples are unsigned.
+		return (float64(b[0]) - 128) / 128
+	case 16:
+		return float64(int16(binary.LittleEndian.Uint16(b))) / 32768
+	case 24:
+		v := int32(b[0]) | int32(b[1])<<8 | int32(int8(b[2]))<<16
+		return float64(v) / 8388608
+	default:
+		bits := binary.LittleEndian.Uint32(b)
+		if r.format.Float {
+			return math.Max(-1, math.Min(1, float64(math.Float32frombits(bits))))
+		}
+		return float64(int32(bits)) / 2147483648
+	}
+}
+
+// WAV audio formats.
+const (
+	wavFormatPCM        = 1
+	wavFormatFloat      = 3
+	wavFormatExtensible = 0xfffe
+)
+
+// readWAVHeader reads the header of a WAV file up to the start of its data.
+func readWAVHeader(r *bufio.Reader) (Format, error) {
+	var riff [12]byte
+	if _, err := io.ReadFull(r, riff[:]); err != nil {
+		return Format{}, fmt.Errorf("unable to read WAV header: %w", err)
+	}
+	if !bytes.Equal(riff[8:12], []byte("WAVE")) {
+		return Format{}, errors.New("not a WAV file")
+	}
+
+	var (
+		format    Format
+		hasFormat bool
+	)
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			return Format{}, fmt.Errorf("unable to read WAV chunk: %w", err)
+		}
+		id, size := string(chunk[:4]), binary.LittleEndian.Uint32(chunk[4:])
+
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return Format{}, errors.New("invalid WAV format chunk")
+			}
+			fmtChunk := make([]byte, size+size%2)
+			if _, err := io.ReadFull(r, fmtChunk); err != nil {
+				return Format{}, fmt.Errorf("unable to read WAV format: %w", err)
+			}
+
+			audioFormat := binary.LittleEndian.Uint16(fmtChunk[0:2])
+			format = Format{
+				Channels:      int(binary.LittleEndian.Uint16(fmtChunk[2:4])),
+				SampleRate:    int(binary.LittleEndian.Uint32(fmtChunk[4:8])),
+				BitsPerSample: int(binary.LittleEndian.Uint16(fmtChunk[14:16])),
+			}
+			if audioFormat == wavFormatExtensible && size >= 26 {
+				// The actual format is the first two bytes of the sub format GUID.
+				audioFormat = binary.LittleEndian.Uint16(fmtChunk[24:26])
+			}
+
+			switch audioFormat {
+			case wavFormatPCM:
+			case wavFormatFloat:
+				format.Float = true
+			default:
+				return Format{}, fmt.Errorf("unsupported WAV audio format %d, only PCM and floating point audio are supported", audioFormat)
+			}
+			hasFormat = true
+		case "data":
+			if !hasFormat {
+				return Format{}, errors.New("WAV data found before its format")
+			}
+			// Data runs until the end of the file: streamed WAV files, e.g.
+			// from ffmpeg, do not know the size of their data.
+			return format, nil
+		default:
+			// Skip other chunks, padded to an even size.
+			if _, err := r.Discard(int(size + size%2)); err != nil {
+				return Format{}, fmt.Errorf("unable to read WAV chunk: %w", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,121 @@
+// Package music makes lights react to music: audio is split in short windows
+// whose loudness, frequency bands and beats are mapped to light colors by a
+// preset, then sent to lights through the REST API or entertainment
+// streaming.
+package music
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// Player plays audio on lights. Create one with NewPlayer and start it with
+// Run.
+type Player struct {
+	reader   *Reader
+	preset   Preset
+	output   Output
+	analyzer *Analyzer
+	realTime bool
+}
+
+// Option allows to customize a Player.
+type Option func(*Player)
+
+// WithSensitivity sets the sensitivity of beat detection, see NewAnalyzer.
+func WithSensitivity(s float64) Option {
+	return func(p *Player) {
+		p.analyzer = NewAnalyzer(p.reader.Format().SampleRate, s)
+	}
+}
+
+// WithoutRealTime processes audio as fast as it can be read, instead of
+// at the pace it is played at. Mostly useful for tests.
+func WithoutRealTime() Option {
+	return func(p *Player) {
+		p.realTime = false
+	}
+}
+
+// NewPlayer returns a player mapping audio read from r to the output using
+// the given preset.
+func NewPlayer(r *Reader, preset Preset, out Output, opts ...Option) *Player {
+	p := &Player{
+		reader:   r,
+		preset:   preset,
+		output:   out,
+		analyzer: NewAnalyzer(r.Format().SampleRate, 0),
+		realTime: true,
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	return p
+}
+
+// Run plays audio until its end or until the context is canceled.
+//
+// Audio is processed at the pace it would be played at, so lights follow
+// music played at the same time from a file. Live sources are never ahead
+// of it and are processed as they come.
+func (p *Player) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	outErr := make(chan error, 1)
+	go func() {
+		outErr <- p.output.Run(ctx)
+	}()
+
+	err := p.play(ctx)
+	cancel()
+
+	if oerr := <-outErr; err == nil && !errors.Is(oerr, context.Canceled) {
+		err = oerr
+	}
+
+	return err
+}
+
+func (p *Player) play(ctx context.Context) error {
+	samples := make([]float64, p.analyzer.WindowSize())
+	start := time.Now()
+
+	for {
+		n, err := p.reader.Read(samples)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// Pad the last window with silence.
+		for i := n; i < len(samples); i++ {
+			samples[i] = 0
+		}
+
+		f := p.analyzer.Analyze(samples)
+		p.output.Set(p.preset.Map(f, p.output.Lights()))
+
+		if p.realTime {
+			windowEnd := f.Time + time.Duration(len(samples))*time.Second/time.Duration(p.reader.Format().SampleRate)
+			if wait := time.Until(start.Add(windowEnd)); wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+				case <-timer.C:
+				}
+			}
+		}
+
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,351 @@
+package music
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"math"
+	"sync"
+	"testing"
+	"time"
+)
+
+// beatInterval is the time between the beats of the test audio, 120 BPM.
+const beatInterval = 500 * time.Millisecond
+
+// beatTrack returns samples at the given rate of a 60Hz tone played for 50ms
+// every beatInterval, starting with a beat, with some quiet high frequency
+// noise in between.
+func beatTrack(sampleRate, beats int) []float64 {
+	perBeat := int(time.Duration(sampleRate) * beatInterval / time.Second)
+	burst := sampleRate / 20
+
+	samples := make([]float64, perBeat*beats)
+	for i := range samples {
+		t := float64(i) / float64(sampleRate)
+		samples[i] = 0.01 * math.Sin(2*math.Pi*5000*t)
+		if i%perBeat < burst {
+			samples[i] += 0.8 * math.Sin(2*math.Pi*60*t)
+		}
+	}
+
+	return samples
+}
+
+// encodePCM encodes samples in the given format, duplicating them on every
+// channel.
+func encodePCM(samples []float64, f Format) []byte {
+	var buf bytes.Buffer
+	for _, s := range samples {
+		for c := 0; c < f.Channels; c++ {
+			switch {
+			case f.Float:
+				_ = binary.Write(&buf, binary.LittleEndian, float32(s))
+			case f.BitsPerSample == 8:
+				buf.WriteByte(byte(math.Round(s*127) + 128))
+			case f.BitsPerSample == 16:
+				_ = binary.Write(&buf, binary.LittleEndian, int16(math.Round(s*32767)))
+			case f.BitsPerSample == 24:
+				v := int32(math.Round(s * 8388607))
+				buf.Write([]byte{byte(v), byte(v >> 8), byte(v >> 16)})
+			default:
+				_ = binary.Write(&buf, binary.LittleEndian, int32(math.Round(s*2147483647)))
+			}
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// encodeWAV encodes samples as a WAV file in the given format, with a chunk
+// to skip between the format and the data.
+func encodeWAV(samples []float64, f Format) []byte {
+	data := encodePCM(samples, f)
+
+	audioFormat := uint16(wavFormatPCM)
+	if f.Float {
+		audioFormat = wavFormatFloat
+	}
+	blockAlign := f.Channels * f.BitsPerSample / 8
+
+	var buf bytes.Buffer
+	write := func(vs ...interface{}) {
+		for _, v := range vs {
+			if s, ok := v.(string); ok {
+				buf.WriteString(s)
+				continue
+			}
+			_ = binary.Write(&buf, binary.LittleEndian, v)
+		}
+	}
+
+	write("RIFF", uint32(4+24+16+8+len(data)), "WAVE")
+	write("fmt ", uint32(16), audioFormat, uint16(f.Channels), uint32(f.SampleRate),
+		uint32(f.SampleRate*blockAlign), uint16(blockAlign), uint16(f.BitsPerSample))
+	// Odd sized chunks are padded.
+	write("LIST", uint32(3), "abc\x00")
+	write("data", uint32(len(data)), data)
+
+	return buf.Bytes()
+}
+
+func TestReader(t *testing.T) {
+	samples := []float64{0, 0.5, -0.5, 0.25, -1, 0.999}
+
+	tests := []struct {
+		name      string
+		data      []byte
+		raw       Format
+		wantFmt   Format
+		tolerance float64
+	}{
+		{
+			name:      "wav 16 bits stereo",
+			data:      encodeWAV(samples, Format{SampleRate: 44100, Channels: 2, BitsPerSample: 16}),
+			raw:       Format{},
+			wantFmt:   Format{SampleRate: 44100, Channels: 2, BitsPerSample: 16},
+			tolerance: 2.0 / 32768,
+		},
+		{
+			name:      "wav 8 bits mono",
+			data:      encodeWAV(samples, Format{SampleRate: 8000, Channels: 1, BitsPerSample: 8}),
+			wantFmt:   Format{SampleRate: 8000, Channels: 1, BitsPerSample: 8},
+			tolerance: 2.0 / 128,
+		},
+		{
+			name:      "wav 24 bits",
+			data:      encodeWAV(samples, Format{SampleRate: 48000, Channels: 2, BitsPerSample: 24}),
+			wantFmt:   Format{SampleRate: 48000, Channels: 2, BitsPerSample: 24},
+			tolerance: 2.0 / 8388608,
+		},
+		{
+			name:      "wav float",
+			data:      encodeWAV(samples, Format{SampleRate: 48000, Channels: 1, BitsPerSample: 32, Float: true}),
+			wantFmt:   Format{SampleRate: 48000, Channels: 1, BitsPerSample: 32, Float: true},
+			tolerance: 1e-6,
+		},
+		{
+			name:      "raw pcm",
+			data:      encodePCM(samples, DefaultFormat),
+			raw:       DefaultFormat,
+			wantFmt:   DefaultFormat,
+			tolerance: 2.0 / 32768,
+		},
+		{
+			name:      "raw 32 bits",
+			data:      encodePCM(samples, Format{SampleRate: 22050, Channels: 1, BitsPerSample: 32}),
+			raw:       Format{SampleRate: 22050, Channels: 1, BitsPerSample: 32},
+			wantFmt:   Format{SampleRate: 22050, Channels: 1, BitsPerSample: 32},
+			tolerance: 1e-9,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewReader(bytes.NewReader(tt.data), tt.raw)
+			if err != nil {
+				t.Fatalf("unable to create reader: %v", err)
+			}
+			if r.Format() != tt.wantFmt {
+				t.Errorf("expected format %+v, got %+v", tt.wantFmt, r.Format())
+			}
+
+			// Read more than available to reach the end of the audio.
+			buf := make([]float64, len(samples)+2)
+			n, err := r.Read(buf)
+			if err != nil {
+				t.Fatalf("unable to read samples: %v", err)
+			}
+			if n != len(samples) {
+				t.Fatalf("expected %d samples, got %d", len(samples), n)
+			}
+			for i, want := range samples {
+				if math.Abs(buf[i]-want) > tt.tolerance {
+					t.Errorf("expected sample %d to be %g, got %g", i, want, buf[i])
+				}
+			}
+
+			if _, err = r.Read(buf); err == nil {
+				t.Error("expected the end of the audio")
+			}
+		})
+	}
+}
+
+func TestNewReaderErrors(t *testing.T) {
+	valid := encodeWAV([]float64{0}, DefaultFormat)
+
+	notWAVE := append([]byte(nil), valid...)
+	copy(notWAVE[8:12], "AVI ")
+
+	adpcm := append([]byte(nil), valid...)
+	binary.LittleEndian.PutUint16(adpcm[20:22], 2)
+
+	tests := []struct {
+		name string
+		data []byte
+		raw  Format
+	}{
+		{name: "not a wav file", data: notWAVE, raw: DefaultFormat},
+		{name: "unsupported wav format", data: adpcm, raw: DefaultFormat},
+		{name: "data before format", data: []byte("RIFF\x00\x00\x00\x00WAVEdata\x00\x00\x00\x00"), raw: DefaultFormat},
+		{name: "truncated header", data: valid[:30], raw: DefaultFormat},
+		{name: "invalid raw format", data: []byte{0, 0}, raw: Format{SampleRate: 44100, Channels: 2, BitsPerSample: 12}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewReader(bytes.NewReader(tt.data), tt.raw); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestAnalyzerBeats(t *testing.T) {
+	const beats = 8
+
+	for _, rate := range []int{22050, 44100, 48000} {
+		r, err := NewReader(bytes.NewReader(encodeWAV(beatTrack(rate, beats), Format{SampleRate: rate, Channels: 1, BitsPerSample: 16})), Format{})
+		if err != nil {
+			t.Fatalf("unable to create reader: %v", err)
+		}
+
+		a := NewAnalyzer(rate, 0)
+		window := make([]float64, a.WindowSize())
+		windowDuration := time.Duration(a.WindowSize()) * time.Second / time.Duration(rate)
+
+		var got []time.Duration
+		for {
+			if _, err = r.Read(window); err != nil {
+				break
+			}
+			if f := a.Analyze(window); f.Beat {
+				got = append(got, f.Time)
+			}
+		}
+
+		if len(got) != beats {
+			t.Fatalf("%dHz: expected %d beats, got %d at %v", rate, beats, len(got), got)
+		}
+		for i, at := range got {
+			// Beats are detected in the window they start in, or in the
+			// next one when they start at its very end.
+			want := time.Duration(i) * beatInterval
+			if at < want-windowDuration || at > want+windowDuration {
+				t.Errorf("%dHz: expected beat %d at %s, got %s", rate, i, want, at)
+			}
+		}
+	}
+}
+
+// fakeOutput records the targets set by a player.
+type fakeOutput struct {
+	lights int
+
+	mu      sync.Mutex
+	targets [][]Target
+	ran     bool
+}
+
+func (o *fakeOutput) Lights() int { return o.lights }
+
+func (o *fakeOutput) Set(targets []Target) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.targets = append(o.targets, targets)
+}
+
+func (o *fakeOutput) Run(ctx context.Context) error {
+	o.mu.Lock()
+	o.ran = true
+	o.mu.Unlock()
+
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestPlayer(t *testing.T) {
+	const (
+		rate   = 44100
+		beats  = 6
+		lights = 4
+	)
+
+	for _, name := range PresetNames() {
+		t.Run(name, func(t *testing.T) {
+			r, err := NewReader(bytes.NewReader(encodePCM(beatTrack(rate, beats), DefaultFormat)), DefaultFormat)
+			if err != nil {
+				t.Fatalf("unable to create reader: %v", err)
+			}
+
+			preset, err := NewPreset(name)
+			if err != nil {
+				t.Fatalf("unable to create preset: %v", err)
+			}
+
+			out := &fakeOutput{lights: lights}
+			p := NewPlayer(r, preset, out, WithoutRealTime())
+
+			start := time.Now()
+			if err = p.Run(context.Background()); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			// The track lasts 3s, but is not played in real time.
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("expected the audio to be processed right away, took %s", elapsed)
+			}
+
+			if !out.ran {
+				t.Error("expected the output to run")
+			}
+
+			samples := rate * beats * int(beatInterval/time.Millisecond) / 1000
+			windows := (samples + p.analyzer.WindowSize() - 1) / p.analyzer.WindowSize()
+			if len(out.targets) != windows {
+				t.Fatalf("expected targets for %d windows, got %d", windows, len(out.targets))
+			}
+
+			var flashes int
+			for _, targets := range out.targets {
+				if len(targets) != lights {
+					t.Fatalf("expected targets for %d lights, got %d", lights, len(targets))
+				}
+				for _, tgt := range targets {
+					if tgt.Bri < 0 || tgt.Bri > 1 || tgt.Sat < 0 || tgt.Sat > 1 {
+						t.Fatalf("invalid target %+v", tgt)
+					}
+					if tgt.Bri == 1 {
+						flashes++
+						break
+					}
+				}
+			}
+
+			// The beats preset sets one light at full brightness on each
+			// beat.
+			if name == "beats" && flashes != beats {
+				t.Errorf("expected %d flashes, got %d", beats, flashes)
+			}
+		})
+	}
+}
+
+func TestPlayerCanceled(t *testing.T) {
+	// Enough audio to play for a minute in real time.
+	r, err := NewReader(bytes.NewReader(encodePCM(beatTrack(8000, 120), Format{SampleRate: 8000, Channels: 1, BitsPerSample: 16})), Format{SampleRate: 8000, Channels: 1, BitsPerSample: 16})
+	if err != nil {
+		t.Fatalf("unable to create reader: %v", err)
+	}
+
+	preset, _ := NewPreset("pulse")
+	p := NewPlayer(r, preset, &fakeOutput{lights: 1})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if err = p.Run(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected the deadline to be exceeded, got %v", err)
+	}
+}
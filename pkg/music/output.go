@@ -0,0 +1,176 @@
+package music
+
+import (
+	"context"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/skwair/harmony/optional"
+	"github.com/skwair/huectl/pkg/entertainment"
+	"github.com/skwair/huectl/pkg/hue"
+)
+
+// Output sends targets to lights.
+type Output interface {
+	// Lights returns the number of lights targets are given for.
+	Lights() int
+	// Set sets the current targets of lights, in order.
+	Set(targets []Target)
+	// Run sends targets to lights until the context is canceled.
+	Run(ctx context.Context) error
+}
+
+// DefaultRESTRate is the number of light updates per second sent through the
+// REST API, as recommended by the Hue developer documentation.
+const DefaultRESTRate = 10
+
+// RESTOutput sends targets to lights through the REST API of the bridge. As
+// only a few updates can be sent per second, each one goes to the light whose
+// target changed the most since it was last updated. Create one with
+// NewRESTOutput.
+type RESTOutput struct {
+	client *hue.Client
+	lights []hue.Light
+	rate   int
+	logger *log.Logger
+
+	mu      sync.Mutex
+	targets []Target
+	sent    []*Target
+}
+
+// NewRESTOutput returns an output updating the given lights through the
+// given client, sending at most rate updates per second. Errors are logged to
+// the given logger if not nil.
+func NewRESTOutput(client *hue.Client, lights []hue.Light, rate int, logger *log.Logger) *RESTOutput {
+	if rate <= 0 {
+		rate = DefaultRESTRate
+	}
+
+	return &RESTOutput{
+		client:  client,
+		lights:  lights,
+		rate:    rate,
+		logger:  logger,
+		targets: make([]Target, len(lights)),
+		sent:    make([]*Target, len(lights)),
+	}
+}
+
+// Lights implements Output.
+func (o *RESTOutput) Lights() int { return len(o.lights) }
+
+// Set implements Output.
+func (o *RESTOutput) Set(targets []Target) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	copy(o.targets, targets)
+}
+
+// Run implements Output.
+func (o *RESTOutput) Run(ctx context.Context) error {
+	interval := time.Second / time.Duration(o.rate)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		i, t, ok := o.next()
+		if !ok {
+			continue
+		}
+
+		req := &hue.SetLightStateRequest{
+			On:             optional.NewBool(true),
+			Bri:            optional.NewInt(int(math.Max(1, math.Round(t.Bri*254)))),
+			Hue:            optional.NewInt(int(math.Round(math.Mod(t.Hue, 360) / 360 * 65535))),
+			Sat:            optional.NewInt(int(math.Round(t.Sat * 254))),
+			TransitionTime: optional.NewInt(int(interval / (100 * time.Millisecond))),
+		}
+
+		l := &o.lights[i]
+		req, _, err := hue.ValidateLightState(l, req, hue.Convert)
+		if err == nil {
+			_, err = o.client.SetLightState(l.ID, req)
+		}
+		if err != nil && o.logger != nil {
+			o.logger.Printf("Unable to update light %s: %v", l.Name, err)
+		}
+	}
+}
+
+// minChange is the difference between the target of a light and what was
+// last sent to it below which it is not updated.
+const minChange = 0.03
+
+// next returns the light whose target changed the most since it was last
+// updated, and records it as sent.
+func (o *RESTOutput) next() (int, Target, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	best, bestChange := -1, minChange
+	for i, t := range o.targets {
+		change := math.Inf(1)
+		if sent := o.sent[i]; sent != nil {
+			hueDiff := math.Abs(math.Mod(t.Hue-sent.Hue+540, 360) - 180)
+			change = math.Abs(t.Bri-sent.Bri) + math.Abs(t.Sat-sent.Sat) + hueDiff/360
+		}
+		if change > bestChange {
+			best, bestChange = i, change
+		}
+	}
+
+	if best < 0 {
+		return 0, Target{}, false
+	}
+
+	t := o.targets[best]
+	o.sent[best] = &t
+
+	return best, t, true
+}
+
+// StreamOutput sends targets to the lights of an entertainment group through
+// an entertainment streamer, updating all of them many times per second.
+type StreamOutput struct {
+	streamer *entertainment.Streamer
+	ids      []int
+}
+
+// NewStreamOutput returns an output streaming to the given lights, or
+// channels with version 2 of the protocol. The streamer must use the RGB
+// color space.
+func NewStreamOutput(s *entertainment.Streamer, ids []int) *StreamOutput {
+	return &StreamOutput{streamer: s, ids: ids}
+}
+
+// Lights implements Output.
+func (o *StreamOutput) Lights() int { return len(o.ids) }
+
+// Set implements Output.
+func (o *StreamOutput) Set(targets []Target) {
+	colors := make(map[int]entertainment.Color, len(targets))
+	for i, t := range targets {
+		if i >= len(o.ids) {
+			break
+		}
+		r, g, b := t.RGB()
+		colors[o.ids[i]] = entertainment.Color{r, g, b}
+	}
+
+	o.streamer.SetAll(colors)
+}
+
+// Run implements Output.
+func (o *StreamOutput) Run(ctx context.Context) error {
+	return o.streamer.Run(ctx)
+}
@@ -0,0 +1,201 @@
+package music
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Target is the color a light should have, as a hue in degrees and a
+// saturation and a brightness from 0 to 1.
+type Target struct {
+	Hue, Sat, Bri float64
+}
+
+// RGB returns the target as red, green and blue components from 0 to 1.
+func (t Target) RGB() (r, g, b float64) {
+	h := math.Mod(t.Hue, 360)
+	if h < 0 {
+		h += 360
+	}
+
+	c := t.Bri * t.Sat
+	x := c * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	m := t.Bri - c
+
+	switch {
+	case h < 60:
+		r, g, b = c, x, 0
+	case h < 120:
+		r, g, b = x, c, 0
+	case h < 180:
+		r, g, b = 0, c, x
+	case h < 240:
+		r, g, b = 0, x, c
+	case h < 300:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+
+	return r + m, g + m, b + m
+}
+
+// Preset maps audio features to light colors.
+type Preset interface {
+	// Map returns the targets of the given number of lights for a window of
+	// audio. It is called for every window, in order.
+	Map(f Features, lights int) []Target
+}
+
+// presets holds the constructors of presets by name, each run needing its own
+// instance as presets keep state between windows.
+var presets = map[string]struct {
+	help string
+	new  func() Preset
+}{
+	"pulse":    {"All lights share a slowly rotating color, their brightness follows the music and flashes on beats.", func() Preset { return &pulse{} }},
+	"spectrum": {"Lights are split between bass (red), mids (green) and treble (blue), each following its band.", func() Preset { return &spectrum{} }},
+	"beats":    {"On every beat, the next light jumps to a new color at full brightness while the others fade out.", func() Preset { return &beats{} }},
+	"chill":    {"Soft colors drifting with the music, without flashes.", func() Preset { return &chill{} }},
+}
+
+// NewPreset returns a new instance of the preset with the given name.
+func NewPreset(name string) (Preset, error) {
+	p, ok := presets[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown preset %q, must be one of: %s", name, strings.Join(PresetNames(), ", "))
+	}
+
+	return p.new(), nil
+}
+
+// PresetNames returns the names of the available presets, sorted.
+func PresetNames() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// PresetHelp returns a description of the preset with the given name.
+func PresetHelp(name string) string {
+	return presets[name].help
+}
+
+// decay brings v down towards target at the given rate per second, for a
+// window starting at the given time after the previous one.
+func decay(v, target, perSecond float64, elapsed time.Duration) float64 {
+	return target + (v-target)*math.Pow(perSecond, elapsed.Seconds())
+}
+
+type pulse struct {
+	flash float64
+	last  time.Duration
+}
+
+func (p *pulse) Map(f Features, lights int) []Target {
+	p.flash = decay(p.flash, 0, 0.01, f.Time-p.last)
+	p.last = f.Time
+	if f.Beat {
+		p.flash = 1
+	}
+
+	t := Target{
+		// A full turn of the color wheel every minute.
+		Hue: math.Mod(f.Time.Seconds()*6, 360),
+		Sat: 1,
+		Bri: math.Max(0.1, math.Max(f.Level, p.flash)),
+	}
+
+	targets := make([]Target, lights)
+	for i := range targets {
+		targets[i] = t
+	}
+
+	return targets
+}
+
+type spectrum struct{}
+
+func (spectrum) Map(f Features, lights int) []Target {
+	bands := []Target{
+		{Hue: 0, Sat: 1, Bri: f.Bass},
+		{Hue: 120, Sat: 1, Bri: f.Mid},
+		{Hue: 240, Sat: 1, Bri: f.Treble},
+	}
+
+	targets := make([]Target, lights)
+	for i := range targets {
+		targets[i] = bands[i%len(bands)]
+		targets[i].Bri = math.Max(0.05, targets[i].Bri)
+	}
+
+	return targets
+}
+
+type beats struct {
+	targets []Target
+	next    int
+	hue     float64
+	last    time.Duration
+}
+
+func (b *beats) Map(f Features, lights int) []Target {
+	if len(b.targets) != lights {
+		b.targets = make([]Target, lights)
+		for i := range b.targets {
+			b.targets[i] = Target{Hue: float64(i) * 360 / float64(lights), Sat: 1, Bri: 0.1}
+		}
+	}
+
+	elapsed := f.Time - b.last
+	b.last = f.Time
+	for i := range b.targets {
+		b.targets[i].Bri = decay(b.targets[i].Bri, 0.1, 0.2, elapsed)
+	}
+
+	if f.Beat && lights > 0 {
+		// Turn by the golden angle so colors of consecutive beats are
+		// always clearly distinct.
+		b.hue = math.Mod(b.hue+137.5, 360)
+		b.targets[b.next] = Target{Hue: b.hue, Sat: 1, Bri: 1}
+		b.next = (b.next + 1) % lights
+	}
+
+	res := make([]Target, lights)
+	copy(res, b.targets)
+
+	return res
+}
+
+type chill struct {
+	hue, bri float64
+	last     time.Duration
+}
+
+func (c *chill) Map(f Features, lights int) []Target {
+	elapsed := f.Time - c.last
+	c.last = f.Time
+
+	// Drift faster when mids are loud, and smooth the brightness over about
+	// a second.
+	c.hue = math.Mod(c.hue+elapsed.Seconds()*(2+10*f.Mid), 360)
+	c.bri = decay(c.bri, 0.2+0.6*f.Level, 0.1, elapsed)
+
+	targets := make([]Target, lights)
+	for i := range targets {
+		targets[i] = Target{
+			Hue: math.Mod(c.hue+float64(i)*30, 360),
+			Sat: 0.7,
+			Bri: c.bri,
+		}
+	}
+
+	return targets
+}
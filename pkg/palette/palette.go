@@ -0,0 +1,308 @@
+// Package palette extracts the dominant colors of images and assigns them to
+// lights.
+package palette
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"sort"
+
+	// Register the decoders of the supported image formats.
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/skwair/harmony/optional"
+	"github.com/skwair/huectl/pkg/colors"
+	"github.com/skwair/huectl/pkg/hue"
+)
+
+// Color is a color of a palette, along with the share of the image it
+// covers.
+type Color struct {
+	colors.RGB
+	// Weight is the share of the image covered by the color, from 0 to 1.
+	Weight float64
+}
+
+// Load decodes the image at the given path, which can be a JPEG, PNG or GIF
+// image.
+func Load(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open image: %w", err)
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode image: %w", err)
+	}
+
+	return img, nil
+}
+
+// maxSamples is the maximum number of pixels sampled from an image, which is
+// plenty to find its dominant colors while keeping large pictures fast.
+const maxSamples = 1 << 16
+
+// minValue is the value (the highest of the RGB components) below which
+// pixels are ignored, as nearly black colors would barely light anything up.
+const minValue = 16
+
+// Extract returns up to n dominant colors of the image, sorted by decreasing
+// weight. Colors are first found with the median cut algorithm, splitting the
+// pixels of the image in n boxes of similar colors, then refined with a few
+// iterations of k-means clustering, which better separates small areas of
+// distinct colors.
+//
+// Fewer than n colors are returned for images with fewer distinct colors.
+// Transparent and nearly black pixels are ignored, unless the image has no
+// other pixels.
+func Extract(img image.Image, n int) []Color {
+	if n <= 0 {
+		return nil
+	}
+
+	pixels := sample(img, true)
+	if len(pixels) == 0 {
+		pixels = sample(img, false)
+	}
+	if len(pixels) == 0 {
+		return nil
+	}
+
+	boxes := []box{pixels}
+	for len(boxes) < n {
+		// Split the box with the widest range of colors.
+		widest, widestRange := -1, 0
+		for i, b := range boxes {
+			if _, r := b.widestChannel(); r > widestRange {
+				widest, widestRange = i, r
+			}
+		}
+		if widest < 0 {
+			// All boxes hold a single color.
+			break
+		}
+
+		lo, hi := boxes[widest].split()
+		boxes[widest] = lo
+		boxes = append(boxes, hi)
+	}
+
+	centers := make([]colors.RGB, len(boxes))
+	for i, b := range boxes {
+		centers[i] = b.average()
+	}
+	clusters := refine(pixels, centers)
+
+	res := make([]Color, 0, len(clusters))
+	for _, c := range clusters {
+		if len(c) > 0 {
+			res = append(res, Color{RGB: c.average(), Weight: float64(len(c)) / float64(len(pixels))})
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].Weight > res[j].Weight })
+
+	return res
+}
+
+// sample returns up to maxSamples pixels of the image spread evenly, skipping
+// transparent ones and, if skipDark is set, nearly black ones.
+func sample(img image.Image, skipDark bool) []colors.RGB {
+	bounds := img.Bounds()
+	step := 1
+	for bounds.Dx()*bounds.Dy()/(step*step) > maxSamples {
+		step++
+	}
+
+	var pixels []colors.RGB
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += step {
+		for x := bounds.Min.X; x < bounds.Max.X; x += step {
+			r, g, b, a := img.At(x, y).RGBA()
+			if a < 0x8000 {
+				continue
+			}
+
+			// Undo the alpha premultiplication.
+			c := colors.RGB{R: uint8(r * 0xff / a), G: uint8(g * 0xff / a), B: uint8(b * 0xff / a)}
+			if skipDark && c.R < minValue && c.G < minValue && c.B < minValue {
+				continue
+			}
+			pixels = append(pixels, c)
+		}
+	}
+
+	return pixels
+}
+
+// maxIterations is the maximum number of k-means iterations run by refine.
+const maxIterations = 8
+
+// refine clusters pixels around the given initial colors with k-means, and
+// returns the pixels of each cluster.
+func refine(pixels []colors.RGB, centers []colors.RGB) []box {
+	var clusters []box
+	for it := 0; it < maxIterations; it++ {
+		clusters = make([]box, len(centers))
+		for _, p := range pixels {
+			nearest, nearestDist := 0, math.MaxInt32
+			for i, c := range centers {
+				if d := distance(p, c); d < nearestDist {
+					nearest, nearestDist = i, d
+				}
+			}
+			clusters[nearest] = append(clusters[nearest], p)
+		}
+
+		moved := false
+		for i, c := range clusters {
+			if len(c) == 0 {
+				// Restart empty clusters from the pixel the farthest from any
+				// color, so distinct colors do not end up merged.
+				if p, d := farthest(pixels, centers); d > 0 {
+					centers[i], moved = p, true
+				}
+				continue
+			}
+			if avg := c.average(); avg != centers[i] {
+				centers[i], moved = avg, true
+			}
+		}
+		if !moved {
+			break
+		}
+	}
+
+	return clusters
+}
+
+// farthest returns the pixel the farthest from its nearest center, and its
+// distance to it.
+func farthest(pixels []colors.RGB, centers []colors.RGB) (colors.RGB, int) {
+	var (
+		res     colors.RGB
+		resDist = -1
+	)
+	for _, p := range pixels {
+		nearestDist := math.MaxInt32
+		for _, c := range centers {
+			if d := distance(p, c); d < nearestDist {
+				nearestDist = d
+			}
+		}
+		if nearestDist > resDist {
+			res, resDist = p, nearestDist
+		}
+	}
+
+	return res, resDist
+}
+
+// distance returns the squared euclidean distance between two colors.
+func distance(a, b colors.RGB) int {
+	dr, dg, db := int(a.R)-int(b.R), int(a.G)-int(b.G), int(a.B)-int(b.B)
+	return dr*dr + dg*dg + db*db
+}
+
+// box is a set of pixels of similar colors.
+type box []colors.RGB
+
+func channel(c colors.RGB, i int) uint8 {
+	switch i {
+	case 0:
+		return c.R
+	case 1:
+		return c.G
+	default:
+		return c.B
+	}
+}
+
+// widestChannel returns the RGB component whose values are the most spread
+// in the box, and their range.
+func (b box) widestChannel() (int, int) {
+	widest, widestRange := 0, 0
+	for i := 0; i < 3; i++ {
+		lo, hi := uint8(255), uint8(0)
+		for _, c := range b {
+			v := channel(c, i)
+			if v < lo {
+				lo = v
+			}
+			if v > hi {
+				hi = v
+			}
+		}
+		if r := int(hi) - int(lo); r > widestRange {
+			widest, widestRange = i, r
+		}
+	}
+
+	return widest, widestRange
+}
+
+// split splits the box in two at the median of its widest channel.
+func (b box) split() (box, box) {
+	ch, _ := b.widestChannel()
+	sort.Slice(b, func(i, j int) bool { return channel(b[i], ch) < channel(b[j], ch) })
+
+	// When the lower half is a single value, split after it instead so both
+	// halves are never empty: boxes are only split when their range is not 0.
+	median := len(b) / 2
+	for channel(b[median], ch) == channel(b[0], ch) {
+		median++
+	}
+
+	return b[:median], b[median:]
+}
+
+func (b box) average() colors.RGB {
+	var r, g, bl int
+	for _, c := range b {
+		r += int(c.R)
+		g += int(c.G)
+		bl += int(c.B)
+	}
+	n := len(b)
+
+	return colors.RGB{R: uint8((r + n/2) / n), G: uint8((g + n/2) / n), B: uint8((bl + n/2) / n)}
+}
+
+// Assign returns the states giving each light a color of the palette, in
+// order, cycling through the palette if there are more lights than colors.
+// Colors are clamped to the gamut of each light, and converted to a color
+// temperature for lights that only support white. Lights are switched on,
+// with a brightness following the brightness of their color.
+func Assign(p []Color, lights []hue.Light) (map[string]*hue.SetLightStateRequest, error) {
+	if len(p) == 0 {
+		return nil, errors.New("no colors to assign")
+	}
+
+	reqs := make(map[string]*hue.SetLightStateRequest, len(lights))
+	for i := range lights {
+		l := &lights[i]
+		c := p[i%len(p)]
+
+		xy := l.Gamut().Clamp(hue.RGBToXY(c.R, c.G, c.B))
+		value := math.Max(float64(c.R), math.Max(float64(c.G), float64(c.B))) / 255
+
+		req := &hue.SetLightStateRequest{
+			On:  optional.NewBool(true),
+			Bri: optional.NewInt(int(math.Max(1, math.Round(value*254)))),
+			XY:  &[2]float32{float32(xy[0]), float32(xy[1])},
+		}
+
+		req, _, err := hue.ValidateLightState(l, req, hue.Convert)
+		if err != nil {
+			return nil, fmt.Errorf("light %s: %w", l.Name, err)
+		}
+		reqs[l.ID] = req
+	}
+
+	return reqs, nil
+}
@@ -0,0 +1,226 @@
+package palette
+
+import (
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/skwair/huectl/pkg/colors"
+	"github.com/skwair/huectl/pkg/hue"
+)
+
+// stripes returns an image made of vertical stripes of the given colors, each
+// as wide as given.
+func stripes(widths []int, cs []color.Color) image.Image {
+	total := 0
+	for _, w := range widths {
+		total += w
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, total, 10))
+	x := 0
+	for i, w := range widths {
+		for ; w > 0; w-- {
+			for y := 0; y < 10; y++ {
+				img.Set(x, y, cs[i])
+			}
+			x++
+		}
+	}
+
+	return img
+}
+
+var (
+	red         = color.NRGBA{R: 255, A: 255}
+	green       = color.NRGBA{G: 200, A: 255}
+	blue        = color.NRGBA{B: 255, A: 255}
+	black       = color.NRGBA{A: 255}
+	transparent = color.NRGBA{R: 255, G: 255, B: 255}
+)
+
+func TestExtract(t *testing.T) {
+	img := stripes([]int{50, 30, 10, 5, 5}, []color.Color{red, blue, green, black, transparent})
+
+	tests := []struct {
+		name string
+		n    int
+		want []Color
+	}{
+		{
+			name: "dominant colors",
+			n:    3,
+			want: []Color{
+				{RGB: colors.RGB{R: 255}, Weight: 50.0 / 90},
+				{RGB: colors.RGB{B: 255}, Weight: 30.0 / 90},
+				{RGB: colors.RGB{G: 200}, Weight: 10.0 / 90},
+			},
+		},
+		{
+			name: "fewer distinct colors",
+			n:    5,
+			want: []Color{
+				{RGB: colors.RGB{R: 255}, Weight: 50.0 / 90},
+				{RGB: colors.RGB{B: 255}, Weight: 30.0 / 90},
+				{RGB: colors.RGB{G: 200}, Weight: 10.0 / 90},
+			},
+		},
+		{
+			name: "single color",
+			n:    1,
+			want: []Color{{RGB: colors.RGB{R: 142, G: 22, B: 85}, Weight: 1}},
+		},
+		{
+			name: "none",
+			n:    0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Extract(img, tt.n)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("expected %+v, got %+v", tt.want, got)
+			}
+
+			// Extraction is deterministic.
+			if again := Extract(img, tt.n); !reflect.DeepEqual(again, got) {
+				t.Errorf("expected the same colors on each run, got %+v then %+v", got, again)
+			}
+		})
+	}
+}
+
+func TestExtractDarkImage(t *testing.T) {
+	img := stripes([]int{10}, []color.Color{black})
+
+	want := []Color{{RGB: colors.RGB{}, Weight: 1}}
+	if got := Extract(img, 2); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
+
+// state is a decoded light state update.
+type state struct {
+	On  *bool       `json:"on"`
+	Bri *int        `json:"bri"`
+	XY  *[2]float64 `json:"xy"`
+	CT  *int        `json:"ct"`
+}
+
+func decodeState(t *testing.T, req *hue.SetLightStateRequest) state {
+	t.Helper()
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		t.Fatalf("unable to encode request: %v", err)
+	}
+
+	var s state
+	if err = json.Unmarshal(data, &s); err != nil {
+		t.Fatalf("unable to decode request: %v", err)
+	}
+
+	return s
+}
+
+func TestAssign(t *testing.T) {
+	p := []Color{
+		{RGB: colors.RGB{R: 255}, Weight: 0.6},
+		{RGB: colors.RGB{B: 128}, Weight: 0.4},
+	}
+	lights := []hue.Light{
+		{ID: "1", Type: hue.LightTypeExtendedColor, Capabilities: hue.LightCapabilities{
+			Control: hue.LightCapabilitiesControl{ColorGamutType: "A"},
+		}},
+		{ID: "2", Type: hue.LightTypeExtendedColor},
+		{ID: "3", Type: hue.LightTypeColorTemperature, Capabilities: hue.LightCapabilities{
+			Control: hue.LightCapabilitiesControl{Ct: hue.LightCapabilitiesControlCt{Min: 153, Max: 454}},
+		}},
+		{ID: "4", Type: hue.LightTypeDimmable},
+	}
+
+	reqs, err := Assign(p, lights)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(reqs) != len(lights) {
+		t.Fatalf("expected %d states, got %d", len(lights), len(reqs))
+	}
+
+	// Red is clamped to gamut A.
+	s := decodeState(t, reqs["1"])
+	if s.On == nil || !*s.On || s.Bri == nil || *s.Bri != 254 || s.XY == nil || s.CT != nil {
+		t.Fatalf("unexpected state for a color light: %+v", s)
+	}
+	want := hue.GamutA.Clamp(hue.RGBToXY(255, 0, 0))
+	if xy := *s.XY; math.Abs(xy[0]-want[0]) > 1e-4 || math.Abs(xy[1]-want[1]) > 1e-4 {
+		t.Errorf("expected red clamped to gamut A at %v, got %v", want, xy)
+	}
+
+	// Dark blue is dimmed.
+	s = decodeState(t, reqs["2"])
+	if s.Bri == nil || *s.Bri != 127 || s.XY == nil {
+		t.Errorf("unexpected state for a color light: %+v", s)
+	}
+
+	// White ambiance lights get the closest color temperature, within their
+	// range, cycling back to the first color.
+	s = decodeState(t, reqs["3"])
+	if s.CT == nil || *s.CT != 454 || s.XY != nil {
+		t.Errorf("expected a color temperature of 454 for a white ambiance light, got %+v", s)
+	}
+
+	// Dimmable lights only get a brightness.
+	s = decodeState(t, reqs["4"])
+	if s.Bri == nil || *s.Bri != 127 || s.XY != nil || s.CT != nil {
+		t.Errorf("expected only a brightness for a dimmable light, got %+v", s)
+	}
+
+	if _, err = Assign(nil, lights); err == nil {
+		t.Error("expected an error for an empty palette")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "palette")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "image.png")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("unable to create image: %v", err)
+	}
+	if err = png.Encode(f, stripes([]int{4}, []color.Color{red})); err != nil {
+		t.Fatalf("unable to encode image: %v", err)
+	}
+	f.Close()
+
+	img, err := Load(path)
+	if err != nil {
+		t.Fatalf("unable to load image: %v", err)
+	}
+	if got := img.Bounds(); got != image.Rect(0, 0, 4, 10) {
+		t.Errorf("expected a 4x10 image, got %v", got)
+	}
+
+	if _, err = Load(filepath.Join(dir, "missing.png")); err == nil {
+		t.Error("expected an error for a missing image")
+	}
+	if err = ioutil.WriteFile(path, []byte("not an image"), 0600); err != nil {
+		t.Fatalf("unable to write file: %v", err)
+	}
+	if _, err = Load(path); err == nil {
+		t.Error("expected an error for an invalid image")
+	}
+}
@@ -0,0 +1,139 @@
+// Package sun computes the position of the sun and the times of sunrise and
+// sunset at a given location, without any network access.
+package sun
+
+import (
+	"math"
+	"time"
+)
+
+// Location is a position on Earth, used to compute sunrise and sunset times.
+type Location struct {
+	Latitude  float64 `yaml:"latitude"`
+	Longitude float64 `yaml:"longitude"`
+}
+
+// zenith of the sun at sunrise and sunset, accounting for refraction and
+// the size of the sun's disk.
+const zenith = 90.833
+
+// Sunrise returns the time of sunrise at the given location on the day of t,
+// in the location of t. It returns false if the sun does not rise that day
+// (polar night or midnight sun).
+func (l Location) Sunrise(t time.Time) (time.Time, bool) {
+	return l.sunEvent(t, true)
+}
+
+// Sunset returns the time of sunset at the given location on the day of t,
+// in the location of t. It returns false if the sun does not set that day
+// (polar night or midnight sun).
+func (l Location) Sunset(t time.Time) (time.Time, bool) {
+	return l.sunEvent(t, false)
+}
+
+// sunEvent implements the sunrise/sunset algorithm of the Almanac for
+// Computers (1990), accurate to about a minute.
+func (l Location) sunEvent(t time.Time, rising bool) (time.Time, bool) {
+	y, m, d := t.Date()
+	n := float64(t.YearDay())
+	lngHour := l.Longitude / 15
+
+	approx := n + (18-lngHour)/24
+	if rising {
+		approx = n + (6-lngHour)/24
+	}
+
+	// Mean anomaly and true longitude of the sun.
+	meanAnomaly := 0.9856*approx - 3.289
+	trueLong := normalize(meanAnomaly+1.916*sin(meanAnomaly)+0.020*sin(2*meanAnomaly)+282.634, 360)
+
+	// Right ascension, in the same quadrant as the true longitude, in hours.
+	ra := normalize(deg(math.Atan(0.91764*tan(trueLong))), 360)
+	ra += math.Floor(trueLong/90)*90 - math.Floor(ra/90)*90
+	ra /= 15
+
+	// Declination and local hour angle of the sun.
+	sinDec := 0.39782 * sin(trueLong)
+	cosDec := math.Cos(math.Asin(sinDec))
+	cosH := (cos(zenith) - sinDec*sin(l.Latitude)) / (cosDec * cos(l.Latitude))
+	if cosH > 1 || cosH < -1 {
+		return time.Time{}, false
+	}
+
+	h := deg(math.Acos(cosH))
+	if rising {
+		h = 360 - h
+	}
+	h /= 15
+
+	localMean := h + ra - 0.06571*approx - 6.622
+	utc := normalize(localMean-lngHour, 24)
+
+	event := time.Date(y, m, d, 0, 0, 0, 0, time.UTC).
+		Add(time.Duration(utc * float64(time.Hour))).
+		In(t.Location()).
+		Round(time.Second)
+
+	// The event happens on the UTC day computed above, which can be the day
+	// before or after the requested one in the time zone of t.
+	switch ey, em, ed := event.Date(); {
+	case time.Date(ey, em, ed, 0, 0, 0, 0, time.UTC).Before(time.Date(y, m, d, 0, 0, 0, 0, time.UTC)):
+		event = event.Add(24 * time.Hour)
+	case time.Date(ey, em, ed, 0, 0, 0, 0, time.UTC).After(time.Date(y, m, d, 0, 0, 0, 0, time.UTC)):
+		event = event.Add(-24 * time.Hour)
+	}
+
+	return event, true
+}
+
+// Elevation returns the elevation of the sun above the horizon at the given
+// location and time, in degrees. It is negative at night.
+func (l Location) Elevation(t time.Time) float64 {
+	decl, ra, n := position(t)
+
+	// Greenwich mean sidereal time, then hour angle of the sun, in degrees.
+	gmst := normalize(18.697374558+24.06570982441908*n, 24)
+	hourAngle := gmst*15 + l.Longitude - ra
+
+	return deg(math.Asin(sin(l.Latitude)*sin(decl) + cos(l.Latitude)*cos(decl)*cos(hourAngle)))
+}
+
+// NoonElevation returns the elevation of the sun at solar noon on the day
+// of t at the given location, its highest of the day, in degrees.
+func (l Location) NoonElevation(t time.Time) float64 {
+	decl, _, _ := position(t)
+
+	return 90 - math.Abs(l.Latitude-decl)
+}
+
+// position returns the declination and the right ascension of the sun at the
+// given time, in degrees, along with the number of days since J2000.
+func position(t time.Time) (decl, ra, n float64) {
+	n = float64(t.UTC().Sub(j2000)) / float64(24*time.Hour)
+
+	meanLong := normalize(280.460+0.9856474*n, 360)
+	meanAnomaly := normalize(357.528+0.9856003*n, 360)
+	eclipticLong := meanLong + 1.915*sin(meanAnomaly) + 0.020*sin(2*meanAnomaly)
+	obliquity := 23.439 - 0.0000004*n
+
+	decl = deg(math.Asin(sin(obliquity) * sin(eclipticLong)))
+	ra = normalize(deg(math.Atan2(cos(obliquity)*sin(eclipticLong), cos(eclipticLong))), 360)
+
+	return decl, ra, n
+}
+
+// j2000 is the reference epoch of the formulas above.
+var j2000 = time.Date(2000, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+func sin(x float64) float64 { return math.Sin(x * math.Pi / 180) }
+func cos(x float64) float64 { return math.Cos(x * math.Pi / 180) }
+func tan(x float64) float64 { return math.Tan(x * math.Pi / 180) }
+func deg(x float64) float64 { return x * 180 / math.Pi }
+
+func normalize(x, max float64) float64 {
+	x = math.Mod(x, max)
+	if x < 0 {
+		x += max
+	}
+	return x
+}
@@ -0,0 +1,131 @@
+package sun
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+var (
+	paris   = Location{Latitude: 48.8566, Longitude: 2.3522}
+	newYork = Location{Latitude: 40.7128, Longitude: -74.0060}
+	sydney  = Location{Latitude: -33.8688, Longitude: 151.2093}
+	tromso  = Location{Latitude: 69.6492, Longitude: 18.9553}
+
+	cest = time.FixedZone("CEST", 2*60*60)
+	est  = time.FixedZone("EST", -5*60*60)
+	aedt = time.FixedZone("AEDT", 11*60*60)
+)
+
+// tolerance is the accuracy of the algorithm compared to published times,
+// which are rounded to the minute.
+const tolerance = 2 * time.Minute
+
+func TestSunriseSunset(t *testing.T) {
+	tests := []struct {
+		name        string
+		location    Location
+		day         time.Time
+		wantSunrise time.Time
+		wantSunset  time.Time
+	}{
+		{
+			name:        "Paris, summer solstice",
+			location:    paris,
+			day:         time.Date(2021, time.June, 21, 12, 0, 0, 0, cest),
+			wantSunrise: time.Date(2021, time.June, 21, 5, 47, 0, 0, cest),
+			wantSunset:  time.Date(2021, time.June, 21, 21, 58, 0, 0, cest),
+		},
+		{
+			name:        "New York, winter solstice",
+			location:    newYork,
+			day:         time.Date(2021, time.December, 21, 12, 0, 0, 0, est),
+			wantSunrise: time.Date(2021, time.December, 21, 7, 16, 0, 0, est),
+			wantSunset:  time.Date(2021, time.December, 21, 16, 32, 0, 0, est),
+		},
+		{
+			name:        "Sydney, southern summer",
+			location:    sydney,
+			day:         time.Date(2021, time.December, 21, 12, 0, 0, 0, aedt),
+			wantSunrise: time.Date(2021, time.December, 21, 5, 41, 0, 0, aedt),
+			wantSunset:  time.Date(2021, time.December, 21, 20, 5, 0, 0, aedt),
+		},
+		{
+			// Sunrise in Sydney happens the day before in UTC, the sunrise
+			// of the requested UTC day is the one of the next local day.
+			name:        "Sydney, in UTC",
+			location:    sydney,
+			day:         time.Date(2021, time.December, 21, 0, 0, 0, 0, time.UTC),
+			wantSunrise: time.Date(2021, time.December, 22, 5, 41, 0, 0, aedt),
+			wantSunset:  time.Date(2021, time.December, 21, 20, 5, 0, 0, aedt),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sunrise, ok := tt.location.Sunrise(tt.day)
+			if !ok {
+				t.Fatalf("expected the sun to rise")
+			}
+			if d := sunrise.Sub(tt.wantSunrise); d < -tolerance || d > tolerance {
+				t.Errorf("expected sunrise at %s, got %s", tt.wantSunrise, sunrise)
+			}
+			if sunrise.Location() != tt.day.Location() {
+				t.Errorf("expected sunrise in %s, got %s", tt.day.Location(), sunrise.Location())
+			}
+
+			sunset, ok := tt.location.Sunset(tt.day)
+			if !ok {
+				t.Fatalf("expected the sun to set")
+			}
+			if d := sunset.Sub(tt.wantSunset); d < -tolerance || d > tolerance {
+				t.Errorf("expected sunset at %s, got %s", tt.wantSunset, sunset)
+			}
+		})
+	}
+}
+
+func TestSunriseSunsetPolar(t *testing.T) {
+	for _, day := range []time.Time{
+		// Polar night.
+		time.Date(2021, time.December, 21, 12, 0, 0, 0, time.UTC),
+		// Midnight sun.
+		time.Date(2021, time.June, 21, 12, 0, 0, 0, time.UTC),
+	} {
+		if sunrise, ok := tromso.Sunrise(day); ok {
+			t.Errorf("expected no sunrise in Tromsø on %s, got %s", day.Format("2006-01-02"), sunrise)
+		}
+		if sunset, ok := tromso.Sunset(day); ok {
+			t.Errorf("expected no sunset in Tromsø on %s, got %s", day.Format("2006-01-02"), sunset)
+		}
+	}
+}
+
+func TestElevation(t *testing.T) {
+	day := time.Date(2021, time.June, 21, 12, 0, 0, 0, cest)
+
+	// The sun is a bit below the horizon at sunrise and sunset, because of
+	// refraction and the size of its disk.
+	sunrise, _ := paris.Sunrise(day)
+	sunset, _ := paris.Sunset(day)
+	for _, at := range []time.Time{sunrise, sunset} {
+		if e := paris.Elevation(at); math.Abs(e+0.833) > 0.5 {
+			t.Errorf("expected an elevation of about -0.833° at %s, got %.3f°", at.Format(time.Kitchen), e)
+		}
+	}
+
+	if e := paris.Elevation(time.Date(2021, time.June, 21, 1, 0, 0, 0, cest)); e >= 0 {
+		t.Errorf("expected the sun to be below the horizon at night, got %.3f°", e)
+	}
+
+	// At the summer solstice, the sun culminates at 90° minus the latitude
+	// plus the tilt of the Earth's axis.
+	noon := paris.NoonElevation(day)
+	if want := 90 - paris.Latitude + 23.44; math.Abs(noon-want) > 0.1 {
+		t.Errorf("expected a noon elevation of %.2f°, got %.2f°", want, noon)
+	}
+	// Solar noon in Paris is at about 13:52 in summer.
+	if e := paris.Elevation(time.Date(2021, time.June, 21, 13, 52, 0, 0, cest)); math.Abs(e-noon) > 0.5 {
+		t.Errorf("expected an elevation of %.2f° at solar noon, got %.2f°", noon, e)
+	}
+}
@@ -0,0 +1,194 @@
+package tui
+
+import (
+	"fmt"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/skwair/harmony/optional"
+	"github.com/skwair/huectl/pkg/colors"
+	"github.com/skwair/huectl/pkg/hue"
+)
+
+// picker is a popup list from which the user selects an item to apply.
+type picker struct {
+	title string
+	items []string
+	idx   int
+	apply func(idx int)
+}
+
+// maxPickerRows is the number of items displayed at once by a picker.
+const maxPickerRows = 12
+
+func (a *App) handlePickerKey(ev *tcell.EventKey) {
+	p := a.picker
+
+	switch ev.Key() {
+	case tcell.KeyEscape, tcell.KeyCtrlC:
+		a.picker = nil
+	case tcell.KeyUp:
+		p.idx = clampIdx(p.idx-1, len(p.items))
+	case tcell.KeyDown:
+		p.idx = clampIdx(p.idx+1, len(p.items))
+	case tcell.KeyEnter:
+		a.picker = nil
+		p.apply(p.idx)
+	case tcell.KeyRune:
+		switch ev.Rune() {
+		case 'k':
+			p.idx = clampIdx(p.idx-1, len(p.items))
+		case 'j':
+			p.idx = clampIdx(p.idx+1, len(p.items))
+		case 'q':
+			a.picker = nil
+		}
+	}
+}
+
+// whites are offered by the color picker in addition to named colors.
+var whites = []struct {
+	name  string
+	mired int
+}{
+	{"warm white", 454},
+	{"soft white", 370},
+	{"neutral white", 250},
+	{"daylight", 175},
+}
+
+func (a *App) openColorPicker() {
+	light := a.selectedLight()
+	if light == nil {
+		return
+	}
+
+	if !light.SupportsColor() && !light.SupportsColorTemperature() {
+		a.status = fmt.Sprintf("%s does not support colors", light.Name)
+		return
+	}
+
+	var items []string
+	var reqs []*hue.SetLightStateRequest
+	for _, w := range whites {
+		items = append(items, w.name)
+		reqs = append(reqs, &hue.SetLightStateRequest{CT: optional.NewInt(w.mired)})
+	}
+
+	if light.SupportsColor() {
+		for _, name := range colors.Names() {
+			c, _ := colors.Parse(name)
+			xy := hue.RGBToXY(c.R, c.G, c.B)
+
+			items = append(items, name)
+			reqs = append(reqs, &hue.SetLightStateRequest{XY: &[2]float32{float32(xy[0]), float32(xy[1])}})
+		}
+	}
+
+	a.picker = &picker{
+		title: "Color of " + light.Name,
+		items: items,
+		apply: func(idx int) {
+			a.setLightState(light, reqs[idx], fmt.Sprintf("%s set to %s", light.Name, items[idx]))
+		},
+	}
+}
+
+func (a *App) openScenePicker() {
+	r := a.currentRoom()
+
+	var scenes []hue.Scene
+	for _, s := range a.scenes {
+		// Only show scenes of the current room, or every room scene when
+		// all lights are displayed.
+		if (r.groupID == "0" && s.Group != "") || s.Group == r.groupID {
+			scenes = append(scenes, s)
+		}
+	}
+
+	if len(scenes) == 0 {
+		a.status = fmt.Sprintf("no scene for %s", r.name)
+		return
+	}
+
+	items := make([]string, len(scenes))
+	for i, s := range scenes {
+		items[i] = s.Name
+		if r.groupID == "0" {
+			items[i] += " (" + a.roomName(s.Group) + ")"
+		}
+	}
+
+	a.picker = &picker{
+		title: "Scenes of " + r.name,
+		items: items,
+		apply: func(idx int) {
+			s := scenes[idx]
+			a.do(func() (string, error) {
+				res, err := a.client.RecallScene(s.Group, s.ID)
+				if err != nil {
+					return "", err
+				}
+				if err = res.Err(); err != nil {
+					return "", err
+				}
+
+				return fmt.Sprintf("recalled scene %s", s.Name), nil
+			})
+		},
+	}
+}
+
+func (a *App) roomName(groupID string) string {
+	for _, r := range a.rooms {
+		if r.groupID == groupID {
+			return r.name
+		}
+	}
+
+	return groupID
+}
+
+// draw draws the picker as a box whose top left corner is at x, y.
+func (p *picker) draw(s tcell.Screen, x, y int) {
+	width := len(p.title) + 4
+	for _, item := range p.items {
+		if len(item)+6 > width {
+			width = len(item) + 6
+		}
+	}
+
+	// Scroll so the selected item is always visible.
+	first := 0
+	if p.idx >= maxPickerRows {
+		first = p.idx - maxPickerRows + 1
+	}
+	rows := len(p.items) - first
+	if rows > maxPickerRows {
+		rows = maxPickerRows
+	}
+
+	style := tcell.StyleDefault
+	for row := 0; row < rows+2; row++ {
+		for col := 0; col < width; col++ {
+			ch := ' '
+			switch {
+			case (row == 0 || row == rows+1) && (col == 0 || col == width-1):
+				ch = '+'
+			case row == 0 || row == rows+1:
+				ch = '-'
+			case col == 0 || col == width-1:
+				ch = '|'
+			}
+			s.SetContent(x+col, y+row, ch, nil, style)
+		}
+	}
+
+	drawText(s, x+2, y, style.Bold(true), " "+p.title+" ")
+	for i := 0; i < rows; i++ {
+		itemStyle := style
+		if first+i == p.idx {
+			itemStyle = itemStyle.Reverse(true)
+		}
+		drawText(s, x+2, y+1+i, itemStyle, p.items[first+i])
+	}
+}
@@ -0,0 +1,466 @@
+// Package tui implements an interactive, full-screen terminal interface to
+// control the lights of a Hue bridge.
+package tui
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/skwair/harmony/optional"
+	"github.com/skwair/huectl/pkg/hue"
+)
+
+// DefaultRefreshInterval is how often the state of lights is polled from the
+// bridge by default.
+const DefaultRefreshInterval = 2 * time.Second
+
+// brightnessStep is how much brightness changes with each key press, on the
+// 0-254 scale used by the bridge (10%).
+const brightnessStep = 25
+
+// App is a terminal UI listing rooms and lights with their live state.
+// Create one with New and start it with Run.
+type App struct {
+	client   *hue.Client
+	screen   tcell.Screen
+	interval time.Duration
+
+	rooms     []room
+	lights    map[string]hue.Light
+	scenes    []hue.Scene
+	fetchedAt time.Time
+
+	roomIdx  int
+	lightIdx int
+	picker   *picker
+	status   string
+}
+
+// room is a group of lights displayed in the rooms column.
+type room struct {
+	groupID string
+	name    string
+	lights  []string
+}
+
+// Option allows to customize an App.
+type Option func(*App)
+
+// WithRefreshInterval sets how often the state of lights is polled from the
+// bridge, DefaultRefreshInterval if not set.
+func WithRefreshInterval(d time.Duration) Option {
+	return func(a *App) {
+		if d > 0 {
+			a.interval = d
+		}
+	}
+}
+
+// New returns a new terminal UI controlling lights through the given client
+// and drawing on the given screen, which is initialized by Run. Use
+// tcell.NewScreen for a real terminal or tcell.NewSimulationScreen in tests.
+func New(client *hue.Client, screen tcell.Screen, opts ...Option) *App {
+	a := &App{
+		client:   client,
+		screen:   screen,
+		interval: DefaultRefreshInterval,
+		lights:   make(map[string]hue.Light),
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
+}
+
+// Run initializes the screen and processes events until the user quits.
+func (a *App) Run() error {
+	if err := a.screen.Init(); err != nil {
+		return fmt.Errorf("unable to initialize screen: %w", err)
+	}
+	defer a.screen.Fini()
+
+	done := make(chan struct{})
+	defer close(done)
+	go a.poll(done)
+
+	for {
+		a.draw()
+
+		switch ev := a.screen.PollEvent().(type) {
+		case nil:
+			return nil
+		case *tcell.EventResize:
+			a.screen.Sync()
+		case *tcell.EventKey:
+			if quit := a.handleKey(ev); quit {
+				return nil
+			}
+		case *inventoryEvent:
+			a.applyInventory(ev)
+		case *statusEvent:
+			a.status = ev.msg
+		}
+	}
+}
+
+// poll fetches the inventory of the bridge right away, then periodically
+// until done is closed.
+func (a *App) poll(done <-chan struct{}) {
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		a.fetch()
+
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// fetch retrieves lights, groups and scenes from the bridge and posts them
+// to the event loop.
+func (a *App) fetch() {
+	ev := &inventoryEvent{when: time.Now()}
+
+	ev.lights, ev.err = a.client.Lights()
+	if ev.err == nil {
+		ev.groups, ev.err = a.client.Groups()
+	}
+	if ev.err == nil {
+		ev.scenes, ev.err = a.client.Scenes()
+	}
+
+	_ = a.screen.PostEvent(ev)
+}
+
+// do runs an action against the bridge in the background, then reports its
+// outcome in the status line and refreshes the state of lights.
+func (a *App) do(action func() (string, error)) {
+	go func() {
+		msg, err := action()
+		if err != nil {
+			msg = "error: " + err.Error()
+		}
+
+		_ = a.screen.PostEvent(&statusEvent{when: time.Now(), msg: msg})
+		a.fetch()
+	}()
+}
+
+func (a *App) applyInventory(ev *inventoryEvent) {
+	if ev.err != nil {
+		a.status = "unable to refresh: " + ev.err.Error()
+		return
+	}
+
+	a.fetchedAt = ev.when
+
+	a.lights = make(map[string]hue.Light, len(ev.lights))
+	all := room{groupID: "0", name: "All lights"}
+	for _, l := range ev.lights {
+		a.lights[l.ID] = l
+		all.lights = append(all.lights, l.ID)
+	}
+	sortIDs(all.lights)
+
+	rooms := []room{all}
+	for _, g := range ev.groups {
+		if g.Type != hue.GroupTypeRoom && g.Type != hue.GroupTypeZone {
+			continue
+		}
+		rooms = append(rooms, room{groupID: g.ID, name: g.Name, lights: g.Lights})
+	}
+	sort.SliceStable(rooms[1:], func(i, j int) bool { return rooms[i+1].name < rooms[j+1].name })
+	a.rooms = rooms
+
+	sort.Slice(ev.scenes, func(i, j int) bool { return ev.scenes[i].Name < ev.scenes[j].Name })
+	a.scenes = ev.scenes
+
+	a.roomIdx = clampIdx(a.roomIdx, len(a.rooms))
+	a.lightIdx = clampIdx(a.lightIdx, len(a.currentRoom().lights))
+}
+
+func (a *App) currentRoom() room {
+	if len(a.rooms) == 0 {
+		return room{}
+	}
+
+	return a.rooms[a.roomIdx]
+}
+
+// selectedLight returns the selected light, or nil if the room is empty.
+func (a *App) selectedLight() *hue.Light {
+	r := a.currentRoom()
+	if a.lightIdx >= len(r.lights) {
+		return nil
+	}
+
+	l, ok := a.lights[r.lights[a.lightIdx]]
+	if !ok {
+		return nil
+	}
+
+	return &l
+}
+
+// handleKey processes a key press and reports whether the app must quit.
+func (a *App) handleKey(ev *tcell.EventKey) bool {
+	if a.picker != nil {
+		a.handlePickerKey(ev)
+		return false
+	}
+
+	switch ev.Key() {
+	case tcell.KeyCtrlC, tcell.KeyEscape:
+		return true
+	case tcell.KeyUp:
+		a.lightIdx = clampIdx(a.lightIdx-1, len(a.currentRoom().lights))
+	case tcell.KeyDown:
+		a.lightIdx = clampIdx(a.lightIdx+1, len(a.currentRoom().lights))
+	case tcell.KeyLeft, tcell.KeyBacktab:
+		a.switchRoom(-1)
+	case tcell.KeyRight, tcell.KeyTab:
+		a.switchRoom(1)
+	case tcell.KeyRune:
+		switch ev.Rune() {
+		case 'q':
+			return true
+		case 'k':
+			a.lightIdx = clampIdx(a.lightIdx-1, len(a.currentRoom().lights))
+		case 'j':
+			a.lightIdx = clampIdx(a.lightIdx+1, len(a.currentRoom().lights))
+		case 'h':
+			a.switchRoom(-1)
+		case 'l':
+			a.switchRoom(1)
+		case ' ':
+			a.toggleSelected()
+		case '+', '=':
+			a.adjustBrightness(brightnessStep)
+		case '-', '_':
+			a.adjustBrightness(-brightnessStep)
+		case 'c':
+			a.openColorPicker()
+		case 's':
+			a.openScenePicker()
+		case 'r':
+			a.status = "refreshing..."
+			go a.fetch()
+		}
+	}
+
+	return false
+}
+
+func (a *App) switchRoom(delta int) {
+	if len(a.rooms) == 0 {
+		return
+	}
+
+	a.roomIdx = (a.roomIdx + delta + len(a.rooms)) % len(a.rooms)
+	a.lightIdx = 0
+}
+
+func (a *App) toggleSelected() {
+	light := a.selectedLight()
+	if light == nil {
+		return
+	}
+
+	// Update the displayed state right away, the next refresh will fix it
+	// should the bridge reject the change.
+	light.State.On = !light.State.On
+	a.lights[light.ID] = *light
+
+	req := &hue.SetLightStateRequest{On: optional.NewBool(light.State.On)}
+	a.setLightState(light, req, fmt.Sprintf("%s switched %s", light.Name, onOff(light.State.On)))
+}
+
+func (a *App) adjustBrightness(delta int) {
+	light := a.selectedLight()
+	if light == nil || !light.IsDimmable() {
+		return
+	}
+
+	light.State.Bri = int(math.Max(1, math.Min(254, float64(light.State.Bri+delta))))
+	a.lights[light.ID] = *light
+
+	req := &hue.SetLightStateRequest{BriInc: optional.NewInt(delta)}
+	a.setLightState(light, req, fmt.Sprintf("%s brightness set to %d%%", light.Name, percent(light.State.Bri)))
+}
+
+// setLightState converts the given update to what the light supports and
+// sends it in the background.
+func (a *App) setLightState(light *hue.Light, req *hue.SetLightStateRequest, msg string) {
+	req, _, err := hue.ValidateLightState(light, req, hue.Convert)
+	if err != nil {
+		a.status = "error: " + err.Error()
+		return
+	}
+
+	id := light.ID
+	a.do(func() (string, error) {
+		res, err := a.client.SetLightState(id, req)
+		if err != nil {
+			return "", err
+		}
+		if err = res.Err(); err != nil {
+			return "", err
+		}
+
+		return msg, nil
+	})
+}
+
+func (a *App) draw() {
+	s := a.screen
+	s.Clear()
+
+	width, height := s.Size()
+	title := tcell.StyleDefault.Bold(true)
+	dim := tcell.StyleDefault.Dim(true)
+
+	drawText(s, 1, 0, title, "huectl")
+	if !a.fetchedAt.IsZero() {
+		age := fmt.Sprintf("refreshed %s ago", time.Since(a.fetchedAt).Round(time.Second))
+		drawText(s, width-len(age)-1, 0, dim, age)
+	}
+
+	drawText(s, 1, 2, title, "ROOMS")
+	for i, r := range a.rooms {
+		style := tcell.StyleDefault
+		prefix := "  "
+		if i == a.roomIdx {
+			style, prefix = style.Reverse(true), "> "
+		}
+		drawText(s, 1, 3+i, style, truncate(prefix+r.name, roomsWidth-2))
+	}
+
+	drawText(s, roomsWidth+1, 2, title, "LIGHTS")
+	for i, id := range a.currentRoom().lights {
+		light, ok := a.lights[id]
+		if !ok {
+			continue
+		}
+
+		style := tcell.StyleDefault
+		if i == a.lightIdx {
+			style = style.Reverse(true)
+		}
+		drawText(s, roomsWidth+1, 3+i, style, formatLight(light))
+	}
+
+	if a.picker != nil {
+		a.picker.draw(s, roomsWidth+4, 4)
+	}
+
+	drawText(s, 1, height-2, tcell.StyleDefault, truncate(a.status, width-2))
+	drawText(s, 1, height-1, dim, truncate(helpLine, width-2))
+
+	s.Show()
+}
+
+const (
+	roomsWidth = 22
+	helpLine   = "↑↓ select  ←→ room  space toggle  +/- brightness  c color  s scenes  r refresh  q quit"
+)
+
+func formatLight(l hue.Light) string {
+	switch {
+	case !l.State.Reachable:
+		return fmt.Sprintf("[!] %-20s unreachable", truncate(l.Name, 20))
+	case !l.IsDimmable():
+		return fmt.Sprintf("[%s] %-20s", check(l.State.On), truncate(l.Name, 20))
+	}
+
+	bars := percent(l.State.Bri) / 10
+	bar := ""
+	for i := 0; i < 10; i++ {
+		if i < bars {
+			bar += "█"
+		} else {
+			bar += "░"
+		}
+	}
+
+	return fmt.Sprintf("[%s] %-20s %s %3d%%", check(l.State.On), truncate(l.Name, 20), bar, percent(l.State.Bri))
+}
+
+func drawText(s tcell.Screen, x, y int, style tcell.Style, text string) {
+	for _, r := range text {
+		s.SetContent(x, y, r, nil, style)
+		x++
+	}
+}
+
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if n < 0 || len(runes) <= n {
+		return s
+	}
+	if n < 1 {
+		return ""
+	}
+
+	return string(runes[:n-1]) + "…"
+}
+
+func check(on bool) string {
+	if on {
+		return "x"
+	}
+	return " "
+}
+
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
+
+func percent(bri int) int {
+	return int(math.Round(float64(bri) / 254 * 100))
+}
+
+func clampIdx(i, n int) int {
+	if i >= n {
+		i = n - 1
+	}
+	if i < 0 {
+		i = 0
+	}
+	return i
+}
+
+// sortIDs sorts numeric IDs numerically, e.g. "2" before "10".
+func sortIDs(ids []string) {
+	sort.Slice(ids, func(i, j int) bool { return hue.LessID(ids[i], ids[j]) })
+}
+
+type inventoryEvent struct {
+	when   time.Time
+	lights []hue.Light
+	groups []hue.Group
+	scenes []hue.Scene
+	err    error
+}
+
+// When implements the tcell.Event interface.
+func (ev *inventoryEvent) When() time.Time { return ev.when }
+
+type statusEvent struct {
+	when time.Time
+	msg  string
+}
+
+// When implements the tcell.Event interface.
+func (ev *statusEvent) When() time.Time { return ev.when }
@@ -0,0 +1,210 @@
+package tui
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/skwair/huectl/pkg/hue"
+	"github.com/skwair/huectl/pkg/hue/huetest"
+)
+
+// key is a key press injected in the simulation screen.
+type key struct {
+	key tcell.Key
+	r   rune
+}
+
+func runeKeys(s string) []key {
+	var keys []key
+	for _, r := range s {
+		keys = append(keys, key{key: tcell.KeyRune, r: r})
+	}
+	return keys
+}
+
+func newTestBridge() *huetest.Bridge {
+	b := huetest.NewBridge()
+	b.AddLight(hue.Light{
+		ID:    "1",
+		Name:  "Desk",
+		Type:  hue.LightTypeExtendedColor,
+		State: hue.LightState{On: true, Bri: 100, Reachable: true},
+	})
+	b.AddLight(hue.Light{
+		ID:    "2",
+		Name:  "Lamp",
+		Type:  hue.LightTypeDimmable,
+		State: hue.LightState{Bri: 200, Reachable: true},
+	})
+	b.AddLight(hue.Light{
+		ID:    "10",
+		Name:  "Plug",
+		Type:  hue.LightTypeOnOffPlug,
+		State: hue.LightState{Reachable: true},
+	})
+	b.AddGroup(hue.Group{ID: "1", Name: "Office", Type: hue.GroupTypeRoom, Lights: []string{"2"}})
+	b.AddScene(
+		hue.Scene{ID: "1", Name: "Relax", Group: "1", Lights: []string{"2"}},
+		map[string]hue.LightState{"2": {On: true, Bri: 42}},
+	)
+
+	return b
+}
+
+func TestApp(t *testing.T) {
+	tests := []struct {
+		name  string
+		keys  []key
+		light string
+		want  func(s hue.LightState) bool
+	}{
+		{
+			name:  "toggle",
+			keys:  runeKeys(" "),
+			light: "1",
+			want:  func(s hue.LightState) bool { return !s.On },
+		},
+		{
+			name:  "toggle numerically sorted",
+			keys:  runeKeys("jj "),
+			light: "10",
+			want:  func(s hue.LightState) bool { return s.On },
+		},
+		{
+			name:  "brighten",
+			keys:  runeKeys("+"),
+			light: "1",
+			want:  func(s hue.LightState) bool { return s.Bri == 100+brightnessStep },
+		},
+		{
+			name:  "dim",
+			keys:  runeKeys("-"),
+			light: "1",
+			want:  func(s hue.LightState) bool { return s.Bri == 100-brightnessStep },
+		},
+		{
+			name:  "color picker",
+			keys:  append(runeKeys("c"), key{key: tcell.KeyEnter}),
+			light: "1",
+			want:  func(s hue.LightState) bool { return s.ColorMode == "ct" && s.CT == whites[0].mired },
+		},
+		{
+			name:  "scene picker",
+			keys:  append(runeKeys("ls"), key{key: tcell.KeyEnter}),
+			light: "2",
+			want:  func(s hue.LightState) bool { return s.On && s.Bri == 42 },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestBridge()
+			defer b.Close()
+
+			screen := &recordingScreen{SimulationScreen: tcell.NewSimulationScreen("")}
+			app := New(b.Client(), screen, WithRefreshInterval(time.Hour))
+
+			errc := make(chan error, 1)
+			go func() { errc <- app.Run() }()
+
+			waitFor(t, "lights to be displayed", func() bool { return strings.Contains(screen.Text(), "Plug") })
+
+			for _, k := range tt.keys {
+				screen.InjectKey(k.key, k.r, tcell.ModNone)
+			}
+			waitFor(t, "light "+tt.light+" to be updated", func() bool { return tt.want(b.Light(tt.light).State) })
+
+			screen.InjectKey(tcell.KeyRune, 'q', tcell.ModNone)
+			select {
+			case err := <-errc:
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("app did not quit")
+			}
+		})
+	}
+}
+
+func TestFormatLight(t *testing.T) {
+	tests := []struct {
+		name  string
+		light hue.Light
+		want  string
+	}{
+		{
+			name:  "dimmable",
+			light: hue.Light{Name: "Desk", Type: hue.LightTypeDimmable, State: hue.LightState{On: true, Bri: 127, Reachable: true}},
+			want:  "[x] Desk                 █████░░░░░  50%",
+		},
+		{
+			name:  "plug",
+			light: hue.Light{Name: "Plug", Type: hue.LightTypeOnOffPlug, State: hue.LightState{Reachable: true}},
+			want:  "[ ] Plug                ",
+		},
+		{
+			name:  "unreachable",
+			light: hue.Light{Name: "A rather long light name", Type: hue.LightTypeDimmable},
+			want:  "[!] A rather long light… unreachable",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatLight(tt.light); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+// recordingScreen is a simulation screen recording the text it displays, to
+// be read safely while the app draws on it.
+type recordingScreen struct {
+	tcell.SimulationScreen
+
+	mu   sync.Mutex
+	text string
+}
+
+// Show implements the tcell.Screen interface.
+func (s *recordingScreen) Show() {
+	s.SimulationScreen.Show()
+
+	var sb strings.Builder
+	cells, width, _ := s.GetContents()
+	for i, c := range cells {
+		sb.WriteString(string(c.Runes))
+		if (i+1)%width == 0 {
+			sb.WriteByte('\n')
+		}
+	}
+
+	s.mu.Lock()
+	s.text = sb.String()
+	s.mu.Unlock()
+}
+
+// Text returns the text displayed on the screen, one line per row.
+func (s *recordingScreen) Text() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.text
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}